@@ -0,0 +1,76 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/opencontainers/runc/libsysbox/syscont"
+	"github.com/urfave/cli"
+)
+
+var auditCapsCommand = cli.Command{
+	Name:  "audit-caps",
+	Usage: "displays the capability audit log of a container",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The audit-caps command displays the capabilities granted to (and denied
+from) the container each time it was created. The audit log is only kept when
+sysbox-runc is invoked with the global option "--capability-audit-log-dir".`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: "table",
+			Usage: `select one of: ` + formatOptions,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+
+		auditDir := context.GlobalString("capability-audit-log-dir")
+		if auditDir == "" {
+			return errors.New("the capability audit log is disabled (see the --capability-audit-log-dir option)")
+		}
+
+		id := context.Args().First()
+		entries, err := syscont.ReadCapAuditLog(auditDir, id)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("no capability audit log for container %s", id)
+			}
+			return err
+		}
+
+		switch context.String("format") {
+		case "table":
+			w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+			fmt.Fprint(w, "TIMESTAMP\tUID\tGRANTED\tDENIED\n")
+			for _, e := range entries {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\n",
+					e.Timestamp.Format(time.RFC3339Nano),
+					e.Uid,
+					strings.Join(e.Granted, ","),
+					strings.Join(e.Denied, ","))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		case "json":
+			if err := json.NewEncoder(os.Stdout).Encode(entries); err != nil {
+				return err
+			}
+		default:
+			return errors.New("invalid format option")
+		}
+		return nil
+	},
+}
@@ -0,0 +1,333 @@
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/opencontainers/runc/libcontainer/specconv"
+	"github.com/opencontainers/runc/libsysbox/syscont"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+var configCommand = cli.Command{
+	Name:  "config",
+	Usage: "container configuration (spec) utilities",
+	Subcommands: []cli.Command{
+		configGenerateCommand,
+	},
+}
+
+var configGenerateCommand = cli.Command{
+	Name:  "generate",
+	Usage: "generate a container spec (config.json) from the given flags",
+	Description: `The generate command outputs a container spec built from the given flags.
+Unlike "sysbox-runc spec", it doesn't require a bundle directory and allows
+setting common resource limits and mounts directly.
+
+With "--sys-container" the spec includes the full set of system container
+namespaces and capabilities, as well as the sysbox-fs mounts; otherwise it's
+a basic container spec, to which sysbox-runc adds these when the container
+is created.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "memory-limit",
+			Usage: "memory limit (e.g., 512M or 1G)",
+		},
+		cli.Uint64Flag{
+			Name:  "cpushares",
+			Usage: "relative CPU shares",
+		},
+		cli.StringFlag{
+			Name:  "cpuset",
+			Usage: "CPUs in which to allow execution (e.g., 0-3 or 0,1)",
+		},
+		cli.StringSliceFlag{
+			Name:  "bind",
+			Usage: `bind mount a host path into the container ("src:dst[:ro]"; may be repeated)`,
+		},
+		cli.BoolFlag{
+			Name:  "read-only",
+			Usage: "make the container's root filesystem read-only",
+		},
+		cli.StringFlag{
+			Name:  "parent-death-signal",
+			Usage: "signal sent to the container's init process when sysbox-runc dies (e.g., SIGKILL)",
+		},
+		cli.BoolFlag{
+			Name:  "sys-container",
+			Usage: "generate a full system container spec",
+		},
+		cli.StringFlag{
+			Name:  "id-map",
+			Usage: `"uid gid [size]" user and group ID mappings (see "sysbox-runc spec --help")`,
+		},
+		cli.Uint64Flag{
+			Name:  "id-range-min",
+			Value: uint64(syscont.IdRangeMin),
+			Usage: "size of the ID mappings when not given in --id-map",
+		},
+		cli.BoolFlag{
+			Name:  "inner-docker",
+			Usage: "tune the spec for running Docker inside the container (implies --sys-container)",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "file to write the spec to (default: stdout)",
+		},
+		cli.StringFlag{
+			Name:  "format",
+			Value: "json",
+			Usage: "output format (json or yaml)",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 0, exactArgs); err != nil {
+			return err
+		}
+
+		opts, err := parseConfigGenerateFlags(context)
+		if err != nil {
+			return err
+		}
+
+		spec, err := generateSpec(opts)
+		if err != nil {
+			return err
+		}
+
+		data, err := marshalSpec(spec, context.String("format"))
+		if err != nil {
+			return err
+		}
+
+		if output := context.String("output"); output != "" {
+			return ioutil.WriteFile(output, data, 0666)
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	},
+}
+
+// configGenerateOpts holds the settings of a generated spec.
+type configGenerateOpts struct {
+	memoryLimit  int64
+	cpuShares    uint64
+	cpuset       string
+	binds        []specs.Mount
+	readOnly     bool
+	pdeathSignal string
+	sysContainer bool
+	innerDocker  bool
+
+	// ID mappings (if idSize is not 0)
+	uid, gid, idSize uint32
+}
+
+func parseConfigGenerateFlags(context *cli.Context) (*configGenerateOpts, error) {
+	opts := &configGenerateOpts{
+		cpuShares:    context.Uint64("cpushares"),
+		cpuset:       context.String("cpuset"),
+		readOnly:     context.Bool("read-only"),
+		pdeathSignal: context.String("parent-death-signal"),
+		sysContainer: context.Bool("sys-container") || context.Bool("inner-docker"),
+		innerDocker:  context.Bool("inner-docker"),
+	}
+
+	if val := context.String("memory-limit"); val != "" {
+		limit, err := units.RAMInBytes(val)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid memory limit: %s", val)
+		}
+		opts.memoryLimit = limit
+	}
+
+	for _, val := range context.StringSlice("bind") {
+		m, err := parseBindFlag(val)
+		if err != nil {
+			return nil, err
+		}
+		opts.binds = append(opts.binds, m)
+	}
+
+	if val := context.String("id-map"); val != "" {
+		idMap := val
+		if len(strings.Fields(val)) == 2 {
+			idMap = val + " " + strconv.FormatUint(context.Uint64("id-range-min"), 10)
+		}
+
+		if err := parseIDMap(idMap, &opts.uid, &opts.gid, &opts.idSize); err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+// parseBindFlag parses a "src:dst[:ro]" bind mount.
+func parseBindFlag(val string) (specs.Mount, error) {
+	parts := strings.Split(val, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return specs.Mount{}, fmt.Errorf("invalid bind mount %q: must be of the form \"src:dst[:ro]\"", val)
+	}
+
+	src, err := filepath.Abs(parts[0])
+	if err != nil {
+		return specs.Mount{}, err
+	}
+	if !filepath.IsAbs(parts[1]) {
+		return specs.Mount{}, fmt.Errorf("invalid bind mount %q: destination must be an absolute path", val)
+	}
+
+	m := specs.Mount{
+		Destination: parts[1],
+		Source:      src,
+		Type:        "bind",
+		Options:     []string{"rbind", "rprivate"},
+	}
+
+	if len(parts) == 3 {
+		if parts[2] != "ro" {
+			return specs.Mount{}, fmt.Errorf("invalid bind mount %q: unknown option %q", val, parts[2])
+		}
+		m.Options = append(m.Options, "ro")
+	}
+
+	return m, nil
+}
+
+// generateSpec returns the spec for the given settings.
+func generateSpec(opts *configGenerateOpts) (*specs.Spec, error) {
+	var spec *specs.Spec
+
+	if opts.sysContainer {
+		var err error
+		if spec, err = syscont.Example(); err != nil {
+			return nil, err
+		}
+		spec.Linux.Namespaces = append(spec.Linux.Namespaces, specs.LinuxNamespace{Type: specs.UserNamespace})
+		spec.Mounts = append(spec.Mounts, syscont.SysboxFsMountStubs()...)
+	} else {
+		spec = specconv.Example()
+	}
+
+	spec.Root.Readonly = opts.readOnly
+	spec.Mounts = append(spec.Mounts, opts.binds...)
+
+	if opts.memoryLimit != 0 || opts.cpuShares != 0 || opts.cpuset != "" {
+		if spec.Linux.Resources == nil {
+			spec.Linux.Resources = &specs.LinuxResources{}
+		}
+		res := spec.Linux.Resources
+
+		if opts.memoryLimit != 0 {
+			limit := opts.memoryLimit
+			res.Memory = &specs.LinuxMemory{Limit: &limit}
+		}
+		if opts.cpuShares != 0 || opts.cpuset != "" {
+			res.CPU = &specs.LinuxCPU{Cpus: opts.cpuset}
+			if opts.cpuShares != 0 {
+				shares := opts.cpuShares
+				res.CPU.Shares = &shares
+			}
+		}
+	}
+
+	if opts.pdeathSignal != "" {
+		if err := syscont.SetParentDeathSignal(spec, opts.pdeathSignal); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.idSize != 0 {
+		if !hasNamespace(spec, specs.UserNamespace) {
+			spec.Linux.Namespaces = append(spec.Linux.Namespaces, specs.LinuxNamespace{Type: specs.UserNamespace})
+		}
+		spec.Linux.UIDMappings = []specs.LinuxIDMapping{{
+			HostID:      opts.uid,
+			ContainerID: 0,
+			Size:        opts.idSize,
+		}}
+		spec.Linux.GIDMappings = []specs.LinuxIDMapping{{
+			HostID:      opts.gid,
+			ContainerID: 0,
+			Size:        opts.idSize,
+		}}
+	}
+
+	// dockerd and its containers need processes to gain privileges (e.g., via
+	// setuid helpers) and many open files
+	if opts.innerDocker {
+		spec.Process.NoNewPrivileges = false
+		for i, rl := range spec.Process.Rlimits {
+			if rl.Type == "RLIMIT_NOFILE" {
+				spec.Process.Rlimits[i].Hard = 1048576
+				spec.Process.Rlimits[i].Soft = 1048576
+			}
+		}
+	}
+
+	return spec, nil
+}
+
+func hasNamespace(spec *specs.Spec, nsType specs.LinuxNamespaceType) bool {
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Type == nsType {
+			return true
+		}
+	}
+	return false
+}
+
+// marshalSpec encodes the given spec in the given format ("json" or "yaml").
+// The yaml encoding uses the same field names as the json one.
+func marshalSpec(spec *specs.Spec, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(spec, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "json":
+		return append(data, '\n'), nil
+	case "yaml":
+		// json is valid yaml; decoding it into a node keeps the field order
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, err
+		}
+		clearYamlStyle(&node)
+
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("invalid format %q (must be json or yaml)", format)
+	}
+}
+
+// clearYamlStyle switches the given node (and its children) from the flow
+// (json-like) style to the default block style.
+func clearYamlStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, n := range node.Content {
+		clearYamlStyle(n)
+	}
+}
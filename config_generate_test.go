@@ -0,0 +1,213 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runc/libsysbox/syscont"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+func configGenerateContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet("generate", flag.ContinueOnError)
+	for _, f := range configGenerateCommand.Flags {
+		f.Apply(set)
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatalf("failed to parse flags %v: %v", args, err)
+	}
+	return cli.NewContext(nil, set, nil)
+}
+
+func generateSpecFromFlags(t *testing.T, args ...string) (*specs.Spec, error) {
+	opts, err := parseConfigGenerateFlags(configGenerateContext(t, args...))
+	if err != nil {
+		return nil, err
+	}
+	return generateSpec(opts)
+}
+
+func TestConfigGenerate(t *testing.T) {
+	spec, err := generateSpecFromFlags(t,
+		"--memory-limit", "1G",
+		"--cpushares", "512",
+		"--cpuset", "0-1",
+		"--bind", "/var/data:/data",
+		"--bind", "/etc/app:/etc/app:ro",
+		"--read-only",
+		"--parent-death-signal", "SIGKILL",
+		"--id-map", "100000 200000 70000",
+	)
+	if err != nil {
+		t.Fatalf("generateSpec: unexpected error: %v", err)
+	}
+
+	res := spec.Linux.Resources
+	if res == nil || res.Memory == nil || *res.Memory.Limit != 1<<30 {
+		t.Errorf("generateSpec: want 1G memory limit; got %+v", res)
+	}
+	if res == nil || res.CPU == nil || *res.CPU.Shares != 512 || res.CPU.Cpus != "0-1" {
+		t.Errorf("generateSpec: want 512 cpu shares and cpuset 0-1; got %+v", res)
+	}
+
+	if !spec.Root.Readonly {
+		t.Errorf("generateSpec: want read-only rootfs")
+	}
+
+	want := []specs.Mount{
+		{Destination: "/data", Source: "/var/data", Type: "bind", Options: []string{"rbind", "rprivate"}},
+		{Destination: "/etc/app", Source: "/etc/app", Type: "bind", Options: []string{"rbind", "rprivate", "ro"}},
+	}
+	binds := spec.Mounts[len(spec.Mounts)-2:]
+	for i := range want {
+		if binds[i].Destination != want[i].Destination || binds[i].Source != want[i].Source ||
+			strings.Join(binds[i].Options, ",") != strings.Join(want[i].Options, ",") {
+			t.Errorf("generateSpec: want bind mount %+v; got %+v", want[i], binds[i])
+		}
+	}
+
+	sig, err := syscont.ParentDeathSignal(spec.Annotations)
+	if err != nil || sig != 9 {
+		t.Errorf("generateSpec: want parent death signal 9; got %d (err %v)", sig, err)
+	}
+
+	if !hasNamespace(spec, specs.UserNamespace) {
+		t.Errorf("generateSpec: want user namespace")
+	}
+	if len(spec.Linux.UIDMappings) != 1 || spec.Linux.UIDMappings[0].HostID != 100000 || spec.Linux.UIDMappings[0].Size != 70000 {
+		t.Errorf("generateSpec: want uid mapping 100000:70000; got %v", spec.Linux.UIDMappings)
+	}
+	if len(spec.Linux.GIDMappings) != 1 || spec.Linux.GIDMappings[0].HostID != 200000 || spec.Linux.GIDMappings[0].Size != 70000 {
+		t.Errorf("generateSpec: want gid mapping 200000:70000; got %v", spec.Linux.GIDMappings)
+	}
+
+	// basic container spec: no sysbox-fs mounts
+	if len(syscont.SysboxFsMounts(spec)) != 0 {
+		t.Errorf("generateSpec: want no sysbox-fs mounts; got %v", syscont.SysboxFsMounts(spec))
+	}
+}
+
+func TestConfigGenerateSysContainer(t *testing.T) {
+	spec, err := generateSpecFromFlags(t, "--sys-container", "--id-map", "100000 100000", "--id-range-min", "131072")
+	if err != nil {
+		t.Fatalf("generateSpec: unexpected error: %v", err)
+	}
+
+	for _, ns := range []specs.LinuxNamespaceType{
+		specs.PIDNamespace, specs.NetworkNamespace, specs.IPCNamespace, specs.UTSNamespace,
+		specs.MountNamespace, specs.CgroupNamespace, specs.UserNamespace,
+	} {
+		if !hasNamespace(spec, ns) {
+			t.Errorf("generateSpec: missing %s namespace", ns)
+		}
+	}
+
+	n := 0
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Type == specs.UserNamespace {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("generateSpec: want a single user namespace; got %d", n)
+	}
+
+	if len(syscont.SysboxFsMounts(spec)) != len(syscont.SysboxFsMountStubs()) {
+		t.Errorf("generateSpec: want all sysbox-fs mounts; got %v", syscont.SysboxFsMounts(spec))
+	}
+
+	caps := spec.Process.Capabilities
+	if caps == nil || len(caps.Bounding) == 0 || len(caps.Effective) != len(caps.Bounding) {
+		t.Errorf("generateSpec: want full capabilities; got %+v", caps)
+	}
+
+	if spec.Linux.UIDMappings[0].Size != 131072 || spec.Linux.GIDMappings[0].Size != 131072 {
+		t.Errorf("generateSpec: want id mappings of size 131072; got %v, %v", spec.Linux.UIDMappings, spec.Linux.GIDMappings)
+	}
+}
+
+func TestConfigGenerateInnerDocker(t *testing.T) {
+	spec, err := generateSpecFromFlags(t, "--inner-docker")
+	if err != nil {
+		t.Fatalf("generateSpec: unexpected error: %v", err)
+	}
+
+	if len(syscont.SysboxFsMounts(spec)) == 0 {
+		t.Errorf("generateSpec: want --inner-docker to imply --sys-container")
+	}
+	if spec.Process.NoNewPrivileges {
+		t.Errorf("generateSpec: want NoNewPrivileges disabled")
+	}
+	for _, rl := range spec.Process.Rlimits {
+		if rl.Type == "RLIMIT_NOFILE" && rl.Soft != 1048576 {
+			t.Errorf("generateSpec: want RLIMIT_NOFILE 1048576; got %d", rl.Soft)
+		}
+	}
+}
+
+func TestConfigGenerateInvalidFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"--memory-limit", "lots"},
+		{"--bind", "/var/data"},
+		{"--bind", "/var/data:data"},
+		{"--bind", "/var/data:/data:rw"},
+		{"--parent-death-signal", "SIGFOO"},
+		{"--id-map", "100000 100000 1000"},
+		{"--id-map", "100000 100000", "--id-range-min", "1000"},
+	} {
+		if _, err := generateSpecFromFlags(t, args...); err == nil {
+			t.Errorf("generateSpec(%v): want error", args)
+		}
+	}
+}
+
+func TestMarshalSpec(t *testing.T) {
+	spec, err := generateSpecFromFlags(t, "--sys-container", "--memory-limit", "1G")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := marshalSpec(spec, "json")
+	if err != nil {
+		t.Fatalf("marshalSpec: unexpected error: %v", err)
+	}
+	var fromJSON specs.Spec
+	if err := json.Unmarshal(data, &fromJSON); err != nil {
+		t.Fatalf("marshalSpec: invalid json: %v", err)
+	}
+
+	data, err = marshalSpec(spec, "yaml")
+	if err != nil {
+		t.Fatalf("marshalSpec: unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), "ociVersion: ") {
+		t.Errorf("marshalSpec: want yaml with the spec's json field names; got:\n%s", data)
+	}
+
+	// the yaml decodes into the same spec as the json
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		t.Fatalf("marshalSpec: invalid yaml: %v", err)
+	}
+	js, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromYAML specs.Spec
+	if err := json.Unmarshal(js, &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+	if *fromYAML.Linux.Resources.Memory.Limit != 1<<30 || len(fromYAML.Mounts) != len(fromJSON.Mounts) {
+		t.Errorf("marshalSpec: yaml and json specs differ")
+	}
+
+	if _, err := marshalSpec(spec, "toml"); err == nil {
+		t.Errorf("marshalSpec: want error for unknown format")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/opencontainers/runc/libsysbox/sysbox"
 	"github.com/opencontainers/runc/libsysbox/syscont"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
@@ -50,10 +51,22 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 			Name:  "no-new-keyring",
 			Usage: "do not create a new session keyring for the container.  This will cause the container to inherit the calling processes session key",
 		},
+		cli.StringSliceFlag{
+			Name:  "exclude-cgroup-subsystem",
+			Usage: "do not create a cgroup for the container in the given cgroup v1 subsystem (may be repeated; devices can't be excluded)",
+		},
 		cli.IntFlag{
 			Name:  "preserve-fds",
 			Usage: "Pass N additional file descriptors to the container (stdio + $LISTEN_FDS + N in total)",
 		},
+		cli.BoolFlag{
+			Name:  "prepare-rootfs",
+			Usage: "set up the rootfs for the system container before creating it (see rootfs-prepare)",
+		},
+		cli.StringFlag{
+			Name:  "image-config",
+			Usage: "path to the container image's config (in OCI image config format); the sysbox.io/* labels that images may set are added to the spec's annotations (the latter take priority)",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		var (
@@ -70,6 +83,9 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 		if err = revisePidFile(context); err != nil {
 			return err
 		}
+		if err = loadResourcePolicy(context); err != nil {
+			return err
+		}
 
 		spec, err = setupSpec(context)
 		if err != nil {
@@ -80,6 +96,26 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 			return err
 		}
 
+		if context.Bool("prepare-rootfs") && spec.Root != nil {
+			manifest, err := syscont.PrepareRootfs(spec.Root.Path, false)
+			if err != nil {
+				return fmt.Errorf("failed to prepare rootfs: %v", err)
+			}
+			for _, c := range manifest.Changes {
+				logrus.Debugf("rootfs-prepare: %s %s (mode %s)", c.Action, c.Path, c.Mode)
+			}
+		}
+
+		if path := context.String("image-config"); path != "" {
+			imgConfig, err := syscont.LoadImageConfig(path)
+			if err != nil {
+				return fmt.Errorf("failed to load image config: %v", err)
+			}
+			if err := syscont.InjectImageAnnotations(spec, imgConfig.Labels); err != nil {
+				return fmt.Errorf("invalid image config: %v", err)
+			}
+		}
+
 		id := context.Args().First()
 		sysMgr := sysbox.NewMgr(id, !context.GlobalBool("no-sysbox-mgr"))
 		sysFs := sysbox.NewFs(id, !context.GlobalBool("no-sysbox-fs"))
@@ -96,6 +132,13 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 			}()
 		}
 
+		// remove the files generated for the container (if any) on failure
+		defer func() {
+			if err != nil {
+				syscont.RemoveRunDir(id)
+			}
+		}()
+
 		uidShiftSupported, uidShiftRootfs, err = syscont.ConvertSpec(context, sysMgr, sysFs, spec)
 		if err != nil {
 			return fmt.Errorf("error in the container spec: %v", err)
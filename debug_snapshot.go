@@ -0,0 +1,590 @@
+// +build linux
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/utils"
+	"github.com/opencontainers/runc/libsysbox/syscont"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urfave/cli"
+)
+
+// DebugSnapshotVersion is the version of the debug snapshot format.
+const DebugSnapshotVersion = 1
+
+// replaceable in tests
+var (
+	snapshotProcDir = "/proc"
+	readKernelLog   = dmesgKernelLog
+)
+
+// DebugSnapshot holds the runtime state of a container, for debugging. Items
+// that could not be captured are left empty, with the reason in Errors.
+type DebugSnapshot struct {
+	Version     int       `json:"version"`
+	ContainerID string    `json:"container_id"`
+	Time        time.Time `json:"time"`
+	// The container's spec, per its bundle's config.json
+	OriginalSpec *specs.Spec `json:"original_spec,omitempty"`
+	// The container's config, as converted by sysbox-runc from its spec
+	Config         *configs.Config         `json:"config,omitempty"`
+	Cgroups        *cgroups.CgroupSnapshot `json:"cgroups,omitempty"`
+	SysboxFsMounts []SysboxFsMountStatus   `json:"sysbox_fs_mounts,omitempty"`
+	Network        *NetworkInspectResult   `json:"network,omitempty"`
+	Processes      []ProcessInfo           `json:"processes,omitempty"`
+	// Kernel log lines that refer to the container or its processes
+	KernelLog []string        `json:"kernel_log,omitempty"`
+	Seccomp   []SeccompStatus `json:"seccomp,omitempty"`
+	// Errors maps each item that could not be captured to the reason
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// SysboxFsMountStatus describes whether the source of a sysbox-fs mount of the
+// container can be read (e.g., fails if sysbox-fs is hung or gone).
+type SysboxFsMountStatus struct {
+	Destination string `json:"destination"`
+	Source      string `json:"source"`
+	Readable    bool   `json:"readable"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ProcessInfo describes a process in the container.
+type ProcessInfo struct {
+	PID int `json:"pid"`
+	// The process' pid in each of its pid namespaces, from the host's one to
+	// its own (innermost) one
+	NSPids  []int    `json:"ns_pids"`
+	Name    string   `json:"name"`
+	Cmdline []string `json:"cmdline"`
+}
+
+// SeccompStatus describes the seccomp state of a process in the container.
+type SeccompStatus struct {
+	PID int `json:"pid"`
+	// "disabled", "strict" or "filter"
+	Mode string `json:"mode"`
+	// Number of seccomp filters attached to the process (-1 if the kernel
+	// doesn't report it)
+	Filters int `json:"filters"`
+}
+
+var debugSnapshotCommand = cli.Command{
+	Name:  "debug-snapshot",
+	Usage: "captures the runtime state of a container for debugging",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The debug-snapshot command captures the runtime state of the given container
+into the directory given by --output, one file per item: the container's
+original spec and its config (as converted by sysbox-runc), its cgroup tree,
+the state of its sysbox-fs mounts, its network interfaces and routes, its
+processes (with their pids in each pid namespace), the kernel log messages
+that refer to it, and the seccomp state of its processes.
+
+Items that can't be captured (e.g., within the --timeout) are listed, along
+with the reason, in the snapshot.json file.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "directory to write the snapshot to (required)",
+		},
+		cli.BoolFlag{
+			Name:  "compress",
+			Usage: "write the snapshot as a gzip-compressed tarball in the output directory",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Value: 30 * time.Second,
+			Usage: "max time to spend capturing the snapshot",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		output := context.String("output")
+		if output == "" {
+			return fmt.Errorf("missing --output directory")
+		}
+		timeout := context.Duration("timeout")
+		if timeout <= 0 {
+			return fmt.Errorf("invalid timeout %v", timeout)
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		status, err := container.Status()
+		if err != nil {
+			return err
+		}
+		if status == libcontainer.Stopped {
+			return fmt.Errorf("container %s is not running", container.ID())
+		}
+		state, err := container.State()
+		if err != nil {
+			return err
+		}
+		snap := captureDebugSnapshot(container, state, timeout)
+		return writeDebugSnapshot(snap, output, context.Bool("compress"))
+	},
+}
+
+// snapshotCapture captures an item of a debug snapshot; on success, it returns
+// a func that sets the item in the snapshot.
+type snapshotCapture struct {
+	name    string
+	capture func() (func(*DebugSnapshot), error)
+}
+
+func captureDebugSnapshot(container libcontainer.Container, state *libcontainer.State, timeout time.Duration) *DebugSnapshot {
+	snap := &DebugSnapshot{
+		Version:     DebugSnapshotVersion,
+		ContainerID: container.ID(),
+		Time:        time.Now(),
+		Config:      &state.Config,
+		Errors:      make(map[string]string),
+	}
+
+	pids, err := container.Processes()
+	if err != nil {
+		snap.Errors["processes"] = err.Error()
+	}
+
+	captures := []snapshotCapture{
+		{"original-spec", func() (func(*DebugSnapshot), error) {
+			spec, err := captureOriginalSpec(&state.Config)
+			return func(s *DebugSnapshot) { s.OriginalSpec = spec }, err
+		}},
+		{"processes", func() (func(*DebugSnapshot), error) {
+			procs, err := captureProcesses(pids)
+			return func(s *DebugSnapshot) { s.Processes = procs }, err
+		}},
+		{"seccomp", func() (func(*DebugSnapshot), error) {
+			seccomp, err := captureSeccomp(pids)
+			return func(s *DebugSnapshot) { s.Seccomp = seccomp }, err
+		}},
+		{"sysbox-fs-mounts", func() (func(*DebugSnapshot), error) {
+			mounts := captureSysboxFsMounts(state.Config.Mounts, syscont.SysboxFsDir)
+			return func(s *DebugSnapshot) { s.SysboxFsMounts = mounts }, nil
+		}},
+		{"cgroups", func() (func(*DebugSnapshot), error) {
+			cg, err := container.CgroupSnapshot()
+			return func(s *DebugSnapshot) { s.Cgroups = cg }, err
+		}},
+		{"network", func() (func(*DebugSnapshot), error) {
+			net, err := inspectNetwork(state.InitProcessPid, "")
+			return func(s *DebugSnapshot) { s.Network = net }, err
+		}},
+		{"kernel-log", func() (func(*DebugSnapshot), error) {
+			lines, err := captureKernelLog(container.ID(), pids)
+			return func(s *DebugSnapshot) { s.KernelLog = lines }, err
+		}},
+	}
+
+	runSnapshotCaptures(snap, captures, timeout)
+	return snap
+}
+
+// runSnapshotCaptures runs the given captures in order, until they are all
+// done or the timeout expires; the captures not done by then are recorded as
+// errors in the snapshot.
+func runSnapshotCaptures(snap *DebugSnapshot, captures []snapshotCapture, timeout time.Duration) {
+	type result struct {
+		set func(*DebugSnapshot)
+		err error
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for i, c := range captures {
+		// buffered, so that a capture that times out doesn't block forever
+		done := make(chan result, 1)
+		go func(c snapshotCapture) {
+			set, err := c.capture()
+			done <- result{set, err}
+		}(c)
+
+		select {
+		case res := <-done:
+			if res.err != nil {
+				snap.Errors[c.name] = res.err.Error()
+				continue
+			}
+			res.set(snap)
+		case <-deadline.C:
+			for _, c := range captures[i:] {
+				snap.Errors[c.name] = fmt.Sprintf("timed out after %v", timeout)
+			}
+			return
+		}
+	}
+}
+
+// captureOriginalSpec returns the spec in the bundle of the container with the
+// given config.
+func captureOriginalSpec(config *configs.Config) (*specs.Spec, error) {
+	bundle := utils.SearchLabels(config.Labels, "bundle")
+	if bundle == "" {
+		return nil, fmt.Errorf("no bundle found for the container")
+	}
+	return loadSpec(filepath.Join(bundle, specConfig), false)
+}
+
+// captureSysboxFsMounts checks whether the sources of the given sysbox-fs
+// mounts (i.e., those with sources under fsDir) can be read.
+func captureSysboxFsMounts(mounts []*configs.Mount, fsDir string) []SysboxFsMountStatus {
+	var status []SysboxFsMountStatus
+
+	for _, m := range mounts {
+		if m.Source != fsDir && !strings.HasPrefix(m.Source, fsDir+"/") {
+			continue
+		}
+		st := SysboxFsMountStatus{
+			Destination: m.Destination,
+			Source:      m.Source,
+		}
+		if err := checkReadable(m.Source); err != nil {
+			st.Error = err.Error()
+		} else {
+			st.Readable = true
+		}
+		status = append(status, st)
+	}
+
+	return status
+}
+
+// checkReadable reads the first entry of the given dir, or the first bytes of
+// the given file.
+func checkReadable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		if _, err := f.Readdirnames(1); err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+	}
+
+	buf := make([]byte, 4096)
+	if _, err := f.Read(buf); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// readProcStatus returns the fields of the given process' /proc/<pid>/status
+// file.
+func readProcStatus(pid int) (map[string]string, error) {
+	f, err := os.Open(filepath.Join(snapshotProcDir, strconv.Itoa(pid), "status"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fields := make(map[string]string)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		fields[kv[0]] = strings.TrimSpace(kv[1])
+	}
+	return fields, s.Err()
+}
+
+// captureProcesses returns info on the given processes. Processes that exit
+// while they are read are skipped.
+func captureProcesses(pids []int) ([]ProcessInfo, error) {
+	var procs []ProcessInfo
+
+	for _, pid := range pids {
+		status, err := readProcStatus(pid)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		proc := ProcessInfo{
+			PID:  pid,
+			Name: status["Name"],
+		}
+
+		// NSpid is missing on kernels < 4.1
+		if val, ok := status["NSpid"]; ok {
+			for _, f := range strings.Fields(val) {
+				nsPid, err := strconv.Atoi(f)
+				if err != nil {
+					return nil, fmt.Errorf("invalid NSpid for pid %d: %v", pid, err)
+				}
+				proc.NSPids = append(proc.NSPids, nsPid)
+			}
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(snapshotProcDir, strconv.Itoa(pid), "cmdline"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if len(data) > 0 {
+			proc.Cmdline = strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+		}
+
+		procs = append(procs, proc)
+	}
+
+	return procs, nil
+}
+
+var seccompModes = map[string]string{
+	"0": "disabled",
+	"1": "strict",
+	"2": "filter",
+}
+
+// captureSeccomp returns the seccomp state of the given processes. Processes
+// that exit while they are read are skipped.
+func captureSeccomp(pids []int) ([]SeccompStatus, error) {
+	var seccomp []SeccompStatus
+
+	for _, pid := range pids {
+		status, err := readProcStatus(pid)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		val, ok := status["Seccomp"]
+		if !ok {
+			return nil, fmt.Errorf("kernel does not report the seccomp mode of processes")
+		}
+		mode, ok := seccompModes[val]
+		if !ok {
+			mode = val
+		}
+
+		// Seccomp_filters was added in kernel 5.9
+		filters := -1
+		if val, ok := status["Seccomp_filters"]; ok {
+			if filters, err = strconv.Atoi(val); err != nil {
+				return nil, fmt.Errorf("invalid Seccomp_filters for pid %d: %v", pid, err)
+			}
+		}
+
+		seccomp = append(seccomp, SeccompStatus{
+			PID:     pid,
+			Mode:    mode,
+			Filters: filters,
+		})
+	}
+
+	return seccomp, nil
+}
+
+// captureKernelLog returns the kernel log lines that refer to the container
+// with the given id or to its processes.
+func captureKernelLog(id string, pids []int) ([]string, error) {
+	lines, err := readKernelLog()
+	if err != nil {
+		return nil, err
+	}
+	return filterKernelLog(lines, id, pids), nil
+}
+
+// filterKernelLog returns the given kernel log lines that refer to the
+// container with the given id, or to one of the given pids (as "pid=N",
+// "pid N", "pid: N", "process N" or "[N]", per the kernel's messages).
+func filterKernelLog(lines []string, id string, pids []int) []string {
+	var patterns []string
+	if id != "" {
+		patterns = append(patterns, id)
+	}
+	for _, pid := range pids {
+		for _, f := range []string{"pid=%d", "pid %d", "pid: %d", "process %d", "[%d]"} {
+			patterns = append(patterns, fmt.Sprintf(f, pid))
+		}
+	}
+
+	var filtered []string
+	for _, line := range lines {
+		for _, p := range patterns {
+			if containsWord(line, p) {
+				filtered = append(filtered, line)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// containsWord returns true if s contains the given word (i.e., not followed
+// by a digit, so that "pid 12" doesn't match "pid 123").
+func containsWord(s, word string) bool {
+	for i := 0; ; {
+		j := strings.Index(s[i:], word)
+		if j < 0 {
+			return false
+		}
+		end := i + j + len(word)
+		if end == len(s) || s[end] < '0' || s[end] > '9' {
+			return true
+		}
+		i = i + j + 1
+	}
+}
+
+func dmesgKernelLog() ([]string, error) {
+	out, err := exec.Command("dmesg").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run dmesg: %v", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"), nil
+}
+
+// files returns the files of the snapshot (file name -> contents), one per
+// captured item, plus a snapshot.json with the snapshot's metadata and errors.
+func (s *DebugSnapshot) files() (map[string][]byte, error) {
+	items := map[string]interface{}{
+		"snapshot.json": &DebugSnapshot{
+			Version:     s.Version,
+			ContainerID: s.ContainerID,
+			Time:        s.Time,
+			Errors:      s.Errors,
+		},
+	}
+	if s.OriginalSpec != nil {
+		items["spec-original.json"] = s.OriginalSpec
+	}
+	if s.Config != nil {
+		items["config-converted.json"] = s.Config
+	}
+	if s.Cgroups != nil {
+		items["cgroups.json"] = s.Cgroups
+	}
+	if s.SysboxFsMounts != nil {
+		items["sysbox-fs-mounts.json"] = s.SysboxFsMounts
+	}
+	if s.Network != nil {
+		items["network.json"] = s.Network
+	}
+	if s.Processes != nil {
+		items["processes.json"] = s.Processes
+	}
+	if s.Seccomp != nil {
+		items["seccomp.json"] = s.Seccomp
+	}
+
+	files := make(map[string][]byte, len(items)+1)
+	for name, item := range items {
+		data, err := json.MarshalIndent(item, "", "\t")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %v", name, err)
+		}
+		files[name] = append(data, '\n')
+	}
+
+	if _, ok := s.Errors["kernel-log"]; !ok {
+		var buf bytes.Buffer
+		for _, line := range s.KernelLog {
+			buf.WriteString(line + "\n")
+		}
+		files["dmesg.txt"] = buf.Bytes()
+	}
+
+	return files, nil
+}
+
+// writeDebugSnapshot writes the given snapshot's files to the given dir, or, if
+// compress is set, to a gzip-compressed tarball in it.
+func writeDebugSnapshot(snap *DebugSnapshot, dir string, compress bool) error {
+	files, err := snap.files()
+	if err != nil {
+		return err
+	}
+
+	// the snapshot may hold sensitive data (e.g., env vars in the spec)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	if !compress {
+		for name, data := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	prefix := "debug-snapshot-" + snap.ContainerID
+	f, err := os.OpenFile(filepath.Join(dir, prefix+".tar.gz"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		hdr := &tar.Header{
+			Name:    prefix + "/" + name,
+			Mode:    0600,
+			Size:    int64(len(files[name])),
+			ModTime: snap.Time,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
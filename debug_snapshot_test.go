@@ -0,0 +1,382 @@
+// +build linux
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// mkTestProc creates the status and cmdline files of the given process under
+// the given (fake) /proc dir.
+func mkTestProc(t *testing.T, procDir, pid, status, cmdline string) {
+	dir := filepath.Join(procDir, pid)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "status"), []byte(status), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cmdline"), []byte(cmdline), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setupTestProcDir(t *testing.T) (string, func()) {
+	procDir, err := ioutil.TempDir("", "debug-snapshot-proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mkTestProc(t, procDir, "1000",
+		"Name:\tsystemd\nNSpid:\t1000\t1\nSeccomp:\t2\nSeccomp_filters:\t1\n",
+		"/sbin/init\x00")
+	mkTestProc(t, procDir, "1001",
+		"Name:\tdockerd\nNSpid:\t1001\t52\nSeccomp:\t0\n",
+		"dockerd\x00--debug\x00")
+	mkTestProc(t, procDir, "1002",
+		"Name:\tsleep\nNSpid:\t1002\t60\t1\nSeccomp:\t2\nSeccomp_filters:\t3\n",
+		"sleep\x00inf\x00")
+
+	orig := snapshotProcDir
+	snapshotProcDir = procDir
+
+	return procDir, func() {
+		snapshotProcDir = orig
+		os.RemoveAll(procDir)
+	}
+}
+
+func TestCaptureProcesses(t *testing.T) {
+	_, cleanup := setupTestProcDir(t)
+	defer cleanup()
+
+	// pid 1003 exited
+	procs, err := captureProcesses([]int{1000, 1001, 1002, 1003})
+	if err != nil {
+		t.Fatalf("captureProcesses: unexpected error: %v", err)
+	}
+
+	want := []ProcessInfo{
+		{PID: 1000, NSPids: []int{1000, 1}, Name: "systemd", Cmdline: []string{"/sbin/init"}},
+		{PID: 1001, NSPids: []int{1001, 52}, Name: "dockerd", Cmdline: []string{"dockerd", "--debug"}},
+		{PID: 1002, NSPids: []int{1002, 60, 1}, Name: "sleep", Cmdline: []string{"sleep", "inf"}},
+	}
+	if !reflect.DeepEqual(procs, want) {
+		t.Errorf("captureProcesses: want %+v; got %+v", want, procs)
+	}
+}
+
+func TestCaptureSeccomp(t *testing.T) {
+	procDir, cleanup := setupTestProcDir(t)
+	defer cleanup()
+
+	seccomp, err := captureSeccomp([]int{1000, 1001, 1002, 1003})
+	if err != nil {
+		t.Fatalf("captureSeccomp: unexpected error: %v", err)
+	}
+
+	want := []SeccompStatus{
+		{PID: 1000, Mode: "filter", Filters: 1},
+		{PID: 1001, Mode: "disabled", Filters: -1},
+		{PID: 1002, Mode: "filter", Filters: 3},
+	}
+	if !reflect.DeepEqual(seccomp, want) {
+		t.Errorf("captureSeccomp: want %+v; got %+v", want, seccomp)
+	}
+
+	// kernel without seccomp
+	mkTestProc(t, procDir, "1004", "Name:\tsh\n", "sh\x00")
+	if _, err := captureSeccomp([]int{1004}); err == nil {
+		t.Errorf("captureSeccomp: want error without the Seccomp field")
+	}
+}
+
+func TestCaptureOriginalSpec(t *testing.T) {
+	bundle, err := ioutil.TempDir("", "debug-snapshot-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bundle)
+
+	spec := &specs.Spec{
+		Version:     specs.Version,
+		Process:     &specs.Process{Cwd: "/", Args: []string{"sh"}},
+		Root:        &specs.Root{Path: "rootfs"},
+		Annotations: map[string]string{"com.example.app/version": "1.2"},
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundle, specConfig), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &configs.Config{Labels: []string{"bundle=" + bundle}}
+	got, err := captureOriginalSpec(config)
+	if err != nil {
+		t.Fatalf("captureOriginalSpec: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got.Process.Args, spec.Process.Args) || !reflect.DeepEqual(got.Annotations, spec.Annotations) {
+		t.Errorf("captureOriginalSpec: want %+v; got %+v", spec, got)
+	}
+
+	if _, err := captureOriginalSpec(&configs.Config{}); err == nil {
+		t.Errorf("captureOriginalSpec: want error without a bundle label")
+	}
+}
+
+func TestCaptureSysboxFsMounts(t *testing.T) {
+	fsDir, err := ioutil.TempDir("", "debug-snapshot-sysboxfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(fsDir)
+
+	if err := os.MkdirAll(filepath.Join(fsDir, "proc/sys"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(fsDir, "proc/uptime"), []byte("100.0 50.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mounts := []*configs.Mount{
+		{Source: "proc", Destination: "/proc", Device: "proc"},
+		{Source: filepath.Join(fsDir, "proc/sys"), Destination: "/proc/sys", Device: "bind"},
+		{Source: filepath.Join(fsDir, "proc/uptime"), Destination: "/proc/uptime", Device: "bind"},
+		{Source: filepath.Join(fsDir, "proc/swaps"), Destination: "/proc/swaps", Device: "bind"},
+		{Source: fsDir + "-other/proc/swaps", Destination: "/other", Device: "bind"},
+	}
+
+	status := captureSysboxFsMounts(mounts, fsDir)
+
+	if len(status) != 3 {
+		t.Fatalf("captureSysboxFsMounts: want 3 sysbox-fs mounts; got %+v", status)
+	}
+	for _, st := range status[:2] {
+		if !st.Readable || st.Error != "" {
+			t.Errorf("captureSysboxFsMounts: want %s readable; got %+v", st.Source, st)
+		}
+	}
+	if st := status[2]; st.Readable || st.Error == "" || st.Destination != "/proc/swaps" {
+		t.Errorf("captureSysboxFsMounts: want /proc/swaps unreadable; got %+v", st)
+	}
+}
+
+func TestFilterKernelLog(t *testing.T) {
+	lines := []string{
+		"[  100.1] eth0: link up",
+		"[  100.2] Memory cgroup out of memory: Killed process 1002 (sleep) total-vm:1000kB",
+		"[  100.3] audit: type=1326 audit(1.2:3): pid=1001 comm=\"dockerd\" syscall=165",
+		"[  100.4] audit: type=1326 audit(1.2:3): pid=10011 comm=\"other\" syscall=165",
+		"[  100.5] overlayfs: failed to mount container abc123",
+		"[  100.6] sleep[1000]: segfault at 0 ip 0",
+	}
+
+	got := filterKernelLog(lines, "abc123", []int{1000, 1001, 1002})
+	want := []string{lines[1], lines[2], lines[4], lines[5]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filterKernelLog: want %q; got %q", want, got)
+	}
+
+	if got := filterKernelLog(lines, "", nil); got != nil {
+		t.Errorf("filterKernelLog: want no lines without id and pids; got %q", got)
+	}
+}
+
+func TestCaptureKernelLog(t *testing.T) {
+	orig := readKernelLog
+	defer func() { readKernelLog = orig }()
+
+	readKernelLog = func() ([]string, error) {
+		return []string{"pid=42 denied", "pid=43 denied"}, nil
+	}
+	lines, err := captureKernelLog("ctr", []int{42})
+	if err != nil || !reflect.DeepEqual(lines, []string{"pid=42 denied"}) {
+		t.Errorf("captureKernelLog: want [pid=42 denied]; got %q (err %v)", lines, err)
+	}
+
+	readKernelLog = func() ([]string, error) {
+		return nil, errors.New("dmesg: read kernel buffer failed: Operation not permitted")
+	}
+	if _, err := captureKernelLog("ctr", []int{42}); err == nil {
+		t.Errorf("captureKernelLog: want error")
+	}
+}
+
+func TestCaptureNetwork(t *testing.T) {
+	// the test's own network namespace
+	net, err := inspectNetwork(os.Getpid(), "")
+	if err != nil {
+		t.Skipf("can't inspect the test's network namespace: %v", err)
+	}
+
+	found := false
+	for _, iface := range net.Interfaces {
+		if iface.Name == "lo" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("inspectNetwork: want the lo interface; got %+v", net.Interfaces)
+	}
+}
+
+func TestRunSnapshotCaptures(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	captures := []snapshotCapture{
+		{"ok", func() (func(*DebugSnapshot), error) {
+			return func(s *DebugSnapshot) { s.KernelLog = []string{"line"} }, nil
+		}},
+		{"failed", func() (func(*DebugSnapshot), error) {
+			return func(s *DebugSnapshot) { s.Processes = []ProcessInfo{{PID: 1}} }, errors.New("failed")
+		}},
+		{"hung", func() (func(*DebugSnapshot), error) {
+			<-block
+			return func(s *DebugSnapshot) {}, nil
+		}},
+		{"after-hung", func() (func(*DebugSnapshot), error) {
+			return func(s *DebugSnapshot) {}, nil
+		}},
+	}
+
+	snap := &DebugSnapshot{Errors: make(map[string]string)}
+	runSnapshotCaptures(snap, captures, 50*time.Millisecond)
+
+	if !reflect.DeepEqual(snap.KernelLog, []string{"line"}) {
+		t.Errorf("runSnapshotCaptures: want kernel log set; got %q", snap.KernelLog)
+	}
+	if snap.Processes != nil {
+		t.Errorf("runSnapshotCaptures: want failed item not set; got %+v", snap.Processes)
+	}
+
+	var names []string
+	for name := range snap.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := []string{"after-hung", "failed", "hung"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("runSnapshotCaptures: want errors for %v; got %v", want, snap.Errors)
+	}
+	if !strings.Contains(snap.Errors["hung"], "timed out") {
+		t.Errorf("runSnapshotCaptures: want timeout error for hung capture; got %q", snap.Errors["hung"])
+	}
+}
+
+func testDebugSnapshot() *DebugSnapshot {
+	return &DebugSnapshot{
+		Version:     DebugSnapshotVersion,
+		ContainerID: "ctr",
+		Time:        time.Unix(1600000000, 0),
+		Config:      &configs.Config{Hostname: "ctr"},
+		Processes:   []ProcessInfo{{PID: 1000, NSPids: []int{1000, 1}, Name: "init"}},
+		KernelLog:   []string{"pid=1000 denied"},
+		Errors:      map[string]string{"network": "no such netns"},
+	}
+}
+
+func TestWriteDebugSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debug-snapshot-out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "snap")
+	if err := writeDebugSnapshot(testDebugSnapshot(), out, false); err != nil {
+		t.Fatalf("writeDebugSnapshot: unexpected error: %v", err)
+	}
+
+	entries, err := ioutil.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"config-converted.json", "dmesg.txt", "processes.json", "snapshot.json"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("writeDebugSnapshot: want files %v; got %v", want, names)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(out, "snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta DebugSnapshot
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.ContainerID != "ctr" || meta.Errors["network"] != "no such netns" || meta.Processes != nil {
+		t.Errorf("writeDebugSnapshot: unexpected snapshot.json: %s", data)
+	}
+
+	data, err = ioutil.ReadFile(filepath.Join(out, "dmesg.txt"))
+	if err != nil || string(data) != "pid=1000 denied\n" {
+		t.Errorf("writeDebugSnapshot: unexpected dmesg.txt: %q (err %v)", data, err)
+	}
+}
+
+func TestWriteDebugSnapshotCompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debug-snapshot-out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := writeDebugSnapshot(testDebugSnapshot(), dir, true); err != nil {
+		t.Fatalf("writeDebugSnapshot: unexpected error: %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "debug-snapshot-ctr.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+
+	want := []string{
+		"debug-snapshot-ctr/config-converted.json",
+		"debug-snapshot-ctr/dmesg.txt",
+		"debug-snapshot-ctr/processes.json",
+		"debug-snapshot-ctr/snapshot.json",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("writeDebugSnapshot: want tarball entries %v; got %v", want, names)
+	}
+}
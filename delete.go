@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libsysbox/syscont"
 	"github.com/urfave/cli"
 
 	"golang.org/x/sys/unix"
@@ -62,6 +63,9 @@ status of "ubuntu01" as "stopped" the following will delete resources held for
 				if e := os.RemoveAll(path); e != nil {
 					fmt.Fprintf(os.Stderr, "remove %s: %v\n", path, e)
 				}
+				if e := syscont.RemoveRunDir(id); e != nil {
+					fmt.Fprintf(os.Stderr, "remove sysbox run dir of %s: %v\n", id, e)
+				}
 				if force {
 					return nil
 				}
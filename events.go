@@ -122,6 +122,9 @@ func convertLibcontainerStats(ls *libcontainer.Stats) *types.Stats {
 	s.Pids.Current = cg.PidsStats.Current
 	s.Pids.Limit = cg.PidsStats.Limit
 
+	s.NetPrio.Prioidx = cg.NetPrioStats.Prioidx
+	s.NetPrio.Ifpriomap = cg.NetPrioStats.Ifpriomap
+
 	s.CPU.Usage.Kernel = cg.CpuStats.CpuUsage.UsageInKernelmode
 	s.CPU.Usage.User = cg.CpuStats.CpuUsage.UsageInUsermode
 	s.CPU.Usage.Total = cg.CpuStats.CpuUsage.TotalUsage
@@ -139,6 +142,13 @@ func convertLibcontainerStats(ls *libcontainer.Stats) *types.Stats {
 	s.Memory.KernelTCP = convertMemoryEntry(cg.MemoryStats.KernelTCPUsage)
 	s.Memory.Swap = convertMemoryEntry(cg.MemoryStats.SwapUsage)
 	s.Memory.Usage = convertMemoryEntry(cg.MemoryStats.Usage)
+	s.Memory.Events = types.MemoryEvents(cg.MemoryStats.Events)
+	if len(cg.MemoryStats.NUMAStats) > 0 {
+		s.Memory.NUMA = make(map[int]types.NUMANode)
+		for node, stat := range cg.MemoryStats.NUMAStats {
+			s.Memory.NUMA[node] = types.NUMANode(stat)
+		}
+	}
 	s.Memory.Raw = cg.MemoryStats.Stats
 
 	s.Blkio.IoServiceBytesRecursive = convertBlkioEntry(cg.BlkioStats.IoServiceBytesRecursive)
@@ -149,6 +159,8 @@ func convertLibcontainerStats(ls *libcontainer.Stats) *types.Stats {
 	s.Blkio.IoMergedRecursive = convertBlkioEntry(cg.BlkioStats.IoMergedRecursive)
 	s.Blkio.IoTimeRecursive = convertBlkioEntry(cg.BlkioStats.IoTimeRecursive)
 	s.Blkio.SectorsRecursive = convertBlkioEntry(cg.BlkioStats.SectorsRecursive)
+	s.Blkio.IoDiscardedBytesRecursive = convertBlkioEntry(cg.BlkioStats.IoDiscardedBytesRecursive)
+	s.Blkio.IoDiscardedOpsRecursive = convertBlkioEntry(cg.BlkioStats.IoDiscardedOpsRecursive)
 
 	s.Hugetlb = make(map[string]types.Hugetlb)
 	for k, v := range cg.HugetlbStats {
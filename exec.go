@@ -133,8 +133,8 @@ func execProcess(context *cli.Context) (int, error) {
 	if err != nil {
 		return -1, err
 	}
-	bundle := utils.SearchLabels(state.Config.Labels, "bundle")
-	p, err := getProcess(context, bundle)
+	bundle, annotations := utils.Annotations(state.Config.Labels)
+	p, err := getProcess(context, bundle, annotations)
 	if err != nil {
 		return -1, err
 	}
@@ -159,7 +159,7 @@ func execProcess(context *cli.Context) (int, error) {
 	return r.run(p)
 }
 
-func getProcess(context *cli.Context, bundle string) (*specs.Process, error) {
+func getProcess(context *cli.Context, bundle string, annotations map[string]string) (*specs.Process, error) {
 	if path := context.String("process"); path != "" {
 		f, err := os.Open(path)
 		if err != nil {
@@ -174,13 +174,13 @@ func getProcess(context *cli.Context, bundle string) (*specs.Process, error) {
 			return nil, err
 		}
 		// sysbox-runc: convert the process spec for system containers
-		return &p, syscont.ConvertProcessSpec(&p)
+		return &p, syscont.ConvertProcessSpec(&p, annotations)
 	}
 	// process via cli flags
 	if err := os.Chdir(bundle); err != nil {
 		return nil, err
 	}
-	spec, err := loadSpec(specConfig)
+	spec, err := loadSpec(specConfig, context.GlobalBool("strict-spec-validation"))
 	if err != nil {
 		return nil, err
 	}
@@ -245,7 +245,7 @@ func getProcess(context *cli.Context, bundle string) (*specs.Process, error) {
 	}
 
 	// sysbox-runc: convert the process spec for system containers
-	if err := syscont.ConvertProcessSpec(p); err != nil {
+	if err := syscont.ConvertProcessSpec(p, annotations); err != nil {
 		return nil, err
 	}
 	return p, nil
@@ -0,0 +1,52 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/urfave/cli"
+)
+
+var exportCgroupsCommand = cli.Command{
+	Name:  "export-cgroups",
+	Usage: "outputs a snapshot of the container's cgroup tree",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The export-cgroups command outputs (in JSON format) a snapshot of the
+container's cgroup tree, including the child cgroups created by cgroup managers
+inside the container, along with their limits and stats. The snapshot is
+versioned, and is meant for container migration or debugging.`,
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		status, err := container.Status()
+		if err != nil {
+			return err
+		}
+		if status == libcontainer.Stopped {
+			return fmt.Errorf("container %s is not running", container.ID())
+		}
+		snap, err := container.CgroupSnapshot()
+		if err != nil {
+			return fmt.Errorf("failed to snapshot cgroup tree: %v", err)
+		}
+		data, err := json.MarshalIndent(snap, "", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stdout.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write cgroup snapshot: %v", err)
+		}
+		return nil
+	},
+}
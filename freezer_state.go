@@ -0,0 +1,41 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/urfave/cli"
+)
+
+var freezerStateCommand = cli.Command{
+	Name:  "freezer-state",
+	Usage: "output the state of the container's cgroup freezer",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The freezer-state command outputs the state of the container's cgroup
+freezer: "frozen", "thawed", or "undefined" (e.g., when the freezer cgroup is
+not available).`,
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		state, err := container.FreezerState()
+		if err != nil {
+			return err
+		}
+		if state == configs.Undefined {
+			fmt.Println("undefined")
+		} else {
+			fmt.Println(strings.ToLower(string(state)))
+		}
+		return nil
+	},
+}
@@ -23,14 +23,17 @@ require (
 	github.com/opencontainers/runc v0.0.0-00010101000000-000000000000
 	github.com/opencontainers/runtime-spec v1.0.3-0.20200929063507-e6143ca7d51d
 	github.com/opencontainers/selinux v1.8.0
+	github.com/pelletier/go-toml v1.8.1
 	github.com/pkg/errors v0.9.1
 	github.com/pkg/profile v1.5.0
 	github.com/sirupsen/logrus v1.7.0
 	// NOTE: urfave/cli must be <= v1.22.1 due to a regression: https://github.com/urfave/cli/issues/1092
 	github.com/urfave/cli v1.22.1
 	github.com/vishvananda/netlink v1.1.0
+	github.com/vishvananda/netns v0.0.0-20191106174202-0a2b9b5464df
 	github.com/willf/bitset v1.1.11
 	golang.org/x/sys v0.0.0-20201107080550-4d91cf3a1aaf
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 replace github.com/nestybox/sysbox-ipc => ../sysbox-ipc
@@ -3,10 +3,14 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libsysbox/syscont"
 	"github.com/urfave/cli"
 	"golang.org/x/sys/unix"
 )
@@ -29,6 +33,14 @@ signal to the init process of the "ubuntu01" container:
 			Name:  "all, a",
 			Usage: "send the specified signal to all processes inside the container",
 		},
+		cli.IntFlag{
+			Name:  "inner-pid",
+			Usage: "send the specified signal to the process with the given pid in the container's pid namespace",
+		},
+		cli.StringFlag{
+			Name:  "kill-method",
+			Usage: "kill all processes inside the container using cgroup.kill (\"cgroup\"), a SIGKILL per process (\"signal\"), or the former if available (\"auto\"); requires the KILL signal",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 1, minArgs); err != nil {
@@ -51,10 +63,56 @@ signal to the init process of the "ubuntu01" container:
 		if err != nil {
 			return err
 		}
+
+		if context.IsSet("kill-method") {
+			if context.IsSet("inner-pid") {
+				return errors.New("--kill-method and --inner-pid are mutually exclusive")
+			}
+			if signal != unix.SIGKILL {
+				return errors.New("--kill-method requires the KILL signal")
+			}
+			method, err := cgroups.ParseKillMethod(context.String("kill-method"))
+			if err != nil {
+				return err
+			}
+			return container.KillAll(method)
+		}
+
+		if context.IsSet("inner-pid") {
+			if context.Bool("all") {
+				return errors.New("--inner-pid and --all are mutually exclusive")
+			}
+			return signalInnerProcess(container, context.Int("inner-pid"), signal)
+		}
+
 		return container.Signal(signal, context.Bool("all"))
 	},
 }
 
+// signalInnerProcess sends the given signal to the process with the given pid in
+// the container's pid namespace.
+func signalInnerProcess(container libcontainer.Container, innerPid int, signal unix.Signal) error {
+	status, err := container.Status()
+	if err != nil {
+		return err
+	}
+	if status == libcontainer.Stopped {
+		return errors.New("container not running")
+	}
+
+	state, err := container.State()
+	if err != nil {
+		return err
+	}
+
+	pid, err := syscont.ResolveContainerPID(innerPid, state.InitProcessPid)
+	if err != nil {
+		return err
+	}
+
+	return unix.Kill(pid, signal)
+}
+
 func parseSignal(rawSignal string) (unix.Signal, error) {
 	s, err := strconv.Atoi(rawSignal)
 	if err == nil {
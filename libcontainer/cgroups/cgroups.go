@@ -82,6 +82,10 @@ type Manager interface {
 	// sysbox-runc: same as GetPaths(), but returns child cgroup paths
 	GetChildCgroupPaths() map[string]string
 
+	// sysbox-runc: re-applies the cgroup configuration to the child cgroups
+	// (if any), such that cgroup updates on a running container reach them too.
+	UpdateChildCgroups(container *configs.Config) error
+
 	// sysbox-runc: get the type of the cgroup manager
 	GetType() CgroupType
 }
@@ -0,0 +1,253 @@
+// +build linux
+
+package ebpf
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// NetworkPolicy holds the eBPF programs that filter (or classify) the network
+// traffic of the processes in a cgroup. Each program is an ELF object (e.g.,
+// as built with "clang -target bpf") holding a single cgroup_skb program,
+// which returns 1 to let a packet through and 0 to drop it.
+type NetworkPolicy struct {
+	IngressProgram []byte
+	EgressProgram  []byte
+}
+
+// cgroup_skb programs attached in multi program mode (BPF_F_ALLOW_MULTI)
+// require kernel 4.15
+var netPolicyMinKernel = [2]int{4, 15}
+
+// skbProgram is a loaded cgroup_skb program.
+type skbProgram interface {
+	Attach(fd int, typ ebpf.AttachType, flags ebpf.AttachFlags) error
+	Detach(fd int, typ ebpf.AttachType, flags ebpf.AttachFlags) error
+	Pin(fileName string) error
+	Close() error
+}
+
+// replaceable in tests
+var (
+	loadSKBProgram       = loadSKBProgramELF
+	loadPinnedSKBProgram = loadPinnedSKBProgramFile
+	kernelRelease        = unameRelease
+)
+
+type netPolicyProg struct {
+	name string
+	elf  []byte
+	typ  ebpf.AttachType
+}
+
+func (p NetworkPolicy) progs() []netPolicyProg {
+	return []netPolicyProg{
+		{"ingress", p.IngressProgram, ebpf.AttachCGroupInetIngress},
+		{"egress", p.EgressProgram, ebpf.AttachCGroupInetEgress},
+	}
+}
+
+// Empty returns true if the policy has no programs.
+func (p NetworkPolicy) Empty() bool {
+	return len(p.IngressProgram) == 0 && len(p.EgressProgram) == 0
+}
+
+// AttachNetworkPolicy loads the programs in the given policy and attaches them
+// to the cgroup referred to by cgroupFd (a cgroup v2 directory).
+//
+// The programs are attached in multi program mode (BPF_F_ALLOW_MULTI), such
+// that the processes in the cgroup (e.g., the container's inner systemd or
+// container runtimes) can still attach their own programs to its
+// sub-cgroups. Each attached program is pinned under pinDir (on a bpffs), so
+// that DetachNetworkPolicy can find it later; programs already pinned there
+// are assumed attached and skipped. If attaching a program fails, the ones
+// attached before it are detached.
+func AttachNetworkPolicy(cgroupFd int, pinDir string, policy NetworkPolicy) error {
+	if policy.Empty() {
+		return nil
+	}
+
+	if err := checkNetworkPolicyKernel(); err != nil {
+		return err
+	}
+
+	// see LoadAttachCgroupDeviceFilter()
+	memlockLimit := &unix.Rlimit{
+		Cur: unix.RLIM_INFINITY,
+		Max: unix.RLIM_INFINITY,
+	}
+	_ = unix.Setrlimit(unix.RLIMIT_MEMLOCK, memlockLimit)
+
+	if err := os.MkdirAll(pinDir, 0700); err != nil {
+		return errors.Wrap(err, "failed to create network policy pin dir")
+	}
+
+	var attached []netPolicyProg
+
+	for _, p := range policy.progs() {
+		if len(p.elf) == 0 {
+			continue
+		}
+		pinPath := filepath.Join(pinDir, p.name)
+		if _, err := os.Stat(pinPath); err == nil {
+			continue
+		}
+		if err := attachSKBProgram(cgroupFd, p.elf, p.typ, pinPath); err != nil {
+			for _, a := range attached {
+				detachPinnedProgram(cgroupFd, a.typ, filepath.Join(pinDir, a.name))
+			}
+			return errors.Wrapf(err, "failed to attach %s network policy program", p.name)
+		}
+		attached = append(attached, p)
+	}
+
+	return nil
+}
+
+// DetachNetworkPolicy detaches the network policy programs pinned under pinDir
+// (see AttachNetworkPolicy) from the cgroup referred to by cgroupFd, and
+// removes the pins. Programs that are not pinned or not attached are ignored.
+// If cgroupFd is negative (e.g., the cgroup is gone, which detaches its
+// programs), the pins are just removed.
+func DetachNetworkPolicy(cgroupFd int, pinDir string) error {
+	for _, p := range (NetworkPolicy{}).progs() {
+		if err := detachPinnedProgram(cgroupFd, p.typ, filepath.Join(pinDir, p.name)); err != nil {
+			return errors.Wrapf(err, "failed to detach %s network policy program", p.name)
+		}
+	}
+	if err := os.Remove(pinDir); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove network policy pin dir")
+	}
+	return nil
+}
+
+func attachSKBProgram(cgroupFd int, elf []byte, typ ebpf.AttachType, pinPath string) error {
+	prog, err := loadSKBProgram(elf)
+	if err != nil {
+		return err
+	}
+
+	// the kernel (and the pin) hold references to the attached program, so our
+	// fd to it can be closed
+	defer prog.Close()
+
+	if err := prog.Attach(cgroupFd, typ, ebpf.AttachFlags(unix.BPF_F_ALLOW_MULTI)); err != nil {
+		return errors.Wrapf(err, "failed to call BPF_PROG_ATTACH (%v)", typ)
+	}
+
+	// without the pin, the program can't be detached by another process
+	if err := prog.Pin(pinPath); err != nil {
+		prog.Detach(cgroupFd, typ, 0)
+		return err
+	}
+	return nil
+}
+
+// detachPinnedProgram detaches the program pinned at pinPath from the given
+// cgroup (unless cgroupFd is negative) and removes the pin.
+func detachPinnedProgram(cgroupFd int, typ ebpf.AttachType, pinPath string) error {
+	prog, err := loadPinnedSKBProgram(pinPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer prog.Close()
+
+	if cgroupFd >= 0 {
+		if err := prog.Detach(cgroupFd, typ, 0); err != nil && !errors.Is(err, unix.ENOENT) {
+			return errors.Wrapf(err, "failed to call BPF_PROG_DETACH (%v)", typ)
+		}
+	}
+
+	if err := os.Remove(pinPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// loadSKBProgramELF loads the single cgroup_skb program in the given ELF
+// object (along with the maps it uses).
+func loadSKBProgramELF(elf []byte) (skbProgram, error) {
+	spec, err := ebpf.LoadCollectionSpecFromReader(bytes.NewReader(elf))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse eBPF ELF object")
+	}
+
+	name := ""
+	for n, p := range spec.Programs {
+		if p.Type != ebpf.CGroupSKB {
+			continue
+		}
+		if name != "" {
+			return nil, fmt.Errorf("eBPF ELF object has more than one cgroup_skb program (%s, %s)", name, n)
+		}
+		name = n
+	}
+	if name == "" {
+		return nil, fmt.Errorf("eBPF ELF object has no cgroup_skb program")
+	}
+
+	coll, err := ebpf.NewCollection(spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load eBPF program")
+	}
+
+	// keep the program; the maps it uses stay alive while it references them
+	prog := coll.DetachProgram(name)
+	coll.Close()
+
+	return prog, nil
+}
+
+func loadPinnedSKBProgramFile(pinPath string) (skbProgram, error) {
+	prog, err := ebpf.LoadPinnedProgram(pinPath)
+	if err != nil {
+		return nil, err
+	}
+	return prog, nil
+}
+
+func checkNetworkPolicyKernel() error {
+	rel, err := kernelRelease()
+	if err != nil {
+		return err
+	}
+
+	splits := strings.SplitN(rel, ".", 3)
+	if len(splits) < 2 {
+		return fmt.Errorf("failed to parse kernel release %v", rel)
+	}
+	major, err := strconv.Atoi(splits[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse kernel release %v", rel)
+	}
+	minor, err := strconv.Atoi(splits[1])
+	if err != nil {
+		return fmt.Errorf("failed to parse kernel release %v", rel)
+	}
+
+	if major < netPolicyMinKernel[0] || (major == netPolicyMinKernel[0] && minor < netPolicyMinKernel[1]) {
+		return fmt.Errorf("network policy programs require kernel >= %d.%d (have %s)",
+			netPolicyMinKernel[0], netPolicyMinKernel[1], rel)
+	}
+	return nil
+}
+
+func unameRelease() (string, error) {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return "", err
+	}
+	return unix.ByteSliceToString(uts.Release[:]), nil
+}
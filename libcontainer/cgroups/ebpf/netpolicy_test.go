@@ -0,0 +1,266 @@
+// +build linux
+
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+// mockProgram is a loaded program whose attachments are recorded in a mockBpf
+type mockProgram struct {
+	bpf    *mockBpf
+	elf    string
+	closed bool
+}
+
+func (p *mockProgram) Attach(fd int, typ ebpf.AttachType, flags ebpf.AttachFlags) error {
+	if err := p.bpf.attachErr[typ]; err != nil {
+		return err
+	}
+	if flags != ebpf.AttachFlags(unix.BPF_F_ALLOW_MULTI) {
+		return fmt.Errorf("unexpected attach flags %v", flags)
+	}
+	p.bpf.attached[typ] = p.elf
+	return nil
+}
+
+func (p *mockProgram) Detach(fd int, typ ebpf.AttachType, flags ebpf.AttachFlags) error {
+	if err := p.bpf.detachErr; err != nil {
+		return err
+	}
+	if p.bpf.attached[typ] != p.elf {
+		return unix.ENOENT
+	}
+	delete(p.bpf.attached, typ)
+	return nil
+}
+
+func (p *mockProgram) Pin(fileName string) error {
+	if err := ioutil.WriteFile(fileName, nil, 0600); err != nil {
+		return err
+	}
+	p.bpf.pinned[fileName] = p.elf
+	return nil
+}
+
+func (p *mockProgram) Close() error {
+	p.closed = true
+	return nil
+}
+
+// mockBpf mocks the bpf syscall wrappers, tracking the programs attached to
+// a single cgroup.
+type mockBpf struct {
+	attached  map[ebpf.AttachType]string
+	attachErr map[ebpf.AttachType]error
+	detachErr error
+	pinned    map[string]string
+	progs     []*mockProgram
+}
+
+// setupMockBpf mocks the bpf syscall wrappers and the kernel release; the
+// returned func restores them.
+func setupMockBpf(release string) (*mockBpf, func()) {
+	m := &mockBpf{
+		attached:  make(map[ebpf.AttachType]string),
+		attachErr: make(map[ebpf.AttachType]error),
+		pinned:    make(map[string]string),
+	}
+
+	origLoad, origLoadPinned, origRelease := loadSKBProgram, loadPinnedSKBProgram, kernelRelease
+	restore := func() {
+		loadSKBProgram, loadPinnedSKBProgram, kernelRelease = origLoad, origLoadPinned, origRelease
+	}
+
+	loadSKBProgram = func(elf []byte) (skbProgram, error) {
+		p := &mockProgram{bpf: m, elf: string(elf)}
+		m.progs = append(m.progs, p)
+		return p, nil
+	}
+	loadPinnedSKBProgram = func(pinPath string) (skbProgram, error) {
+		elf, ok := m.pinned[pinPath]
+		if !ok {
+			return nil, fmt.Errorf("get object %s: %w", pinPath, unix.ENOENT)
+		}
+		return &mockProgram{bpf: m, elf: elf}, nil
+	}
+	kernelRelease = func() (string, error) {
+		return release, nil
+	}
+
+	return m, restore
+}
+
+func TestAttachNetworkPolicy(t *testing.T) {
+	m, restore := setupMockBpf("5.4.0-42-generic")
+	defer restore()
+
+	tmpDir, err := ioutil.TempDir("", "netpolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	pinDir := filepath.Join(tmpDir, "pins")
+
+	policy := NetworkPolicy{
+		IngressProgram: []byte("ingress"),
+		EgressProgram:  []byte("egress"),
+	}
+	if err := AttachNetworkPolicy(3, pinDir, policy); err != nil {
+		t.Fatalf("AttachNetworkPolicy: unexpected error: %v", err)
+	}
+
+	want := map[ebpf.AttachType]string{
+		ebpf.AttachCGroupInetIngress: "ingress",
+		ebpf.AttachCGroupInetEgress:  "egress",
+	}
+	if !reflect.DeepEqual(m.attached, want) {
+		t.Errorf("AttachNetworkPolicy: want attached %v; got %v", want, m.attached)
+	}
+
+	wantPinned := map[string]string{
+		filepath.Join(pinDir, "ingress"): "ingress",
+		filepath.Join(pinDir, "egress"):  "egress",
+	}
+	if !reflect.DeepEqual(m.pinned, wantPinned) {
+		t.Errorf("AttachNetworkPolicy: want pinned %v; got %v", wantPinned, m.pinned)
+	}
+
+	for _, p := range m.progs {
+		if !p.closed {
+			t.Errorf("AttachNetworkPolicy: program %q not closed after attach", p.elf)
+		}
+	}
+
+	// programs already pinned are not attached again
+	if err := AttachNetworkPolicy(3, pinDir, policy); err != nil {
+		t.Fatalf("AttachNetworkPolicy: unexpected error on second attach: %v", err)
+	}
+	if len(m.progs) != 2 {
+		t.Errorf("AttachNetworkPolicy: want 2 programs loaded; got %d", len(m.progs))
+	}
+
+	if err := DetachNetworkPolicy(3, pinDir); err != nil {
+		t.Errorf("DetachNetworkPolicy: unexpected error: %v", err)
+	}
+	if len(m.attached) != 0 {
+		t.Errorf("DetachNetworkPolicy: want no attached programs; got %v", m.attached)
+	}
+	if _, err := os.Stat(pinDir); !os.IsNotExist(err) {
+		t.Errorf("DetachNetworkPolicy: want pin dir removed; got %v", err)
+	}
+
+	// detaching programs that are no longer pinned is a no-op
+	if err := DetachNetworkPolicy(3, pinDir); err != nil {
+		t.Errorf("DetachNetworkPolicy: unexpected error on second detach: %v", err)
+	}
+}
+
+func TestAttachNetworkPolicySingleProgram(t *testing.T) {
+	m, restore := setupMockBpf("4.15.0")
+	defer restore()
+
+	pinDir, err := ioutil.TempDir("", "netpolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(pinDir)
+
+	policy := NetworkPolicy{EgressProgram: []byte("egress")}
+	if err := AttachNetworkPolicy(3, pinDir, policy); err != nil {
+		t.Fatalf("AttachNetworkPolicy: unexpected error: %v", err)
+	}
+
+	want := map[ebpf.AttachType]string{ebpf.AttachCGroupInetEgress: "egress"}
+	if !reflect.DeepEqual(m.attached, want) {
+		t.Errorf("AttachNetworkPolicy: want attached %v; got %v", want, m.attached)
+	}
+}
+
+func TestAttachNetworkPolicyRollback(t *testing.T) {
+	m, restore := setupMockBpf("5.10.0")
+	defer restore()
+	m.attachErr[ebpf.AttachCGroupInetEgress] = errors.New("attach failed")
+
+	pinDir, err := ioutil.TempDir("", "netpolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(pinDir)
+
+	policy := NetworkPolicy{
+		IngressProgram: []byte("ingress"),
+		EgressProgram:  []byte("egress"),
+	}
+	if err := AttachNetworkPolicy(3, pinDir, policy); err == nil {
+		t.Errorf("AttachNetworkPolicy: want error")
+	}
+	if len(m.attached) != 0 {
+		t.Errorf("AttachNetworkPolicy: want ingress program detached on failure; got %v", m.attached)
+	}
+	if _, err := os.Stat(filepath.Join(pinDir, "ingress")); !os.IsNotExist(err) {
+		t.Errorf("AttachNetworkPolicy: want ingress program unpinned on failure; got %v", err)
+	}
+}
+
+func TestAttachNetworkPolicyKernel(t *testing.T) {
+	m, restore := setupMockBpf("4.14.0")
+	defer restore()
+
+	policy := NetworkPolicy{IngressProgram: []byte("ingress")}
+	if err := AttachNetworkPolicy(3, "/nonexistent", policy); err == nil {
+		t.Errorf("AttachNetworkPolicy: want error on kernel 4.14")
+	}
+	if len(m.progs) != 0 {
+		t.Errorf("AttachNetworkPolicy: want no programs loaded on kernel 4.14; got %d", len(m.progs))
+	}
+
+	// an empty policy needs no kernel support
+	if err := AttachNetworkPolicy(3, "/nonexistent", NetworkPolicy{}); err != nil {
+		t.Errorf("AttachNetworkPolicy: unexpected error for empty policy: %v", err)
+	}
+}
+
+func TestDetachNetworkPolicyError(t *testing.T) {
+	m, restore := setupMockBpf("5.10.0")
+	defer restore()
+
+	pinDir, err := ioutil.TempDir("", "netpolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(pinDir)
+
+	policy := NetworkPolicy{IngressProgram: []byte("ingress")}
+	if err := AttachNetworkPolicy(3, pinDir, policy); err != nil {
+		t.Fatalf("AttachNetworkPolicy: unexpected error: %v", err)
+	}
+
+	m.detachErr = unix.EPERM
+	if err := DetachNetworkPolicy(3, pinDir); err == nil {
+		t.Errorf("DetachNetworkPolicy: want error")
+	}
+
+	// without the cgroup (e.g., removed), the pins are just removed
+	if err := DetachNetworkPolicy(-1, pinDir); err != nil {
+		t.Errorf("DetachNetworkPolicy: unexpected error without cgroup: %v", err)
+	}
+	if _, err := os.Stat(pinDir); !os.IsNotExist(err) {
+		t.Errorf("DetachNetworkPolicy: want pin dir removed; got %v", err)
+	}
+}
+
+func TestLoadSKBProgramELFInvalid(t *testing.T) {
+	if _, err := loadSKBProgramELF([]byte("not an elf object")); err == nil {
+		t.Errorf("loadSKBProgramELF: want error for invalid ELF object")
+	}
+}
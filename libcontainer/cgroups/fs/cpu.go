@@ -6,11 +6,13 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/sirupsen/logrus"
 )
 
 type CpuGroup struct {
@@ -82,9 +84,27 @@ func (s *CpuGroup) Set(path string, cgroup *configs.Cgroup) error {
 			return err
 		}
 	}
+	if cgroup.Resources.CpuBurst != 0 {
+		if err := s.setCpuBurst(path, cgroup.Resources.CpuBurst); err != nil {
+			return err
+		}
+	}
 	return s.SetRtSched(path, cgroup)
 }
 
+// setCpuBurst sets the cpu burst allowance; cpu.cfs_burst_us is only present
+// in kernels >= 5.14 (or patched ones), so it's skipped if not present.
+func (s *CpuGroup) setCpuBurst(path string, burst uint64) error {
+	if _, err := os.Stat(filepath.Join(path, "cpu.cfs_burst_us")); err != nil {
+		if os.IsNotExist(err) {
+			logrus.Debugf("cpu.cfs_burst_us not supported by the kernel; ignoring cpu burst setting")
+			return nil
+		}
+		return err
+	}
+	return fscommon.WriteFile(path, "cpu.cfs_burst_us", strconv.FormatUint(burst, 10))
+}
+
 func (s *CpuGroup) GetStats(path string, stats *cgroups.Stats) error {
 	f, err := fscommon.OpenFile(path, "cpu.stat", os.O_RDONLY)
 	if err != nil {
@@ -110,6 +130,13 @@ func (s *CpuGroup) GetStats(path string, stats *cgroups.Stats) error {
 
 		case "throttled_time":
 			stats.CpuStats.ThrottlingData.ThrottledTime = v
+
+		case "nr_bursts":
+			stats.CpuStats.Bursts = v
+
+		case "burst_time":
+			// reported in nsecs
+			stats.CpuStats.BurstUs = v / 1000
 		}
 	}
 	return nil
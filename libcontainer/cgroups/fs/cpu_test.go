@@ -4,6 +4,8 @@ package fs
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 
@@ -133,6 +135,72 @@ func TestCpuStats(t *testing.T) {
 	expectThrottlingDataEquals(t, expectedStats, actualStats.CpuStats.ThrottlingData)
 }
 
+func TestCpuSetBurst(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+
+	const (
+		burstBefore = 0
+		burstAfter  = 20000
+	)
+
+	helper.writeFileContents(map[string]string{
+		"cpu.cfs_burst_us": strconv.Itoa(burstBefore),
+	})
+
+	helper.CgroupData.config.Resources.CpuBurst = burstAfter
+	cpu := &CpuGroup{}
+	if err := cpu.Set(helper.CgroupPath, helper.CgroupData.config); err != nil {
+		t.Fatal(err)
+	}
+
+	burst, err := fscommon.GetCgroupParamUint(helper.CgroupPath, "cpu.cfs_burst_us")
+	if err != nil {
+		t.Fatalf("Failed to parse cpu.cfs_burst_us - %s", err)
+	}
+	if burst != burstAfter {
+		t.Fatal("Got the wrong value, set cpu.cfs_burst_us failed.")
+	}
+}
+
+func TestCpuSetBurstNotSupported(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+
+	helper.CgroupData.config.Resources.CpuBurst = 20000
+	cpu := &CpuGroup{}
+	if err := cpu.Set(helper.CgroupPath, helper.CgroupData.config); err != nil {
+		t.Fatalf("Expected cpu burst to be ignored when not supported, but got %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(helper.CgroupPath, "cpu.cfs_burst_us")); !os.IsNotExist(err) {
+		t.Fatal("cpu.cfs_burst_us should not have been created.")
+	}
+}
+
+func TestCpuBurstStats(t *testing.T) {
+	helper := NewCgroupTestUtil("cpu", t)
+	defer helper.cleanup()
+
+	cpuStatContent := "nr_periods 2000\nnr_throttled 200\nthrottled_time 1000\nnr_bursts 15\nburst_time 3000000\n"
+	helper.writeFileContents(map[string]string{
+		"cpu.stat": cpuStatContent,
+	})
+
+	cpu := &CpuGroup{}
+	actualStats := *cgroups.NewStats()
+	if err := cpu.GetStats(helper.CgroupPath, &actualStats); err != nil {
+		t.Fatal(err)
+	}
+
+	if actualStats.CpuStats.Bursts != 15 {
+		t.Errorf("Expected 15 bursts, got %d", actualStats.CpuStats.Bursts)
+	}
+	if actualStats.CpuStats.BurstUs != 3000 {
+		t.Errorf("Expected 3000 burst usecs, got %d", actualStats.CpuStats.BurstUs)
+	}
+}
+
 func TestNoCpuStatFile(t *testing.T) {
 	helper := NewCgroupTestUtil("cpu", t)
 	defer helper.cleanup()
@@ -39,9 +39,38 @@ func (s *CpusetGroup) Set(path string, cgroup *configs.Cgroup) error {
 			return err
 		}
 	}
+	if cgroup.Resources.CpusetCpusExclusive {
+		if err := s.setCpuExclusive(path, cgroup.Resources.CpusetCpus); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// setCpuExclusive marks the cgroup's cpus as exclusive. The kernel requires
+// that the cpus be a subset of the parent's cpus, so we check this first to
+// provide a meaningful error.
+func (s *CpusetGroup) setCpuExclusive(path, cpus string) error {
+	if cpus == "" {
+		var err error
+		cpus, err = fscommon.GetCgroupParamString(path, "cpuset.cpus")
+		if err != nil {
+			return err
+		}
+	}
+
+	parentCpus, err := fscommon.GetCgroupParamString(filepath.Dir(path), "cpuset.cpus")
+	if err != nil {
+		return err
+	}
+
+	if err := fscommon.CheckCpusetSubset(cpus, parentCpus); err != nil {
+		return fmt.Errorf("invalid exclusive cpuset %q: %v", cpus, err)
+	}
+
+	return fscommon.WriteFile(path, "cpuset.cpu_exclusive", "1")
+}
+
 func (s *CpusetGroup) Clone(source, dest string) error {
 
 	// For the cpuset cgroup, cloning is done by simply setting cgroup.clone_children on the source
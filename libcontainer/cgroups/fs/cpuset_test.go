@@ -96,6 +96,64 @@ func TestCPUSetSetMems(t *testing.T) {
 	}
 }
 
+func TestCPUSetSetCpuExclusive(t *testing.T) {
+	helper := NewCgroupTestUtil("cpuset", t)
+	defer helper.cleanup()
+
+	if err := fscommon.WriteFile(helper.tempDir, "cpuset.cpus", "0-7"); err != nil {
+		t.Fatal(err)
+	}
+	helper.writeFileContents(map[string]string{
+		"cpuset.cpus":          "0",
+		"cpuset.cpu_exclusive": "0",
+	})
+
+	helper.CgroupData.config.Resources.CpusetCpus = "2-3"
+	helper.CgroupData.config.Resources.CpusetCpusExclusive = true
+	cpuset := &CpusetGroup{}
+	if err := cpuset.Set(helper.CgroupPath, helper.CgroupData.config); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := fscommon.GetCgroupParamString(helper.CgroupPath, "cpuset.cpu_exclusive")
+	if err != nil {
+		t.Fatalf("Failed to parse cpuset.cpu_exclusive - %s", err)
+	}
+
+	if value != "1" {
+		t.Fatal("Got the wrong value, set cpuset.cpu_exclusive failed.")
+	}
+}
+
+func TestCPUSetSetCpuExclusiveNotSubset(t *testing.T) {
+	helper := NewCgroupTestUtil("cpuset", t)
+	defer helper.cleanup()
+
+	if err := fscommon.WriteFile(helper.tempDir, "cpuset.cpus", "0-3"); err != nil {
+		t.Fatal(err)
+	}
+	helper.writeFileContents(map[string]string{
+		"cpuset.cpus":          "0",
+		"cpuset.cpu_exclusive": "0",
+	})
+
+	helper.CgroupData.config.Resources.CpusetCpus = "2-5"
+	helper.CgroupData.config.Resources.CpusetCpusExclusive = true
+	cpuset := &CpusetGroup{}
+	if err := cpuset.Set(helper.CgroupPath, helper.CgroupData.config); err == nil {
+		t.Fatal("Expected failure when exclusive cpus are not a subset of the parent's cpus.")
+	}
+
+	value, err := fscommon.GetCgroupParamString(helper.CgroupPath, "cpuset.cpu_exclusive")
+	if err != nil {
+		t.Fatalf("Failed to parse cpuset.cpu_exclusive - %s", err)
+	}
+
+	if value != "0" {
+		t.Fatal("cpuset.cpu_exclusive should not have been set.")
+	}
+}
+
 func TestCPUSetStatsCorrect(t *testing.T) {
 	helper := NewCgroupTestUtil("cpuset", t)
 	defer helper.cleanup()
@@ -8,13 +8,16 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	libcontainerUtils "github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 )
 
@@ -261,10 +264,46 @@ func (m *manager) CreateChildCgroup(config *configs.Config) error {
 		}
 	}
 
+	if err := m.setChildCgroupLimits(paths); err != nil {
+		return err
+	}
+
 	m.childCgroupCreated = true
 	return nil
 }
 
+// setChildCgroupLimits sets the memory and pids limits of the child cgroup to
+// those of the container (see cgroups.ScaleResourcesForInner), so that they are
+// visible to cgroup managers inside the container (e.g., when sizing inner
+// containers). The child cgroup will hold all of the container's processes,
+// so no pids are accounted as used. Cpusets are cloned from the parent.
+func (m *manager) setChildCgroupLimits(paths map[string]string) error {
+	if m.cgroups == nil || m.cgroups.Resources == nil {
+		return nil
+	}
+
+	limits, err := cgroups.ScaleResourcesForInner(m.cgroups.Resources, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	if path := paths["memory"]; path != "" && limits.Memory > 0 {
+		childPath := filepath.Join(path, cgroups.SyscontCgroupRoot)
+		if err := fscommon.WriteFile(childPath, "memory.limit_in_bytes", strconv.FormatInt(limits.Memory, 10)); err != nil {
+			return fmt.Errorf("failed to set memory limit of child cgroup %s: %v", childPath, err)
+		}
+	}
+
+	if path := paths["pids"]; path != "" && limits.PidsLimit > 0 {
+		childPath := filepath.Join(path, cgroups.SyscontCgroupRoot)
+		if err := fscommon.WriteFile(childPath, "pids.max", strconv.FormatInt(limits.PidsLimit, 10)); err != nil {
+			return fmt.Errorf("failed to set pids limit of child cgroup %s: %v", childPath, err)
+		}
+	}
+
+	return nil
+}
+
 func (m *manager) Apply(pid int) (err error) {
 	if m.cgroups == nil {
 		return nil
@@ -298,6 +337,10 @@ func (m *manager) Apply(pid int) (err error) {
 	}
 
 	for _, sys := range subsystems {
+		if c.IsSubsystemExcluded(sys.Name()) {
+			logrus.Debugf("skipping excluded cgroup subsystem %s", sys.Name())
+			continue
+		}
 		p, err := d.path(sys.Name())
 		if err != nil {
 			// The non-presence of the devices subsystem is
@@ -371,7 +414,7 @@ func (m *manager) GetStats() (*cgroups.Stats, error) {
 	stats := cgroups.NewStats()
 	for _, sys := range subsystems {
 		path := m.paths[sys.Name()]
-		if path == "" {
+		if path == "" || m.cgroups.IsSubsystemExcluded(sys.Name()) {
 			continue
 		}
 		if err := sys.GetStats(path, stats); err != nil {
@@ -436,6 +479,45 @@ func (m *manager) Freeze(state configs.FreezerState) error {
 	return nil
 }
 
+func (m *manager) UpdateChildCgroups(container *configs.Config) error {
+	if container.Cgroups == nil {
+		return nil
+	}
+
+	// If Paths are set, then we are just joining cgroups paths
+	// and there is no need to set any values.
+	if m.cgroups != nil && m.cgroups.Paths != nil {
+		return nil
+	}
+
+	paths := m.GetChildCgroupPaths()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, sys := range subsystems {
+		path, ok := paths[sys.Name()]
+		if !ok {
+			continue
+		}
+		// The child cgroup may not exist (e.g., it has not been created yet)
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if err := sys.Set(path, container.Cgroups); err != nil {
+			if m.rootless && sys.Name() == "devices" {
+				continue
+			}
+			return fmt.Errorf("failed to update child cgroup %s: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
 func (m *manager) GetPids() ([]int, error) {
 	// sysbox-runc: return the pids starting from the system container root
 	// (all sys container pids start at this level)
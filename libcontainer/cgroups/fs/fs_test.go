@@ -3,11 +3,13 @@
 package fs
 
 import (
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 )
 
@@ -104,3 +106,86 @@ func TestTryDefaultCgroupRoot(t *testing.T) {
 		t.Errorf("tryDefaultCgroupRoot: want %q, got %q", exp, res)
 	}
 }
+
+func TestUpdateChildCgroups(t *testing.T) {
+	helper := NewCgroupTestUtil("pids", t)
+	defer helper.cleanup()
+
+	childPath := filepath.Join(helper.CgroupPath, cgroups.SyscontCgroupRoot)
+	if err := os.MkdirAll(childPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fscommon.WriteFile(childPath, "pids.max", "max"); err != nil {
+		t.Fatal(err)
+	}
+
+	helper.CgroupData.config.Resources.PidsLimit = 42
+
+	paths := map[string]string{"pids": helper.CgroupPath}
+	m := NewManager(helper.CgroupData.config, paths, false)
+	config := &configs.Config{Cgroups: helper.CgroupData.config}
+
+	if err := m.UpdateChildCgroups(config); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := fscommon.GetCgroupParamString(childPath, "pids.max")
+	if err != nil {
+		t.Fatalf("Failed to parse pids.max - %s", err)
+	}
+	if value != "42" {
+		t.Fatalf("Got the wrong value (%s), child cgroup pids.max update failed.", value)
+	}
+}
+
+func TestUpdateChildCgroupsNoChild(t *testing.T) {
+	helper := NewCgroupTestUtil("pids", t)
+	defer helper.cleanup()
+
+	helper.CgroupData.config.Resources.PidsLimit = 42
+
+	paths := map[string]string{"pids": helper.CgroupPath}
+	m := NewManager(helper.CgroupData.config, paths, false)
+	config := &configs.Config{Cgroups: helper.CgroupData.config}
+
+	if err := m.UpdateChildCgroups(config); err != nil {
+		t.Fatalf("Expected no failure when child cgroup does not exist, but got %s", err)
+	}
+
+	childPath := filepath.Join(helper.CgroupPath, cgroups.SyscontCgroupRoot)
+	if _, err := os.Stat(childPath); !os.IsNotExist(err) {
+		t.Fatal("Child cgroup should not have been created.")
+	}
+}
+
+func TestExcludedSubsystems(t *testing.T) {
+	if cgroups.IsCgroup2UnifiedMode() {
+		t.Skip("cgroup v2 is not supported")
+	}
+
+	c := &configs.Cgroup{
+		Path:               "/sysbox-runc-test-excluded-subsystems",
+		Resources:          &configs.Resources{},
+		ExcludedSubsystems: []string{"hugetlb", "blkio"},
+	}
+
+	m := NewManager(c, nil, false)
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Destroy()
+
+	paths := m.GetPaths()
+	for _, s := range c.ExcludedSubsystems {
+		if _, ok := paths[s]; ok {
+			t.Errorf("excluded subsystem %s found in cgroup paths %v", s, paths)
+		}
+	}
+	if _, ok := paths["devices"]; !ok {
+		t.Errorf("devices subsystem not found in cgroup paths %v", paths)
+	}
+
+	if _, err := m.GetStats(); err != nil {
+		t.Errorf("failed to get stats: %v", err)
+	}
+}
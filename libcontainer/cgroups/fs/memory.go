@@ -183,6 +183,9 @@ func (s *MemoryGroup) GetStats(path string, stats *cgroups.Stats) error {
 		return err
 	}
 	stats.MemoryStats.Usage = memoryUsage
+	// cgroup v1 has no memory.events; the closest equivalent of the oom
+	// counter is the number of times the memory limit was hit.
+	stats.MemoryStats.Events.Oom = memoryUsage.Failcnt
 	swapUsage, err := getMemoryData(path, "memsw")
 	if err != nil {
 		return err
@@ -213,6 +216,14 @@ func (s *MemoryGroup) GetStats(path string, stats *cgroups.Stats) error {
 	}
 	stats.MemoryStats.PageUsageByNUMA = pagesByNUMA
 
+	// the values in memory.numa_stat are in pages on cgroup v1
+	numaStat, err := fscommon.ParseNUMAStat(path)
+	if err == nil {
+		stats.MemoryStats.NUMAStats = cgroups.NUMAStatsFromValues(numaStat, uint64(os.Getpagesize()))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
 	return nil
 }
 
@@ -226,6 +237,43 @@ func memoryAssigned(cgroup *configs.Cgroup) bool {
 		(cgroup.Resources.MemorySwappiness != nil && int64(*cgroup.Resources.MemorySwappiness) != -1)
 }
 
+// ReadMemoryEvents parses the cgroup v2 memory.events file in the given cgroup
+// path. Unknown keys are ignored.
+func ReadMemoryEvents(path string) (cgroups.MemoryEvents, error) {
+	events := cgroups.MemoryEvents{}
+
+	f, err := fscommon.OpenFile(path, "memory.events", os.O_RDONLY)
+	if err != nil {
+		return events, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		k, v, err := fscommon.GetCgroupParamKeyValue(sc.Text())
+		if err != nil {
+			return events, fmt.Errorf("failed to parse memory.events (%q) - %v", sc.Text(), err)
+		}
+		switch k {
+		case "low":
+			events.Low = v
+		case "high":
+			events.High = v
+		case "max":
+			events.Max = v
+		case "oom":
+			events.Oom = v
+		case "oom_kill":
+			events.OomKill = v
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return events, err
+	}
+
+	return events, nil
+}
+
 func getMemoryData(path, name string) (cgroups.MemoryData, error) {
 	memoryData := cgroups.MemoryData{}
 
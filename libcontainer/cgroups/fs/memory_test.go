@@ -3,6 +3,8 @@
 package fs
 
 import (
+	"os"
+	"reflect"
 	"strconv"
 	"testing"
 
@@ -298,6 +300,7 @@ func TestMemoryStats(t *testing.T) {
 		t.Fatal(err)
 	}
 	expectedStats := cgroups.MemoryStats{Cache: 512, Usage: cgroups.MemoryData{Usage: 2048, MaxUsage: 4096, Failcnt: 100, Limit: 8192}, SwapUsage: cgroups.MemoryData{Usage: 2048, MaxUsage: 4096, Failcnt: 100, Limit: 8192}, KernelUsage: cgroups.MemoryData{Usage: 2048, MaxUsage: 4096, Failcnt: 100, Limit: 8192}, Stats: map[string]uint64{"cache": 512, "rss": 1024}, UseHierarchy: true,
+		Events: cgroups.MemoryEvents{Oom: 100},
 		PageUsageByNUMA: cgroups.PageUsageByNUMA{
 			PageUsageByNUMAInner: cgroups.PageUsageByNUMAInner{
 				Total:       cgroups.PageStats{Total: 44611, Nodes: map[uint8]uint64{0: 32631, 1: 7501, 2: 1982, 3: 2497}},
@@ -313,6 +316,18 @@ func TestMemoryStats(t *testing.T) {
 			},
 		}}
 	expectMemoryStatEquals(t, expectedStats, actualStats.MemoryStats)
+
+	// the NUMA stats are in pages on cgroup v1; they're reported in bytes
+	pageSize := uint64(os.Getpagesize())
+	expectedNUMAStats := map[int]cgroups.NUMANodeStat{
+		0: {Anon: 17 * pageSize, File: 32614 * pageSize},
+		1: {Anon: 166 * pageSize, File: 7335 * pageSize},
+		2: {File: 1982 * pageSize},
+		3: {File: 2497 * pageSize},
+	}
+	if !reflect.DeepEqual(actualStats.MemoryStats.NUMAStats, expectedNUMAStats) {
+		t.Errorf("Expected NUMA stats %+v, but found %+v", expectedNUMAStats, actualStats.MemoryStats.NUMAStats)
+	}
 }
 
 func TestMemoryStatsNoStatFile(t *testing.T) {
@@ -515,3 +530,37 @@ func TestWithoutNumaStat(t *testing.T) {
 	}
 	expectPageUsageByNUMAEquals(t, cgroups.PageUsageByNUMA{}, actualStats)
 }
+
+func TestReadMemoryEvents(t *testing.T) {
+	helper := NewCgroupTestUtil("memory", t)
+	defer helper.cleanup()
+	helper.writeFileContents(map[string]string{
+		"memory.events": "low 1\nhigh 22\nmax 333\noom 4\noom_kill 5\noom_group_kill 0\n",
+	})
+
+	events, err := ReadMemoryEvents(helper.CgroupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := cgroups.MemoryEvents{Low: 1, High: 22, Max: 333, Oom: 4, OomKill: 5}
+	if events != expected {
+		t.Errorf("Expected memory events %+v, but found %+v", expected, events)
+	}
+
+	helper.writeFileContents(map[string]string{
+		"memory.events": "low 1\nhigh\n",
+	})
+	if _, err := ReadMemoryEvents(helper.CgroupPath); err == nil {
+		t.Error("Expected failure parsing invalid memory.events")
+	}
+}
+
+func TestReadMemoryEventsNoFile(t *testing.T) {
+	helper := NewCgroupTestUtil("memory", t)
+	defer helper.cleanup()
+
+	if _, err := ReadMemoryEvents(helper.CgroupPath); !os.IsNotExist(err) {
+		t.Errorf("Expected not-exist error, got %v", err)
+	}
+}
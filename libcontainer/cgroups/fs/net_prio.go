@@ -5,6 +5,7 @@ package fs
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
@@ -33,6 +34,33 @@ func (s *NetPrioGroup) Set(path string, cgroup *configs.Cgroup) error {
 }
 
 func (s *NetPrioGroup) GetStats(path string, stats *cgroups.Stats) error {
+	if !cgroups.PathExists(path) {
+		return nil
+	}
+	prioidx, err := fscommon.GetCgroupParamUint(path, "net_prio.prioidx")
+	if err != nil {
+		return fmt.Errorf("failed to parse net_prio.prioidx - %s", err)
+	}
+
+	ifpriomap, err := fscommon.ReadFile(path, "net_prio.ifpriomap")
+	if err != nil {
+		return fmt.Errorf("failed to read net_prio.ifpriomap - %s", err)
+	}
+
+	prios := make(map[string]uint32)
+	for _, line := range strings.Split(ifpriomap, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		iface, prio, err := fscommon.GetCgroupParamKeyValue(line)
+		if err != nil {
+			return fmt.Errorf("failed to parse net_prio.ifpriomap - %s", err)
+		}
+		prios[iface] = uint32(prio)
+	}
+
+	stats.NetPrioStats.Prioidx = prioidx
+	stats.NetPrioStats.Ifpriomap = prios
 	return nil
 }
 
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 )
@@ -37,3 +38,49 @@ func TestNetPrioSetIfPrio(t *testing.T) {
 		t.Fatal("Got the wrong value, set net_prio.ifpriomap failed.")
 	}
 }
+
+func TestNetPrioStats(t *testing.T) {
+	helper := NewCgroupTestUtil("net_prio", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"net_prio.prioidx":   "3",
+		"net_prio.ifpriomap": "lo 0\neth0 5\neth1 2\n",
+	})
+
+	netPrio := &NetPrioGroup{}
+	stats := *cgroups.NewStats()
+	if err := netPrio.GetStats(helper.CgroupPath, &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.NetPrioStats.Prioidx != 3 {
+		t.Fatalf("Expected 3, got %d for net_prio.prioidx", stats.NetPrioStats.Prioidx)
+	}
+
+	expected := map[string]uint32{"lo": 0, "eth0": 5, "eth1": 2}
+	if len(stats.NetPrioStats.Ifpriomap) != len(expected) {
+		t.Fatalf("Expected %v, got %v for net_prio.ifpriomap", expected, stats.NetPrioStats.Ifpriomap)
+	}
+	for iface, prio := range expected {
+		if got, ok := stats.NetPrioStats.Ifpriomap[iface]; !ok || got != prio {
+			t.Fatalf("Expected %v, got %v for net_prio.ifpriomap", expected, stats.NetPrioStats.Ifpriomap)
+		}
+	}
+}
+
+func TestNetPrioStatsInvalid(t *testing.T) {
+	helper := NewCgroupTestUtil("net_prio", t)
+	defer helper.cleanup()
+
+	helper.writeFileContents(map[string]string{
+		"net_prio.prioidx":   "3",
+		"net_prio.ifpriomap": "eth0 high\n",
+	})
+
+	netPrio := &NetPrioGroup{}
+	stats := *cgroups.NewStats()
+	if err := netPrio.GetStats(helper.CgroupPath, &stats); err == nil {
+		t.Fatal("Expected failure parsing an invalid net_prio.ifpriomap")
+	}
+}
@@ -80,6 +80,10 @@ func expectMemoryStatEquals(t *testing.T, expected, actual cgroups.MemoryStats)
 		t.Errorf("Expected memory use hierarchy %v, but found %v\n", expected.UseHierarchy, actual.UseHierarchy)
 	}
 
+	if expected.Events != actual.Events {
+		t.Errorf("Expected memory events %+v, but found %+v\n", expected.Events, actual.Events)
+	}
+
 	for key, expValue := range expected.Stats {
 		actValue, ok := actual.Stats[key]
 		if !ok {
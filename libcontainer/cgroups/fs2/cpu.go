@@ -4,14 +4,22 @@ package fs2
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 )
 
+// The kernel rejects cpu.max quotas below 1ms
+const minCpuQuota = 1000
+
+// The cpu.max period when none is given (see the cgroup v2 docs)
+const defaultCpuPeriod = 100000
+
 func isCpuSet(cgroup *configs.Cgroup) bool {
 	return cgroup.Resources.CpuWeight != 0 || cgroup.Resources.CpuQuota != 0 || cgroup.Resources.CpuPeriod != 0
 }
@@ -32,13 +40,16 @@ func setCpu(dirPath string, cgroup *configs.Cgroup) error {
 	if r.CpuQuota != 0 || r.CpuPeriod != 0 {
 		str := "max"
 		if r.CpuQuota > 0 {
+			if r.CpuQuota < minCpuQuota {
+				return fmt.Errorf("cpu quota %d is below the minimum of %d", r.CpuQuota, minCpuQuota)
+			}
 			str = strconv.FormatInt(r.CpuQuota, 10)
 		}
 		period := r.CpuPeriod
 		if period == 0 {
 			// This default value is documented in
 			// https://www.kernel.org/doc/html/latest/admin-guide/cgroup-v2.html
-			period = 100000
+			period = defaultCpuPeriod
 		}
 		str += " " + strconv.FormatUint(period, 10)
 		if err := fscommon.WriteFile(dirPath, "cpu.max", str); err != nil {
@@ -48,6 +59,40 @@ func setCpu(dirPath string, cgroup *configs.Cgroup) error {
 
 	return nil
 }
+
+// getCpuMax returns the quota (-1 if unlimited) and period in the cpu.max
+// file, which has the format "<quota> [<period>]", where the quota may be
+// "max".
+func getCpuMax(dirPath string) (int64, uint64, error) {
+	str, err := fscommon.ReadFile(dirPath, "cpu.max")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fields := strings.Fields(str)
+	if len(fields) < 1 || len(fields) > 2 {
+		return 0, 0, fmt.Errorf("invalid cpu.max value %q", str)
+	}
+
+	quota := int64(-1)
+	if fields[0] != "max" {
+		quota, err = strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid cpu.max quota %q", fields[0])
+		}
+	}
+
+	period := uint64(defaultCpuPeriod)
+	if len(fields) == 2 {
+		period, err = strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid cpu.max period %q", fields[1])
+		}
+	}
+
+	return quota, period, nil
+}
+
 func statCpu(dirPath string, stats *cgroups.Stats) error {
 	f, err := fscommon.OpenFile(dirPath, "cpu.stat", os.O_RDONLY)
 	if err != nil {
@@ -72,5 +117,17 @@ func statCpu(dirPath string, stats *cgroups.Stats) error {
 			stats.CpuStats.CpuUsage.UsageInKernelmode = v * 1000
 		}
 	}
+
+	// cpu.max is not present in the root cgroup
+	quota, period, err := getCpuMax(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	stats.CpuStats.Quota = quota
+	stats.CpuStats.Period = period
+
 	return nil
 }
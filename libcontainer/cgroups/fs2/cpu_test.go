@@ -0,0 +1,152 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestSetCpuMax(t *testing.T) {
+	cases := []struct {
+		quota    int64
+		period   uint64
+		expected string
+		expErr   bool
+	}{
+		{quota: 200000, period: 100000, expected: "200000 100000"},
+		{quota: 50000, expected: "50000 100000"},
+		{quota: 1000, period: 10000, expected: "1000 10000"},
+		{quota: -1, period: 50000, expected: "max 50000"},
+		{period: 50000, expected: "max 50000"},
+		// below the kernel minimum
+		{quota: 999, period: 100000, expErr: true},
+		{quota: 1, expErr: true},
+	}
+
+	for _, c := range cases {
+		dir, err := ioutil.TempDir("", "fs2_cpu_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		if err := fscommon.WriteFile(dir, "cpu.max", "unset"); err != nil {
+			t.Fatal(err)
+		}
+
+		cgroup := &configs.Cgroup{
+			Resources: &configs.Resources{
+				CpuQuota:  c.quota,
+				CpuPeriod: c.period,
+			},
+		}
+
+		err = setCpu(dir, cgroup)
+		if c.expErr {
+			if err == nil {
+				t.Errorf("setCpu(%+v): expected error", c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("setCpu(%+v): unexpected error: %v", c, err)
+			continue
+		}
+
+		val, err := fscommon.ReadFile(dir, "cpu.max")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(val) != c.expected {
+			t.Errorf("setCpu(%+v): want cpu.max %q, got %q", c, c.expected, val)
+		}
+	}
+}
+
+func TestGetCpuMax(t *testing.T) {
+	cases := []struct {
+		content string
+		quota   int64
+		period  uint64
+		expErr  bool
+	}{
+		{content: "200000 100000\n", quota: 200000, period: 100000},
+		{content: "max 100000\n", quota: -1, period: 100000},
+		{content: "50000 250000\n", quota: 50000, period: 250000},
+		{content: "max\n", quota: -1, period: 100000},
+		{content: "lots 100000\n", expErr: true},
+		{content: "50000 often\n", expErr: true},
+		{content: "\n", expErr: true},
+	}
+
+	for _, c := range cases {
+		dir, err := ioutil.TempDir("", "fs2_cpu_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		if err := ioutil.WriteFile(dir+"/cpu.max", []byte(c.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		quota, period, err := getCpuMax(dir)
+		if c.expErr {
+			if err == nil {
+				t.Errorf("getCpuMax(%q): expected error", c.content)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("getCpuMax(%q): unexpected error: %v", c.content, err)
+			continue
+		}
+		if quota != c.quota || period != c.period {
+			t.Errorf("getCpuMax(%q): want (%d, %d), got (%d, %d)", c.content, c.quota, c.period, quota, period)
+		}
+	}
+}
+
+func TestStatCpu(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs2_cpu_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cpuStat := "usage_usec 2000\nuser_usec 1500\nsystem_usec 500\n"
+	if err := ioutil.WriteFile(dir+"/cpu.stat", []byte(cpuStat), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// no cpu.max (e.g., the root cgroup)
+	stats := cgroups.NewStats()
+	if err := statCpu(dir, stats); err != nil {
+		t.Fatalf("statCpu: unexpected error: %v", err)
+	}
+	if stats.CpuStats.CpuUsage.TotalUsage != 2000000 {
+		t.Errorf("statCpu: want total usage 2000000, got %d", stats.CpuStats.CpuUsage.TotalUsage)
+	}
+	if stats.CpuStats.Quota != 0 || stats.CpuStats.Period != 0 {
+		t.Errorf("statCpu: want no quota without cpu.max, got (%d, %d)", stats.CpuStats.Quota, stats.CpuStats.Period)
+	}
+
+	if err := ioutil.WriteFile(dir+"/cpu.max", []byte("200000 100000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stats = cgroups.NewStats()
+	if err := statCpu(dir, stats); err != nil {
+		t.Fatalf("statCpu: unexpected error: %v", err)
+	}
+	if stats.CpuStats.Quota != 200000 || stats.CpuStats.Period != 100000 {
+		t.Errorf("statCpu: want quota (200000, 100000), got (%d, %d)", stats.CpuStats.Quota, stats.CpuStats.Period)
+	}
+}
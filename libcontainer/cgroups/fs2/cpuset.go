@@ -3,8 +3,14 @@
 package fs2
 
 import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"golang.org/x/sys/unix"
 )
 
 func isCpusetSet(cgroup *configs.Cgroup) bool {
@@ -26,5 +32,59 @@ func setCpuset(dirPath string, cgroup *configs.Cgroup) error {
 			return err
 		}
 	}
+	if cgroup.Resources.CpusetCpusExclusive && cgroup.Resources.CpusetCpus != "" {
+		if err := setCpusetExclusive(dirPath, cgroup.Resources.CpusetCpus); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// setCpusetExclusive writes the cgroup's cpus to cpuset.cpus.exclusive. This
+// is only supported on kernels >= 5.14; on older kernels the request is
+// rejected rather than silently ignored.
+func setCpusetExclusive(dirPath, cpus string) error {
+	supported, err := cpusetExclusiveSupported()
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return fmt.Errorf("exclusive cpusets require kernel >= 5.14")
+	}
+
+	parentCpus, err := fscommon.GetCgroupParamString(filepath.Dir(dirPath), "cpuset.cpus.effective")
+	if err != nil {
+		return err
+	}
+
+	if err := fscommon.CheckCpusetSubset(cpus, parentCpus); err != nil {
+		return fmt.Errorf("invalid exclusive cpuset %q: %v", cpus, err)
+	}
+
+	return fscommon.WriteFile(dirPath, "cpuset.cpus.exclusive", cpus)
+}
+
+func cpusetExclusiveSupported() (bool, error) {
+	var uts unix.Utsname
+
+	if err := unix.Uname(&uts); err != nil {
+		return false, err
+	}
+
+	rel := unix.ByteSliceToString(uts.Release[:])
+	splits := strings.SplitN(rel, ".", 3)
+	if len(splits) < 2 {
+		return false, fmt.Errorf("failed to parse kernel release %v", rel)
+	}
+
+	major, err := strconv.Atoi(splits[0])
+	if err != nil {
+		return false, fmt.Errorf("failed to parse kernel release %v", rel)
+	}
+	minor, err := strconv.Atoi(splits[1])
+	if err != nil {
+		return false, fmt.Errorf("failed to parse kernel release %v", rel)
+	}
+
+	return major > 5 || (major == 5 && minor >= 14), nil
+}
@@ -151,3 +151,51 @@ func CreateCgroupPath(path string, c *configs.Cgroup) (Err error) {
 
 	return nil
 }
+
+// Controllers that must be delegated to the sys container so that it can
+// create cgroups for inner containers.
+var delegatedControllers = []string{"cpuset", "memory", "pids", "cpu"}
+
+// ValidateDelegation checks that the controllers required by the sys container
+// are available in its cgroup at the given path (i.e., listed in its
+// cgroup.controllers, as enabled in the parent's cgroup.subtree_control).
+// Controllers that the parent itself doesn't have are not required.
+func ValidateDelegation(path string) error {
+	readControllers := func(dir string) (map[string]bool, error) {
+		content, err := fscommon.ReadFile(dir, "cgroup.controllers")
+		if err != nil {
+			return nil, err
+		}
+		ctrs := make(map[string]bool)
+		for _, c := range strings.Fields(content) {
+			ctrs[c] = true
+		}
+		return ctrs, nil
+	}
+
+	parent := filepath.Dir(path)
+
+	avail, err := readControllers(parent)
+	if err != nil {
+		return err
+	}
+	delegated, err := readControllers(path)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, c := range delegatedControllers {
+		if avail[c] && !delegated[c] {
+			missing = append(missing, c)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("cgroup %s does not delegate controllers %v to the container; "+
+			"enable them with 'echo \"+%s\" > %s' (and set Delegate=yes on the systemd unit)",
+			parent, missing, strings.Join(missing, " +"), filepath.Join(parent, "cgroup.subtree_control"))
+	}
+
+	return nil
+}
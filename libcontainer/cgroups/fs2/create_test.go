@@ -0,0 +1,58 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateDelegation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs2_delegation_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "container")
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var delegationTests = []struct {
+		parentCtrl string // the parent's cgroup.controllers
+		ctrl       string // the container's cgroup.controllers
+		expectErr  bool
+	}{
+		{"cpuset cpu io memory pids", "cpuset cpu io memory pids", false},
+		{"cpuset cpu io memory pids", "cpu memory pids cpuset", false},
+		{"cpu memory pids", "cpu memory pids", false},
+		{"cpuset cpu io memory pids", "cpu memory", true},
+		{"cpu memory", "", true},
+		{"io", "", false},
+	}
+
+	for _, dt := range delegationTests {
+		if err := ioutil.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte(dt.parentCtrl+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(path, "cgroup.controllers"), []byte(dt.ctrl+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		err := ValidateDelegation(path)
+		if !dt.expectErr && err != nil {
+			t.Errorf("ValidateDelegation(%q, %q); want nil; got %v", dt.parentCtrl, dt.ctrl, err)
+		}
+		if dt.expectErr && err == nil {
+			t.Errorf("ValidateDelegation(%q, %q); wanted failure; got nil", dt.parentCtrl, dt.ctrl)
+		}
+	}
+
+	// no cgroup.controllers file (i.e., not a cgroup v2 path)
+	if err := ValidateDelegation(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("ValidateDelegation() without cgroup.controllers; wanted failure; got nil")
+	}
+}
@@ -85,9 +85,17 @@ func (m *manager) Apply(pid int) error {
 		}
 		return err
 	}
+	if err := AttachNetworkPolicy(m.dirPath, m.config); err != nil {
+		return err
+	}
 	if err := cgroups.WriteCgroupProc(m.dirPath, pid); err != nil {
 		return err
 	}
+	if !m.rootless {
+		if err := ValidateDelegation(m.dirPath); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -127,7 +135,7 @@ func (m *manager) GetStats() (*cgroups.Stats, error) {
 	}
 	// io (since kernel 4.5)
 	if _, ok := m.controllers["io"]; ok {
-		if err := statIo(m.dirPath, st); err != nil {
+		if err := StatIo(m.dirPath, st); err != nil {
 			errs = append(errs, err)
 		}
 	}
@@ -158,6 +166,9 @@ func (m *manager) Freeze(state configs.FreezerState) error {
 }
 
 func (m *manager) Destroy() error {
+	if err := DetachNetworkPolicy(m.dirPath, m.config); err != nil {
+		return err
+	}
 	return cgroups.RemovePath(m.dirPath)
 }
 
@@ -260,6 +271,19 @@ func (m *manager) Exists() bool {
 	return cgroups.PathExists(m.dirPath)
 }
 
+// ReclaimMemory triggers the reclaim of the given amount of memory (in bytes)
+// from the container's cgroup via memory.reclaim.
+func (m *manager) ReclaimMemory(bytes uint64) error {
+	return cgroups.ReclaimCgroupMemory(m.dirPath, bytes)
+}
+
+// KillCgroup kills all processes in the container's cgroup (including child
+// cgroups) via cgroup.kill. Returns cgroups.ErrCgroupKillNotSupported if the
+// kernel lacks it.
+func (m *manager) KillCgroup() error {
+	return cgroups.KillCgroupProcs(m.dirPath)
+}
+
 func (m *manager) CreateChildCgroup(config *configs.Config) error {
 
 	// Change the cgroup ownership to match the root user in the system
@@ -359,6 +383,12 @@ func (m *manager) GetChildCgroupPaths() map[string]string {
 	return m.GetPaths()
 }
 
+func (m *manager) UpdateChildCgroups(container *configs.Config) error {
+	// On cgroup v2 the child cgroup is the container's own cgroup (see
+	// GetChildCgroupPaths()), so it's already updated by Set().
+	return nil
+}
+
 func (m *manager) GetType() cgroups.CgroupType {
 	return cgroups.Cgroup_v2_fs
 }
@@ -0,0 +1,40 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+)
+
+func TestKillCgroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs2_kill_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &manager{dirPath: dir}
+	if err := m.KillCgroup(); err != cgroups.ErrCgroupKillNotSupported {
+		t.Fatalf("KillCgroup: want ErrCgroupKillNotSupported; got %v", err)
+	}
+
+	killFile := filepath.Join(dir, "cgroup.kill")
+	if err := ioutil.WriteFile(killFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.KillCgroup(); err != nil {
+		t.Fatalf("KillCgroup: unexpected error: %v", err)
+	}
+	data, err := ioutil.ReadFile(killFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "1" {
+		t.Errorf("KillCgroup: want \"1\" written to %s; got %q", killFile, string(data))
+	}
+}
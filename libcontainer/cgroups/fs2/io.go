@@ -4,13 +4,16 @@ package fs2
 
 import (
 	"bufio"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/sirupsen/logrus"
 )
 
 func isIoSet(cgroup *configs.Cgroup) bool {
@@ -18,7 +21,8 @@ func isIoSet(cgroup *configs.Cgroup) bool {
 		len(cgroup.Resources.BlkioThrottleReadBpsDevice) > 0 ||
 		len(cgroup.Resources.BlkioThrottleWriteBpsDevice) > 0 ||
 		len(cgroup.Resources.BlkioThrottleReadIOPSDevice) > 0 ||
-		len(cgroup.Resources.BlkioThrottleWriteIOPSDevice) > 0
+		len(cgroup.Resources.BlkioThrottleWriteIOPSDevice) > 0 ||
+		len(cgroup.Resources.IoLatency) > 0
 }
 
 func setIo(dirPath string, cgroup *configs.Cgroup) error {
@@ -53,82 +57,149 @@ func setIo(dirPath string, cgroup *configs.Cgroup) error {
 			return err
 		}
 	}
+	if len(cgroup.Resources.IoLatency) > 0 {
+		if err := setIoLatency(dirPath, cgroup.Resources.IoLatency); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func readCgroup2MapFile(dirPath string, name string) (map[string][]string, error) {
-	ret := map[string][]string{}
-	f, err := fscommon.OpenFile(dirPath, name, os.O_RDONLY)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Fields(line)
-		if len(parts) < 2 {
-			continue
+// setIoLatency sets the io latency targets; io.latency is only present when
+// the kernel supports it (>= 5.2), so it's skipped if not present.
+func setIoLatency(dirPath string, entries []*configs.IoLatencyEntry) error {
+	if _, err := os.Stat(filepath.Join(dirPath, "io.latency")); err != nil {
+		if os.IsNotExist(err) {
+			logrus.Debugf("io.latency not supported by the kernel; ignoring io latency settings")
+			return nil
 		}
-		ret[parts[0]] = parts[1:]
+		return err
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
+
+	for _, le := range entries {
+		if err := fscommon.WriteFile(dirPath, "io.latency", le.String()); err != nil {
+			return err
+		}
 	}
-	return ret, nil
+
+	return nil
+}
+
+// ioStatField describes where an io.stat key is reported in the blkio stats.
+type ioStatField struct {
+	op    string
+	entry func(*cgroups.BlkioStats) *[]cgroups.BlkioStatEntry
+}
+
+// The io.stat keys we report. The wait, service and merged keys are only
+// present in the extended io stats of some kernels. Other keys (e.g., the
+// io.latency and io.cost ones) are ignored.
+var ioStatFields = map[string]ioStatField{
+	"rbytes": {"read", func(s *cgroups.BlkioStats) *[]cgroups.BlkioStatEntry { return &s.IoServiceBytesRecursive }},
+	"wbytes": {"write", func(s *cgroups.BlkioStats) *[]cgroups.BlkioStatEntry { return &s.IoServiceBytesRecursive }},
+	"rios":   {"read", func(s *cgroups.BlkioStats) *[]cgroups.BlkioStatEntry { return &s.IoServicedRecursive }},
+	"wios":   {"write", func(s *cgroups.BlkioStats) *[]cgroups.BlkioStatEntry { return &s.IoServicedRecursive }},
+	"dbytes": {"discard", func(s *cgroups.BlkioStats) *[]cgroups.BlkioStatEntry { return &s.IoDiscardedBytesRecursive }},
+	"dios":   {"discard", func(s *cgroups.BlkioStats) *[]cgroups.BlkioStatEntry { return &s.IoDiscardedOpsRecursive }},
+
+	"rwait":   {"read", func(s *cgroups.BlkioStats) *[]cgroups.BlkioStatEntry { return &s.IoWaitTimeRecursive }},
+	"wwait":   {"write", func(s *cgroups.BlkioStats) *[]cgroups.BlkioStatEntry { return &s.IoWaitTimeRecursive }},
+	"rserv":   {"read", func(s *cgroups.BlkioStats) *[]cgroups.BlkioStatEntry { return &s.IoServiceTimeRecursive }},
+	"wserv":   {"write", func(s *cgroups.BlkioStats) *[]cgroups.BlkioStatEntry { return &s.IoServiceTimeRecursive }},
+	"rmerged": {"read", func(s *cgroups.BlkioStats) *[]cgroups.BlkioStatEntry { return &s.IoMergedRecursive }},
+	"wmerged": {"write", func(s *cgroups.BlkioStats) *[]cgroups.BlkioStatEntry { return &s.IoMergedRecursive }},
+	"avg_lat": {"avg_lat", func(s *cgroups.BlkioStats) *[]cgroups.BlkioStatEntry { return &s.IoLatencyRecursive }},
 }
 
-func statIo(dirPath string, stats *cgroups.Stats) error {
+// StatIo reports the block I/O stats in the io.stat file of the given cgroup
+// v2 path. A missing io.stat (i.e., the io controller is not enabled for the
+// cgroup) is not an error.
+func StatIo(dirPath string, stats *cgroups.Stats) error {
 	// more details on the io.stat file format: https://www.kernel.org/doc/Documentation/cgroup-v2.txt
-	var ioServiceBytesRecursive []cgroups.BlkioStatEntry
-	values, err := readCgroup2MapFile(dirPath, "io.stat")
-	if err != nil {
+	if _, err := os.Stat(filepath.Join(dirPath, "io.stat")); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
 		return err
 	}
-	for k, v := range values {
-		d := strings.Split(k, ":")
-		if len(d) != 2 {
+
+	entries, err := parseIoStat(dirPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse io.stat - %s", err)
+	}
+
+	blkio := cgroups.BlkioStats{}
+	for _, e := range entries {
+		field := ioStatFields[e.Op]
+		list := field.entry(&blkio)
+		e.Op = field.op
+		*list = append(*list, e)
+	}
+	stats.BlkioStats = blkio
+
+	return nil
+}
+
+// parseIoStat parses the io.stat file under the given cgroup path. Each line of
+// the file has the format:
+//
+//	major:minor rbytes=X wbytes=Y rios=Z wios=W dbytes=A dios=B ...
+//
+// One entry is returned per device and reported key (see ioStatFields), with
+// the entry's op set to the io.stat key; the entries are in file order.
+func parseIoStat(path string) ([]cgroups.BlkioStatEntry, error) {
+	f, err := fscommon.OpenFile(path, "io.stat", os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []cgroups.BlkioStatEntry
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
 			continue
 		}
-		major, err := strconv.ParseUint(d[0], 10, 0)
+
+		dev := strings.Split(fields[0], ":")
+		if len(dev) != 2 {
+			return nil, fmt.Errorf("invalid device %q", fields[0])
+		}
+		major, err := strconv.ParseUint(dev[0], 10, 64)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		minor, err := strconv.ParseUint(d[1], 10, 0)
+		minor, err := strconv.ParseUint(dev[1], 10, 64)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		for _, item := range v {
-			d := strings.Split(item, "=")
-			if len(d) != 2 {
+		for _, kv := range fields[1:] {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
 				continue
 			}
-			op := d[0]
-
-			// Accommodate the cgroup v1 naming
-			switch op {
-			case "rbytes":
-				op = "read"
-			case "wbytes":
-				op = "write"
+			if _, ok := ioStatFields[parts[0]]; !ok {
+				continue
 			}
-
-			value, err := strconv.ParseUint(d[1], 10, 0)
+			value, err := strconv.ParseUint(parts[1], 10, 64)
 			if err != nil {
-				return err
+				return nil, err
 			}
-
-			entry := cgroups.BlkioStatEntry{
-				Op:    op,
+			entries = append(entries, cgroups.BlkioStatEntry{
 				Major: major,
 				Minor: minor,
+				Op:    parts[0],
 				Value: value,
-			}
-			ioServiceBytesRecursive = append(ioServiceBytesRecursive, entry)
+			})
 		}
 	}
-	stats.BlkioStats = cgroups.BlkioStats{IoServiceBytesRecursive: ioServiceBytesRecursive}
-	return nil
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
 }
@@ -0,0 +1,233 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func init() {
+	fscommon.TestMode = true
+}
+
+func TestSetIoLatency(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs2_io_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := fscommon.WriteFile(dir, "io.latency", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	cgroup := &configs.Cgroup{
+		Resources: &configs.Resources{
+			IoLatency: []*configs.IoLatencyEntry{
+				{Device: "8:16", Target: "10000"},
+			},
+		},
+	}
+
+	if err := setIo(dir, cgroup); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := fscommon.GetCgroupParamString(dir, "io.latency")
+	if err != nil {
+		t.Fatalf("Failed to parse io.latency - %s", err)
+	}
+	if value != "8:16 target=10000" {
+		t.Fatalf("Got the wrong value (%q), set io.latency failed.", value)
+	}
+}
+
+func TestSetIoLatencyNotSupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs2_io_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cgroup := &configs.Cgroup{
+		Resources: &configs.Resources{
+			IoLatency: []*configs.IoLatencyEntry{
+				{Device: "8:16", Target: "10000"},
+			},
+		},
+	}
+
+	if err := setIo(dir, cgroup); err != nil {
+		t.Fatalf("Expected io latency to be ignored when not supported, but got %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "io.latency")); !os.IsNotExist(err) {
+		t.Fatal("io.latency should not have been created.")
+	}
+}
+
+func TestStatIoLatency(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs2_io_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioStat := "8:16 rbytes=1024 wbytes=2048 rios=1 wios=2 dbytes=0 dios=0 depth=max avg_lat=1500 win=100\n"
+	if err := fscommon.WriteFile(dir, "io.stat", ioStat); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := cgroups.NewStats()
+	if err := StatIo(dir, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	lat := stats.BlkioStats.IoLatencyRecursive
+	if len(lat) != 1 {
+		t.Fatalf("Expected 1 io latency entry, got %v", lat)
+	}
+	if lat[0].Major != 8 || lat[0].Minor != 16 || lat[0].Op != "avg_lat" || lat[0].Value != 1500 {
+		t.Errorf("Got the wrong io latency entry: %+v", lat[0])
+	}
+
+	for _, e := range stats.BlkioStats.IoServiceBytesRecursive {
+		if e.Op == "avg_lat" || e.Op == "depth" || e.Op == "win" {
+			t.Errorf("Unexpected io latency entry in io service bytes: %+v", e)
+		}
+	}
+}
+
+func blkioEntry(major, minor, value uint64, op string) cgroups.BlkioStatEntry {
+	return cgroups.BlkioStatEntry{Major: major, Minor: minor, Value: value, Op: op}
+}
+
+func TestStatIo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs2_io_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioStat := `8:16 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+8:0 rbytes=90430464 wbytes=299008000 rios=8950 wios=1252 dbytes=50331648 dios=3021
+`
+	if err := fscommon.WriteFile(dir, "io.stat", ioStat); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := cgroups.NewStats()
+	if err := StatIo(dir, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := cgroups.BlkioStats{
+		IoServiceBytesRecursive: []cgroups.BlkioStatEntry{
+			blkioEntry(8, 16, 1459200, "read"),
+			blkioEntry(8, 16, 314773504, "write"),
+			blkioEntry(8, 0, 90430464, "read"),
+			blkioEntry(8, 0, 299008000, "write"),
+		},
+		IoServicedRecursive: []cgroups.BlkioStatEntry{
+			blkioEntry(8, 16, 192, "read"),
+			blkioEntry(8, 16, 353, "write"),
+			blkioEntry(8, 0, 8950, "read"),
+			blkioEntry(8, 0, 1252, "write"),
+		},
+		IoDiscardedBytesRecursive: []cgroups.BlkioStatEntry{
+			blkioEntry(8, 16, 0, "discard"),
+			blkioEntry(8, 0, 50331648, "discard"),
+		},
+		IoDiscardedOpsRecursive: []cgroups.BlkioStatEntry{
+			blkioEntry(8, 16, 0, "discard"),
+			blkioEntry(8, 0, 3021, "discard"),
+		},
+	}
+	if !reflect.DeepEqual(stats.BlkioStats, expected) {
+		t.Errorf("Got the wrong io stats:\n%+v\nexpected:\n%+v", stats.BlkioStats, expected)
+	}
+}
+
+func TestStatIoExtended(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs2_io_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioStat := `8:0 rbytes=1024 wbytes=2048 rios=1 wios=2 dbytes=0 dios=0 rwait=300 wwait=400 rserv=500 wserv=600 rmerged=7 wmerged=8
+253:1 rbytes=4096 wbytes=0 rios=1 wios=0 dbytes=0 dios=0 cost.vrate=100.00 cost.usage=10 cost.wait=0
+`
+	if err := fscommon.WriteFile(dir, "io.stat", ioStat); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := cgroups.NewStats()
+	if err := StatIo(dir, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	blkio := stats.BlkioStats
+	for _, tc := range []struct {
+		name     string
+		actual   []cgroups.BlkioStatEntry
+		expected []cgroups.BlkioStatEntry
+	}{
+		{"IoWaitTimeRecursive", blkio.IoWaitTimeRecursive, []cgroups.BlkioStatEntry{blkioEntry(8, 0, 300, "read"), blkioEntry(8, 0, 400, "write")}},
+		{"IoServiceTimeRecursive", blkio.IoServiceTimeRecursive, []cgroups.BlkioStatEntry{blkioEntry(8, 0, 500, "read"), blkioEntry(8, 0, 600, "write")}},
+		{"IoMergedRecursive", blkio.IoMergedRecursive, []cgroups.BlkioStatEntry{blkioEntry(8, 0, 7, "read"), blkioEntry(8, 0, 8, "write")}},
+		{"IoServiceBytesRecursive", blkio.IoServiceBytesRecursive, []cgroups.BlkioStatEntry{
+			blkioEntry(8, 0, 1024, "read"), blkioEntry(8, 0, 2048, "write"),
+			blkioEntry(253, 1, 4096, "read"), blkioEntry(253, 1, 0, "write"),
+		}},
+	} {
+		if !reflect.DeepEqual(tc.actual, tc.expected) {
+			t.Errorf("Got the wrong %s: %+v, expected %+v", tc.name, tc.actual, tc.expected)
+		}
+	}
+}
+
+func TestStatIoNoIoStat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs2_io_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stats := cgroups.NewStats()
+	if err := StatIo(dir, stats); err != nil {
+		t.Fatalf("Expected missing io.stat to be ignored, but got %s", err)
+	}
+	if !reflect.DeepEqual(stats.BlkioStats, cgroups.BlkioStats{}) {
+		t.Errorf("Expected no io stats, got %+v", stats.BlkioStats)
+	}
+}
+
+func TestStatIoBadIoStat(t *testing.T) {
+	for _, contents := range []string{
+		"8:0 rbytes=abc wbytes=0\n",
+		"8-0 rbytes=1 wbytes=0\n",
+		"x:0 rbytes=1 wbytes=0\n",
+	} {
+		dir, err := ioutil.TempDir("", "fs2_io_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fscommon.WriteFile(dir, "io.stat", contents); err != nil {
+			t.Fatal(err)
+		}
+
+		stats := cgroups.NewStats()
+		if err := StatIo(dir, stats); err == nil {
+			t.Errorf("Expected failure parsing io.stat %q", contents)
+		}
+		os.RemoveAll(dir)
+	}
+}
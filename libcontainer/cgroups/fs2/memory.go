@@ -8,6 +8,7 @@ import (
 	"strconv"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/pkg/errors"
@@ -32,7 +33,8 @@ func numToStr(value int64) (ret string) {
 
 func isMemorySet(cgroup *configs.Cgroup) bool {
 	return cgroup.Resources.MemoryReservation != 0 ||
-		cgroup.Resources.Memory != 0 || cgroup.Resources.MemorySwap != 0
+		cgroup.Resources.Memory != 0 || cgroup.Resources.MemorySwap != 0 ||
+		cgroup.Resources.MemorySwapMax != nil
 }
 
 func setMemory(dirPath string, cgroup *configs.Cgroup) error {
@@ -48,6 +50,15 @@ func setMemory(dirPath string, cgroup *configs.Cgroup) error {
 		// memory and memorySwap set to the same value -- disable swap
 		swapStr = "0"
 	}
+	if swapMax := cgroup.Resources.MemorySwapMax; swapMax != nil {
+		if err := cgroups.ValidateMemorySwapMax(swapMax, cgroup.Resources.Memory); err != nil {
+			return err
+		}
+		swapStr = numToStr(*swapMax)
+		if *swapMax == 0 {
+			swapStr = "0"
+		}
+	}
 	// never write empty string to `memory.swap.max`, it means set to 0.
 	if swapStr != "" {
 		if err := fscommon.WriteFile(dirPath, "memory.swap.max", swapStr); err != nil {
@@ -101,6 +112,20 @@ func statMemory(dirPath string, stats *cgroups.Stats) error {
 	}
 	stats.MemoryStats.SwapUsage = swapUsage
 
+	events, err := fs.ReadMemoryEvents(dirPath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to parse memory.events")
+	}
+	stats.MemoryStats.Events = events
+
+	// memory.numa_stat is absent on kernels without NUMA support
+	numaStat, err := fscommon.ParseNUMAStat(dirPath)
+	if err == nil {
+		stats.MemoryStats.NUMAStats = cgroups.NUMAStatsFromValues(numaStat, 1)
+	} else if !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to parse memory.numa_stat")
+	}
+
 	stats.MemoryStats.UseHierarchy = true
 	return nil
 }
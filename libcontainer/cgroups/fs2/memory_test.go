@@ -0,0 +1,150 @@
+// +build linux
+
+package fs2
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestSetMemorySwapMax(t *testing.T) {
+	val := func(v int64) *int64 { return &v }
+
+	cases := []struct {
+		memory     int64
+		memorySwap int64
+		swapMax    *int64
+		expected   string
+		expErr     bool
+	}{
+		{memory: 1000, swapMax: val(500), expected: "500"},
+		{memory: 1000, swapMax: val(0), expected: "0"},
+		{memory: 1000, swapMax: val(-1), expected: "max"},
+		{memory: 1000, swapMax: val(1000), expected: "1000"},
+		{memory: 1000, swapMax: val(1001), expErr: true},
+		{memory: 1000, swapMax: val(-2), expErr: true},
+		{swapMax: val(2000), expected: "2000"},
+		// MemorySwapMax takes precedence over MemorySwap
+		{memory: 1000, memorySwap: 1500, swapMax: val(200), expected: "200"},
+		// MemorySwap (memory+swap) is used otherwise
+		{memory: 1000, memorySwap: 1500, expected: "500"},
+	}
+
+	for _, c := range cases {
+		dir, err := ioutil.TempDir("", "fs2_memory_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		if err := fscommon.WriteFile(dir, "memory.swap.max", "unset"); err != nil {
+			t.Fatal(err)
+		}
+
+		cgroup := &configs.Cgroup{
+			Resources: &configs.Resources{
+				Memory:        c.memory,
+				MemorySwap:    c.memorySwap,
+				MemorySwapMax: c.swapMax,
+			},
+		}
+
+		err = setMemory(dir, cgroup)
+		if c.expErr {
+			if err == nil {
+				t.Errorf("setMemory(%+v): expected error", c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("setMemory(%+v): unexpected error: %v", c, err)
+			continue
+		}
+
+		value, err := fscommon.GetCgroupParamString(dir, "memory.swap.max")
+		if err != nil {
+			t.Fatalf("failed to read memory.swap.max: %v", err)
+		}
+		if value != c.expected {
+			t.Errorf("setMemory(%+v): want memory.swap.max %q, got %q", c, c.expected, value)
+		}
+	}
+}
+
+func TestStatMemorySwap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs2_memory_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for file, val := range map[string]string{
+		"memory.stat":         "cache 100\n",
+		"memory.current":      "4096\n",
+		"memory.max":          "8192\n",
+		"memory.swap.current": "1024\n",
+		"memory.swap.max":     "max\n",
+	} {
+		if err := fscommon.WriteFile(dir, file, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := cgroups.NewStats()
+	if err := statMemory(dir, stats); err != nil {
+		t.Fatalf("statMemory: unexpected error: %v", err)
+	}
+
+	if stats.MemoryStats.SwapUsage.Usage != 1024 {
+		t.Errorf("statMemory: want swap usage 1024, got %d", stats.MemoryStats.SwapUsage.Usage)
+	}
+	if stats.MemoryStats.SwapUsage.Limit != ^uint64(0) {
+		t.Errorf("statMemory: want unlimited swap, got %d", stats.MemoryStats.SwapUsage.Limit)
+	}
+}
+
+func TestStatMemoryNUMA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs2_memory_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for file, val := range map[string]string{
+		"memory.stat":         "cache 100\n",
+		"memory.current":      "4096\n",
+		"memory.max":          "8192\n",
+		"memory.swap.current": "0\n",
+		"memory.swap.max":     "max\n",
+	} {
+		if err := fscommon.WriteFile(dir, file, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// non-NUMA system: no memory.numa_stat
+	stats := cgroups.NewStats()
+	if err := statMemory(dir, stats); err != nil {
+		t.Fatalf("statMemory: unexpected error: %v", err)
+	}
+	if len(stats.MemoryStats.NUMAStats) != 0 {
+		t.Errorf("statMemory: want no NUMA stats, got %+v", stats.MemoryStats.NUMAStats)
+	}
+
+	if err := fscommon.WriteFile(dir, "memory.numa_stat", "anon N0=4096 N1=8192\nfile N0=1024 N1=2048\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats = cgroups.NewStats()
+	if err := statMemory(dir, stats); err != nil {
+		t.Fatalf("statMemory: unexpected error: %v", err)
+	}
+	if stats.MemoryStats.NUMAStats[1].Anon != 8192 || stats.MemoryStats.NUMAStats[1].File != 2048 {
+		t.Errorf("statMemory: want node 1 anon 8192 and file 2048, got %+v", stats.MemoryStats.NUMAStats[1])
+	}
+}
@@ -0,0 +1,74 @@
+// +build linux
+
+package fs2
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups/ebpf"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// netPolicyPinRoot is the bpffs dir under which the network policy programs
+// attached to each cgroup are pinned (see ebpf.AttachNetworkPolicy).
+const netPolicyPinRoot = "/sys/fs/bpf/sysbox-runc/netpolicy"
+
+func networkPolicy(cgroup *configs.Cgroup) ebpf.NetworkPolicy {
+	if cgroup.Resources == nil {
+		return ebpf.NetworkPolicy{}
+	}
+	return ebpf.NetworkPolicy{
+		IngressProgram: cgroup.Resources.NetIngressProgram,
+		EgressProgram:  cgroup.Resources.NetEgressProgram,
+	}
+}
+
+// netPolicyPinDir returns the dir where the network policy programs attached
+// to the cgroup at dirPath are pinned.
+func netPolicyPinDir(dirPath string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(dirPath)))
+	return filepath.Join(netPolicyPinRoot, hex.EncodeToString(sum[:16]))
+}
+
+// AttachNetworkPolicy attaches the cgroup's network policy programs (if any)
+// to the cgroup at dirPath.
+func AttachNetworkPolicy(dirPath string, cgroup *configs.Cgroup) error {
+	policy := networkPolicy(cgroup)
+	if policy.Empty() {
+		return nil
+	}
+
+	dirFD, err := unix.Open(dirPath, unix.O_DIRECTORY|unix.O_RDONLY, 0600)
+	if err != nil {
+		return errors.Errorf("cannot get dir FD for %s", dirPath)
+	}
+	defer unix.Close(dirFD)
+
+	return ebpf.AttachNetworkPolicy(dirFD, netPolicyPinDir(dirPath), policy)
+}
+
+// DetachNetworkPolicy detaches the cgroup's network policy programs (if any)
+// from the cgroup at dirPath. If the cgroup no longer exists, the programs'
+// pins are just removed.
+func DetachNetworkPolicy(dirPath string, cgroup *configs.Cgroup) error {
+	policy := networkPolicy(cgroup)
+	if policy.Empty() {
+		return nil
+	}
+
+	dirFD, err := unix.Open(dirPath, unix.O_DIRECTORY|unix.O_RDONLY, 0600)
+	if err != nil {
+		if err != unix.ENOENT {
+			return errors.Errorf("cannot get dir FD for %s", dirPath)
+		}
+		dirFD = -1
+	} else {
+		defer unix.Close(dirFD)
+	}
+
+	return ebpf.DetachNetworkPolicy(dirFD, netPolicyPinDir(dirPath))
+}
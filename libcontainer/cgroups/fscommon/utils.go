@@ -3,9 +3,11 @@
 package fscommon
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"math"
+	"os"
 	"strconv"
 	"strings"
 )
@@ -100,3 +102,121 @@ func GetCgroupParamString(path, file string) (string, error) {
 
 	return strings.TrimSpace(contents), nil
 }
+
+// ParseCpusetList parses a cpuset list string (e.g., "0-3,7") and returns
+// the individual cpu (or mem node) numbers in it.
+func ParseCpusetList(list string) ([]uint16, error) {
+	var extracted []uint16
+
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return extracted, nil
+	}
+
+	for _, s := range strings.Split(list, ",") {
+		splitted := strings.SplitN(s, "-", 3)
+		switch len(splitted) {
+		case 3:
+			return nil, fmt.Errorf("invalid cpuset list %q", list)
+		case 2:
+			min, err := strconv.ParseUint(splitted[0], 10, 16)
+			if err != nil {
+				return nil, err
+			}
+			max, err := strconv.ParseUint(splitted[1], 10, 16)
+			if err != nil {
+				return nil, err
+			}
+			if min > max {
+				return nil, fmt.Errorf("invalid cpuset list %q", list)
+			}
+			for i := min; i <= max; i++ {
+				extracted = append(extracted, uint16(i))
+			}
+		case 1:
+			value, err := strconv.ParseUint(s, 10, 16)
+			if err != nil {
+				return nil, err
+			}
+			extracted = append(extracted, uint16(value))
+		}
+	}
+
+	return extracted, nil
+}
+
+// CheckCpusetSubset verifies that all cpus in the given cpuset list are also
+// present in the parent's cpuset list.
+func CheckCpusetSubset(cpus, parentCpus string) error {
+	child, err := ParseCpusetList(cpus)
+	if err != nil {
+		return err
+	}
+	parent, err := ParseCpusetList(parentCpus)
+	if err != nil {
+		return err
+	}
+
+	avail := make(map[uint16]bool, len(parent))
+	for _, c := range parent {
+		avail[c] = true
+	}
+	for _, c := range child {
+		if !avail[c] {
+			return fmt.Errorf("cpu %d is not in the parent cgroup's cpuset (%s)", c, parentCpus)
+		}
+	}
+
+	return nil
+}
+
+// ParseNUMAStat parses the memory.numa_stat file in the given cgroup path,
+// returning the per-node values of each stat. Each line holds a stat followed
+// by its per-node values, e.g., "anon N0=4096 N1=8192" (cgroup v2, in bytes) or
+// "anon=3 N0=1 N1=2" (cgroup v1, in pages, where the stat's total follows the
+// key).
+func ParseNUMAStat(path string) (map[string]map[int]uint64, error) {
+	const file = "memory.numa_stat"
+
+	f, err := OpenFile(path, file, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stats := make(map[string]map[int]uint64)
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		key := strings.SplitN(fields[0], "=", 2)[0]
+		nodes := make(map[int]uint64, len(fields)-1)
+
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 || !strings.HasPrefix(kv[0], "N") {
+				return nil, fmt.Errorf("failed to parse %s (%q)", file, sc.Text())
+			}
+			node, err := strconv.Atoi(kv[0][1:])
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s (%q) - %v", file, sc.Text(), err)
+			}
+			val, err := strconv.ParseUint(kv[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s (%q) - %v", file, sc.Text(), err)
+			}
+			nodes[node] = val
+		}
+
+		stats[key] = nodes
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
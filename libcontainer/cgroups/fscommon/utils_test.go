@@ -7,6 +7,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -95,3 +96,56 @@ func TestGetCgroupParamsInt(t *testing.T) {
 		t.Fatal("Expecting error, got none")
 	}
 }
+
+func TestParseNUMAStat(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "cgroup_utils_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if _, err := ParseNUMAStat(tempDir); !os.IsNotExist(err) {
+		t.Errorf("Expected not-exist error, got %v", err)
+	}
+
+	tempFile := filepath.Join(tempDir, "memory.numa_stat")
+
+	// cgroup v2 format
+	if err := ioutil.WriteFile(tempFile, []byte("anon N0=4096 N1=8192\nfile N0=1024 N1=0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := ParseNUMAStat(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]map[int]uint64{
+		"anon": {0: 4096, 1: 8192},
+		"file": {0: 1024, 1: 0},
+	}
+	if !reflect.DeepEqual(stat, expected) {
+		t.Errorf("Expected NUMA stat %v, but found %v", expected, stat)
+	}
+
+	// cgroup v1 format (the stat's total follows the key)
+	if err := ioutil.WriteFile(tempFile, []byte("total=44611 N0=32631 N1=11980\nanon=183 N0=17 N1=166\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	stat, err = ParseNUMAStat(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]map[int]uint64{
+		"total": {0: 32631, 1: 11980},
+		"anon":  {0: 17, 1: 166},
+	}
+	if !reflect.DeepEqual(stat, expected) {
+		t.Errorf("Expected NUMA stat %v, but found %v", expected, stat)
+	}
+
+	if err := ioutil.WriteFile(tempFile, []byte("anon N0=4096 X1=2\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseNUMAStat(tempDir); err == nil {
+		t.Error("Expected failure parsing invalid memory.numa_stat")
+	}
+}
@@ -0,0 +1,49 @@
+// +build linux
+
+package cgroups
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// KillMethod is the method used to kill all the processes in a cgroup.
+type KillMethod string
+
+const (
+	// KillAuto uses cgroup.kill when available, and otherwise signals each process.
+	KillAuto KillMethod = "auto"
+	// KillCgroup uses cgroup.kill (cgroup v2, kernel >= 5.14).
+	KillCgroup KillMethod = "cgroup"
+	// KillSignal sends SIGKILL to each process in the cgroup.
+	KillSignal KillMethod = "signal"
+)
+
+// ErrCgroupKillNotSupported is returned when cgroup.kill is not available.
+var ErrCgroupKillNotSupported = errors.New("cgroup.kill is not supported")
+
+// ParseKillMethod returns the kill method with the given name.
+func ParseKillMethod(name string) (KillMethod, error) {
+	switch m := KillMethod(name); m {
+	case KillAuto, KillCgroup, KillSignal:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid kill method %q (expected %q, %q or %q)", name, KillAuto, KillCgroup, KillSignal)
+}
+
+// KillCgroupProcs atomically kills all processes in the given cgroup v2 cgroup
+// and its descendants by writing to its cgroup.kill file. Returns
+// ErrCgroupKillNotSupported if the file does not exist.
+func KillCgroupProcs(path string) error {
+	file := filepath.Join(path, "cgroup.kill")
+	if _, err := os.Stat(file); err != nil {
+		if os.IsNotExist(err) {
+			return ErrCgroupKillNotSupported
+		}
+		return err
+	}
+	return ioutil.WriteFile(file, []byte("1"), 0)
+}
@@ -0,0 +1,50 @@
+// +build linux
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKillCgroupProcs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup-kill-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := KillCgroupProcs(dir); err != ErrCgroupKillNotSupported {
+		t.Errorf("KillCgroupProcs: want ErrCgroupKillNotSupported; got %v", err)
+	}
+
+	file := filepath.Join(dir, "cgroup.kill")
+	if err := ioutil.WriteFile(file, nil, 0200); err != nil {
+		t.Fatal(err)
+	}
+	if err := KillCgroupProcs(dir); err != nil {
+		t.Fatalf("KillCgroupProcs: unexpected error: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "1" {
+		t.Errorf("KillCgroupProcs: want \"1\" written to cgroup.kill; got %q", string(data))
+	}
+}
+
+func TestParseKillMethod(t *testing.T) {
+	for _, name := range []string{"auto", "cgroup", "signal"} {
+		m, err := ParseKillMethod(name)
+		if err != nil || string(m) != name {
+			t.Errorf("ParseKillMethod(%q): got %q, %v", name, m, err)
+		}
+	}
+	if _, err := ParseKillMethod("sigterm"); err == nil {
+		t.Errorf("ParseKillMethod: expected error for invalid method")
+	}
+}
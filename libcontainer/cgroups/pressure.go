@@ -0,0 +1,256 @@
+// +build linux
+
+package cgroups
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrPressureNotSupported is returned when PSI (pressure stall information)
+// is not available for a resource.
+var ErrPressureNotSupported = errors.New("pressure stall information (PSI) is not supported")
+
+// PressureEvent reports the pressure stall information of a resource when it
+// crosses the threshold of a pressure subscription. The averages are the
+// percentage of time (over the last 10, 60 and 300 secs) in which some tasks
+// were stalled on the resource; Total is the total stall time in usecs.
+type PressureEvent struct {
+	Subsystem string
+	Avg10     float64
+	Avg60     float64
+	Avg300    float64
+	Total     uint64
+	Timestamp time.Time
+}
+
+// PressureCancelFunc ends a pressure subscription; the subscription's event
+// channel is closed by the time it returns.
+type PressureCancelFunc func()
+
+// Resources with pressure stall information, and their (cgroup v2) files
+var pressureFiles = map[string]string{
+	"cpu":    "cpu.pressure",
+	"io":     "io.pressure",
+	"memory": "memory.pressure",
+}
+
+// Limits of the PSI trigger window (see the kernel's psi docs)
+const (
+	minPressureWindow = 500 * time.Millisecond
+	maxPressureWindow = 10 * time.Second
+)
+
+// replaceable in tests
+var (
+	psiProcDir = "/proc/pressure"
+
+	// waitPressureEvent waits for the PSI trigger on the given fd to fire
+	// (returns true) or for the given wakeup fd to become readable (returns
+	// false).
+	waitPressureEvent = func(fd, wakeFd int) (bool, error) {
+		fds := []unix.PollFd{
+			{Fd: int32(fd), Events: unix.POLLPRI},
+			{Fd: int32(wakeFd), Events: unix.POLLIN},
+		}
+		for {
+			if _, err := unix.Poll(fds, -1); err != nil {
+				if err == unix.EINTR {
+					continue
+				}
+				return false, err
+			}
+			if fds[1].Revents != 0 {
+				return false, nil
+			}
+			// the trigger fails (POLLERR) once the cgroup is removed
+			if fds[0].Revents&unix.POLLERR != 0 {
+				return false, errors.New("pressure trigger is no longer valid")
+			}
+			if fds[0].Revents&unix.POLLPRI != 0 {
+				return true, nil
+			}
+		}
+	}
+)
+
+// PressureFile returns the name of the pressure file for the given subsystem
+// ("cpu", "io" or "memory").
+func PressureFile(subsystem string) (string, error) {
+	file, ok := pressureFiles[subsystem]
+	if !ok {
+		return "", fmt.Errorf("no pressure stall information for subsystem %q", subsystem)
+	}
+	return file, nil
+}
+
+// PressureSubscription delivers the pressure events of a PSI trigger.
+type PressureSubscription struct {
+	subsystem string
+	path      string
+	file      *os.File
+	wakeR     *os.File
+	wakeW     *os.File
+	events    chan PressureEvent
+	done      chan struct{}
+	wg        sync.WaitGroup
+	once      sync.Once
+}
+
+// SubscribePressure sets up a PSI trigger on the given subsystem's pressure
+// file in the given cgroup dir. An event is sent on the returned channel each
+// time the tasks in the cgroup are stalled on the resource for over the given
+// threshold (a percentage) of the given window (between 500ms and 10s). The
+// returned function cancels the subscription. Returns ErrPressureNotSupported
+// if the kernel or cgroup has no PSI for the subsystem.
+func SubscribePressure(dir, subsystem string, window time.Duration, threshold float64) (<-chan PressureEvent, PressureCancelFunc, error) {
+	file, err := PressureFile(subsystem)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if window < minPressureWindow || window > maxPressureWindow {
+		return nil, nil, fmt.Errorf("invalid pressure window %v (must be between %v and %v)", window, minPressureWindow, maxPressureWindow)
+	}
+	if threshold <= 0 || threshold > 100 {
+		return nil, nil, fmt.Errorf("invalid pressure threshold %v (must be a percentage)", threshold)
+	}
+
+	// PSI may be compiled out or disabled (psi=0)
+	if _, err := os.Stat(filepath.Join(psiProcDir, subsystem)); err != nil {
+		return nil, nil, ErrPressureNotSupported
+	}
+
+	path := filepath.Join(dir, file)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, ErrPressureNotSupported
+		}
+		return nil, nil, err
+	}
+
+	windowUs := window.Microseconds()
+	stallUs := int64(float64(windowUs) * threshold / 100)
+	trigger := fmt.Sprintf("some %d %d", stallUs, windowUs)
+
+	if _, err := f.Write([]byte(trigger)); err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to set pressure trigger %q on %s: %v", trigger, path, err)
+	}
+
+	wakeR, wakeW, err := os.Pipe()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	sub := &PressureSubscription{
+		subsystem: subsystem,
+		path:      path,
+		file:      f,
+		wakeR:     wakeR,
+		wakeW:     wakeW,
+		events:    make(chan PressureEvent),
+		done:      make(chan struct{}),
+	}
+
+	sub.wg.Add(1)
+	go sub.run()
+
+	return sub.events, sub.cancel, nil
+}
+
+// run delivers the subscription's events until it's canceled or the trigger
+// fails (e.g., because the cgroup was removed); the event channel is closed
+// on return.
+func (s *PressureSubscription) run() {
+	defer s.wg.Done()
+	defer close(s.events)
+
+	for {
+		fired, err := waitPressureEvent(int(s.file.Fd()), int(s.wakeR.Fd()))
+		if err != nil || !fired {
+			return
+		}
+
+		data, err := ioutil.ReadFile(s.path)
+		if err != nil {
+			return
+		}
+		event, err := parsePressure(string(data))
+		if err != nil {
+			continue
+		}
+		event.Subsystem = s.subsystem
+		event.Timestamp = time.Now()
+
+		select {
+		case s.events <- event:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *PressureSubscription) cancel() {
+	s.once.Do(func() {
+		close(s.done)
+		s.wakeW.Write([]byte{0})
+		s.wg.Wait()
+
+		s.file.Close()
+		s.wakeR.Close()
+		s.wakeW.Close()
+	})
+}
+
+// parsePressure returns the "some" stats in the given pressure file data,
+// which has the format:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parsePressure(data string) (PressureEvent, error) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "some" {
+			continue
+		}
+
+		var event PressureEvent
+		for _, kv := range fields[1:] {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				return PressureEvent{}, fmt.Errorf("invalid pressure field %q", kv)
+			}
+
+			var err error
+			switch parts[0] {
+			case "avg10":
+				event.Avg10, err = strconv.ParseFloat(parts[1], 64)
+			case "avg60":
+				event.Avg60, err = strconv.ParseFloat(parts[1], 64)
+			case "avg300":
+				event.Avg300, err = strconv.ParseFloat(parts[1], 64)
+			case "total":
+				event.Total, err = strconv.ParseUint(parts[1], 10, 64)
+			}
+			if err != nil {
+				return PressureEvent{}, fmt.Errorf("invalid pressure field %q", kv)
+			}
+		}
+
+		return event, nil
+	}
+
+	return PressureEvent{}, errors.New("no \"some\" line in pressure data")
+}
@@ -0,0 +1,160 @@
+// +build linux
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const testPressureData = `some avg10=12.50 avg60=4.25 avg300=1.00 total=123456
+full avg10=2.00 avg60=1.00 avg300=0.50 total=23456
+`
+
+func TestParsePressure(t *testing.T) {
+	event, err := parsePressure(testPressureData)
+	if err != nil {
+		t.Fatalf("parsePressure: unexpected error: %v", err)
+	}
+	want := PressureEvent{Avg10: 12.5, Avg60: 4.25, Avg300: 1, Total: 123456}
+	if event != want {
+		t.Errorf("parsePressure: want %+v, got %+v", want, event)
+	}
+
+	bad := []string{
+		"",
+		"full avg10=2.00 avg60=1.00 avg300=0.50 total=23456\n",
+		"some avg10=lots avg60=1.00 avg300=0.50 total=23456\n",
+		"some avg10\n",
+	}
+	for _, data := range bad {
+		if _, err := parsePressure(data); err == nil {
+			t.Errorf("parsePressure(%q): expected error", data)
+		}
+	}
+}
+
+// waitWake blocks until the given wakeup fd is readable.
+func waitWake(wakeFd int) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(wakeFd), Events: unix.POLLIN}}
+	_, err := unix.Poll(fds, -1)
+	return false, err
+}
+
+func TestSubscribePressure(t *testing.T) {
+	origProcDir := psiProcDir
+	origWait := waitPressureEvent
+	defer func() {
+		psiProcDir = origProcDir
+		waitPressureEvent = origWait
+	}()
+
+	tmpDir, err := ioutil.TempDir("", "cgroup-pressure-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	psiProcDir = filepath.Join(tmpDir, "proc")
+	cgroupDir := filepath.Join(tmpDir, "cgroup")
+	for _, dir := range []string{psiProcDir, cgroupDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pressureFile := filepath.Join(cgroupDir, "memory.pressure")
+
+	// no PSI in the kernel
+	if _, _, err := SubscribePressure(cgroupDir, "memory", time.Second, 50); err != ErrPressureNotSupported {
+		t.Errorf("SubscribePressure: want ErrPressureNotSupported without PSI, got %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(psiProcDir, "memory"), []byte(testPressureData), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// no PSI in the cgroup
+	if _, _, err := SubscribePressure(cgroupDir, "memory", time.Second, 50); err != ErrPressureNotSupported {
+		t.Errorf("SubscribePressure: want ErrPressureNotSupported without pressure file, got %v", err)
+	}
+
+	if err := ioutil.WriteFile(pressureFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []struct {
+		subsystem string
+		window    time.Duration
+		threshold float64
+	}{
+		{"pids", time.Second, 50},
+		{"memory", 100 * time.Millisecond, 50},
+		{"memory", time.Minute, 50},
+		{"memory", time.Second, 0},
+		{"memory", time.Second, 101},
+	}
+	for _, c := range invalid {
+		if _, _, err := SubscribePressure(cgroupDir, c.subsystem, c.window, c.threshold); err == nil {
+			t.Errorf("SubscribePressure(%+v): expected error", c)
+		}
+	}
+
+	// the trigger fires twice; the mock then emulates the kernel by replacing
+	// the trigger with the pressure data
+	triggers := make(chan string, 2)
+	fired := 0
+
+	waitPressureEvent = func(fd, wakeFd int) (bool, error) {
+		if fired == 2 {
+			return waitWake(wakeFd)
+		}
+		fired++
+
+		data, err := ioutil.ReadFile(pressureFile)
+		if err != nil {
+			return false, err
+		}
+		triggers <- string(data)
+
+		if err := ioutil.WriteFile(pressureFile, []byte(testPressureData), 0644); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	events, cancel, err := SubscribePressure(cgroupDir, "memory", time.Second, 50)
+	if err != nil {
+		t.Fatalf("SubscribePressure: unexpected error: %v", err)
+	}
+
+	if trigger := <-triggers; !strings.HasPrefix(trigger, "some 500000 1000000") {
+		t.Errorf("SubscribePressure: want trigger \"some 500000 1000000\", got %q", trigger)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-events:
+			if event.Subsystem != "memory" || event.Avg10 != 12.5 || event.Total != 123456 || event.Timestamp.IsZero() {
+				t.Errorf("SubscribePressure: unexpected event %+v", event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("SubscribePressure: timed out waiting for event %d", i)
+		}
+	}
+
+	cancel()
+
+	if _, ok := <-events; ok {
+		t.Errorf("SubscribePressure: event channel not closed after cancel")
+	}
+
+	// canceling twice is harmless
+	cancel()
+}
@@ -0,0 +1,30 @@
+// +build linux
+
+package cgroups
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ErrMemoryReclaimNotSupported is returned when memory.reclaim is not available.
+var ErrMemoryReclaimNotSupported = errors.New("memory.reclaim is not supported")
+
+// ReclaimCgroupMemory triggers the reclaim of the given amount of memory (in
+// bytes) from the given cgroup v2 cgroup by writing to its memory.reclaim file
+// (kernel >= 5.19). Returns ErrMemoryReclaimNotSupported if the file does not
+// exist. Note that the kernel fails the write (with EAGAIN) if it can't
+// reclaim the full amount.
+func ReclaimCgroupMemory(path string, bytes uint64) error {
+	file := filepath.Join(path, "memory.reclaim")
+	if _, err := os.Stat(file); err != nil {
+		if os.IsNotExist(err) {
+			return ErrMemoryReclaimNotSupported
+		}
+		return err
+	}
+	return ioutil.WriteFile(file, []byte(strconv.FormatUint(bytes, 10)), 0)
+}
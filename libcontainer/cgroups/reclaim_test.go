@@ -0,0 +1,38 @@
+// +build linux
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReclaimCgroupMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup-reclaim-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ReclaimCgroupMemory(dir, 1024); err != ErrMemoryReclaimNotSupported {
+		t.Errorf("ReclaimCgroupMemory: want ErrMemoryReclaimNotSupported; got %v", err)
+	}
+
+	file := filepath.Join(dir, "memory.reclaim")
+	if err := ioutil.WriteFile(file, nil, 0200); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReclaimCgroupMemory(dir, 104857600); err != nil {
+		t.Fatalf("ReclaimCgroupMemory: unexpected error: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "104857600" {
+		t.Errorf("ReclaimCgroupMemory: want \"104857600\" written to memory.reclaim; got %q", string(data))
+	}
+}
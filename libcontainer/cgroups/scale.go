@@ -0,0 +1,130 @@
+// +build linux
+
+package cgroups
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// cpu shares of a cgroup with default weight
+const defaultCpuShares = 1024
+
+// ScaleResourcesForInner returns a copy of the given inner (nested) container
+// resources, adjusted so they don't exceed those of the outer container:
+//
+//   - the memory limit is capped at the outer memory limit.
+//   - cpu shares are scaled by the outer cpu shares (relative to the default
+//     1024 shares) and capped at them.
+//   - the pids limit is capped at the outer pids limit minus the given number of
+//     pids already in use in the outer container.
+//   - the cpuset is the intersection of the inner and outer cpusets.
+//
+// Unset inner limits are set to the outer ones, except for cpu shares, which
+// are relative to sibling cgroups.
+func ScaleResourcesForInner(outer, inner *configs.Resources, pidsUsed int64) (*configs.Resources, error) {
+	if inner == nil {
+		inner = &configs.Resources{}
+	}
+	scaled := *inner
+	if outer == nil {
+		return &scaled, nil
+	}
+
+	if outer.Memory > 0 && (scaled.Memory <= 0 || scaled.Memory > outer.Memory) {
+		scaled.Memory = outer.Memory
+	}
+
+	if outer.CpuShares > 0 && scaled.CpuShares > 0 {
+		shares := scaled.CpuShares * outer.CpuShares / defaultCpuShares
+		if shares > outer.CpuShares {
+			shares = outer.CpuShares
+		}
+		// minimum value accepted by the kernel
+		if shares < 2 {
+			shares = 2
+		}
+		scaled.CpuShares = shares
+	}
+
+	if outer.PidsLimit > 0 {
+		avail := outer.PidsLimit - pidsUsed
+		if avail <= 0 {
+			return nil, fmt.Errorf("no pids available for inner container (limit %d, used %d)", outer.PidsLimit, pidsUsed)
+		}
+		if scaled.PidsLimit <= 0 || scaled.PidsLimit > avail {
+			scaled.PidsLimit = avail
+		}
+	}
+
+	if outer.CpusetCpus != "" {
+		if scaled.CpusetCpus == "" {
+			scaled.CpusetCpus = outer.CpusetCpus
+		} else {
+			cpus, err := intersectCpusets(scaled.CpusetCpus, outer.CpusetCpus)
+			if err != nil {
+				return nil, err
+			}
+			if cpus == "" {
+				return nil, fmt.Errorf("inner cpuset %q does not overlap outer cpuset %q", inner.CpusetCpus, outer.CpusetCpus)
+			}
+			scaled.CpusetCpus = cpus
+		}
+	}
+
+	return &scaled, nil
+}
+
+// intersectCpusets returns the intersection of the given cpuset lists (e.g.,
+// "0-3,6"), as a cpuset list.
+func intersectCpusets(a, b string) (string, error) {
+	cpusA, err := fscommon.ParseCpusetList(a)
+	if err != nil {
+		return "", err
+	}
+	cpusB, err := fscommon.ParseCpusetList(b)
+	if err != nil {
+		return "", err
+	}
+
+	inB := make(map[uint16]bool, len(cpusB))
+	for _, cpu := range cpusB {
+		inB[cpu] = true
+	}
+
+	var cpus []int
+	for _, cpu := range cpusA {
+		if inB[cpu] {
+			cpus = append(cpus, int(cpu))
+			delete(inB, cpu)
+		}
+	}
+	sort.Ints(cpus)
+
+	return formatCpusetList(cpus), nil
+}
+
+// formatCpusetList formats the given (sorted, unique) cpus as a cpuset list.
+func formatCpusetList(cpus []int) string {
+	var ranges []string
+
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(cpus[i]))
+		} else {
+			ranges = append(ranges, strconv.Itoa(cpus[i])+"-"+strconv.Itoa(cpus[j]))
+		}
+		i = j + 1
+	}
+
+	return strings.Join(ranges, ",")
+}
@@ -0,0 +1,147 @@
+// +build linux
+
+package cgroups
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func TestScaleResourcesForInnerMemory(t *testing.T) {
+	cases := []struct {
+		outer, inner, expected int64
+	}{
+		{outer: 4096, inner: 1024, expected: 1024},
+		{outer: 4096, inner: 4096, expected: 4096},
+		{outer: 4096, inner: 8192, expected: 4096},
+		{outer: 4096, inner: 0, expected: 4096},  // unset
+		{outer: 4096, inner: -1, expected: 4096}, // unlimited
+		{outer: 0, inner: 8192, expected: 8192},
+		{outer: -1, inner: 8192, expected: 8192},
+	}
+
+	for _, c := range cases {
+		r, err := ScaleResourcesForInner(&configs.Resources{Memory: c.outer}, &configs.Resources{Memory: c.inner}, 0)
+		if err != nil {
+			t.Errorf("ScaleResourcesForInner(%+v): unexpected error: %v", c, err)
+			continue
+		}
+		if r.Memory != c.expected {
+			t.Errorf("ScaleResourcesForInner(%+v): want memory %d, got %d", c, c.expected, r.Memory)
+		}
+	}
+}
+
+func TestScaleResourcesForInnerCpuShares(t *testing.T) {
+	cases := []struct {
+		outer, inner, expected uint64
+	}{
+		{outer: 512, inner: 1024, expected: 512},
+		{outer: 512, inner: 256, expected: 128},
+		{outer: 512, inner: 4096, expected: 512},
+		{outer: 2048, inner: 1024, expected: 2048},
+		{outer: 2048, inner: 512, expected: 1024},
+		{outer: 2, inner: 2, expected: 2}, // kernel minimum
+		{outer: 512, inner: 0, expected: 0},
+		{outer: 0, inner: 4096, expected: 4096},
+	}
+
+	for _, c := range cases {
+		r, err := ScaleResourcesForInner(&configs.Resources{CpuShares: c.outer}, &configs.Resources{CpuShares: c.inner}, 0)
+		if err != nil {
+			t.Errorf("ScaleResourcesForInner(%+v): unexpected error: %v", c, err)
+			continue
+		}
+		if r.CpuShares != c.expected {
+			t.Errorf("ScaleResourcesForInner(%+v): want cpu shares %d, got %d", c, c.expected, r.CpuShares)
+		}
+	}
+}
+
+func TestScaleResourcesForInnerPids(t *testing.T) {
+	cases := []struct {
+		outer, inner, used, expected int64
+		expErr                       bool
+	}{
+		{outer: 100, inner: 50, used: 10, expected: 50},
+		{outer: 100, inner: 95, used: 10, expected: 90},
+		{outer: 100, inner: 0, used: 10, expected: 90},
+		{outer: 100, inner: -1, used: 0, expected: 100},
+		{outer: 100, inner: 10, used: 100, expErr: true},
+		{outer: 100, inner: 10, used: 150, expErr: true},
+		{outer: 0, inner: 500, used: 10, expected: 500},
+		{outer: -1, inner: 500, used: 10, expected: 500},
+	}
+
+	for _, c := range cases {
+		r, err := ScaleResourcesForInner(&configs.Resources{PidsLimit: c.outer}, &configs.Resources{PidsLimit: c.inner}, c.used)
+		if c.expErr {
+			if err == nil {
+				t.Errorf("ScaleResourcesForInner(%+v): expected error", c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ScaleResourcesForInner(%+v): unexpected error: %v", c, err)
+			continue
+		}
+		if r.PidsLimit != c.expected {
+			t.Errorf("ScaleResourcesForInner(%+v): want pids limit %d, got %d", c, c.expected, r.PidsLimit)
+		}
+	}
+}
+
+func TestScaleResourcesForInnerCpuset(t *testing.T) {
+	cases := []struct {
+		outer, inner, expected string
+		expErr                 bool
+	}{
+		{outer: "0-3", inner: "2-5", expected: "2-3"},
+		{outer: "0-7", inner: "1,3,5-6", expected: "1,3,5-6"},
+		{outer: "0,2,4", inner: "0-4", expected: "0,2,4"},
+		{outer: "0-3", inner: "", expected: "0-3"},
+		{outer: "", inner: "4-5", expected: "4-5"},
+		{outer: "0-1", inner: "2-3", expErr: true},
+		{outer: "0-3", inner: "3-1", expErr: true},
+	}
+
+	for _, c := range cases {
+		r, err := ScaleResourcesForInner(&configs.Resources{CpusetCpus: c.outer}, &configs.Resources{CpusetCpus: c.inner}, 0)
+		if c.expErr {
+			if err == nil {
+				t.Errorf("ScaleResourcesForInner(%+v): expected error", c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ScaleResourcesForInner(%+v): unexpected error: %v", c, err)
+			continue
+		}
+		if r.CpusetCpus != c.expected {
+			t.Errorf("ScaleResourcesForInner(%+v): want cpuset %q, got %q", c, c.expected, r.CpusetCpus)
+		}
+	}
+}
+
+func TestScaleResourcesForInnerNoCopy(t *testing.T) {
+	outer := &configs.Resources{Memory: 4096}
+	inner := &configs.Resources{Memory: 8192, CpuShares: 100}
+
+	r, err := ScaleResourcesForInner(outer, inner, 0)
+	if err != nil {
+		t.Fatalf("ScaleResourcesForInner: unexpected error: %v", err)
+	}
+	if inner.Memory != 8192 {
+		t.Errorf("ScaleResourcesForInner: inner resources modified: %+v", inner)
+	}
+	if r.Memory != 4096 || r.CpuShares != 100 {
+		t.Errorf("ScaleResourcesForInner: unexpected result: %+v", r)
+	}
+
+	// no inner resources: the outer limits apply
+	r, err = ScaleResourcesForInner(outer, nil, 0)
+	if err != nil || r.Memory != 4096 {
+		t.Errorf("ScaleResourcesForInner: want memory 4096, got %+v (err %v)", r, err)
+	}
+}
@@ -0,0 +1,243 @@
+// +build linux
+
+package cgroups
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CgroupSnapshotVersion is the version of the cgroup snapshot format.
+const CgroupSnapshotVersion = 1
+
+// CgroupSnapshot is a point-in-time copy of a container's cgroup tree(s),
+// including the child cgroups created by the container's inner cgroup
+// managers.
+type CgroupSnapshot struct {
+	Version     int    `json:"version"`
+	ContainerID string `json:"container_id"`
+	// Subsystems maps each subsystem (the empty string for the cgroup v2
+	// unified hierarchy) to the root of its cgroup tree.
+	Subsystems map[string]*CgroupSnapshotNode `json:"subsystems"`
+}
+
+// CgroupSnapshotNode holds the state of a single cgroup in a snapshot.
+type CgroupSnapshotNode struct {
+	// Limits holds the writable cgroup files (e.g., memory.limit_in_bytes)
+	Limits map[string]string `json:"limits,omitempty"`
+	// Stats holds the read-only cgroup files (e.g., memory.stat)
+	Stats    map[string]string              `json:"stats,omitempty"`
+	Children map[string]*CgroupSnapshotNode `json:"children,omitempty"`
+}
+
+// cgroup files that are not included in snapshots since they describe (or
+// control) process membership or release notifications rather than resources.
+var cgroupSnapshotSkipFiles = map[string]bool{
+	CgroupProcesses:         true,
+	"tasks":                 true,
+	"cgroup.threads":        true,
+	"cgroup.clone_children": true,
+	"cgroup.kill":           true,
+	"notify_on_release":     true,
+	"release_agent":         true,
+}
+
+// cgroup limits that are written back by RestoreCgroupTree. Other writable
+// cgroup files are not restored since writing them triggers an action (e.g.,
+// memory.force_empty, memory.max_usage_in_bytes) or they can't be changed once
+// the cgroup has children or processes (e.g., memory.use_hierarchy).
+var cgroupRestoreFiles = map[string]bool{
+	// cgroup v1
+	"cpu.shares":                     true,
+	"cpu.cfs_period_us":              true,
+	"cpu.cfs_quota_us":               true,
+	"cpu.rt_period_us":               true,
+	"cpu.rt_runtime_us":              true,
+	"cpuset.cpus":                    true,
+	"cpuset.mems":                    true,
+	"blkio.weight":                   true,
+	"blkio.leaf_weight":              true,
+	"memory.limit_in_bytes":          true,
+	"memory.soft_limit_in_bytes":     true,
+	"memory.memsw.limit_in_bytes":    true,
+	"memory.kmem.limit_in_bytes":     true,
+	"memory.kmem.tcp.limit_in_bytes": true,
+	"memory.swappiness":              true,
+	"net_cls.classid":                true,
+	"pids.max":                       true,
+
+	// cgroup v2
+	"cgroup.subtree_control": true,
+	"cgroup.max.depth":       true,
+	"cgroup.max.descendants": true,
+	"cpu.weight":             true,
+	"cpu.max":                true,
+	"memory.min":             true,
+	"memory.low":             true,
+	"memory.high":            true,
+	"memory.max":             true,
+	"memory.swap.max":        true,
+	"memory.oom.group":       true,
+}
+
+// isRestorableCgroupFile returns true if the given cgroup file is a limit that
+// RestoreCgroupTree writes back.
+func isRestorableCgroupFile(name string) bool {
+	if cgroupRestoreFiles[name] {
+		return true
+	}
+	// hugetlb.<pagesize>.limit_in_bytes (v1) and hugetlb.<pagesize>.max (v2)
+	if strings.HasPrefix(name, "hugetlb.") {
+		return strings.HasSuffix(name, ".limit_in_bytes") || strings.HasSuffix(name, ".max")
+	}
+	return false
+}
+
+// SnapshotCgroupTree returns a snapshot of the cgroup trees rooted at the
+// given subsystem paths.
+func SnapshotCgroupTree(containerID string, paths map[string]string) (*CgroupSnapshot, error) {
+	snap := &CgroupSnapshot{
+		Version:     CgroupSnapshotVersion,
+		ContainerID: containerID,
+		Subsystems:  make(map[string]*CgroupSnapshotNode),
+	}
+
+	for subsys, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		node, err := snapshotCgroupNode(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot cgroup %s: %v", path, err)
+		}
+		snap.Subsystems[subsys] = node
+	}
+
+	return snap, nil
+}
+
+func snapshotCgroupNode(path string) (*CgroupSnapshotNode, error) {
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &CgroupSnapshotNode{
+		Limits:   make(map[string]string),
+		Stats:    make(map[string]string),
+		Children: make(map[string]*CgroupSnapshotNode),
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+
+		if e.IsDir() {
+			child, err := snapshotCgroupNode(filepath.Join(path, name))
+			if err != nil {
+				// the child cgroup may have been removed while walking the tree
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+			node.Children[name] = child
+			continue
+		}
+
+		if !e.Mode().IsRegular() || cgroupSnapshotSkipFiles[name] {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(path, name))
+		if err != nil {
+			// write-only or otherwise unreadable file; skip it
+			continue
+		}
+		val := strings.TrimSpace(string(data))
+
+		if e.Mode().Perm()&0200 != 0 {
+			node.Limits[name] = val
+		} else {
+			node.Stats[name] = val
+		}
+	}
+
+	return node, nil
+}
+
+// RestoreCgroupTree writes the limits in the given snapshot back to the cgroup
+// trees rooted at the given subsystem paths, creating child cgroups as needed.
+// Only the limits in cgroupRestoreFiles are restored; process memberships and
+// other writable files are not. Limits are only written when they differ from
+// the current ones, and a parent's limits are written before its children's
+// (e.g., so that cgroup v2 controllers are enabled in the parent's
+// cgroup.subtree_control before the children's limits are set).
+func RestoreCgroupTree(snap *CgroupSnapshot, paths map[string]string) error {
+	if snap.Version != CgroupSnapshotVersion {
+		return fmt.Errorf("unsupported cgroup snapshot version %d (expected %d)", snap.Version, CgroupSnapshotVersion)
+	}
+
+	for subsys, node := range snap.Subsystems {
+		path, ok := paths[subsys]
+		if !ok {
+			return fmt.Errorf("no cgroup path for subsystem %q in snapshot", subsys)
+		}
+
+		if err := restoreCgroupNode(path, node); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func restoreCgroupNode(path string, node *CgroupSnapshotNode) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+
+	// write the limits in a deterministic order
+	files := make([]string, 0, len(node.Limits))
+	for name := range node.Limits {
+		if isRestorableCgroupFile(name) {
+			files = append(files, name)
+		}
+	}
+	sort.Strings(files)
+
+	for _, name := range files {
+		val := node.Limits[name]
+		file := filepath.Join(path, name)
+
+		cur, err := ioutil.ReadFile(file)
+		if err == nil && strings.TrimSpace(string(cur)) == val {
+			continue
+		}
+
+		// cgroup.subtree_control reads as "cpu memory" but is written as
+		// "+cpu +memory"
+		if name == "cgroup.subtree_control" && val != "" {
+			val = "+" + strings.Join(strings.Fields(val), " +")
+		}
+
+		if err := ioutil.WriteFile(file, []byte(val), 0); err != nil {
+			return fmt.Errorf("failed to restore %s: %v", file, err)
+		}
+	}
+
+	for name, child := range node.Children {
+		if err := restoreCgroupNode(filepath.Join(path, name), child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
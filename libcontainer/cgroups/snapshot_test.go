@@ -0,0 +1,138 @@
+// +build linux
+
+package cgroups
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotAndRestoreCgroupTree(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup-snapshot-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	memPath := filepath.Join(root, "memory", "ctr")
+	childPath := filepath.Join(memPath, "inner", "ctr2")
+	if err := os.MkdirAll(childPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []struct {
+		dir  string
+		name string
+		data string
+		mode os.FileMode
+	}{
+		{memPath, "memory.limit_in_bytes", "1073741824\n", 0644},
+		{memPath, "memory.usage_in_bytes", "4096\n", 0444},
+		{memPath, "memory.max_usage_in_bytes", "8192\n", 0644},
+		{memPath, "memory.stat", "cache 0\nrss 4096\n", 0444},
+		{memPath, "cgroup.procs", "1\n2\n", 0644},
+		{memPath, "tasks", "1\n2\n", 0644},
+		{childPath, "memory.limit_in_bytes", "536870912\n", 0644},
+		{childPath, "cgroup.procs", "3\n", 0644},
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(f.dir, f.name), []byte(f.data), f.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths := map[string]string{
+		"memory":  memPath,
+		"missing": filepath.Join(root, "missing"),
+	}
+
+	snap, err := SnapshotCgroupTree("ctr", paths)
+	if err != nil {
+		t.Fatalf("SnapshotCgroupTree: unexpected error: %v", err)
+	}
+
+	if snap.Version != CgroupSnapshotVersion || snap.ContainerID != "ctr" {
+		t.Errorf("SnapshotCgroupTree: bad snapshot header: version %d, id %q", snap.Version, snap.ContainerID)
+	}
+	if _, ok := snap.Subsystems["missing"]; ok {
+		t.Errorf("SnapshotCgroupTree: non-existent subsystem path included")
+	}
+
+	mem, ok := snap.Subsystems["memory"]
+	if !ok {
+		t.Fatalf("SnapshotCgroupTree: memory subsystem missing")
+	}
+	if mem.Limits["memory.limit_in_bytes"] != "1073741824" {
+		t.Errorf("SnapshotCgroupTree: want memory limit 1073741824; got %q", mem.Limits["memory.limit_in_bytes"])
+	}
+	if mem.Stats["memory.stat"] != "cache 0\nrss 4096" {
+		t.Errorf("SnapshotCgroupTree: bad memory.stat: %q", mem.Stats["memory.stat"])
+	}
+	if _, ok := mem.Limits["memory.usage_in_bytes"]; ok {
+		t.Errorf("SnapshotCgroupTree: read-only file included in limits")
+	}
+	if _, ok := mem.Limits[CgroupProcesses]; ok {
+		t.Errorf("SnapshotCgroupTree: process membership included in snapshot")
+	}
+	if _, ok := mem.Limits["tasks"]; ok {
+		t.Errorf("SnapshotCgroupTree: process membership included in snapshot")
+	}
+
+	inner, ok := mem.Children["inner"]
+	if !ok {
+		t.Fatalf("SnapshotCgroupTree: child cgroup missing")
+	}
+	child, ok := inner.Children["ctr2"]
+	if !ok || child.Limits["memory.limit_in_bytes"] != "536870912" {
+		t.Errorf("SnapshotCgroupTree: bad grandchild cgroup: %+v", child)
+	}
+
+	// the snapshot must survive a JSON round-trip
+	data, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &CgroupSnapshot{}
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+
+	// restore into a fresh tree
+	newPath := filepath.Join(root, "memory", "ctr-new")
+	if err := RestoreCgroupTree(restored, map[string]string{"memory": newPath}); err != nil {
+		t.Fatalf("RestoreCgroupTree: unexpected error: %v", err)
+	}
+
+	checks := map[string]string{
+		filepath.Join(newPath, "memory.limit_in_bytes"):                  "1073741824",
+		filepath.Join(newPath, "inner", "ctr2", "memory.limit_in_bytes"): "536870912",
+	}
+	for file, want := range checks {
+		got, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Errorf("RestoreCgroupTree: %v", err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("RestoreCgroupTree: %s: want %q; got %q", file, want, string(got))
+		}
+	}
+
+	for _, name := range []string{"memory.stat", "memory.max_usage_in_bytes", CgroupProcesses} {
+		if _, err := os.Stat(filepath.Join(newPath, name)); !os.IsNotExist(err) {
+			t.Errorf("RestoreCgroupTree: %s should not have been written", name)
+		}
+	}
+
+	// missing subsystem path and unsupported version
+	if err := RestoreCgroupTree(restored, map[string]string{}); err == nil {
+		t.Errorf("RestoreCgroupTree: expected error for missing subsystem path")
+	}
+	restored.Version = CgroupSnapshotVersion + 1
+	if err := RestoreCgroupTree(restored, map[string]string{"memory": newPath}); err == nil {
+		t.Errorf("RestoreCgroupTree: expected error for unsupported snapshot version")
+	}
+}
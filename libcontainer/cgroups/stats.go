@@ -37,6 +37,15 @@ type CpuUsage struct {
 type CpuStats struct {
 	CpuUsage       CpuUsage       `json:"cpu_usage,omitempty"`
 	ThrottlingData ThrottlingData `json:"throttling_data,omitempty"`
+	// Number of periods in which a burst occurred
+	Bursts uint64 `json:"bursts,omitempty"`
+	// Aggregate time spent bursting above the quota (in usecs)
+	BurstUs uint64 `json:"burst_us,omitempty"`
+	// CPU time (in usecs) the cgroup may use per period (-1 if unlimited), as
+	// set in the cgroup v2 cpu.max file
+	Quota int64 `json:"quota,omitempty"`
+	// Length of the quota period (in usecs)
+	Period uint64 `json:"period,omitempty"`
 }
 
 type CPUSetStats struct {
@@ -89,10 +98,42 @@ type MemoryStats struct {
 	PageUsageByNUMA PageUsageByNUMA `json:"page_usage_by_numa,omitempty"`
 	// if true, memory usage is accounted for throughout a hierarchy of cgroups.
 	UseHierarchy bool `json:"use_hierarchy"`
+	// memory event counters (cgroup v2 memory.events; on cgroup v1 only the
+	// oom counter is set, from memory.failcnt)
+	Events MemoryEvents `json:"events,omitempty"`
+	// memory usage by NUMA node, keyed by node number (from memory.numa_stat)
+	NUMAStats map[int]NUMANodeStat `json:"numa_stats,omitempty"`
 
 	Stats map[string]uint64 `json:"stats,omitempty"`
 }
 
+type MemoryEvents struct {
+	// number of times the cgroup was reclaimed due to high memory pressure
+	// even though its usage was under the low boundary
+	Low uint64 `json:"low,omitempty"`
+	// number of times processes of the cgroup were throttled and routed to
+	// perform direct memory reclaim because the high boundary was exceeded
+	High uint64 `json:"high,omitempty"`
+	// number of times the cgroup's memory usage was about to go over the max boundary
+	Max uint64 `json:"max,omitempty"`
+	// number of times the cgroup's memory usage reached the limit and allocation failed
+	Oom uint64 `json:"oom,omitempty"`
+	// number of processes belonging to this cgroup killed by any kind of OOM killer
+	OomKill uint64 `json:"oom_kill,omitempty"`
+}
+
+// NUMANodeStat holds the memory usage (in bytes) of a cgroup on a single NUMA
+// node. On cgroup v1 only Anon and File are set.
+type NUMANodeStat struct {
+	Anon          uint64 `json:"anon,omitempty"`
+	File          uint64 `json:"file,omitempty"`
+	Shmem         uint64 `json:"shmem,omitempty"`
+	FileMapped    uint64 `json:"file_mapped,omitempty"`
+	FileDirty     uint64 `json:"file_dirty,omitempty"`
+	FileWriteback uint64 `json:"file_writeback,omitempty"`
+	ShmemThp      uint64 `json:"shmem_thp,omitempty"`
+}
+
 type PageUsageByNUMA struct {
 	// Embedding is used as types can't be recursive.
 	PageUsageByNUMAInner
@@ -118,6 +159,13 @@ type PidsStats struct {
 	Limit uint64 `json:"limit,omitempty"`
 }
 
+type NetPrioStats struct {
+	// index of the cgroup in the net_prio hierarchy
+	Prioidx uint64 `json:"prioidx,omitempty"`
+	// network priority of the cgroup's traffic, per interface
+	Ifpriomap map[string]uint32 `json:"ifpriomap,omitempty"`
+}
+
 type BlkioStatEntry struct {
 	Major uint64 `json:"major,omitempty"`
 	Minor uint64 `json:"minor,omitempty"`
@@ -135,6 +183,11 @@ type BlkioStats struct {
 	IoMergedRecursive       []BlkioStatEntry `json:"io_merged_recursive,omitempty"`
 	IoTimeRecursive         []BlkioStatEntry `json:"io_time_recursive,omitempty"`
 	SectorsRecursive        []BlkioStatEntry `json:"sectors_recursive,omitempty"`
+	// number of bytes and operations discarded (cgroup v2 only)
+	IoDiscardedBytesRecursive []BlkioStatEntry `json:"io_discarded_bytes_recursive,omitempty"`
+	IoDiscardedOpsRecursive   []BlkioStatEntry `json:"io_discarded_ops_recursive,omitempty"`
+	// average IO latency (in usecs), for devices with an io.latency target (cgroup v2 only)
+	IoLatencyRecursive []BlkioStatEntry `json:"io_latency_recursive,omitempty"`
 }
 
 type HugetlbStats struct {
@@ -152,6 +205,8 @@ type Stats struct {
 	MemoryStats MemoryStats `json:"memory_stats,omitempty"`
 	PidsStats   PidsStats   `json:"pids_stats,omitempty"`
 	BlkioStats  BlkioStats  `json:"blkio_stats,omitempty"`
+	// only available for cgroup v1
+	NetPrioStats NetPrioStats `json:"net_prio_stats,omitempty"`
 	// the map is in the format "size of hugepage: stats of the hugepage"
 	HugetlbStats map[string]HugetlbStats `json:"hugetlb_stats,omitempty"`
 }
@@ -0,0 +1,201 @@
+// +build linux
+
+package systemd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// UnitDropInDir is the directory where the resource settings of the
+// container's transient systemd units are persisted (as runtime unit drop-ins),
+// so they survive systemd restarts. Like the containers, they don't survive
+// host reboots.
+const UnitDropInDir = "/run/systemd/system"
+
+const resourcesDropIn = "override.conf"
+
+// PersistResources writes the given resource settings of the unit (i.e., those
+// last passed to Set()) to a systemd drop-in file at
+// <configDir>/<unitName>.d/override.conf.
+func (m *legacyManager) PersistResources(configDir string, r *configs.Resources) error {
+	if m.cgroups.Paths != nil {
+		return nil
+	}
+
+	unitName := getUnitName(m.cgroups)
+	return writeResourcesDropIn(configDir, unitName, r)
+}
+
+// LoadPersistedResources reads the unit's drop-in file written by
+// PersistResources (if any) and applies its resource settings to the unit.
+func (m *legacyManager) LoadPersistedResources(configDir string) error {
+	if m.cgroups.Paths != nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	unitName := getUnitName(m.cgroups)
+
+	data, err := ioutil.ReadFile(resourcesDropInPath(configDir, unitName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	properties, err := parseResourcesDropIn(data)
+	if err != nil {
+		return fmt.Errorf("invalid drop-in for unit %s: %v", unitName, err)
+	}
+	if len(properties) == 0 {
+		return nil
+	}
+
+	dbusConnection, err := getDbusConnection(false)
+	if err != nil {
+		return err
+	}
+
+	return dbusConnection.SetUnitProperties(unitName, true, properties...)
+}
+
+func resourcesDropInPath(configDir, unitName string) string {
+	return filepath.Join(configDir, unitName+".d", resourcesDropIn)
+}
+
+func writeResourcesDropIn(configDir, unitName string, r *configs.Resources) error {
+	if r == nil {
+		return nil
+	}
+
+	path := resourcesDropInPath(configDir, unitName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// write to a tmp file first, so systemd never sees a partial drop-in
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, genResourcesDropIn(unitName, r), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func removeResourcesDropIn(configDir, unitName string) error {
+	path := resourcesDropInPath(configDir, unitName)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// the drop-in dir may hold other (non sysbox) drop-ins; only remove it if empty
+	_ = os.Remove(filepath.Dir(path))
+	return nil
+}
+
+// genResourcesDropIn generates a drop-in with the given resource settings for
+// the given unit; the settings match those in genV1ResourcesProperties().
+func genResourcesDropIn(unitName string, r *configs.Resources) []byte {
+	var buf bytes.Buffer
+
+	section := strings.Title(strings.TrimPrefix(filepath.Ext(unitName), "."))
+
+	fmt.Fprintf(&buf, "# Generated by sysbox-runc; do not edit.\n")
+	fmt.Fprintf(&buf, "[%s]\n", section)
+
+	if r.Memory != 0 {
+		fmt.Fprintf(&buf, "MemoryLimit=%d\n", r.Memory)
+	}
+
+	if r.CpuShares != 0 {
+		fmt.Fprintf(&buf, "CPUShares=%d\n", r.CpuShares)
+	}
+
+	if r.CpuQuota > 0 {
+		period := r.CpuPeriod
+		if period == 0 {
+			period = defCPUQuotaPeriod
+		}
+		// CPUQuota is an integer percentage; round up as in addCpuQuota()
+		pct := (uint64(r.CpuQuota)*100 + period - 1) / period
+		fmt.Fprintf(&buf, "CPUQuota=%d%%\n", pct)
+	}
+
+	if r.BlkioWeight != 0 {
+		fmt.Fprintf(&buf, "BlockIOWeight=%d\n", r.BlkioWeight)
+	}
+
+	if r.PidsLimit > 0 {
+		fmt.Fprintf(&buf, "TasksAccounting=yes\nTasksMax=%d\n", r.PidsLimit)
+	} else if r.PidsLimit == -1 {
+		fmt.Fprintf(&buf, "TasksAccounting=yes\nTasksMax=infinity\n")
+	}
+
+	return buf.Bytes()
+}
+
+// parseResourcesDropIn converts the settings in a drop-in generated by
+// genResourcesDropIn() to systemd unit properties.
+func parseResourcesDropIn(data []byte) ([]systemdDbus.Property, error) {
+	var properties []systemdDbus.Property
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' || line[0] == '[' {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		key, val := kv[0], kv[1]
+
+		switch key {
+		case "MemoryLimit", "CPUShares", "BlockIOWeight":
+			v, err := strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value %q: %v", key, val, err)
+			}
+			properties = append(properties, newProp(key, v))
+
+		case "CPUQuota":
+			pct, err := strconv.ParseUint(strings.TrimSuffix(val, "%"), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value %q: %v", key, val, err)
+			}
+			properties = append(properties, newProp("CPUQuotaPerSecUSec", pct*10000))
+
+		case "TasksAccounting":
+			properties = append(properties, newProp(key, val == "yes"))
+
+		case "TasksMax":
+			var v uint64 = math.MaxUint64
+			if val != "infinity" {
+				var err error
+				v, err = strconv.ParseUint(val, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s value %q: %v", key, val, err)
+				}
+			}
+			properties = append(properties, newProp(key, v))
+
+		default:
+			return nil, fmt.Errorf("unsupported setting %s", key)
+		}
+	}
+
+	return properties, nil
+}
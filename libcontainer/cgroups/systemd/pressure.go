@@ -0,0 +1,42 @@
+// +build linux
+
+package systemd
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+)
+
+// The cgroup v1 controllers whose cgroups hold each pressure file (on kernels
+// that expose PSI in cgroup v1 hierarchies, via the psi_v1 boot option)
+var pressureV1Subsystems = map[string]string{
+	"cpu":    "cpu",
+	"io":     "blkio",
+	"memory": "memory",
+}
+
+// SubscribePressure subscribes to the pressure events of the given subsystem
+// ("cpu", "io" or "memory") in the container's cgroup; see
+// cgroups.SubscribePressure. The pressure file is taken from the container's
+// cgroup v2 cgroup on hybrid hosts, or else from its cgroup v1 cgroup.
+func (m *legacyManager) SubscribePressure(subsystem string, window time.Duration, threshold float64) (<-chan cgroups.PressureEvent, cgroups.PressureCancelFunc, error) {
+	file, err := cgroups.PressureFile(subsystem)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m.mu.Lock()
+	dir := m.unifiedPath()
+	if dir == "" || !cgroups.PathExists(filepath.Join(dir, file)) {
+		dir = m.paths[pressureV1Subsystems[subsystem]]
+	}
+	m.mu.Unlock()
+
+	if dir == "" {
+		return nil, nil, cgroups.ErrPressureNotSupported
+	}
+
+	return cgroups.SubscribePressure(dir, subsystem, window, threshold)
+}
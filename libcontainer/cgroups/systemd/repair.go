@@ -0,0 +1,141 @@
+// +build linux
+
+package systemd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/sirupsen/logrus"
+)
+
+// updatePaths recomputes the manager's cgroup paths from the given unit
+// control group, and returns the subsystems whose path changed.
+func (m *legacyManager) updatePaths(controlGroup string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changed := []string{}
+	paths := make(map[string]string, len(m.paths))
+
+	for name, path := range m.paths {
+		newPath, err := controlGroupPath(name, controlGroup)
+		if err != nil {
+			logrus.Warnf("failed to get %s cgroup path for control group %s: %v", name, controlGroup, err)
+			newPath = path
+		}
+		if newPath != path {
+			changed = append(changed, name)
+		}
+		paths[name] = newPath
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	logrus.Debugf("cgroup paths of unit %s changed: %v", getUnitName(m.cgroups), paths)
+
+	m.paths = paths
+
+	return changed
+}
+
+// AutoRepairCgroupPaths enables repairing the container's cgroup paths (see
+// RepairCgroupPaths()) when getting its cgroup stats fails.
+var AutoRepairCgroupPaths = false
+
+// RepairCgroupPaths re-syncs the manager's cgroup paths with the control
+// group systemd currently reports for the container's unit (e.g., systemd may
+// move the unit's cgroups across a host suspend/resume cycle), and places the
+// given pid (if > 0) in the cgroups whose path changed.
+func (m *legacyManager) RepairCgroupPaths(pid int) error {
+	unitName := getUnitName(m.cgroups)
+
+	controlGroup, err := unitControlGroup(unitName)
+	if err != nil {
+		return fmt.Errorf("failed to get control group of unit %s: %v", unitName, err)
+	}
+
+	changed := m.updatePaths(controlGroup)
+	if len(changed) == 0 || pid <= 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	paths := make(map[string]string, len(m.paths))
+	for k, v := range m.paths {
+		paths[k] = v
+	}
+	m.mu.Unlock()
+
+	for _, name := range changed {
+		// systemd takes care of this one
+		if name == "name=systemd" {
+			continue
+		}
+
+		path := paths[name]
+		err := withTimeout(CgroupJoinTimeout, func() error {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			return cgroups.WriteCgroupProc(path, pid)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to place pid %d in the %s cgroup at %s: %v", pid, name, path, err)
+		}
+	}
+
+	return nil
+}
+
+// unitControlGroup returns the control group systemd reports for the given
+// unit (replaceable for testing).
+var unitControlGroup = func(unitName string) (string, error) {
+	conn, err := getDbusConnection(false)
+	if err != nil {
+		return "", err
+	}
+
+	// the ControlGroup property belongs to the unit type's interface (e.g., "Scope")
+	unitType := strings.TrimPrefix(filepath.Ext(unitName), ".")
+	if unitType == "" {
+		return "", fmt.Errorf("unit %s has no type suffix", unitName)
+	}
+	unitType = strings.ToUpper(unitType[:1]) + unitType[1:]
+
+	prop, err := conn.GetUnitTypeProperty(unitName, unitType, "ControlGroup")
+	if err != nil {
+		return "", err
+	}
+
+	controlGroup, ok := prop.Value.Value().(string)
+	if !ok || controlGroup == "" {
+		return "", fmt.Errorf("unit %s has no control group", unitName)
+	}
+
+	return controlGroup, nil
+}
+
+// controlGroupPath returns the path of the given systemd control group (e.g.,
+// "/system.slice/foo.scope") in the given subsystem's hierarchy (replaceable
+// for testing).
+var controlGroupPath = func(subsystem, controlGroup string) (string, error) {
+	mountpoint, err := cgroups.FindCgroupMountpoint("", subsystem)
+	if err != nil {
+		return "", err
+	}
+
+	initPath, err := cgroups.GetInitCgroup(subsystem)
+	if err != nil {
+		return "", err
+	}
+	// if pid 1 is systemd 226 or later, it will be in init.scope, not the root
+	initPath = strings.TrimSuffix(filepath.Clean(initPath), "init.scope")
+
+	return filepath.Join(mountpoint, initPath, controlGroup), nil
+}
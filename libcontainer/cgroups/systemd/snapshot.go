@@ -0,0 +1,20 @@
+// +build linux
+
+package systemd
+
+import (
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+)
+
+// SnapshotCgroupTree returns a snapshot of the container's child cgroup tree
+// (i.e., the cgroups delegated to the container and those created within it
+// by inner cgroup managers).
+func (m *legacyManager) SnapshotCgroupTree(containerID string) (*cgroups.CgroupSnapshot, error) {
+	return cgroups.SnapshotCgroupTree(containerID, m.GetChildCgroupPaths())
+}
+
+// RestoreCgroupTree writes the limits in the given snapshot back to the
+// container's child cgroup tree. Process memberships are not restored.
+func (m *legacyManager) RestoreCgroupTree(snap *cgroups.CgroupSnapshot) error {
+	return cgroups.RestoreCgroupTree(snap, m.GetChildCgroupPaths())
+}
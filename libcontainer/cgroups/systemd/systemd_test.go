@@ -1,7 +1,24 @@
 package systemd
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"golang.org/x/sys/unix"
 )
 
 func TestSystemdVersion(t *testing.T) {
@@ -30,3 +47,701 @@ func TestSystemdVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestResourcesDropIn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd-dropin-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	unitName := "sysbox-runc-abc.scope"
+	r := &configs.Resources{
+		Memory:      1073741824,
+		CpuShares:   512,
+		CpuQuota:    50001,
+		CpuPeriod:   100000,
+		BlkioWeight: 500,
+		PidsLimit:   -1,
+	}
+
+	if err := writeResourcesDropIn(dir, unitName, r); err != nil {
+		t.Fatalf("writeResourcesDropIn failed: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, unitName+".d", "override.conf"))
+	if err != nil {
+		t.Fatalf("drop-in file not found: %v", err)
+	}
+
+	expected := "# Generated by sysbox-runc; do not edit.\n" +
+		"[Scope]\n" +
+		"MemoryLimit=1073741824\n" +
+		"CPUShares=512\n" +
+		"CPUQuota=51%\n" +
+		"BlockIOWeight=500\n" +
+		"TasksAccounting=yes\n" +
+		"TasksMax=infinity\n"
+
+	if string(data) != expected {
+		t.Errorf("unexpected drop-in; want:\n%s\ngot:\n%s", expected, data)
+	}
+
+	props, err := parseResourcesDropIn(data)
+	if err != nil {
+		t.Fatalf("parseResourcesDropIn failed: %v", err)
+	}
+
+	expectedProps := []systemdDbus.Property{
+		newProp("MemoryLimit", uint64(1073741824)),
+		newProp("CPUShares", uint64(512)),
+		newProp("CPUQuotaPerSecUSec", uint64(510000)),
+		newProp("BlockIOWeight", uint64(500)),
+		newProp("TasksAccounting", true),
+		newProp("TasksMax", uint64(math.MaxUint64)),
+	}
+
+	if !reflect.DeepEqual(props, expectedProps) {
+		t.Errorf("unexpected properties; want %v, got %v", expectedProps, props)
+	}
+
+	if _, err := parseResourcesDropIn([]byte("[Scope]\nCPUWeight=100\n")); err == nil {
+		t.Errorf("parseResourcesDropIn: expected error for unsupported setting")
+	}
+
+	if err := removeResourcesDropIn(dir, unitName); err != nil {
+		t.Fatalf("removeResourcesDropIn failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, unitName+".d")); !os.IsNotExist(err) {
+		t.Errorf("drop-in dir not removed")
+	}
+
+	// slices get a [Slice] section
+	data = genResourcesDropIn("machine.slice", &configs.Resources{CpuShares: 2})
+	if !strings.Contains(string(data), "[Slice]\n") {
+		t.Errorf("unexpected drop-in for slice unit:\n%s", data)
+	}
+}
+
+func TestGenV1ResourcesPropertiesCpuset(t *testing.T) {
+	// AllowedCPUs and AllowedMemoryNodes require systemd >= 244
+	versionOnce.Do(func() { version = 244 })
+	if systemdVersion(nil) < 244 {
+		t.Skip("systemd version already cached and too old")
+	}
+
+	cg := &configs.Cgroup{
+		Resources: &configs.Resources{
+			CpusetCpus:          "2-3",
+			CpusetMems:          "0",
+			CpusetCpusExclusive: true,
+		},
+	}
+
+	props, err := genV1ResourcesProperties(cg, nil)
+	if err != nil {
+		t.Fatalf("genV1ResourcesProperties: unexpected error: %v", err)
+	}
+
+	cpus, _ := rangeToBits("2-3")
+	mems, _ := rangeToBits("0")
+	want := map[string][]byte{
+		"AllowedCPUs":        cpus,
+		"AllowedMemoryNodes": mems,
+	}
+
+	for _, p := range props {
+		if bits, ok := want[p.Name]; ok {
+			if !bytes.Equal(p.Value.Value().([]byte), bits) {
+				t.Errorf("genV1ResourcesProperties: %s: want %v; got %v", p.Name, bits, p.Value.Value())
+			}
+			delete(want, p.Name)
+		}
+	}
+	for name := range want {
+		t.Errorf("genV1ResourcesProperties: missing %s property", name)
+	}
+}
+
+func TestLegacyManagerKillCgroup(t *testing.T) {
+	m := &legacyManager{
+		cgroups: &configs.Cgroup{},
+		paths:   map[string]string{},
+	}
+
+	// no name=systemd cgroup
+	if err := m.KillCgroup(); err != cgroups.ErrCgroupKillNotSupported {
+		t.Errorf("KillCgroup: want ErrCgroupKillNotSupported; got %v", err)
+	}
+
+	sdMnt, err := cgroups.FindCgroupMountpoint("", "name=systemd")
+	if err != nil {
+		t.Skip("name=systemd cgroup hierarchy not found")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-cgroup-kill-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origUnifiedMountpoint := unifiedMountpoint
+	unifiedMountpoint = tmpDir
+	defer func() { unifiedMountpoint = origUnifiedMountpoint }()
+
+	m.paths["name=systemd"] = filepath.Join(sdMnt, "system.slice", "test.scope")
+
+	// no cgroup v2 cgroup for the unit
+	if err := m.KillCgroup(); err != cgroups.ErrCgroupKillNotSupported {
+		t.Errorf("KillCgroup: want ErrCgroupKillNotSupported; got %v", err)
+	}
+
+	unitPath := filepath.Join(tmpDir, "system.slice", "test.scope")
+	if err := os.MkdirAll(unitPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// kernel without cgroup.kill
+	if err := m.KillCgroup(); err != cgroups.ErrCgroupKillNotSupported {
+		t.Errorf("KillCgroup: want ErrCgroupKillNotSupported; got %v", err)
+	}
+
+	killFile := filepath.Join(unitPath, "cgroup.kill")
+	if err := ioutil.WriteFile(killFile, nil, 0200); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.KillCgroup(); err != nil {
+		t.Fatalf("KillCgroup: unexpected error: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(killFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "1" {
+		t.Errorf("KillCgroup: want \"1\" written to %s; got %q", killFile, string(data))
+	}
+}
+
+func TestLegacyManagerReclaimMemory(t *testing.T) {
+	m := &legacyManager{
+		cgroups: &configs.Cgroup{},
+		paths:   map[string]string{},
+	}
+
+	// no name=systemd cgroup (e.g., cgroup v1 only host)
+	if err := m.ReclaimMemory(4096); err != cgroups.ErrMemoryReclaimNotSupported {
+		t.Errorf("ReclaimMemory: want ErrMemoryReclaimNotSupported; got %v", err)
+	}
+
+	sdMnt, err := cgroups.FindCgroupMountpoint("", "name=systemd")
+	if err != nil {
+		t.Skip("name=systemd cgroup hierarchy not found")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-cgroup-reclaim-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origUnifiedMountpoint := unifiedMountpoint
+	unifiedMountpoint = tmpDir
+	defer func() { unifiedMountpoint = origUnifiedMountpoint }()
+
+	m.paths["name=systemd"] = filepath.Join(sdMnt, "system.slice", "test.scope")
+
+	unitPath := filepath.Join(tmpDir, "system.slice", "test.scope")
+	if err := os.MkdirAll(unitPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// kernel without memory.reclaim (< 5.19)
+	if err := m.ReclaimMemory(4096); err != cgroups.ErrMemoryReclaimNotSupported {
+		t.Errorf("ReclaimMemory: want ErrMemoryReclaimNotSupported; got %v", err)
+	}
+
+	reclaimFile := filepath.Join(unitPath, "memory.reclaim")
+	if err := ioutil.WriteFile(reclaimFile, nil, 0200); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ReclaimMemory(4096); err != nil {
+		t.Fatalf("ReclaimMemory: unexpected error: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(reclaimFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "4096" {
+		t.Errorf("ReclaimMemory: want \"4096\" written to %s; got %q", reclaimFile, string(data))
+	}
+}
+
+func TestLegacyManagerSetUnified(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sysbox-cgroup-unified-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origUnifiedMountpoint := unifiedMountpoint
+	origIsCgroup2UnifiedMode := isCgroup2UnifiedMode
+	defer func() {
+		unifiedMountpoint = origUnifiedMountpoint
+		isCgroup2UnifiedMode = origIsCgroup2UnifiedMode
+	}()
+
+	res := map[string]string{"cgroup.max.depth": "3"}
+
+	// pure cgroup v1
+	isCgroup2UnifiedMode = func() bool { return false }
+	unifiedMountpoint = filepath.Join(tmpDir, "unified")
+
+	m := &legacyManager{
+		cgroups: &configs.Cgroup{},
+		paths:   map[string]string{},
+	}
+	if isHybridCgroupSystem() {
+		t.Errorf("isHybridCgroupSystem: want false without %s", unifiedMountpoint)
+	}
+	if err := m.setUnified(res); err != cgroups.ErrV1NoUnified {
+		t.Errorf("setUnified: want ErrV1NoUnified on cgroup v1; got %v", err)
+	}
+	if err := m.setUnified(nil); err != nil {
+		t.Errorf("setUnified: unexpected error without unified resources: %v", err)
+	}
+
+	// pure cgroup v2
+	isCgroup2UnifiedMode = func() bool { return true }
+
+	v2Path := filepath.Join(tmpDir, "v2", "test.scope")
+	if err := os.MkdirAll(v2Path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(v2Path, "cgroup.max.depth"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m.paths[""] = v2Path
+
+	if err := m.setUnified(res); err != nil {
+		t.Fatalf("setUnified: unexpected error on cgroup v2: %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(v2Path, "cgroup.max.depth"))
+	if err != nil || string(data) != "3" {
+		t.Errorf("setUnified: want \"3\" written on cgroup v2; got %q (err %v)", string(data), err)
+	}
+
+	if err := m.setUnified(map[string]string{"../cgroup.max.depth": "3"}); err == nil {
+		t.Errorf("setUnified: want error for resource with slashes")
+	}
+
+	// hybrid
+	isCgroup2UnifiedMode = func() bool { return false }
+
+	sdMnt, err := cgroups.FindCgroupMountpoint("", "name=systemd")
+	if err != nil {
+		t.Skip("name=systemd cgroup hierarchy not found")
+	}
+
+	m.paths = map[string]string{
+		"name=systemd": filepath.Join(sdMnt, "system.slice", "test.scope"),
+	}
+	unitPath := filepath.Join(unifiedMountpoint, "system.slice", "test.scope")
+	if err := os.MkdirAll(unitPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(unitPath, "cgroup.max.depth"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !isHybridCgroupSystem() {
+		t.Errorf("isHybridCgroupSystem: want true with %s", unifiedMountpoint)
+	}
+
+	if err := m.setUnified(res); err != nil {
+		t.Fatalf("setUnified: unexpected error on hybrid cgroups: %v", err)
+	}
+	data, err = ioutil.ReadFile(filepath.Join(unitPath, "cgroup.max.depth"))
+	if err != nil || string(data) != "3" {
+		t.Errorf("setUnified: want \"3\" written on hybrid cgroups; got %q (err %v)", string(data), err)
+	}
+}
+
+func TestLegacyManagerExitStatus(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sysbox-exit-status-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origProcRoot := procRoot
+	procRoot = tmpDir
+	defer func() { procRoot = origProcRoot }()
+
+	m := &legacyManager{
+		cgroups: &configs.Cgroup{},
+		initPid: 1234,
+	}
+
+	statDir := filepath.Join(tmpDir, "1234")
+	if err := os.MkdirAll(statDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	statFile := filepath.Join(statDir, "stat")
+
+	statFmt := "1234 (init) %s 1 1234 1234 0 -1 4194560 0 0 0 0 0 0 0 0 20 0 1 0 9214966 0 0 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 1 0 0 0 0 0 0 0 0 0 0 0 0 %d"
+
+	test := []struct {
+		state    string
+		exitCode int // waitpid(2) status
+		status   int
+		exited   bool
+	}{
+		{"S", 0, 0, false},
+		{"R", 0, 0, false},
+		{"Z", 0, 0, true},
+		{"Z", 3 << 8, 3, true},
+		{"Z", 9, 128 + 9, true}, // killed by SIGKILL
+		{"X", 1 << 8, 1, true},
+	}
+
+	for _, tt := range test {
+		data := fmt.Sprintf(statFmt, tt.state, tt.exitCode)
+		if err := ioutil.WriteFile(statFile, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		status, exited := m.ExitStatus()
+		if exited != tt.exited || status != tt.status {
+			t.Errorf("ExitStatus (state %s, exit code %d): want (%d, %v); got (%d, %v)",
+				tt.state, tt.exitCode, tt.status, tt.exited, status, exited)
+		}
+	}
+
+	// reaped process
+	os.RemoveAll(statDir)
+	if _, exited := m.ExitStatus(); exited {
+		t.Errorf("ExitStatus: want false for reaped process")
+	}
+
+	// no init process
+	m.initPid = 0
+	if _, exited := m.ExitStatus(); exited {
+		t.Errorf("ExitStatus: want false when no process was placed in the cgroup")
+	}
+}
+
+func TestLegacyManagerWaitForExit(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sysbox-wait-exit-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origProcRoot := procRoot
+	origInterval := waitForExitInterval
+	procRoot = tmpDir
+	waitForExitInterval = 10 * time.Millisecond
+	defer func() {
+		procRoot = origProcRoot
+		waitForExitInterval = origInterval
+	}()
+
+	m := &legacyManager{
+		cgroups: &configs.Cgroup{},
+		paths:   map[string]string{},
+		initPid: 1234,
+	}
+
+	statDir := filepath.Join(tmpDir, "1234")
+	if err := os.MkdirAll(statDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	statFile := filepath.Join(statDir, "stat")
+
+	statFmt := "1234 (init) %s 1 1234 1234 0 -1 4194560 0 0 0 0 0 0 0 0 20 0 1 0 9214966 0 0 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 1 0 0 0 0 0 0 0 0 0 0 0 0 %d"
+
+	writeStat := func(state string, exitCode int) {
+		if err := ioutil.WriteFile(statFile, []byte(fmt.Sprintf(statFmt, state, exitCode)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the process exits with code 42 while being waited for
+	writeStat("S", 0)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		writeStat("Z", 42<<8)
+	}()
+
+	status, err := m.WaitForExit(context.Background())
+	if err != nil || status != 42 {
+		t.Errorf("WaitForExit: want status 42; got %d (err %v)", status, err)
+	}
+
+	// cancelled wait
+	writeStat("S", 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := m.WaitForExit(ctx); err != context.DeadlineExceeded {
+		t.Errorf("WaitForExit: want context.DeadlineExceeded; got %v", err)
+	}
+
+	// reaped process
+	os.RemoveAll(statDir)
+	if _, err := m.WaitForExit(context.Background()); err == nil {
+		t.Errorf("WaitForExit: want error for reaped process")
+	}
+
+	// no init process
+	m.initPid = 0
+	if _, err := m.WaitForExit(context.Background()); err == nil {
+		t.Errorf("WaitForExit: want error when no process was placed in the cgroup")
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	// fn completes in time
+	errFn := errors.New("fn error")
+	if err := withTimeout(time.Second, func() error { return errFn }); err != errFn {
+		t.Errorf("withTimeout: want %v; got %v", errFn, err)
+	}
+
+	// fn blocks until the timeout fires
+	release := make(chan struct{})
+	exited := make(chan struct{})
+
+	start := time.Now()
+	err := withTimeout(50*time.Millisecond, func() error {
+		<-release
+		close(exited)
+		return nil
+	})
+	if err != errTimeout {
+		t.Errorf("withTimeout: want errTimeout; got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("withTimeout: returned after %v, before the timeout", elapsed)
+	}
+
+	// the goroutine running fn must not leak once fn returns
+	close(release)
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Errorf("withTimeout: fn goroutine did not exit")
+	}
+
+	// no timeout
+	if err := withTimeout(0, func() error { time.Sleep(10 * time.Millisecond); return nil }); err != nil {
+		t.Errorf("withTimeout: unexpected error with timeout disabled: %v", err)
+	}
+}
+
+func TestLegacyManagerJoinCgroupsTimeout(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sysbox-cgroup-join-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origTimeout := CgroupJoinTimeout
+	CgroupJoinTimeout = 50 * time.Millisecond
+	defer func() { CgroupJoinTimeout = origTimeout }()
+
+	memPath := filepath.Join(tmpDir, "memory")
+	if err := os.MkdirAll(memPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &legacyManager{
+		cgroups: &configs.Cgroup{Resources: &configs.Resources{}},
+		paths:   map[string]string{"memory": memPath},
+	}
+
+	// healthy cgroup
+	procs := filepath.Join(memPath, cgroups.CgroupProcesses)
+	if err := ioutil.WriteFile(procs, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.joinCgroups(1234); err != nil {
+		t.Fatalf("joinCgroups: unexpected error: %v", err)
+	}
+	data, err := ioutil.ReadFile(procs)
+	if err != nil || string(data) != "1234" {
+		t.Errorf("joinCgroups: want pid written to cgroup.procs; got %q (%v)", data, err)
+	}
+
+	// hung cgroup: opening a fifo with no reader for writing blocks
+	os.Remove(procs)
+	if err := unix.Mkfifo(procs, 0644); err != nil {
+		t.Fatalf("failed to create fifo: %v", err)
+	}
+
+	err = m.joinCgroups(1234)
+	if err == nil || !strings.Contains(err.Error(), "memory") || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("joinCgroups: want timeout error for the memory cgroup; got %v", err)
+	}
+
+	// unblock the pending write
+	f, err := os.OpenFile(procs, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(f)
+	f.Close()
+}
+
+func TestLegacyManagerRepairCgroupPaths(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sysbox-cgroup-repair-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origControlGroupPath, origUnitControlGroup := controlGroupPath, unitControlGroup
+	defer func() { controlGroupPath, unitControlGroup = origControlGroupPath, origUnitControlGroup }()
+
+	fscommon.TestMode = true
+	defer func() { fscommon.TestMode = false }()
+
+	controlGroupPath = func(subsystem, controlGroup string) (string, error) {
+		return filepath.Join(tmpDir, subsystem, controlGroup), nil
+	}
+
+	controlGroup := "/system.slice/test-ctr.scope"
+	unitControlGroup = func(unitName string) (string, error) {
+		if unitName != "test-ctr.scope" {
+			return "", errors.New("no such unit")
+		}
+		return controlGroup, nil
+	}
+
+	before := map[string]string{
+		"memory":       filepath.Join(tmpDir, "memory/system.slice/test-ctr.scope"),
+		"pids":         filepath.Join(tmpDir, "pids/system.slice/test-ctr.scope"),
+		"name=systemd": filepath.Join(tmpDir, "name=systemd/system.slice/test-ctr.scope"),
+	}
+
+	m := &legacyManager{
+		cgroups: &configs.Cgroup{ScopePrefix: "test", Name: "ctr"},
+		paths:   make(map[string]string),
+	}
+	for k, v := range before {
+		m.paths[k] = v
+	}
+
+	// unchanged control group -> nothing to repair
+	if err := m.RepairCgroupPaths(1234); err != nil {
+		t.Fatalf("RepairCgroupPaths: unexpected error: %v", err)
+	}
+	if got := m.GetPaths(); !reflect.DeepEqual(got, before) {
+		t.Errorf("RepairCgroupPaths: paths unexpectedly changed: %v", got)
+	}
+
+	// systemd moved the unit
+	controlGroup = "/resume.slice/test-ctr.scope"
+
+	after := map[string]string{
+		"memory":       filepath.Join(tmpDir, "memory/resume.slice/test-ctr.scope"),
+		"pids":         filepath.Join(tmpDir, "pids/resume.slice/test-ctr.scope"),
+		"name=systemd": filepath.Join(tmpDir, "name=systemd/resume.slice/test-ctr.scope"),
+	}
+
+	if err := m.RepairCgroupPaths(1234); err != nil {
+		t.Fatalf("RepairCgroupPaths: unexpected error: %v", err)
+	}
+	if got := m.GetPaths(); !reflect.DeepEqual(got, after) {
+		t.Errorf("RepairCgroupPaths: want paths %v; got %v", after, got)
+	}
+
+	// the pid re-joined the changed cgroups (except name=systemd, which is systemd's job)
+	for _, name := range []string{"memory", "pids"} {
+		data, err := ioutil.ReadFile(filepath.Join(after[name], cgroups.CgroupProcesses))
+		if err != nil || string(data) != "1234" {
+			t.Errorf("RepairCgroupPaths: pid not placed in %s cgroup: %q (%v)", name, data, err)
+		}
+	}
+	if _, err := os.Stat(after["name=systemd"]); !os.IsNotExist(err) {
+		t.Errorf("RepairCgroupPaths: name=systemd cgroup unexpectedly joined")
+	}
+
+	// systemd query failure
+	m.cgroups.Name = "other"
+	if err := m.RepairCgroupPaths(1234); err == nil {
+		t.Errorf("RepairCgroupPaths: expected error when the unit's control group can't be queried")
+	}
+}
+
+func TestVerifyResourcesSet(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sysbox-resource-verify-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	paths := map[string]string{}
+	for _, subsys := range []string{"memory", "cpu", "pids"} {
+		paths[subsys] = filepath.Join(tmpDir, subsys)
+		if err := os.MkdirAll(paths[subsys], 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFiles := func(mem, shares, pids string) {
+		for file, val := range map[string]string{
+			filepath.Join(paths["memory"], "memory.limit_in_bytes"): mem,
+			filepath.Join(paths["cpu"], "cpu.shares"):               shares,
+			filepath.Join(paths["pids"], "pids.max"):                pids,
+		} {
+			if err := ioutil.WriteFile(file, []byte(val+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	pageSize := int64(os.Getpagesize())
+	resources := &configs.Resources{
+		Memory:    256*1024*1024 + 100, // not page aligned
+		CpuShares: 512,
+		PidsLimit: 100,
+	}
+
+	// values applied (memory limit rounded down by the kernel)
+	writeFiles(fmt.Sprint(256*1024*1024/pageSize*pageSize), "512", "100")
+	if errs := verifyResourcesSet(paths, resources); len(errs) != 0 {
+		t.Errorf("verifyResourcesSet: unexpected errors: %v", errs)
+	}
+
+	// values rejected or clamped by the kernel
+	writeFiles("9223372036854771712", "262144", "max")
+	errs := verifyResourcesSet(paths, resources)
+	want := map[string]string{
+		"memory.limit_in_bytes": "9223372036854771712",
+		"cpu.shares":            "262144",
+		"pids.max":              "max",
+	}
+	if len(errs) != len(want) {
+		t.Errorf("verifyResourcesSet: want %d errors; got %v", len(want), errs)
+	}
+	for _, e := range errs {
+		if want[e.Field] != e.Actual {
+			t.Errorf("verifyResourcesSet: unexpected error %+v", e)
+		}
+	}
+
+	// unlimited pids
+	writeFiles("0", "0", "max")
+	errs = verifyResourcesSet(paths, &configs.Resources{PidsLimit: -1})
+	if len(errs) != 0 {
+		t.Errorf("verifyResourcesSet: unexpected errors: %v", errs)
+	}
+
+	// unset resources and missing cgroups are not checked
+	if errs := verifyResourcesSet(map[string]string{}, resources); len(errs) != 0 {
+		t.Errorf("verifyResourcesSet: unexpected errors with no cgroup paths: %v", errs)
+	}
+	if errs := verifyResourcesSet(paths, &configs.Resources{}); len(errs) != 0 {
+		t.Errorf("verifyResourcesSet: unexpected errors with no resources: %v", errs)
+	}
+}
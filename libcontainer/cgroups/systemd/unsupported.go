@@ -82,3 +82,7 @@ func (m *Manager) ApplyChildCgroup(pid int) error {
 func (m *Manager) GetChildCgroupPaths() map[string]string {
 	return nil
 }
+
+func (m *Manager) UpdateChildCgroups(container *configs.Config) error {
+	return fmt.Errorf("Systemd not supported")
+}
@@ -3,19 +3,26 @@
 package systemd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fs"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fs2"
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/system"
+	"github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
 type legacyManager struct {
@@ -23,6 +30,7 @@ type legacyManager struct {
 	cgroups            *configs.Cgroup
 	paths              map[string]string
 	childCgroupCreated bool
+	initPid            int // pid of the process placed in the cgroup by Apply()
 }
 
 func NewLegacyManager(cg *configs.Cgroup, paths map[string]string) cgroups.Manager {
@@ -88,6 +96,18 @@ func genV1ResourcesProperties(c *configs.Cgroup, conn *systemdDbus.Conn) ([]syst
 
 	addCpuQuota(conn, &properties, r.CpuQuota, r.CpuPeriod)
 
+	if r.CpuBurst != 0 {
+		// systemd only supports CPUBurst since v250
+		sdVer := systemdVersion(conn)
+		if sdVer >= 250 {
+			properties = append(properties,
+				newProp("CPUBurst", r.CpuBurst))
+		} else {
+			logrus.Debugf("systemd v%d is too old to support CPUBurst "+
+				" (setting will still be applied to cgroupfs)", sdVer)
+		}
+	}
+
 	if r.BlkioWeight != 0 {
 		properties = append(properties,
 			newProp("BlockIOWeight", uint64(r.BlkioWeight)))
@@ -99,6 +119,11 @@ func genV1ResourcesProperties(c *configs.Cgroup, conn *systemdDbus.Conn) ([]syst
 			newProp("TasksMax", uint64(r.PidsLimit)))
 	}
 
+	// sysbox-runc: the cpus (and mems) are set via AllowedCPUs (and
+	// AllowedMemoryNodes) too, so that systemd keeps them (e.g., across a
+	// daemon-reload); this matters for exclusive cpusets, which are pinned to
+	// their cpus. The exclusive flag itself has no unit property; it's set in
+	// cgroupfs (see fs.CpusetGroup).
 	err = addCpuset(conn, &properties, r.CpusetCpus, r.CpusetMems)
 	if err != nil {
 		return nil, err
@@ -115,12 +140,17 @@ func (m *legacyManager) Apply(pid int) error {
 		properties []systemdDbus.Property
 	)
 
-	if c.Resources.Unified != nil {
+	if c.Resources.Unified != nil && !isCgroup2UnifiedMode() && !isHybridCgroupSystem() {
 		return cgroups.ErrV1NoUnified
 	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
+
+	if pid > 0 {
+		m.initPid = pid
+	}
+
 	if c.Paths != nil {
 		paths := make(map[string]string)
 		cgMap, err := cgroups.ParseCgroupFile("/proc/self/cgroup")
@@ -206,6 +236,10 @@ func (m *legacyManager) Apply(pid int) error {
 
 	paths := make(map[string]string)
 	for _, s := range legacySubsystems {
+		if c.IsSubsystemExcluded(s.Name()) {
+			logrus.Debugf("skipping excluded cgroup subsystem %s", s.Name())
+			continue
+		}
 		subsystemPath, err := getSubsystemPath(m.cgroups, s.Name())
 		if err != nil {
 			// Even if it's `not found` error, we'll return err
@@ -228,6 +262,10 @@ func (m *legacyManager) Apply(pid int) error {
 		return err
 	}
 
+	if err := m.setUnified(c.Resources.Unified); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -244,6 +282,13 @@ func (m *legacyManager) Destroy() error {
 	}
 	unitName := getUnitName(m.cgroups)
 
+	// sysbox-runc: kill the container's processes via cgroup.kill (if
+	// available) first; otherwise stopUnit() may hang on frozen or stuck
+	// processes.
+	if err := m.killCgroup(); err != nil && err != cgroups.ErrCgroupKillNotSupported {
+		logrus.Warnf("failed to kill processes in unit %s via cgroup.kill: %v", unitName, err)
+	}
+
 	stopErr := stopUnit(dbusConnection, unitName)
 	// Both on success and on error, cleanup all the cgroups we are aware of.
 	// Some of them were created directly by Apply() and are not managed by systemd.
@@ -251,67 +296,308 @@ func (m *legacyManager) Destroy() error {
 		return err
 	}
 
+	// sysbox-runc: remove the unit's persisted resource settings (if any)
+	if err := removeResourcesDropIn(UnitDropInDir, unitName); err != nil {
+		logrus.Warnf("failed to remove drop-in for unit %s: %v", unitName, err)
+	}
+
 	return stopErr
 }
 
+// replaceable for testing
+var procRoot = "/proc"
+
+// ExitStatus returns the exit status of the container's init process (i.e.,
+// the process placed in the container's cgroup by Apply()). It returns false
+// if the process is still running or its exit status is no longer available
+// (e.g., it has been reaped by its parent).
+func (m *legacyManager) ExitStatus() (int, bool) {
+	m.mu.Lock()
+	pid := m.initPid
+	m.mu.Unlock()
+
+	if pid <= 0 {
+		return 0, false
+	}
+
+	stat, err := system.StatFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, false
+	}
+
+	if stat.State != system.Zombie && stat.State != system.Dead {
+		return 0, false
+	}
+
+	return utils.ExitStatus(unix.WaitStatus(stat.ExitCode)), true
+}
+
+// Interval at which WaitForExit checks the init process when it gets no
+// cgroup events (replaceable for testing).
+var waitForExitInterval = 100 * time.Millisecond
+
+// WaitForExit waits for the container's init process (i.e., the process
+// placed in the container's cgroup by Apply()) to exit, and returns its exit
+// status. On hybrid cgroup hosts it's woken up by inotify events on the
+// cgroup.events file of the container's cgroup v2 cgroup (which changes when
+// the cgroup becomes empty); otherwise (or in addition) it polls the process
+// periodically. Fails if the context is cancelled, or if the process is gone
+// without its exit status being available (e.g., it was reaped by its parent).
+func (m *legacyManager) WaitForExit(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	pid := m.initPid
+	unifiedPath := m.unifiedPath()
+	m.mu.Unlock()
+
+	if pid <= 0 {
+		return -1, errors.New("no process was placed in the container's cgroup")
+	}
+
+	fd := -1
+	if unifiedPath != "" {
+		ifd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+		if err == nil {
+			if _, err := unix.InotifyAddWatch(ifd, filepath.Join(unifiedPath, "cgroup.events"), unix.IN_MODIFY); err == nil {
+				fd = ifd
+				defer unix.Close(fd)
+			} else {
+				unix.Close(ifd)
+			}
+		}
+	}
+
+	statFile := filepath.Join(procRoot, strconv.Itoa(pid), "stat")
+
+	for {
+		if status, exited := m.ExitStatus(); exited {
+			return status, nil
+		}
+		if _, err := os.Stat(statFile); os.IsNotExist(err) {
+			return -1, fmt.Errorf("init process %d exited, but its exit status is not available", pid)
+		}
+
+		select {
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		default:
+		}
+
+		if fd < 0 {
+			time.Sleep(waitForExitInterval)
+			continue
+		}
+
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(waitForExitInterval/time.Millisecond))
+		if err != nil && err != unix.EINTR {
+			return -1, fmt.Errorf("failed to wait for cgroup events: %v", err)
+		}
+		if n > 0 {
+			// drain the events; they only serve as a wake up
+			buf := make([]byte, unix.SizeofInotifyEvent*16+unix.NAME_MAX+1)
+			unix.Read(fd, buf)
+		}
+	}
+}
+
+// The cgroup v2 hierarchy on hybrid cgroup hosts (replaceable for testing)
+var unifiedMountpoint = "/sys/fs/cgroup/unified"
+
+// unifiedPath returns the path of the container's cgroup in the cgroup v2
+// hierarchy of hybrid cgroup hosts (where systemd places the units in both the
+// name=systemd and the cgroup v2 hierarchies), or "" if there is none.
+func (m *legacyManager) unifiedPath() string {
+	sdPath, ok := m.paths["name=systemd"]
+	if !ok {
+		return ""
+	}
+	sdMnt, err := cgroups.FindCgroupMountpoint("", "name=systemd")
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(sdMnt, sdPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	path := filepath.Join(unifiedMountpoint, rel)
+	if !cgroups.PathExists(path) {
+		return ""
+	}
+	return path
+}
+
+// Reports whether the host is in cgroup v2 unified mode (replaceable for testing)
+var isCgroup2UnifiedMode = cgroups.IsCgroup2UnifiedMode
+
+// isHybridCgroupSystem returns true if the host has the cgroup v2 hierarchy
+// mounted alongside the cgroup v1 ones.
+func isHybridCgroupSystem() bool {
+	return cgroups.PathExists(unifiedMountpoint)
+}
+
+// setUnified writes the given cgroup v2 resources (see configs.Resources.Unified)
+// to the container's cgroup v2 cgroup. Returns cgroups.ErrV1NoUnified on pure
+// cgroup v1 hosts. Note that on hybrid hosts the cgroup v2 hierarchy usually
+// has few (if any) controllers enabled, so only some files are writable.
+func (m *legacyManager) setUnified(res map[string]string) error {
+	if len(res) == 0 {
+		return nil
+	}
+
+	var path string
+	switch {
+	case isCgroup2UnifiedMode():
+		path = m.paths[""]
+	case isHybridCgroupSystem():
+		path = m.unifiedPath()
+	default:
+		return cgroups.ErrV1NoUnified
+	}
+	if path == "" {
+		return fmt.Errorf("can't set unified resources: the container has no cgroup v2 cgroup")
+	}
+
+	for k, v := range res {
+		if strings.Contains(k, "/") {
+			return fmt.Errorf("unified resource %q must be a file name (no slashes)", k)
+		}
+		if err := fscommon.WriteFile(path, k, v); err != nil {
+			return fmt.Errorf("can't set unified resource %q: %v", k, err)
+		}
+	}
+
+	return nil
+}
+
+// killCgroup kills all processes in the container's cgroup via the cgroup.kill
+// file of its cgroup v2 cgroup (if any). Must be called with m.mu held.
+func (m *legacyManager) killCgroup() error {
+	path := m.unifiedPath()
+	if path == "" {
+		return cgroups.ErrCgroupKillNotSupported
+	}
+	return cgroups.KillCgroupProcs(path)
+}
+
+// KillCgroup kills all processes in the container's cgroup (including child
+// cgroups) via cgroup.kill. Returns cgroups.ErrCgroupKillNotSupported if the
+// host or kernel lacks it.
+func (m *legacyManager) KillCgroup() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.killCgroup()
+}
+
+// ReclaimMemory triggers the reclaim of the given amount of memory (in bytes)
+// from the container's cgroup via the memory.reclaim file of its cgroup v2
+// cgroup. Returns cgroups.ErrMemoryReclaimNotSupported if the host or kernel
+// lacks it (e.g., when the memory controller is in the cgroup v1 hierarchy).
+func (m *legacyManager) ReclaimMemory(bytes uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path := m.unifiedPath()
+	if path == "" {
+		return cgroups.ErrMemoryReclaimNotSupported
+	}
+	return cgroups.ReclaimCgroupMemory(path, bytes)
+}
+
 func (m *legacyManager) Path(subsys string) string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return m.paths[subsys]
 }
 
+// CgroupJoinTimeout is the max time allowed for placing a process in each of
+// the container's cgroups (a non-positive value disables the timeout).
+var CgroupJoinTimeout = 5 * time.Second
+
+var errTimeout = errors.New("timed out")
+
+// withTimeout runs fn and waits for it to complete for up to the given
+// duration; it returns errTimeout if fn does not complete in time. Since fn
+// can't be interrupted, it keeps running in the background in this case (the
+// channel is buffered, so the goroutine running it exits once fn returns). A
+// non-positive duration disables the timeout.
+func withTimeout(d time.Duration, fn func() error) error {
+	if d <= 0 {
+		return fn()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errTimeout
+	}
+}
+
 func (m *legacyManager) joinCgroups(pid int) error {
 	for _, sys := range legacySubsystems {
 		name := sys.Name()
+		if m.cgroups.IsSubsystemExcluded(name) {
+			continue
+		}
+
+		var join func() error
+
 		switch name {
 		case "name=systemd":
 			// let systemd handle this
 		case "cpuset":
 			if path, ok := m.paths[name]; ok {
-				s := &fs.CpusetGroup{}
-				if err := s.ApplyDir(path, m.cgroups, pid); err != nil {
-					return err
+				join = func() error {
+					s := &fs.CpusetGroup{}
+					return s.ApplyDir(path, m.cgroups, pid)
 				}
 			}
 		default:
 			if path, ok := m.paths[name]; ok {
-				if err := os.MkdirAll(path, 0755); err != nil {
-					return err
-				}
-				if err := cgroups.WriteCgroupProc(path, pid); err != nil {
-					return err
+				join = func() error {
+					if err := os.MkdirAll(path, 0755); err != nil {
+						return err
+					}
+					return cgroups.WriteCgroupProc(path, pid)
 				}
 			}
 		}
+
+		if join == nil {
+			continue
+		}
+
+		if err := withTimeout(CgroupJoinTimeout, join); err != nil {
+			if err == errTimeout {
+				logrus.Errorf("timed out (%v) placing pid %d in the %s cgroup at %s", CgroupJoinTimeout, pid, name, m.paths[name])
+				return fmt.Errorf("failed to place pid %d in the %s cgroup at %s: timed out after %v", pid, name, m.paths[name], CgroupJoinTimeout)
+			}
+			return err
+		}
 	}
 
 	return nil
 }
 
 func getSubsystemPath(c *configs.Cgroup, subsystem string) (string, error) {
-	mountpoint, err := cgroups.FindCgroupMountpoint("", subsystem)
-	if err != nil {
-		return "", err
-	}
-
-	initPath, err := cgroups.GetInitCgroup(subsystem)
-	if err != nil {
-		return "", err
-	}
-	// if pid 1 is systemd 226 or later, it will be in init.scope, not the root
-	initPath = strings.TrimSuffix(filepath.Clean(initPath), "init.scope")
-
 	slice := "system.slice"
 	if c.Parent != "" {
 		slice = c.Parent
 	}
 
-	slice, err = ExpandSlice(slice)
+	slice, err := ExpandSlice(slice)
 	if err != nil {
 		return "", err
 	}
 
-	return filepath.Join(mountpoint, initPath, slice, getUnitName(c)), nil
+	return controlGroupPath(subsystem, filepath.Join(slice, getUnitName(c)))
 }
 
 func (m *legacyManager) Freeze(state configs.FreezerState) error {
@@ -351,7 +637,7 @@ func (m *legacyManager) GetStats() (*cgroups.Stats, error) {
 	stats := cgroups.NewStats()
 	for _, sys := range legacySubsystems {
 		path := m.paths[sys.Name()]
-		if path == "" {
+		if path == "" || m.cgroups.IsSubsystemExcluded(sys.Name()) {
 			continue
 		}
 		if err := sys.GetStats(path, stats); err != nil {
@@ -359,6 +645,16 @@ func (m *legacyManager) GetStats() (*cgroups.Stats, error) {
 		}
 	}
 
+	// On hybrid cgroup hosts the io controller may be bound to the cgroup v2
+	// hierarchy rather than to blkio in v1; if so, report its stats instead.
+	if len(stats.BlkioStats.IoServiceBytesRecursive) == 0 {
+		if path := m.unifiedPath(); path != "" {
+			if err := fs2.StatIo(path, stats); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	return stats, nil
 }
 
@@ -368,7 +664,7 @@ func (m *legacyManager) Set(container *configs.Config) error {
 	if m.cgroups.Paths != nil {
 		return nil
 	}
-	if container.Cgroups.Resources.Unified != nil {
+	if container.Cgroups.Resources.Unified != nil && !isCgroup2UnifiedMode() && !isHybridCgroupSystem() {
 		return cgroups.ErrV1NoUnified
 	}
 	dbusConnection, err := getDbusConnection(false)
@@ -423,6 +719,21 @@ func (m *legacyManager) Set(container *configs.Config) error {
 		}
 	}
 
+	if err := m.setUnified(container.Cgroups.Resources.Unified); err != nil {
+		return err
+	}
+
+	// sysbox-runc: the kernel may silently reject some values (e.g., memory
+	// limits below the current usage), so read them back.
+	if errs := verifyResourcesSet(m.paths, container.Cgroups.Resources); len(errs) > 0 {
+		for _, e := range errs {
+			logrus.Warnf("cgroup resource not applied: %v", e)
+		}
+		if StrictResourceVerify {
+			return fmt.Errorf("failed to verify cgroup resources: %v", errs[0])
+		}
+	}
+
 	return nil
 }
 
@@ -513,6 +824,16 @@ func (m *legacyManager) ApplyChildCgroup(pid int) error {
 	return nil
 }
 
+func (m *legacyManager) UpdateChildCgroups(container *configs.Config) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The child cgroups are not visible to systemd (due to delegation); thus
+	// we update them directly on the filesystem using the fs cgroup manager.
+	childMgr := fs.NewManager(m.cgroups, m.paths, false)
+	return childMgr.UpdateChildCgroups(container)
+}
+
 func (m *legacyManager) GetChildCgroupPaths() map[string]string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
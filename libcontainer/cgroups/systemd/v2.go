@@ -192,7 +192,13 @@ func genV2ResourcesProperties(c *configs.Cgroup, conn *systemdDbus.Conn) ([]syst
 	if err != nil {
 		return nil, err
 	}
-	if swap != 0 {
+	if r.MemorySwapMax != nil {
+		if err := cgroups.ValidateMemorySwapMax(r.MemorySwapMax, r.Memory); err != nil {
+			return nil, err
+		}
+		properties = append(properties,
+			newProp("MemorySwapMax", uint64(*r.MemorySwapMax)))
+	} else if swap != 0 {
 		properties = append(properties,
 			newProp("MemorySwapMax", uint64(swap)))
 	}
@@ -309,6 +315,12 @@ func (m *unifiedManager) Apply(pid int) error {
 	if err := fs2.CreateCgroupPath(m.path, m.cgroups); err != nil {
 		return err
 	}
+	if err := fs2.AttachNetworkPolicy(m.path, m.cgroups); err != nil {
+		return err
+	}
+	if err := fs2.ValidateDelegation(m.path); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -324,10 +336,24 @@ func (m *unifiedManager) Destroy() error {
 		return err
 	}
 	unitName := getUnitName(m.cgroups)
+
+	// sysbox-runc: kill the container's processes via cgroup.kill (if
+	// available) first; otherwise stopUnit() may hang on frozen or stuck
+	// processes.
+	if m.path != "" {
+		if err := cgroups.KillCgroupProcs(m.path); err != nil && err != cgroups.ErrCgroupKillNotSupported {
+			logrus.Warnf("failed to kill processes in unit %s via cgroup.kill: %v", unitName, err)
+		}
+	}
+
 	if err := stopUnit(dbusConnection, unitName); err != nil {
 		return err
 	}
 
+	if err := fs2.DetachNetworkPolicy(m.path, m.cgroups); err != nil {
+		return err
+	}
+
 	// XXX this is probably not needed, systemd should handle it
 	err = os.Remove(m.path)
 	if err != nil && !os.IsNotExist(err) {
@@ -511,6 +537,24 @@ func (m *unifiedManager) Exists() bool {
 	return cgroups.PathExists(m.path)
 }
 
+// ReclaimMemory triggers the reclaim of the given amount of memory (in bytes)
+// from the container's cgroup via memory.reclaim.
+func (m *unifiedManager) ReclaimMemory(bytes uint64) error {
+	return cgroups.ReclaimCgroupMemory(m.path, bytes)
+}
+
+// KillCgroup kills all processes in the container's cgroup (including child
+// cgroups) via cgroup.kill. Returns cgroups.ErrCgroupKillNotSupported if the
+// kernel lacks it.
+func (m *unifiedManager) KillCgroup() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.initPath(); err != nil {
+		return err
+	}
+	return cgroups.KillCgroupProcs(m.path)
+}
+
 func (m *unifiedManager) CreateChildCgroup(config *configs.Config) error {
 
 	// Change the cgroup ownership to match the root user in the system
@@ -610,6 +654,12 @@ func (m *unifiedManager) GetChildCgroupPaths() map[string]string {
 	return m.GetPaths()
 }
 
+func (m *unifiedManager) UpdateChildCgroups(container *configs.Config) error {
+	// On cgroup v2 the child cgroup is the container's own cgroup (see
+	// GetChildCgroupPaths()), so it's already updated by Set().
+	return nil
+}
+
 func (m *unifiedManager) GetType() cgroups.CgroupType {
 	return cgroups.Cgroup_v2_systemd
 }
@@ -0,0 +1,73 @@
+// +build linux
+
+package systemd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// StrictResourceVerify makes legacyManager.Set fail (rather than just warn)
+// when a resource value read back from the cgroup filesystem differs from the
+// requested one (see verifyResourcesSet()).
+var StrictResourceVerify = false
+
+// ResourceVerificationError describes a cgroup resource whose value, as read
+// back from the cgroup filesystem, differs from the requested one (e.g., the
+// kernel rejects memory limits below the current usage).
+type ResourceVerificationError struct {
+	Field     string
+	Requested string
+	Actual    string
+}
+
+func (e ResourceVerificationError) Error() string {
+	return fmt.Sprintf("%s: requested %s, but cgroup has %s", e.Field, e.Requested, e.Actual)
+}
+
+// verifyResourcesSet reads back the memory limit, cpu shares and pids limit
+// from the given (cgroup v1) subsystem paths and compares them to the given
+// resources. Unset resources and missing cgroup files are not checked.
+func verifyResourcesSet(paths map[string]string, r *configs.Resources) []ResourceVerificationError {
+	var errs []ResourceVerificationError
+
+	check := func(subsys, file, requested string) {
+		path, ok := paths[subsys]
+		if !ok {
+			return
+		}
+		actual, err := fscommon.GetCgroupParamString(path, file)
+		if err != nil {
+			return
+		}
+		if actual != requested {
+			errs = append(errs, ResourceVerificationError{
+				Field:     file,
+				Requested: requested,
+				Actual:    actual,
+			})
+		}
+	}
+
+	if r.Memory > 0 {
+		// the kernel rounds the limit down to a multiple of the page size
+		pageSize := int64(os.Getpagesize())
+		check("memory", "memory.limit_in_bytes", strconv.FormatInt(r.Memory/pageSize*pageSize, 10))
+	}
+
+	if r.CpuShares != 0 {
+		check("cpu", "cpu.shares", strconv.FormatUint(r.CpuShares, 10))
+	}
+
+	if r.PidsLimit > 0 {
+		check("pids", "pids.max", strconv.FormatInt(r.PidsLimit, 10))
+	} else if r.PidsLimit < 0 {
+		check("pids", "pids.max", "max")
+	}
+
+	return errs
+}
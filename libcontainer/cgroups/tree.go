@@ -0,0 +1,116 @@
+// +build linux
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// cgroupTreeMaxDepth is the number of child cgroup levels included in a
+	// cgroup tree dump.
+	cgroupTreeMaxDepth = 3
+
+	// cgroupTreeMaxNodes limits the number of cgroups included in a cgroup tree
+	// dump (across all subsystems).
+	cgroupTreeMaxNodes = 256
+)
+
+// DumpCgroupTree returns the cgroup hierarchy rooted at each of the given
+// subsystem paths, including the resource limits, usage, stats and processes
+// of each cgroup. Child cgroups are included up to cgroupTreeMaxDepth levels
+// deep; the dump is truncated once cgroupTreeMaxNodes cgroups are visited.
+func DumpCgroupTree(paths map[string]string) (map[string]interface{}, error) {
+	tree := make(map[string]interface{})
+	nodes := 0
+
+	for subsys, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		// on cgroup v2 the unified hierarchy has no subsystem name
+		if subsys == "" {
+			subsys = "unified"
+		}
+
+		node, err := dumpCgroupNode(path, 0, &nodes)
+		if err != nil {
+			return nil, err
+		}
+		tree[subsys] = node
+	}
+
+	return tree, nil
+}
+
+func dumpCgroupNode(path string, depth int, nodes *int) (map[string]interface{}, error) {
+	*nodes++
+
+	node := map[string]interface{}{
+		"path": path,
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string)
+	children := make(map[string]interface{})
+	truncated := false
+
+	for _, e := range entries {
+		name := e.Name()
+
+		if !e.IsDir() {
+			if !isCgroupTreeFile(name) {
+				continue
+			}
+			data, err := ioutil.ReadFile(filepath.Join(path, name))
+			if err != nil {
+				// some files can't be read (e.g., removed or permission denied); skip them
+				continue
+			}
+			files[name] = strings.TrimSpace(string(data))
+			continue
+		}
+
+		if depth >= cgroupTreeMaxDepth || *nodes >= cgroupTreeMaxNodes {
+			truncated = true
+			continue
+		}
+
+		child, err := dumpCgroupNode(filepath.Join(path, name), depth+1, nodes)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		children[name] = child
+	}
+
+	node["files"] = files
+	if len(children) > 0 {
+		node["children"] = children
+	}
+	if truncated {
+		node["truncated"] = true
+	}
+
+	return node, nil
+}
+
+func isCgroupTreeFile(name string) bool {
+	return name == CgroupProcesses ||
+		strings.HasSuffix(name, ".limit_in_bytes") ||
+		strings.HasSuffix(name, ".usage_in_bytes") ||
+		strings.HasSuffix(name, ".stat")
+}
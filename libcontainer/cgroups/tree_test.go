@@ -0,0 +1,111 @@
+// +build linux
+
+package cgroups
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDumpCgroupTree(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup-tree-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	memPath := filepath.Join(root, "memory", "ctr")
+	deepPath := filepath.Join(memPath, "l1", "l2", "l3", "l4")
+	if err := os.MkdirAll(deepPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"memory.limit_in_bytes": "1073741824\n",
+		"memory.usage_in_bytes": "4096\n",
+		"memory.stat":           "cache 0\nrss 4096\n",
+		"cgroup.procs":          "1\n2\n",
+		"memory.swappiness":     "60\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(memPath, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths := map[string]string{
+		"memory":  memPath,
+		"freezer": filepath.Join(root, "freezer", "ctr"), // does not exist
+	}
+
+	tree, err := DumpCgroupTree(paths)
+	if err != nil {
+		t.Fatalf("DumpCgroupTree failed: %v", err)
+	}
+
+	if _, ok := tree["freezer"]; ok {
+		t.Errorf("DumpCgroupTree: non-existent subsystem path included in tree")
+	}
+
+	mem, ok := tree["memory"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("DumpCgroupTree: memory subsystem missing from tree: %v", tree)
+	}
+
+	memFiles := mem["files"].(map[string]string)
+	if memFiles["memory.limit_in_bytes"] != "1073741824" || memFiles["cgroup.procs"] != "1\n2" ||
+		memFiles["memory.stat"] != "cache 0\nrss 4096" || memFiles["memory.usage_in_bytes"] != "4096" {
+		t.Errorf("DumpCgroupTree: unexpected files: %v", memFiles)
+	}
+	if _, ok := memFiles["memory.swappiness"]; ok {
+		t.Errorf("DumpCgroupTree: unexpected file memory.swappiness in tree")
+	}
+
+	// child cgroups are included up to 3 levels deep
+	node := mem
+	for _, name := range []string{"l1", "l2", "l3"} {
+		children, ok := node["children"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("DumpCgroupTree: missing child %s", name)
+		}
+		node = children[name].(map[string]interface{})
+	}
+	if _, ok := node["children"]; ok {
+		t.Errorf("DumpCgroupTree: tree exceeds max depth")
+	}
+	if node["truncated"] != true {
+		t.Errorf("DumpCgroupTree: expected truncated node at max depth")
+	}
+}
+
+func TestDumpCgroupTreeNodeLimit(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup-tree-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for i := 0; i < cgroupTreeMaxNodes+10; i++ {
+		if err := os.Mkdir(filepath.Join(root, fmt.Sprintf("child%d", i)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tree, err := DumpCgroupTree(map[string]string{"": root})
+	if err != nil {
+		t.Fatalf("DumpCgroupTree failed: %v", err)
+	}
+
+	node := tree["unified"].(map[string]interface{})
+	children := node["children"].(map[string]interface{})
+
+	if len(children) != cgroupTreeMaxNodes-1 {
+		t.Errorf("DumpCgroupTree: want %d children; got %d", cgroupTreeMaxNodes-1, len(children))
+	}
+	if node["truncated"] != true {
+		t.Errorf("DumpCgroupTree: expected truncated tree")
+	}
+}
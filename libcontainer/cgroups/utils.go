@@ -10,12 +10,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/system"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
@@ -416,13 +418,95 @@ func ConvertBlkIOToCgroupV2Value(blkIoWeight uint16) uint64 {
 // the formula for cpuShares is y = (1 + ((x - 2) * 9999) / 262142)
 // convert from [2-262144] to [1-10000]
 // 262144 comes from Linux kernel definition "#define MAX_SHARES (1UL << 18)"
+// Values outside that range are clamped to it, as the kernel does for cgroup v1.
 func ConvertCPUSharesToCgroupV2Value(cpuShares uint64) uint64 {
 	if cpuShares == 0 {
 		return 0
 	}
+	if cpuShares < 2 {
+		cpuShares = 2
+	}
+	if cpuShares > 262144 {
+		cpuShares = 262144
+	}
 	return (1 + ((cpuShares-2)*9999)/262142)
 }
 
+// ValidateMemorySwapMax checks the given cgroup v2 swap limit (see
+// configs.Resources.MemorySwapMax) against the given memory limit.
+func ValidateMemorySwapMax(swapMax *int64, memory int64) error {
+	if swapMax == nil {
+		return nil
+	}
+	if *swapMax < -1 {
+		return fmt.Errorf("invalid swap limit: %d", *swapMax)
+	}
+	if *swapMax != -1 && memory > 0 && *swapMax > memory {
+		return fmt.Errorf("swap limit (%d) should be <= memory limit (%d)", *swapMax, memory)
+	}
+	return nil
+}
+
+// ChangedResources returns the resources in new that differ from those in old;
+// the others are left unset, so that applying the result only changes what was
+// updated. Device rules are skipped unless they changed, and the freezer state
+// is never included.
+func ChangedResources(old, new *configs.Resources) *configs.Resources {
+	changed := &configs.Resources{}
+
+	ov := reflect.ValueOf(old).Elem()
+	nv := reflect.ValueOf(new).Elem()
+	cv := reflect.ValueOf(changed).Elem()
+
+	for i := 0; i < nv.NumField(); i++ {
+		if !reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			cv.Field(i).Set(nv.Field(i))
+		}
+	}
+
+	changed.SkipDevices = new.SkipDevices || reflect.DeepEqual(old.Devices, new.Devices)
+	changed.Freezer = configs.Undefined
+
+	return changed
+}
+
+// NUMAStatsFromValues returns the per-node memory stats in the given
+// memory.numa_stat values (see fscommon.ParseNUMAStat), in bytes. The values
+// are multiplied by the given unit (i.e., the page size on cgroup v1, where
+// they are in pages; 1 on cgroup v2). Unknown stats (e.g., the cgroup v1 total
+// and hierarchical_* stats) are ignored.
+func NUMAStatsFromValues(values map[string]map[int]uint64, unit uint64) map[int]NUMANodeStat {
+	stats := make(map[int]NUMANodeStat)
+
+	for key, nodes := range values {
+		for node, val := range nodes {
+			stat := stats[node]
+			val *= unit
+			switch key {
+			case "anon":
+				stat.Anon = val
+			case "file":
+				stat.File = val
+			case "shmem":
+				stat.Shmem = val
+			case "file_mapped":
+				stat.FileMapped = val
+			case "file_dirty":
+				stat.FileDirty = val
+			case "file_writeback":
+				stat.FileWriteback = val
+			case "shmem_thp":
+				stat.ShmemThp = val
+			default:
+				continue
+			}
+			stats[node] = stat
+		}
+	}
+
+	return stats
+}
+
 // ConvertMemorySwapToCgroupV2Value converts MemorySwap value from OCI spec
 // for use by cgroup v2 drivers. A conversion is needed since Resources.MemorySwap
 // is defined as memory+swap combined, while in cgroup v2 swap is a separate value.
@@ -9,6 +9,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/devices"
 	"github.com/sirupsen/logrus"
 )
 
@@ -542,9 +544,12 @@ func TestConvertBlkIOToCgroupV2Value(t *testing.T) {
 
 func TestConvertCPUSharesToCgroupV2Value(t *testing.T) {
 	cases := map[uint64]uint64{
-		0:      0,
-		2:      1,
-		262144: 10000,
+		0:       0,
+		1:       1,
+		2:       1,
+		1024:    39,
+		262144:  10000,
+		1 << 20: 10000,
 	}
 	for i, expected := range cases {
 		got := ConvertCPUSharesToCgroupV2Value(i)
@@ -634,3 +639,91 @@ func TestConvertMemorySwapToCgroupV2Value(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateMemorySwapMax(t *testing.T) {
+	val := func(v int64) *int64 { return &v }
+
+	cases := []struct {
+		swapMax *int64
+		memory  int64
+		expErr  bool
+	}{
+		{swapMax: nil, memory: 1000},
+		{swapMax: val(-1), memory: 1000},
+		{swapMax: val(-1), memory: 0},
+		{swapMax: val(0), memory: 1000},
+		{swapMax: val(1000), memory: 1000},
+		{swapMax: val(1001), memory: 1000, expErr: true},
+		{swapMax: val(5000), memory: 0},
+		{swapMax: val(5000), memory: -1},
+		{swapMax: val(-2), memory: 1000, expErr: true},
+	}
+
+	for _, c := range cases {
+		err := ValidateMemorySwapMax(c.swapMax, c.memory)
+		if c.expErr && err == nil {
+			t.Errorf("ValidateMemorySwapMax(%v, %d): expected error", c.swapMax, c.memory)
+		}
+		if !c.expErr && err != nil {
+			t.Errorf("ValidateMemorySwapMax(%v, %d): unexpected error: %v", c.swapMax, c.memory, err)
+		}
+	}
+}
+
+func TestChangedResources(t *testing.T) {
+	rules := []*devices.Rule{{Type: devices.CharDevice, Major: 1, Minor: 3, Permissions: "rwm", Allow: true}}
+
+	old := &configs.Resources{
+		Devices:    rules,
+		Memory:     1000,
+		CpuShares:  512,
+		CpusetCpus: "0-1",
+		PidsLimit:  100,
+		Freezer:    configs.Thawed,
+	}
+	new := &configs.Resources{
+		Devices:    rules,
+		Memory:     2000,
+		CpuShares:  512,
+		CpusetCpus: "0-3",
+		PidsLimit:  100,
+		Freezer:    configs.Frozen,
+	}
+
+	changed := ChangedResources(old, new)
+	want := &configs.Resources{
+		Memory:      2000,
+		CpusetCpus:  "0-3",
+		SkipDevices: true,
+	}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("ChangedResources: want %+v; got %+v", want, changed)
+	}
+
+	// changed device rules are included
+	new.Devices = nil
+	changed = ChangedResources(old, new)
+	if changed.SkipDevices {
+		t.Errorf("ChangedResources: device rules changed but are skipped")
+	}
+}
+
+func TestNUMAStatsFromValues(t *testing.T) {
+	values := map[string]map[int]uint64{
+		"anon":               {0: 4, 1: 8},
+		"file":               {0: 1},
+		"shmem_thp":          {1: 2},
+		"kernel_stack":       {0: 16},
+		"hierarchical_total": {0: 100},
+		"total":              {0: 5, 1: 10},
+	}
+
+	stats := NUMAStatsFromValues(values, 4096)
+	want := map[int]NUMANodeStat{
+		0: {Anon: 4 * 4096, File: 4096},
+		1: {Anon: 8 * 4096, ShmemThp: 2 * 4096},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("NUMAStatsFromValues: want %+v; got %+v", want, stats)
+	}
+}
@@ -64,3 +64,17 @@ func (td *ThrottleDevice) String() string {
 func (td *ThrottleDevice) StringName(name string) string {
 	return fmt.Sprintf("%d:%d %s=%d", td.Major, td.Minor, name, td.Rate)
 }
+
+// IoLatencyEntry struct holds a `major:minor target=N` pair for the cgroup v2
+// io.latency controller
+type IoLatencyEntry struct {
+	// Device is the device's "major:minor" number
+	Device string `json:"device"`
+	// Target is the target IO latency for the device (e.g., "10000" usecs)
+	Target string `json:"target"`
+}
+
+// String formats the struct to be writable to the cgroup specific file
+func (le *IoLatencyEntry) String() string {
+	return fmt.Sprintf("%s target=%s", le.Device, le.Target)
+}
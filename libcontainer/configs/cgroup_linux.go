@@ -39,6 +39,21 @@ type Cgroup struct {
 	// derived from org.systemd.property.xxx annotations.
 	// Ignored unless systemd is used for managing cgroups.
 	SystemdProps []systemdDbus.Property `json:"-"`
+
+	// sysbox-runc: cgroup v1 subsystems in which no cgroup is created for the
+	// container (the devices subsystem can't be excluded).
+	ExcludedSubsystems []string `json:"excluded_subsystems,omitempty"`
+}
+
+// IsSubsystemExcluded returns true if the given cgroup v1 subsystem is in the
+// cgroup's exclusion list.
+func (c *Cgroup) IsSubsystemExcluded(name string) bool {
+	for _, s := range c.ExcludedSubsystems {
+		if s == name {
+			return true
+		}
+	}
+	return false
 }
 
 type Resources struct {
@@ -54,6 +69,10 @@ type Resources struct {
 	// Total memory usage (memory + swap); set `-1` to enable unlimited swap
 	MemorySwap int64 `json:"memory_swap"`
 
+	// Swap limit (in bytes) on cgroup v2, independent of the memory limit; set
+	// `-1` for unlimited swap. Takes precedence over MemorySwap when set.
+	MemorySwapMax *int64 `json:"memory_swap_max,omitempty"`
+
 	// Kernel memory limit (in bytes)
 	KernelMemory int64 `json:"kernel_memory"`
 
@@ -69,6 +88,10 @@ type Resources struct {
 	// CPU period to be used for hardcapping (in usecs). 0 to use system default.
 	CpuPeriod uint64 `json:"cpu_period"`
 
+	// CPU burst allowance above the quota (in usecs); unused quota is accumulated
+	// up to this amount. Requires kernel support for cpu.cfs_burst_us.
+	CpuBurst uint64 `json:"cpu_burst"`
+
 	// How many time CPU will use in realtime scheduling (in usecs).
 	CpuRtRuntime int64 `json:"cpu_rt_quota"`
 
@@ -81,6 +104,10 @@ type Resources struct {
 	// MEM to use
 	CpusetMems string `json:"cpuset_mems"`
 
+	// Use the CPUs in CpusetCpus exclusively (i.e., don't share them with
+	// sibling cgroups). Useful for CPU pinning of latency sensitive workloads.
+	CpusetCpusExclusive bool `json:"cpuset_cpus_exclusive"`
+
 	// Process limit; set <= `0' to disable limit.
 	PidsLimit int64 `json:"pids_limit"`
 
@@ -105,6 +132,9 @@ type Resources struct {
 	// IO write rate limit per cgroup per device, IO per second.
 	BlkioThrottleWriteIOPSDevice []*ThrottleDevice `json:"blkio_throttle_write_iops_device"`
 
+	// IO latency target per cgroup per device (cgroup v2 only)
+	IoLatency []*IoLatencyEntry `json:"io_latency"`
+
 	// set the freeze value for the process
 	Freezer FreezerState `json:"freezer"`
 
@@ -131,6 +161,12 @@ type Resources struct {
 	// Unified is cgroupv2-only key-value map.
 	Unified map[string]string `json:"unified"`
 
+	// NetIngressProgram and NetEgressProgram are eBPF (cgroup_skb) programs,
+	// as ELF objects, that filter the cgroup's network traffic (cgroups v2
+	// only).
+	NetIngressProgram []byte `json:"net_ingress_program,omitempty"`
+	NetEgressProgram  []byte `json:"net_egress_program,omitempty"`
+
 	// SkipDevices allows to skip configuring device permissions.
 	// Used by e.g. kubelet while creating a parent cgroup (kubepods)
 	// common for many containers.
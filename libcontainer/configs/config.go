@@ -202,6 +202,15 @@ type Config struct {
 	// callers keyring in this case.
 	NoNewKeyring bool `json:"no_new_keyring"`
 
+	// sysbox-runc: AnonymousKeyring makes the container's processes join a new
+	// anonymous session keyring (rather than one named after the container),
+	// which other processes can't join by name. Ignored if NoNewKeyring is set.
+	AnonymousKeyring bool `json:"anonymous_keyring,omitempty"`
+
+	// sysbox-runc: EmulatedSysctls are the (non-namespaced) sysctls whose
+	// /proc/sys writes are intercepted and emulated per-container by sysbox-fs.
+	EmulatedSysctls []string `json:"emulated_sysctls,omitempty"`
+
 	// IntelRdt specifies settings for Intel RDT group that the container is placed into
 	// to limit the resources (e.g., L3 cache, memory bandwidth) the container has available
 	IntelRdt *IntelRdt `json:"intel_rdt,omitempty"`
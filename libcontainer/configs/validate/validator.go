@@ -50,6 +50,9 @@ func (v *ConfigValidator) Validate(config *configs.Config) error {
 	if err := v.intelrdt(config); err != nil {
 		return err
 	}
+	if err := v.excludedSubsystems(config); err != nil {
+		return err
+	}
 	if config.RootlessEUID {
 		if err := v.rootlessEUID(config); err != nil {
 			return err
@@ -193,12 +196,60 @@ func (v *ConfigValidator) sysctl(config *configs.Config) error {
 				return fmt.Errorf("sysctl %q is not allowed as it conflicts with the OCI %q field", s, "hostname")
 			}
 		}
+		// sysbox-runc: sysctls emulated per-container by sysbox-fs need not be
+		// namespaced.
+		if isEmulatedSysctl(config, s) {
+			continue
+		}
 		return fmt.Errorf("sysctl %q is not in a separate kernel namespace", s)
 	}
 
 	return nil
 }
 
+// isEmulatedSysctl returns true if the given sysctl is emulated by sysbox-fs
+// for the container.
+func isEmulatedSysctl(config *configs.Config, sysctl string) bool {
+	for _, s := range config.EmulatedSysctls {
+		if s == sysctl {
+			return true
+		}
+	}
+	return false
+}
+
+// cgroup v1 subsystems that can be excluded from the container's cgroups
+var excludableSubsystems = map[string]bool{
+	"cpuset":     true,
+	"memory":     true,
+	"cpu":        true,
+	"cpuacct":    true,
+	"pids":       true,
+	"blkio":      true,
+	"hugetlb":    true,
+	"perf_event": true,
+	"freezer":    true,
+	"net_prio":   true,
+	"net_cls":    true,
+	"rdma":       true,
+}
+
+// excludedSubsystems validates the container's cgroup subsystem exclusion list.
+func (v *ConfigValidator) excludedSubsystems(config *configs.Config) error {
+	if config.Cgroups == nil {
+		return nil
+	}
+	for _, s := range config.Cgroups.ExcludedSubsystems {
+		if s == "devices" {
+			return errors.New("the devices cgroup subsystem can't be excluded (it's required for container security)")
+		}
+		if !excludableSubsystems[s] {
+			return fmt.Errorf("unknown cgroup subsystem %q in exclusion list", s)
+		}
+	}
+	return nil
+}
+
 func (v *ConfigValidator) intelrdt(config *configs.Config) error {
 	if config.IntelRdt != nil {
 		if !intelrdt.IsCATEnabled() && !intelrdt.IsMBAEnabled() {
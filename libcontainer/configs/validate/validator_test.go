@@ -317,3 +317,61 @@ func TestValidateSysctlWithoutNETNamespace(t *testing.T) {
 		t.Error("Expected error to occur but it was nil")
 	}
 }
+
+func TestValidateEmulatedSysctl(t *testing.T) {
+	sysctl := map[string]bool{
+		"kernel.core_pattern": true,
+		"vm.overcommit":       false,
+		"fs.file-max":         false,
+	}
+
+	for k, valid := range sysctl {
+		config := &configs.Config{
+			Rootfs:          "/var",
+			Sysctl:          map[string]string{k: "ctl"},
+			EmulatedSysctls: []string{"kernel.core_pattern"},
+		}
+
+		validator := validate.New()
+		err := validator.Validate(config)
+		if valid && err != nil {
+			t.Errorf("Expected error to not occur with %s but got: %q", k, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("Expected error to occur with %s but it was nil", k)
+		}
+	}
+}
+
+func TestValidateExcludedSubsystems(t *testing.T) {
+	testCases := []struct {
+		excluded []string
+		valid    bool
+	}{
+		{nil, true},
+		{[]string{"hugetlb"}, true},
+		{[]string{"hugetlb", "net_cls", "blkio"}, true},
+		{[]string{"devices"}, false},
+		{[]string{"hugetlb", "devices"}, false},
+		{[]string{"foo"}, false},
+	}
+
+	for _, tc := range testCases {
+		config := &configs.Config{
+			Rootfs: "/var",
+			Cgroups: &configs.Cgroup{
+				Resources:          &configs.Resources{},
+				ExcludedSubsystems: tc.excluded,
+			},
+		}
+
+		validator := validate.New()
+		err := validator.Validate(config)
+		if tc.valid && err != nil {
+			t.Errorf("Expected error to not occur for excluded subsystems %v: %+v", tc.excluded, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("Expected error to occur for excluded subsystems %v", tc.excluded)
+		}
+	}
+}
@@ -23,6 +23,7 @@ import (
 	securejoin "github.com/cyphar/filepath-securejoin"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/systemd"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/intelrdt"
 	"github.com/opencontainers/runc/libcontainer/logs"
@@ -64,6 +65,7 @@ type linuxContainer struct {
 	criuVersion          int
 	state                containerState
 	created              time.Time
+	pausedAt             *time.Time
 	sysFs                *sysbox.Fs
 	sysMgr               *sysbox.Mgr
 }
@@ -101,6 +103,9 @@ type State struct {
 
 	// SysMgr contains info about resources obtained from sysbox-mgr
 	SysMgr sysbox.Mgr `json:"sys_mgr,omitempty"`
+
+	// PausedAt is the time at which the container was paused (if paused)
+	PausedAt *time.Time `json:"paused_at,omitempty"`
 }
 
 // Container is a libcontainer container object.
@@ -157,6 +162,66 @@ type Container interface {
 	// errors:
 	// Systemerror - System error.
 	NotifyMemoryPressure(level PressureLevel) (<-chan struct{}, error)
+
+	// CgroupSnapshot returns a snapshot of the container's child cgroup tree
+	// (including the cgroups created by inner cgroup managers).
+	//
+	// errors:
+	// Systemerror - System error.
+	CgroupSnapshot() (*cgroups.CgroupSnapshot, error)
+
+	// KillAll kills all processes in the container using the given method.
+	//
+	// errors:
+	// Systemerror - System error.
+	KillAll(method cgroups.KillMethod) error
+
+	// ReclaimMemory triggers the reclaim of the given amount of memory (in
+	// bytes) from the container's cgroup via memory.reclaim.
+	//
+	// errors:
+	// ContainerNotRunning - Container not running or created,
+	// cgroups.ErrMemoryReclaimNotSupported - memory.reclaim not available,
+	// Systemerror - System error.
+	ReclaimMemory(bytes uint64) error
+
+	// RepairCgroups re-syncs the container's cgroup paths with those of its
+	// systemd unit, re-joins the container's init process to the cgroups
+	// whose path changed, and persists the new paths in the container's state.
+	//
+	// errors:
+	// ContainerNotRunning - Container not running or created,
+	// Systemerror - System error.
+	RepairCgroups() error
+
+	// AddMounts records the given mounts, which the caller has set up in the
+	// running container, in the container's config and persists it.
+	//
+	// errors:
+	// ContainerNotRunning - Container not running,
+	// Systemerror - System error.
+	AddMounts(mounts []*configs.Mount) error
+
+	// FreezerState returns the state of the container's cgroup freezer.
+	//
+	// errors:
+	// Systemerror - System error.
+	FreezerState() (configs.FreezerState, error)
+
+	// RecordExitCode records the given exit code of the container's init
+	// process in the container's state dir. It must come from a process that
+	// was notified of the init process' exit (e.g., its parent or tracer); the
+	// first recorded exit code is kept.
+	//
+	// errors:
+	// Systemerror - System error.
+	RecordExitCode(code int) error
+
+	// ExitCode returns the exit code of the container's init process, as
+	// recorded by RecordExitCode. It returns false if no exit code was
+	// recorded (e.g., the container has not stopped, or nobody was waiting
+	// for its init process to exit).
+	ExitCode() (int, bool)
 }
 
 // ID returns the container's unique ID
@@ -210,7 +275,7 @@ func (c *linuxContainer) Stats() (*Stats, error) {
 		err   error
 		stats = &Stats{}
 	)
-	if stats.CgroupStats, err = c.cgroupManager.GetStats(); err != nil {
+	if stats.CgroupStats, err = c.cgroupStats(); err != nil {
 		return stats, newSystemErrorWithCause(err, "getting container stats from cgroups")
 	}
 	if c.intelRdtManager != nil {
@@ -231,6 +296,30 @@ func (c *linuxContainer) Stats() (*Stats, error) {
 	return stats, nil
 }
 
+func (c *linuxContainer) CgroupSnapshot() (*cgroups.CgroupSnapshot, error) {
+	if s, ok := c.cgroupManager.(interface {
+		SnapshotCgroupTree(string) (*cgroups.CgroupSnapshot, error)
+	}); ok {
+		return s.SnapshotCgroupTree(c.id)
+	}
+	return cgroups.SnapshotCgroupTree(c.id, c.cgroupManager.GetChildCgroupPaths())
+}
+
+// childCgroupUpdate returns a copy of the given config whose cgroup resources
+// hold only those that differ from the ones in prev, so that updating the sys
+// container's child cgroups does not override the settings made within them.
+func childCgroupUpdate(config, prev *configs.Config) *configs.Config {
+	if config.Cgroups == nil || config.Cgroups.Resources == nil ||
+		prev.Cgroups == nil || prev.Cgroups.Resources == nil {
+		return config
+	}
+	cg := *config.Cgroups
+	cg.Resources = cgroups.ChangedResources(prev.Cgroups.Resources, config.Cgroups.Resources)
+	update := *config
+	update.Cgroups = &cg
+	return &update
+}
+
 func (c *linuxContainer) Set(config configs.Config) error {
 	c.m.Lock()
 	defer c.m.Unlock()
@@ -249,6 +338,18 @@ func (c *linuxContainer) Set(config configs.Config) error {
 		}
 		return err
 	}
+	// sysbox-runc: propagate the update to the sys container's child cgroups
+	if err := c.cgroupManager.UpdateChildCgroups(childCgroupUpdate(&config, c.config)); err != nil {
+		logrus.Warnf("Setting child cgroup configs failed due to error: %v", err)
+		// Set configs back
+		if err2 := c.cgroupManager.Set(c.config); err2 != nil {
+			logrus.Warnf("Setting back cgroup configs failed due to error: %v, your state.json and actual configs might be inconsistent.", err2)
+		}
+		if err2 := c.cgroupManager.UpdateChildCgroups(childCgroupUpdate(c.config, &config)); err2 != nil {
+			logrus.Warnf("Setting back child cgroup configs failed due to error: %v, your state.json and actual configs might be inconsistent.", err2)
+		}
+		return err
+	}
 	if c.intelRdtManager != nil {
 		if err := c.intelRdtManager.Set(&config); err != nil {
 			// Set configs back
@@ -261,12 +362,41 @@ func (c *linuxContainer) Set(config configs.Config) error {
 			return err
 		}
 	}
+	// sysbox-runc: persist the resource settings of the container's systemd
+	// unit (if any), so they survive systemd restarts.
+	if p, ok := c.cgroupManager.(resourcesPersister); ok {
+		if err := p.PersistResources(systemd.UnitDropInDir, config.Cgroups.Resources); err != nil {
+			logrus.Warnf("Persisting cgroup configs failed due to error: %v", err)
+		}
+	}
 	// After config setting succeed, update config and states
 	c.config = &config
 	_, err = c.updateState(nil)
 	return err
 }
 
+// resourcesPersister is implemented by the cgroup managers that persist the
+// container's resource settings across systemd restarts.
+type resourcesPersister interface {
+	PersistResources(configDir string, r *configs.Resources) error
+	LoadPersistedResources(configDir string) error
+}
+
+// loadPersistedResources re-applies the resource settings persisted by Set()
+// (if any) to the container's systemd unit, in case systemd restarted and
+// dropped them. It's called when a process is started in the container (see
+// Start() and Exec()), rather than on every load of the container, so that
+// read-only operations (e.g., state, ps) don't modify the unit.
+func (c *linuxContainer) loadPersistedResources() {
+	p, ok := c.cgroupManager.(resourcesPersister)
+	if !ok {
+		return
+	}
+	if err := p.LoadPersistedResources(systemd.UnitDropInDir); err != nil {
+		logrus.Warnf("Loading persisted cgroup configs failed due to error: %v", err)
+	}
+}
+
 func (c *linuxContainer) Start(process *Process) error {
 	c.m.Lock()
 	defer c.m.Unlock()
@@ -284,6 +414,9 @@ func (c *linuxContainer) Start(process *Process) error {
 				return err
 			}
 		}
+	} else {
+		// sysbox-runc: restore the container's persisted resource settings
+		c.loadPersistedResources()
 	}
 
 	if err := c.start(process); err != nil {
@@ -308,6 +441,8 @@ func (c *linuxContainer) Run(process *Process) error {
 func (c *linuxContainer) Exec() error {
 	c.m.Lock()
 	defer c.m.Unlock()
+	// sysbox-runc: restore the container's persisted resource settings
+	c.loadPersistedResources()
 	return c.exec()
 }
 
@@ -484,6 +619,106 @@ func (c *linuxContainer) Signal(s os.Signal, all bool) error {
 	return newGenericError(errors.New("container not running"), ContainerNotRunning)
 }
 
+func (c *linuxContainer) KillAll(method cgroups.KillMethod) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	status, err := c.currentStatus()
+	if err != nil {
+		return err
+	}
+	if status == Stopped && !c.cgroupManager.Exists() {
+		return nil
+	}
+
+	if method != cgroups.KillSignal {
+		err := cgroups.ErrCgroupKillNotSupported
+		if k, ok := c.cgroupManager.(interface{ KillCgroup() error }); ok {
+			err = k.KillCgroup()
+		}
+		if err == nil || method == cgroups.KillCgroup || err != cgroups.ErrCgroupKillNotSupported {
+			return err
+		}
+	}
+
+	return signalAllProcesses(c.cgroupManager, unix.SIGKILL)
+}
+
+func (c *linuxContainer) ReclaimMemory(bytes uint64) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	status, err := c.currentStatus()
+	if err != nil {
+		return err
+	}
+	if status == Stopped {
+		return newGenericError(fmt.Errorf("container not running or created: %s", status), ContainerNotRunning)
+	}
+
+	r, ok := c.cgroupManager.(interface{ ReclaimMemory(bytes uint64) error })
+	if !ok {
+		return cgroups.ErrMemoryReclaimNotSupported
+	}
+	return r.ReclaimMemory(bytes)
+}
+
+func (c *linuxContainer) RepairCgroups() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	status, err := c.currentStatus()
+	if err != nil {
+		return err
+	}
+	if status == Stopped {
+		return newGenericError(fmt.Errorf("container not running or created: %s", status), ContainerNotRunning)
+	}
+
+	r, ok := c.cgroupManager.(interface{ RepairCgroupPaths(pid int) error })
+	if !ok {
+		return newGenericError(errors.New("cgroup repair is only supported by the systemd cgroup manager on cgroup v1 hosts"), SystemError)
+	}
+
+	if err := r.RepairCgroupPaths(c.initProcess.pid()); err != nil {
+		return newSystemErrorWithCause(err, "repairing container cgroups")
+	}
+
+	return c.persistState()
+}
+
+// cgroupStats returns the container's cgroup stats. If getting them fails and
+// systemd.AutoRepairCgroupPaths is set, the container's cgroup paths are
+// repaired (re-joining the init process recorded in the container's state)
+// and the stats are retried.
+func (c *linuxContainer) cgroupStats() (*cgroups.Stats, error) {
+	stats, err := c.cgroupManager.GetStats()
+	if err == nil || !systemd.AutoRepairCgroupPaths {
+		return stats, err
+	}
+
+	if rerr := c.RepairCgroups(); rerr != nil {
+		logrus.Warnf("failed to repair cgroup paths of container %s: %v", c.id, rerr)
+		return nil, err
+	}
+
+	return c.cgroupManager.GetStats()
+}
+
+func (c *linuxContainer) AddMounts(mounts []*configs.Mount) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	status, err := c.currentStatus()
+	if err != nil {
+		return err
+	}
+	if status != Running {
+		return newGenericError(fmt.Errorf("container not running: %s", status), ContainerNotRunning)
+	}
+	if len(mounts) == 0 {
+		return nil
+	}
+	c.config.Mounts = append(c.config.Mounts, mounts...)
+	return c.persistState()
+}
+
 func (c *linuxContainer) createExecFifo() error {
 	rootuid, err := c.Config().HostRootUID()
 	if err != nil {
@@ -745,6 +980,62 @@ func (c *linuxContainer) Destroy() error {
 	return err
 }
 
+// Max time allowed for freezing the container's cgroups
+var freezeTimeout = 10 * time.Second
+
+// Thawing is retried on EBUSY up to thawRetries times, thawRetryDelay apart
+const (
+	thawRetries    = 5
+	thawRetryDelay = 100 * time.Millisecond
+)
+
+// freezeWithTimeout sets the given cgroup manager's freezer state; it fails if
+// this does not complete within the given timeout (e.g., because a process in
+// the cgroup can't be frozen). On a freeze timeout the cgroup is thawed, so it
+// is not left partially frozen.
+func freezeWithTimeout(m cgroups.Manager, state configs.FreezerState, timeout time.Duration) error {
+	// buffered so the goroutine exits once Freeze() returns
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Freeze(state)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		if state == configs.Frozen {
+			if err := thawWithRetry(m); err != nil {
+				logrus.Warnf("failed to thaw cgroup after freeze timeout: %v", err)
+			}
+			// the pending Freeze() may still complete; undo it if so
+			go func() {
+				if err := <-done; err == nil {
+					thawWithRetry(m)
+				}
+			}()
+		}
+		return fmt.Errorf("timed out after %v setting the cgroup freezer to %s", timeout, state)
+	}
+}
+
+// thawWithRetry thaws the given cgroup manager's freezer, retrying while the
+// freezer is busy.
+func thawWithRetry(m cgroups.Manager) error {
+	var err error
+	for i := 0; i < thawRetries; i++ {
+		err = m.Freeze(configs.Thawed)
+		if err == nil || !errors.Is(err, unix.EBUSY) {
+			return err
+		}
+		time.Sleep(thawRetryDelay)
+	}
+	return err
+}
+
 func (c *linuxContainer) Pause() error {
 	c.m.Lock()
 	defer c.m.Unlock()
@@ -754,7 +1045,7 @@ func (c *linuxContainer) Pause() error {
 	}
 	switch status {
 	case Running, Created:
-		if err := c.cgroupManager.Freeze(configs.Frozen); err != nil {
+		if err := freezeWithTimeout(c.cgroupManager, configs.Frozen, freezeTimeout); err != nil {
 			return err
 		}
 		if c.sysMgr.Enabled() {
@@ -762,9 +1053,14 @@ func (c *linuxContainer) Pause() error {
 				return err
 			}
 		}
-		return c.state.transition(&pausedState{
+		if err := c.state.transition(&pausedState{
 			c: c,
-		})
+		}); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		c.pausedAt = &now
+		return c.persistState()
 	}
 	return newGenericError(fmt.Errorf("container not running or created: %s", status), ContainerNotRunning)
 }
@@ -779,12 +1075,32 @@ func (c *linuxContainer) Resume() error {
 	if status != Paused {
 		return newGenericError(fmt.Errorf("container not paused"), ContainerNotPaused)
 	}
-	if err := c.cgroupManager.Freeze(configs.Thawed); err != nil {
+	if err := thawWithRetry(c.cgroupManager); err != nil {
 		return err
 	}
-	return c.state.transition(&runningState{
+	if err := c.state.transition(&runningState{
 		c: c,
-	})
+	}); err != nil {
+		return err
+	}
+	logrus.Debugf("container %s resumed (paused since %v)", c.id, c.pausedAt)
+	c.pausedAt = nil
+	return c.persistState()
+}
+
+// persistState saves the container's current state to its state dir.
+func (c *linuxContainer) persistState() error {
+	state, err := c.currentState()
+	if err != nil {
+		return err
+	}
+	return c.saveState(state)
+}
+
+func (c *linuxContainer) FreezerState() (configs.FreezerState, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.cgroupManager.GetFreezerState()
 }
 
 func (c *linuxContainer) NotifyOOM() (<-chan struct{}, error) {
@@ -1968,6 +2284,56 @@ func (c *linuxContainer) refreshState() error {
 	return c.state.transition(&stoppedState{c: c})
 }
 
+func (c *linuxContainer) RecordExitCode(code int) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.recordExitCode(code)
+}
+
+// recordExitCode is RecordExitCode without taking the container's lock (e.g.,
+// for the init process' wait(), which may run with the lock held).
+func (c *linuxContainer) recordExitCode(code int) (retErr error) {
+	path := filepath.Join(c.root, exitCodeFilename)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	tmpFile, err := ioutil.TempFile(c.root, "exit-code-")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if retErr != nil {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+		}
+	}()
+
+	if _, err := tmpFile.WriteString(strconv.Itoa(code)); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), path)
+}
+
+func (c *linuxContainer) ExitCode() (int, bool) {
+	data, err := ioutil.ReadFile(filepath.Join(c.root, exitCodeFilename))
+	if err != nil {
+		return 0, false
+	}
+
+	code, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false
+	}
+
+	return code, true
+}
+
 func (c *linuxContainer) runType() Status {
 	if c.initProcess == nil {
 		return Stopped
@@ -2026,6 +2392,7 @@ func (c *linuxContainer) currentState() (*State, error) {
 		ExternalDescriptors: externalDescriptors,
 		SysMgr:              *c.sysMgr,
 		SysFs:               *c.sysFs,
+		PausedAt:            c.pausedAt,
 	}
 
 	if pid > 0 {
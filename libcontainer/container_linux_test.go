@@ -88,6 +88,14 @@ func (m *mockCgroupManager) GetChildCgroupPaths() map[string]string {
 	return m.paths
 }
 
+func (m *mockCgroupManager) UpdateChildCgroups(container *configs.Config) error {
+	return nil
+}
+
+func (m *mockCgroupManager) GetType() cgroups.CgroupType {
+	return cgroups.Cgroup_v1_fs
+}
+
 func (m *mockIntelRdtManager) Apply(pid int) error {
 	return nil
 }
@@ -31,6 +31,7 @@ import (
 const (
 	stateFilename    = "state.json"
 	execFifoFilename = "exec.fifo"
+	exitCodeFilename = "exit-code"
 )
 
 var idRegex = regexp.MustCompile(`^[\w+-\.]+$`)
@@ -354,6 +355,7 @@ func (l *LinuxFactory) Load(id string) (Container, error) {
 		cgroupManager:        l.NewCgroupsManager(state.Config.Cgroups, state.CgroupPaths),
 		root:                 containerRoot,
 		created:              state.Created,
+		pausedAt:             state.PausedAt,
 		sysFs:                &state.SysFs,
 		sysMgr:               &state.SysMgr,
 	}
@@ -19,6 +19,7 @@ import (
 	"github.com/containerd/console"
 	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/keys"
 	"github.com/opencontainers/runc/libcontainer/seccomp"
 	"github.com/opencontainers/runc/libcontainer/system"
 	"github.com/opencontainers/runc/libcontainer/user"
@@ -638,3 +639,13 @@ func setupSyscallTraps(config *initConfig, pipe *os.File) error {
 
 	return nil
 }
+
+// sysbox-runc: joinSessionKeyring makes the calling process join a new session
+// keyring with the given name, or a new anonymous one if so configured (see
+// configs.Config.AnonymousKeyring).
+func joinSessionKeyring(config *configs.Config, name string) (keys.KeySerial, error) {
+	if config.AnonymousKeyring {
+		return keys.JoinAnonymousSessionKeyring()
+	}
+	return keys.JoinSessionKeyring(name)
+}
@@ -21,6 +21,17 @@ func JoinSessionKeyring(name string) (KeySerial, error) {
 	return KeySerial(sessKeyId), nil
 }
 
+// JoinAnonymousSessionKeyring creates a new anonymous session keyring and
+// makes it the caller's session keyring.
+func JoinAnonymousSessionKeyring() (KeySerial, error) {
+	// unix.KeyctlJoinSessionKeyring() can't pass a NULL name
+	sessKeyId, _, errno := unix.Syscall(unix.SYS_KEYCTL, unix.KEYCTL_JOIN_SESSION_KEYRING, 0, 0)
+	if errno != 0 {
+		return 0, errors.Wrap(errno, "create anonymous session key")
+	}
+	return KeySerial(sessKeyId), nil
+}
+
 // ModKeyringPerm modifies permissions on a keyring by reading the current permissions,
 // anding the bits with the given mask (clearing permissions) and setting
 // additional permission bits
@@ -23,6 +23,7 @@ import (
 	"github.com/opencontainers/runc/libcontainer/system"
 	"github.com/opencontainers/runc/libcontainer/utils"
 	"github.com/opencontainers/runc/libsysbox/sysbox"
+	"github.com/opencontainers/runc/libsysbox/syscont"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
@@ -376,6 +377,12 @@ func (p *initProcess) start() (retErr error) {
 		return newSystemErrorWithCause(err, "setting cgroup config for ready process")
 	}
 
+	// sysbox-runc: for OOM-protected sys containers, kill all processes as a
+	// group on OOM.
+	if err := syscont.CfgOOMGroup(p.config.Config.OomScoreAdj, p.manager); err != nil {
+		return newSystemErrorWithCause(err, "setting cgroup oom group")
+	}
+
 	// sysbox-runc: create a child cgroup that will serve as the system container's
 	// cgroup root.
 	cgType := p.manager.GetType()
@@ -672,6 +679,15 @@ func (p *initProcess) wait() (*os.ProcessState, error) {
 	if p.sharePidns {
 		signalAllProcesses(p.manager, unix.SIGKILL)
 	}
+	// sysbox-runc: record the exit code of the reaped init process in the
+	// container's state, for "runc list" and "runc wait"
+	if ps := p.cmd.ProcessState; ps != nil && p.container != nil {
+		if ws, ok := ps.Sys().(syscall.WaitStatus); ok {
+			if rerr := p.container.recordExitCode(utils.ExitStatus(unix.WaitStatus(ws))); rerr != nil && !os.IsNotExist(rerr) {
+				logrus.Warnf("failed to record exit code of container %s: %v", p.container.id, rerr)
+			}
+		}
+	}
 	return p.cmd.ProcessState, err
 }
 
@@ -7,7 +7,6 @@ import (
 	"runtime"
 
 	"github.com/opencontainers/runc/libcontainer/apparmor"
-	"github.com/opencontainers/runc/libcontainer/keys"
 	"github.com/opencontainers/runc/libcontainer/seccomp"
 	"github.com/opencontainers/runc/libcontainer/system"
 	"github.com/opencontainers/runc/libcontainer/utils"
@@ -38,7 +37,7 @@ func (l *linuxSetnsInit) Init() error {
 		}
 		defer selinux.SetKeyLabel("")
 		// Do not inherit the parent's session keyring.
-		if _, err := keys.JoinSessionKeyring(l.getSessionRingName()); err != nil {
+		if _, err := joinSessionKeyring(l.config.Config, l.getSessionRingName()); err != nil {
 			// Same justification as in standart_init_linux.go as to why we
 			// don't bail on ENOSYS.
 			//
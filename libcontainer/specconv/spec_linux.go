@@ -203,6 +203,9 @@ type CreateOpts struct {
 	UidShiftSupported bool
 	UidShiftRootfs    bool
 	SwitchDockerDns   bool
+
+	// cgroup v1 subsystems in which no cgroup is created for the container
+	ExcludedSubsystems []string
 }
 
 // CreateLibcontainerConfig creates a new libcontainer configuration from a
@@ -466,7 +469,8 @@ func CreateCgroupConfig(opts *CreateOpts, defaultDevs []*devices.Device) (*confi
 	)
 
 	c := &configs.Cgroup{
-		Resources: &configs.Resources{},
+		Resources:          &configs.Resources{},
+		ExcludedSubsystems: opts.ExcludedSubsystems,
 	}
 
 	if useSystemdCgroup {
@@ -102,7 +102,7 @@ func (l *linuxStandardInit) Init() error {
 		ringname, keepperms, newperms := l.getSessionRingParams()
 
 		// Do not inherit the parent's session keyring.
-		if sessKeyId, err := keys.JoinSessionKeyring(ringname); err != nil {
+		if sessKeyId, err := joinSessionKeyring(l.config.Config, ringname); err != nil {
 			// If keyrings aren't supported then it is likely we are on an
 			// older kernel (or inside an LXC container). While we could bail,
 			// the security feature we are using here is best-effort (it only
@@ -60,11 +60,20 @@ type Stat_t struct {
 	// StartTime is the number of clock ticks after system boot (since
 	// Linux 2.6).
 	StartTime uint64
+
+	// ExitCode is the exit status of the process in the form reported by
+	// waitpid(2); only meaningful for a zombie process (since Linux 3.5).
+	ExitCode int
 }
 
 // Stat returns a Stat_t instance for the specified process.
 func Stat(pid int) (stat Stat_t, err error) {
-	bytes, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	return StatFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+}
+
+// StatFile returns a Stat_t instance for the given /proc/[pid]/stat file.
+func StatFile(path string) (stat Stat_t, err error) {
+	bytes, err := ioutil.ReadFile(path)
 	if err != nil {
 		return stat, err
 	}
@@ -99,5 +108,8 @@ func parseStat(data string) (stat Stat_t, err error) {
 	fmt.Sscanf(parts[3-3], "%c", &state)
 	stat.State = State(state)
 	fmt.Sscanf(parts[22-3], "%d", &stat.StartTime)
+	if len(parts) > 52-3 {
+		fmt.Sscanf(parts[52-3], "%d", &stat.ExitCode)
+	}
 	return stat, nil
 }
@@ -43,3 +43,27 @@ func TestParseStartTime(t *testing.T) {
 		}
 	}
 }
+
+func TestParseExitCode(t *testing.T) {
+	// zombie process that exited with status 1 (exit code field is in waitpid(2) format)
+	line := "9534 (cat) Z 9323 9534 9323 34828 9534 4194304 95 0 0 0 0 0 0 0 20 0 1 0 9214966 0 0 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 1 0 0 0 0 0 0 0 0 0 0 0 0 256"
+	st, err := parseStat(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.State != Zombie {
+		t.Fatalf("expected state %q but received %q", Zombie, st.State)
+	}
+	if st.ExitCode != 256 {
+		t.Fatalf("expected exit code 256 but received %d", st.ExitCode)
+	}
+
+	// pre-3.5 kernels don't report the exit code
+	st, err = parseStat("9534 (cat) Z 9323 9534 9323 34828 9534 4194304 95 0 0 0 0 0 0 0 20 0 1 0 9214966 0 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.ExitCode != 0 {
+		t.Fatalf("expected exit code 0 but received %d", st.ExitCode)
+	}
+}
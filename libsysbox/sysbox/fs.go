@@ -27,6 +27,10 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
+// FsMountDir is the dir where sysbox-fs is mounted; the files it emulates for
+// each container are under FsMountDir/<container-id>.
+const FsMountDir = "/var/lib/sysboxfs"
+
 // FsRegInfo contains info about a sys container registered with sysbox-fs
 type FsRegInfo struct {
 	Hostname      string
@@ -122,11 +122,27 @@ func (mgr *Mgr) PrepMounts(uid, gid uint32, prepList []ipcLib.MountPrepInfo) err
 	return nil
 }
 
+// SupMountsError is returned when sysbox-mgr fails to setup the requested
+// container mounts; it carries the mounts that sysbox-mgr did setup before the
+// failure (if any).
+type SupMountsError struct {
+	Err    error
+	Mounts []specs.Mount
+}
+
+func (e *SupMountsError) Error() string {
+	if len(e.Mounts) > 0 {
+		return fmt.Sprintf("failed to request mounts from sysbox-mgr (%d mounts setup before the failure): %v", len(e.Mounts), e.Err)
+	}
+	return fmt.Sprintf("failed to request mounts from sysbox-mgr: %v", e.Err)
+}
+
 // ReqMounts sends a request to sysbox-mgr for container mounts; all paths must be absolute.
+// On failure, returns a *SupMountsError.
 func (mgr *Mgr) ReqMounts(rootfs string, uid, gid uint32, shiftUids bool, reqList []ipcLib.MountReqInfo) ([]specs.Mount, error) {
 	mounts, err := sysboxMgrGrpc.ReqMounts(mgr.Id, rootfs, uid, gid, shiftUids, reqList)
 	if err != nil {
-		return nil, fmt.Errorf("failed to request mounts from sysbox-mgr: %v", err)
+		return nil, &SupMountsError{Err: err, Mounts: mounts}
 	}
 	return mounts, nil
 }
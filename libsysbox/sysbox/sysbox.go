@@ -26,8 +26,10 @@ import (
 	"syscall"
 	"unsafe"
 
+	"github.com/moby/sys/mountinfo"
 	libutils "github.com/nestybox/sysbox-libs/utils"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
@@ -150,6 +152,43 @@ func checkKernelVersion(distro string) error {
 	return nil
 }
 
+const overlayfsSuperMagic = 0x794c7630
+
+// replaceable in tests
+var statfs = syscall.Statfs
+
+// detectOverlayfs returns true if the given path is on an overlayfs mount.
+func detectOverlayfs(path string) (bool, error) {
+	var fs syscall.Statfs_t
+
+	if err := statfs(path, &fs); err != nil {
+		return false, fmt.Errorf("failed to statfs %s: %v", path, err)
+	}
+
+	return int64(fs.Type) == overlayfsSuperMagic, nil
+}
+
+// getOverlayLowerDir returns the top-most lower dir of the overlayfs mount at
+// the given path (replaceable in tests).
+var getOverlayLowerDir = func(path string) (string, error) {
+	mounts, err := mountinfo.GetMounts(mountinfo.SingleEntryFilter(path))
+	if err != nil {
+		return "", err
+	}
+	if len(mounts) == 0 {
+		return "", fmt.Errorf("no mount found at %s", path)
+	}
+
+	for _, opt := range strings.Split(mounts[0].VFSOptions, ",") {
+		if strings.HasPrefix(opt, "lowerdir=") {
+			dirs := strings.Split(strings.TrimPrefix(opt, "lowerdir="), ":")
+			return dirs[0], nil
+		}
+	}
+
+	return "", fmt.Errorf("no lowerdir found for overlayfs mount at %s", path)
+}
+
 // needUidShiftOnRootfs checks if uid/gid shifting is required on the container's rootfs.
 func needUidShiftOnRootfs(spec *specs.Spec) (bool, error) {
 	var hostUidMap, hostGidMap uint32
@@ -172,8 +211,25 @@ func needUidShiftOnRootfs(spec *specs.Spec) (bool, error) {
 
 	// find the rootfs owner
 	rootfs := spec.Root.Path
+	ownerPath := rootfs
+
+	// On overlayfs the rootfs mountpoint ownership need not match the image
+	// layers' ownership; get the owner from the top-most lower layer instead.
+	overlay, err := detectOverlayfs(rootfs)
+	if err != nil {
+		return false, err
+	}
+
+	if overlay {
+		lowerDir, err := getOverlayLowerDir(rootfs)
+		if err != nil {
+			logrus.Debugf("failed to get overlayfs lower dir for %s (using rootfs owner instead): %v", rootfs, err)
+		} else {
+			ownerPath = lowerDir
+		}
+	}
 
-	fi, err := os.Stat(rootfs)
+	fi, err := os.Stat(ownerPath)
 	if err != nil {
 		return false, err
 	}
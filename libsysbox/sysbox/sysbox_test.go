@@ -0,0 +1,141 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sysbox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestDetectOverlayfs(t *testing.T) {
+	origStatfs := statfs
+	defer func() { statfs = origStatfs }()
+
+	var fsType int64
+
+	statfs = func(path string, buf *syscall.Statfs_t) error {
+		buf.Type = fsType
+		return nil
+	}
+
+	fsType = overlayfsSuperMagic
+	overlay, err := detectOverlayfs("/some/path")
+	if err != nil {
+		t.Fatalf("detectOverlayfs: returned error: %v", err)
+	}
+	if !overlay {
+		t.Errorf("detectOverlayfs: failed to detect overlayfs")
+	}
+
+	fsType = 0xEF53 // ext4
+	overlay, err = detectOverlayfs("/some/path")
+	if err != nil {
+		t.Fatalf("detectOverlayfs: returned error: %v", err)
+	}
+	if overlay {
+		t.Errorf("detectOverlayfs: ext4 detected as overlayfs")
+	}
+
+	statfs = func(path string, buf *syscall.Statfs_t) error {
+		return syscall.ENOENT
+	}
+	if _, err := detectOverlayfs("/some/path"); err == nil {
+		t.Errorf("detectOverlayfs: expected error on statfs failure")
+	}
+}
+
+func TestNeedUidShiftOnRootfsOverlay(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	origStatfs, origGetLowerDir := statfs, getOverlayLowerDir
+	defer func() { statfs, getOverlayLowerDir = origStatfs, origGetLowerDir }()
+
+	// rootfs owned by true root; lower layer owned by the container's root
+	rootfs, err := ioutil.TempDir("", "sysbox-rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	lowerDir, err := ioutil.TempDir("", "sysbox-lower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(lowerDir)
+
+	if err := os.Chown(lowerDir, 231072, 231072); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &specs.Spec{
+		Root: &specs.Root{Path: rootfs},
+		Linux: &specs.Linux{
+			UIDMappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: 231072, Size: 65536}},
+			GIDMappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: 231072, Size: 65536}},
+		},
+	}
+
+	getOverlayLowerDir = func(path string) (string, error) {
+		return lowerDir, nil
+	}
+
+	// not on overlayfs: rootfs owner is used
+	statfs = func(path string, buf *syscall.Statfs_t) error {
+		buf.Type = 0xEF53
+		return nil
+	}
+	shift, err := needUidShiftOnRootfs(spec)
+	if err != nil {
+		t.Fatalf("needUidShiftOnRootfs: returned error: %v", err)
+	}
+	if !shift {
+		t.Errorf("needUidShiftOnRootfs: want shift for root-owned rootfs")
+	}
+
+	// on overlayfs: lower layer owner is used
+	statfs = func(path string, buf *syscall.Statfs_t) error {
+		buf.Type = overlayfsSuperMagic
+		return nil
+	}
+	shift, err = needUidShiftOnRootfs(spec)
+	if err != nil {
+		t.Fatalf("needUidShiftOnRootfs: returned error: %v", err)
+	}
+	if shift {
+		t.Errorf("needUidShiftOnRootfs: want no shift for overlayfs rootfs with container-owned lower layer")
+	}
+}
+
+func TestSupMountsError(t *testing.T) {
+	err := &SupMountsError{Err: fmt.Errorf("connection refused")}
+	if err.Error() != "failed to request mounts from sysbox-mgr: connection refused" {
+		t.Errorf("SupMountsError: unexpected error string %q", err.Error())
+	}
+
+	err.Mounts = []specs.Mount{{Destination: "/var/lib/docker"}, {Destination: "/var/lib/kubelet"}}
+	if !strings.Contains(err.Error(), "2 mounts setup before the failure") {
+		t.Errorf("SupMountsError: error string %q does not report partial mounts", err.Error())
+	}
+}
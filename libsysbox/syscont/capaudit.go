@@ -0,0 +1,125 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	utils "github.com/nestybox/sysbox-libs/utils"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// CapAuditEntry is a record in a container's capability audit log.
+type CapAuditEntry struct {
+	ContainerID string    `json:"container_id"`
+	Timestamp   time.Time `json:"timestamp"`
+	Uid         uint32    `json:"uid"`
+	// capabilities in the process' bounding set
+	Granted []string `json:"granted"`
+	// capabilities removed from the process' bounding set
+	Denied []string `json:"denied"`
+}
+
+// CapAuditLogPath returns the path of the given container's capability audit
+// log within the given audit dir.
+func CapAuditLogPath(auditDir, containerID string) string {
+	return filepath.Join(auditDir, containerID+"-caps.log")
+}
+
+// cfgCapabilityAuditLog appends a record of the capabilities granted to (and
+// denied from) the given process to the container's capability audit log. Each
+// record is a JSON object in a line of its own.
+func cfgCapabilityAuditLog(p *specs.Process, containerID string, auditDir string) error {
+	if p.Capabilities == nil {
+		return nil
+	}
+
+	granted := p.Capabilities.Bounding
+	if granted == nil {
+		granted = []string{}
+	}
+
+	entry := CapAuditEntry{
+		ContainerID: containerID,
+		Timestamp:   time.Now().UTC(),
+		Uid:         p.User.UID,
+		Granted:     granted,
+		Denied:      utils.StringSliceRemove(linuxCaps, granted),
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(auditDir, 0700); err != nil {
+		return err
+	}
+
+	path := CapAuditLogPath(auditDir, containerID)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// a single write per record, such that records are not interleaved
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// ReadCapAuditLog returns the records in the given container's capability
+// audit log.
+func ReadCapAuditLog(auditDir, containerID string) ([]CapAuditEntry, error) {
+	path := CapAuditLogPath(auditDir, containerID)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []CapAuditEntry{}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		var entry CapAuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s: invalid record at line %d: %v", path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,138 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	utils "github.com/nestybox/sysbox-libs/utils"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestCfgCapabilityAuditLog(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-capaudit-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	auditDir := filepath.Join(tmpDir, "audit")
+
+	// root process with a denied cap
+	rootProc := &specs.Process{
+		User:         specs.User{UID: 0},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	annot := map[string]string{denyCapsAnnot: "CAP_SYS_MODULE"}
+	if err := cfgCapabilities(rootProc, annot); err != nil {
+		t.Fatalf("cfgCapabilities: unexpected error: %v", err)
+	}
+
+	// non-root process
+	userProc := &specs.Process{
+		User:         specs.User{UID: 1000},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	if err := cfgCapabilities(userProc, nil); err != nil {
+		t.Fatalf("cfgCapabilities: unexpected error: %v", err)
+	}
+
+	for _, p := range []*specs.Process{rootProc, userProc} {
+		if err := cfgCapabilityAuditLog(p, "cid", auditDir); err != nil {
+			t.Fatalf("cfgCapabilityAuditLog: unexpected error: %v", err)
+		}
+	}
+
+	path := CapAuditLogPath(auditDir, "cid")
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("cfgCapabilityAuditLog: log not created: %v", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("cfgCapabilityAuditLog: want log perm 0600; got %o", fi.Mode().Perm())
+	}
+
+	// each line must be a complete json object
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		obj := make(map[string]interface{})
+		if err := json.Unmarshal(scanner.Bytes(), &obj); err != nil {
+			t.Errorf("cfgCapabilityAuditLog: line %d is not valid json: %v", lines+1, err)
+		}
+		for _, k := range []string{"container_id", "timestamp", "uid", "granted", "denied"} {
+			if _, ok := obj[k]; !ok {
+				t.Errorf("cfgCapabilityAuditLog: line %d has no %s field", lines+1, k)
+			}
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("cfgCapabilityAuditLog: want 2 records; got %d", lines)
+	}
+
+	entries, err := ReadCapAuditLog(auditDir, "cid")
+	if err != nil {
+		t.Fatalf("ReadCapAuditLog: unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ReadCapAuditLog: want 2 records; got %d", len(entries))
+	}
+
+	root := entries[0]
+	if root.ContainerID != "cid" || root.Uid != 0 || root.Timestamp.IsZero() {
+		t.Errorf("ReadCapAuditLog: unexpected record %+v", root)
+	}
+	if !reflect.DeepEqual(root.Denied, []string{"CAP_SYS_MODULE"}) {
+		t.Errorf("ReadCapAuditLog: want denied [CAP_SYS_MODULE]; got %v", root.Denied)
+	}
+	if utils.StringSliceContains(root.Granted, "CAP_SYS_MODULE") || len(root.Granted) != len(linuxCaps)-1 {
+		t.Errorf("ReadCapAuditLog: unexpected granted caps %v", root.Granted)
+	}
+
+	user := entries[1]
+	if user.Uid != 1000 || len(user.Denied) != 0 || len(user.Granted) != len(linuxCaps) {
+		t.Errorf("ReadCapAuditLog: unexpected record %+v", user)
+	}
+
+	// corrupt records are reported
+	if err := ioutil.WriteFile(CapAuditLogPath(auditDir, "bad"), []byte("{\"uid\": 0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCapAuditLog(auditDir, "bad"); err == nil {
+		t.Errorf("ReadCapAuditLog: expected error for corrupt log")
+	}
+
+	if _, err := ReadCapAuditLog(auditDir, "missing"); !os.IsNotExist(err) {
+		t.Errorf("ReadCapAuditLog: want not-exist error for missing log; got %v", err)
+	}
+}
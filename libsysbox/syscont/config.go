@@ -0,0 +1,173 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	utils "github.com/nestybox/sysbox-libs/utils"
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+)
+
+// Default locations of the sysbox-runc config file (in order of precedence)
+var configPaths = []string{
+	"/etc/sysbox/sysbox-runc.toml",
+	"~/.config/sysbox/sysbox-runc.toml",
+}
+
+// Config holds the settings in the sysbox-runc config file: the "all" array in
+// the "[capabilities]" table and the "isolation" setting in the "[keyring]"
+// table.
+type Config struct {
+	// Capabilities added to the hardcoded set of capabilities given to sys
+	// container root processes.
+	Capabilities []string
+
+	// KeyringIsolation gives each sys container its own anonymous session
+	// keyring (default true; see KeyringIsolation).
+	KeyringIsolation bool
+}
+
+var capNameRe = regexp.MustCompile(`^CAP_[A-Z_]+$`)
+
+// LoadConfig loads the sysbox-runc config file at the given path (or at the
+// default locations if path is empty) and applies its settings. It's not an
+// error for the config file to be absent at the default locations.
+func LoadConfig(path string) error {
+	var paths []string
+
+	if path != "" {
+		paths = []string{path}
+	} else {
+		for _, p := range configPaths {
+			if strings.HasPrefix(p, "~/") {
+				home, err := os.UserHomeDir()
+				if err != nil {
+					continue
+				}
+				p = filepath.Join(home, p[2:])
+			}
+			paths = append(paths, p)
+		}
+	}
+
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			if os.IsNotExist(err) && path == "" {
+				continue
+			}
+			return fmt.Errorf("failed to read config file: %v", err)
+		}
+
+		cfg, err := parseConfig(data)
+		if err != nil {
+			return fmt.Errorf("invalid config file %s: %v", p, err)
+		}
+
+		linuxCaps = mergeCaps(linuxCaps, cfg.Capabilities)
+		keyringIsolation = cfg.KeyringIsolation
+		logrus.Debugf("loaded config file %s", p)
+
+		return nil
+	}
+
+	return nil
+}
+
+// mergeCaps returns the union of the given capability lists.
+func mergeCaps(caps, extra []string) []string {
+	merged := make([]string, len(caps), len(caps)+len(extra))
+	copy(merged, caps)
+
+	for _, c := range extra {
+		if utils.StringSliceContains(merged, c) {
+			continue
+		}
+		logrus.Warnf("capability %s (from config file) is not known to sysbox-runc; containers will fail to start if the kernel does not support it", c)
+		merged = append(merged, c)
+	}
+
+	return merged
+}
+
+// configFile is the format of the sysbox-runc config file.
+type configFile struct {
+	Capabilities struct {
+		All []string `toml:"all"`
+	} `toml:"capabilities"`
+	Keyring struct {
+		Isolation *bool `toml:"isolation"`
+	} `toml:"keyring"`
+}
+
+// knownConfigSettings are the settings in the sysbox-runc config file
+var knownConfigSettings = map[string]bool{
+	"capabilities.all":  true,
+	"keyring.isolation": true,
+}
+
+// parseConfig parses the sysbox-runc config file. Unknown settings are
+// ignored (with a warning).
+func parseConfig(data []byte) (*Config, error) {
+	tree, err := toml.LoadBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var f configFile
+	if err := tree.Unmarshal(&f); err != nil {
+		return nil, err
+	}
+
+	for _, table := range tree.Keys() {
+		sub, ok := tree.Get(table).(*toml.Tree)
+		if !ok {
+			logrus.Warnf("config file: ignoring unknown setting %s", table)
+			continue
+		}
+		for _, key := range sub.Keys() {
+			if !knownConfigSettings[table+"."+key] {
+				logrus.Warnf("config file: ignoring unknown setting %s.%s", table, key)
+			}
+		}
+	}
+
+	cfg := &Config{KeyringIsolation: true}
+
+	for _, c := range f.Capabilities.All {
+		c = strings.ToUpper(c)
+		if !capNameRe.MatchString(c) {
+			return nil, fmt.Errorf("invalid capability %q", c)
+		}
+		cfg.Capabilities = append(cfg.Capabilities, c)
+	}
+
+	if f.Keyring.Isolation != nil {
+		cfg.KeyringIsolation = *f.Keyring.Isolation
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,149 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	utils "github.com/nestybox/sysbox-libs/utils"
+)
+
+func TestParseConfig(t *testing.T) {
+	data := `
+# sysbox-runc config
+[capabilities]
+all = [
+  "CAP_PERFMON",   # linux 5.8
+  'CAP_BPF',
+  "cap_checkpoint_restore",
+]
+
+[other]
+foo = "bar"
+`
+	cfg, err := parseConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("parseConfig: unexpected error: %v", err)
+	}
+
+	want := []string{"CAP_PERFMON", "CAP_BPF", "CAP_CHECKPOINT_RESTORE"}
+	if !utils.StringSliceEqual(cfg.Capabilities, want) {
+		t.Errorf("parseConfig: want caps %v; got %v", want, cfg.Capabilities)
+	}
+
+	// single line array
+	cfg, err = parseConfig([]byte("[capabilities]\nall = [\"CAP_BPF\"]\n"))
+	if err != nil {
+		t.Fatalf("parseConfig: unexpected error: %v", err)
+	}
+	if !utils.StringSliceEqual(cfg.Capabilities, []string{"CAP_BPF"}) {
+		t.Errorf("parseConfig: want caps [CAP_BPF]; got %v", cfg.Capabilities)
+	}
+
+	if !cfg.KeyringIsolation {
+		t.Errorf("parseConfig: want keyring isolation enabled by default")
+	}
+
+	cfg, err = parseConfig([]byte("[keyring]\nisolation = false # shared keyrings\n"))
+	if err != nil {
+		t.Fatalf("parseConfig: unexpected error: %v", err)
+	}
+	if cfg.KeyringIsolation {
+		t.Errorf("parseConfig: want keyring isolation disabled")
+	}
+
+	invalid := []string{
+		"[keyring]\nisolation = \"no\"",
+		"[capabilities\nall = []",
+		"[capabilities]\nall",
+		"[capabilities]\nall = [\"CAP_BPF\"",
+		"[capabilities]\nall = \"CAP_BPF\"",
+		"[capabilities]\nall = [CAP_BPF]",
+		"[capabilities]\nall = [\"NOT_A_CAP\"]",
+	}
+
+	for _, data := range invalid {
+		if _, err := parseConfig([]byte(data)); err == nil {
+			t.Errorf("parseConfig(%q): expected error, got none", data)
+		}
+	}
+}
+
+func TestMergeCaps(t *testing.T) {
+	caps := []string{"CAP_CHOWN", "CAP_SYS_ADMIN"}
+
+	merged := mergeCaps(caps, []string{"CAP_SYS_ADMIN", "CAP_BPF", "CAP_BPF"})
+
+	want := []string{"CAP_CHOWN", "CAP_SYS_ADMIN", "CAP_BPF"}
+	if !utils.StringSliceEqual(merged, want) {
+		t.Errorf("mergeCaps: want %v; got %v", want, merged)
+	}
+
+	// the original list is not modified
+	if !utils.StringSliceEqual(caps, []string{"CAP_CHOWN", "CAP_SYS_ADMIN"}) {
+		t.Errorf("mergeCaps: original list modified: %v", caps)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-config-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origCaps := linuxCaps
+	origPaths := configPaths
+	defer func() {
+		linuxCaps = origCaps
+		configPaths = origPaths
+	}()
+
+	// no config file at the default locations
+	configPaths = []string{filepath.Join(tmpDir, "missing.toml")}
+	if err := LoadConfig(""); err != nil {
+		t.Errorf("LoadConfig: unexpected error with no config file: %v", err)
+	}
+	if len(linuxCaps) != len(origCaps) {
+		t.Errorf("LoadConfig: caps changed with no config file")
+	}
+
+	// explicit config file must exist
+	if err := LoadConfig(filepath.Join(tmpDir, "missing.toml")); err == nil {
+		t.Errorf("LoadConfig: expected error for missing config file")
+	}
+
+	cfgFile := filepath.Join(tmpDir, "sysbox-runc.toml")
+	if err := ioutil.WriteFile(cfgFile, []byte("[capabilities]\nall = [\"CAP_PERFMON\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configPaths = []string{filepath.Join(tmpDir, "missing.toml"), cfgFile}
+	if err := LoadConfig(""); err != nil {
+		t.Fatalf("LoadConfig: unexpected error: %v", err)
+	}
+
+	if len(linuxCaps) != len(origCaps)+1 || !utils.StringSliceContains(linuxCaps, "CAP_PERFMON") {
+		t.Errorf("LoadConfig: CAP_PERFMON not added to caps: %v", linuxCaps)
+	}
+}
@@ -0,0 +1,100 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Core dump pattern used in sys containers when the host's pattern pipes core
+// dumps to a helper (e.g., systemd-coredump or apport), as the helper runs in
+// the host's context and its paths don't apply to the container.
+const defaultCorePattern = "/tmp/core-%e-%p"
+
+// The kernel's max core pattern length (CORENAME_MAX_SIZE - 1)
+const maxCorePatternLen = 127
+
+// replaceable in tests
+var hostCorePatternPath = "/proc/sys/kernel/core_pattern"
+
+// EmulatedSysctls returns the non-namespaced sysctls that sysbox-fs emulates
+// per-container (via its /proc/sys mount), and which may thus be set in the
+// sys container's spec.
+func EmulatedSysctls() []string {
+	return []string{"kernel.core_pattern"}
+}
+
+// cfgCoreDumpPattern sets the sys container's core dump pattern (the
+// kernel.core_pattern sysctl, which sysbox-fs emulates per-container) when the
+// "sysbox.io/core-pattern" annotation is given, or when the host's pattern is a
+// pipe (in which case core dumps go to files in the container's /tmp). A
+// kernel.core_pattern sysctl already in the spec takes priority. Must only be
+// called when sysbox-fs is enabled.
+func cfgCoreDumpPattern(spec *specs.Spec) error {
+	if _, ok := spec.Linux.Sysctl["kernel.core_pattern"]; ok {
+		return nil
+	}
+
+	pattern, err := corePattern(spec.Annotations)
+	if err != nil {
+		return err
+	}
+	if pattern == "" {
+		return nil
+	}
+
+	if spec.Linux.Sysctl == nil {
+		spec.Linux.Sysctl = make(map[string]string)
+	}
+	spec.Linux.Sysctl["kernel.core_pattern"] = pattern
+
+	return nil
+}
+
+// corePattern returns the core dump pattern for the container with the given
+// annotations (see cfgCoreDumpPattern), or an empty string if the host's
+// pattern applies.
+func corePattern(annotations map[string]string) (string, error) {
+	if val, ok := annotations[corePatternAnnot]; ok {
+		val = strings.TrimSpace(val)
+		if val == "" || len(val) > maxCorePatternLen {
+			return "", fmt.Errorf("invalid value for annotation %s: %q (must be 1 to %d characters)",
+				corePatternAnnot, val, maxCorePatternLen)
+		}
+		if strings.HasPrefix(val, "|") {
+			return "", fmt.Errorf("invalid value for annotation %s: %s (pipe patterns are not supported in sys containers)",
+				corePatternAnnot, val)
+		}
+		return val, nil
+	}
+
+	data, err := ioutil.ReadFile(hostCorePatternPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the host's core dump pattern: %v", err)
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "|") {
+		return defaultCorePattern, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,123 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestCfgCoreDumpPattern(t *testing.T) {
+	dir, err := ioutil.TempDir("", "coredump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	orig := hostCorePatternPath
+	defer func() { hostCorePatternPath = orig }()
+	hostCorePatternPath = filepath.Join(dir, "core_pattern")
+
+	tests := []struct {
+		name        string
+		host        string
+		annotations map[string]string
+		sysctl      map[string]string
+		want        string
+	}{
+		{
+			name: "pipe",
+			host: "|/usr/lib/systemd/systemd-coredump %P %u %g %s %t %c %h\n",
+			want: defaultCorePattern,
+		},
+		{
+			name: "file",
+			host: "/var/crash/core.%e.%p\n",
+			want: "",
+		},
+		{
+			name:        "annotation",
+			host:        "|/usr/share/apport/apport %p %s %c %d %P %E\n",
+			annotations: map[string]string{corePatternAnnot: "/cores/%e.%p"},
+			want:        "/cores/%e.%p",
+		},
+		{
+			name:   "spec sysctl",
+			host:   "|/usr/share/apport/apport %p %s %c %d %P %E\n",
+			sysctl: map[string]string{"kernel.core_pattern": "core"},
+			want:   "core",
+		},
+	}
+
+	for _, test := range tests {
+		if err := ioutil.WriteFile(hostCorePatternPath, []byte(test.host), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		spec := &specs.Spec{
+			Annotations: test.annotations,
+			Linux:       &specs.Linux{Sysctl: test.sysctl},
+		}
+		if err := cfgCoreDumpPattern(spec); err != nil {
+			t.Errorf("cfgCoreDumpPattern(%s): unexpected error: %v", test.name, err)
+			continue
+		}
+		if got := spec.Linux.Sysctl["kernel.core_pattern"]; got != test.want {
+			t.Errorf("cfgCoreDumpPattern(%s): want core pattern %q; got %q", test.name, test.want, got)
+		}
+		if _, ok := spec.Linux.Sysctl["kernel.core_pattern"]; ok != (test.want != "") {
+			t.Errorf("cfgCoreDumpPattern(%s): want core pattern set %v; got %v", test.name, test.want != "", ok)
+		}
+		if _, ok := spec.Linux.Sysctl["kernel.core_uses_pid"]; ok {
+			t.Errorf("cfgCoreDumpPattern(%s): unexpected kernel.core_uses_pid", test.name)
+		}
+	}
+}
+
+func TestCfgCoreDumpPatternInvalid(t *testing.T) {
+	orig := hostCorePatternPath
+	defer func() { hostCorePatternPath = orig }()
+
+	invalid := []string{
+		"",
+		"|/bin/sh -c cat",
+		"/tmp/" + strings.Repeat("x", maxCorePatternLen),
+	}
+	for _, val := range invalid {
+		spec := &specs.Spec{
+			Annotations: map[string]string{corePatternAnnot: val},
+			Linux:       &specs.Linux{},
+		}
+		if err := cfgCoreDumpPattern(spec); err == nil {
+			t.Errorf("cfgCoreDumpPattern(%q): want error", val)
+		}
+	}
+
+	// the host's pattern can't be read
+	hostCorePatternPath = "/nonexistent/core_pattern"
+	spec := &specs.Spec{Linux: &specs.Linux{}}
+	if err := cfgCoreDumpPattern(spec); err == nil {
+		t.Errorf("cfgCoreDumpPattern: want error when the host's pattern can't be read")
+	}
+}
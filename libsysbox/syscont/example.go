@@ -17,6 +17,8 @@
 package syscont
 
 import (
+	"strings"
+
 	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
@@ -145,3 +147,28 @@ func Example() (*specs.Spec, error) {
 		},
 	}, nil
 }
+
+// SysboxFsMountStubs returns the mounts virtualized by sysbox-fs, with their
+// sources under the sysbox-fs mountpoint. When the container is created,
+// sysbox-runc replaces them with the container's own sysbox-fs mounts.
+func SysboxFsMountStubs() []specs.Mount {
+	mounts := make([]specs.Mount, len(sysboxFsMounts))
+	for i, m := range sysboxFsMounts {
+		m.Options = append([]string(nil), m.Options...)
+		mounts[i] = m
+	}
+	return mounts
+}
+
+// SysboxFsMounts returns the spec mounts that are backed by sysbox-fs.
+func SysboxFsMounts(spec *specs.Spec) []specs.Mount {
+	var mounts []specs.Mount
+
+	for _, m := range spec.Mounts {
+		if strings.HasPrefix(m.Source, SysboxFsDir+"/") {
+			mounts = append(mounts, m)
+		}
+	}
+
+	return mounts
+}
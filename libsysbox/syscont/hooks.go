@@ -0,0 +1,241 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// HookStage identifies one of the container lifecycle stages at which OCI
+// hooks run.
+type HookStage string
+
+const (
+	HookPrestart      HookStage = "prestart"
+	HookCreateRuntime HookStage = "createRuntime"
+	// startContainer hooks run in the container's namespaces, as children of
+	// its init process, right before the container's process is exec'd.
+	HookStartContainer HookStage = "startContainer"
+	HookPoststart      HookStage = "poststart"
+	HookPoststop       HookStage = "poststop"
+)
+
+// hookStages lists the stages managed by the HookManager, in the order in
+// which they are listed.
+var hookStages = []HookStage{HookPrestart, HookCreateRuntime, HookStartContainer, HookPoststart, HookPoststop}
+
+// IDs of the hooks added by sysbox
+const (
+	supMountChownHookID        = "sysbox-sup-mount-chown"
+	netIsolationSetupHookID    = "sysbox-net-isolation-setup"
+	netIsolationCleanupHookID  = "sysbox-net-isolation-cleanup"
+	netIfaceRenameHookID       = "sysbox-net-iface-rename"
+	netAccountingSetupHookID   = "sysbox-net-accounting-setup"
+	netAccountingCleanupHookID = "sysbox-net-accounting-cleanup"
+)
+
+// Sysbox hooks are shell commands ("/bin/sh -c <cmd>"); the hook's ID is
+// stored in a trailing comment line of the command, so that it does not
+// alter what the hook does.
+const hookIDPrefix = "# sysbox-hook-id="
+
+var hookIDRe = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*$`)
+
+// HookInfo describes a hook in the container's spec.
+type HookInfo struct {
+	Stage HookStage
+	Index int
+	// ID is empty for hooks not added by sysbox
+	ID   string
+	Path string
+	Args []string
+}
+
+// HookManager adds and removes the hooks that sysbox needs in the container's
+// spec. Each sysbox hook has an ID, and a given ID may only be present once in
+// the spec; this way sysbox hooks can't be duplicated or confused with the
+// hooks that come with the spec.
+type HookManager struct {
+	spec *specs.Spec
+}
+
+// NewHookManager returns a hook manager for the given spec.
+func NewHookManager(spec *specs.Spec) *HookManager {
+	return &HookManager{spec: spec}
+}
+
+// AppendHook adds a hook running the given shell command at the end of the
+// given stage's hooks.
+func (hm *HookManager) AppendHook(stage HookStage, id, cmd string) error {
+	return hm.addHook(stage, id, cmd, false)
+}
+
+// PrependHook adds a hook running the given shell command at the start of the
+// given stage's hooks (i.e., before any hooks in the spec).
+func (hm *HookManager) PrependHook(stage HookStage, id, cmd string) error {
+	return hm.addHook(stage, id, cmd, true)
+}
+
+func (hm *HookManager) addHook(stage HookStage, id, cmd string, prepend bool) error {
+	if !hookIDRe.MatchString(id) {
+		return fmt.Errorf("invalid hook ID %q", id)
+	}
+
+	for _, h := range hm.ListHooks() {
+		if h.ID == id {
+			return fmt.Errorf("hook %s conflicts with existing %s hook %d", id, h.Stage, h.Index)
+		}
+	}
+
+	if hm.spec.Hooks == nil {
+		hm.spec.Hooks = &specs.Hooks{}
+	}
+
+	hooks, err := hm.stageHooks(stage)
+	if err != nil {
+		return err
+	}
+
+	hook := sysboxHook(id, cmd)
+	if prepend {
+		*hooks = append([]specs.Hook{hook}, *hooks...)
+	} else {
+		*hooks = append(*hooks, hook)
+	}
+
+	return nil
+}
+
+// RemoveHookByID removes the hook with the given ID from the spec; returns
+// false if there is no such hook.
+func (hm *HookManager) RemoveHookByID(id string) bool {
+	if hm.spec.Hooks == nil {
+		return false
+	}
+
+	found := false
+	for _, stage := range hookStages {
+		hooks, _ := hm.stageHooks(stage)
+		kept := (*hooks)[:0]
+		for _, h := range *hooks {
+			if hookID(h) == id {
+				found = true
+				continue
+			}
+			kept = append(kept, h)
+		}
+		if len(kept) == 0 {
+			kept = nil
+		}
+		*hooks = kept
+	}
+
+	return found
+}
+
+// HasHook returns true if the spec has a hook with the given ID.
+func (hm *HookManager) HasHook(id string) bool {
+	for _, h := range hm.ListHooks() {
+		if h.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ListHooks returns the hooks in the spec (sysbox's and others).
+func (hm *HookManager) ListHooks() []HookInfo {
+	var info []HookInfo
+
+	if hm.spec.Hooks == nil {
+		return info
+	}
+
+	for _, stage := range hookStages {
+		hooks, _ := hm.stageHooks(stage)
+		for i, h := range *hooks {
+			info = append(info, HookInfo{
+				Stage: stage,
+				Index: i,
+				ID:    hookID(h),
+				Path:  h.Path,
+				Args:  h.Args,
+			})
+		}
+	}
+
+	return info
+}
+
+// stageHooks returns the spec's hooks for the given stage; spec.Hooks must
+// not be nil.
+func (hm *HookManager) stageHooks(stage HookStage) (*[]specs.Hook, error) {
+	switch stage {
+	case HookPrestart:
+		return &hm.spec.Hooks.Prestart, nil
+	case HookCreateRuntime:
+		return &hm.spec.Hooks.CreateRuntime, nil
+	case HookStartContainer:
+		return &hm.spec.Hooks.StartContainer, nil
+	case HookPoststart:
+		return &hm.spec.Hooks.Poststart, nil
+	case HookPoststop:
+		return &hm.spec.Hooks.Poststop, nil
+	}
+	return nil, fmt.Errorf("unsupported hook stage %q", stage)
+}
+
+// sysboxHook returns the hook with the given ID that runs the given shell
+// command.
+func sysboxHook(id, cmd string) specs.Hook {
+	return specs.Hook{
+		Path: "/bin/sh",
+		Args: []string{"sh", "-c", cmd + "\n" + hookIDPrefix + id},
+	}
+}
+
+// hookID returns the ID of the given hook, or an empty string if it's not a
+// sysbox hook.
+func hookID(h specs.Hook) string {
+	if h.Path != "/bin/sh" || len(h.Args) != 3 || h.Args[1] != "-c" {
+		return ""
+	}
+
+	i := strings.LastIndex(h.Args[2], "\n"+hookIDPrefix)
+	if i < 0 {
+		return ""
+	}
+
+	id := h.Args[2][i+len(hookIDPrefix)+1:]
+	if !hookIDRe.MatchString(id) {
+		return ""
+	}
+
+	return id
+}
+
+// shellQuote quotes the given string for use as a single word in a shell
+// command.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
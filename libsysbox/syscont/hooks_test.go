@@ -0,0 +1,142 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestHookManagerOrdering(t *testing.T) {
+	userHook := specs.Hook{Path: "/usr/bin/user-hook", Args: []string{"user-hook"}}
+
+	spec := new(specs.Spec)
+	spec.Hooks = &specs.Hooks{Prestart: []specs.Hook{userHook}}
+
+	hm := NewHookManager(spec)
+
+	if err := hm.AppendHook(HookPrestart, "sysbox-last", "true"); err != nil {
+		t.Fatalf("AppendHook: unexpected error: %v", err)
+	}
+	if err := hm.PrependHook(HookPrestart, "sysbox-first", "true"); err != nil {
+		t.Fatalf("PrependHook: unexpected error: %v", err)
+	}
+	if err := hm.AppendHook(HookPoststop, "sysbox-cleanup", "true"); err != nil {
+		t.Fatalf("AppendHook: unexpected error: %v", err)
+	}
+
+	want := []HookInfo{
+		{Stage: HookPrestart, Index: 0, ID: "sysbox-first"},
+		{Stage: HookPrestart, Index: 1, ID: ""},
+		{Stage: HookPrestart, Index: 2, ID: "sysbox-last"},
+		{Stage: HookPoststop, Index: 0, ID: "sysbox-cleanup"},
+	}
+
+	got := hm.ListHooks()
+	if len(got) != len(want) {
+		t.Fatalf("ListHooks: want %d hooks, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i].Stage != want[i].Stage || got[i].Index != want[i].Index || got[i].ID != want[i].ID {
+			t.Errorf("ListHooks: hook %d: want %+v, got %+v", i, want[i], got[i])
+		}
+	}
+
+	if !reflect.DeepEqual(spec.Hooks.Prestart[1], userHook) {
+		t.Errorf("HookManager: user hook modified: %+v", spec.Hooks.Prestart[1])
+	}
+
+	if !hm.RemoveHookByID("sysbox-first") || hm.HasHook("sysbox-first") {
+		t.Errorf("RemoveHookByID: hook not removed: %+v", hm.ListHooks())
+	}
+	if hm.RemoveHookByID("sysbox-first") {
+		t.Errorf("RemoveHookByID: removed non-existent hook")
+	}
+	if len(spec.Hooks.Prestart) != 2 || !reflect.DeepEqual(spec.Hooks.Prestart[0], userHook) {
+		t.Errorf("RemoveHookByID: unexpected prestart hooks: %+v", spec.Hooks.Prestart)
+	}
+}
+
+func TestHookManagerConflicts(t *testing.T) {
+	spec := new(specs.Spec)
+	hm := NewHookManager(spec)
+
+	if err := hm.AppendHook(HookCreateRuntime, netIfaceRenameHookID, "true"); err != nil {
+		t.Fatalf("AppendHook: unexpected error: %v", err)
+	}
+
+	// same ID, in the same or another stage
+	if err := hm.AppendHook(HookCreateRuntime, netIfaceRenameHookID, "false"); err == nil {
+		t.Errorf("AppendHook: expected error for duplicate hook ID")
+	}
+	if err := hm.PrependHook(HookPrestart, netIfaceRenameHookID, "false"); err == nil {
+		t.Errorf("PrependHook: expected error for duplicate hook ID")
+	}
+	if len(hm.ListHooks()) != 1 {
+		t.Errorf("HookManager: conflicting hooks added: %+v", hm.ListHooks())
+	}
+
+	// a hook with the same ID may be added once the old one is removed
+	hm.RemoveHookByID(netIfaceRenameHookID)
+	if err := hm.AppendHook(HookCreateRuntime, netIfaceRenameHookID, "false"); err != nil {
+		t.Errorf("AppendHook: unexpected error: %v", err)
+	}
+
+	// invalid IDs and stages
+	if err := hm.AppendHook(HookPrestart, "Bad ID", "true"); err == nil {
+		t.Errorf("AppendHook: expected error for invalid hook ID")
+	}
+	if err := hm.AppendHook(HookStage("createContainer"), "sysbox-other", "true"); err == nil {
+		t.Errorf("AppendHook: expected error for unsupported stage")
+	}
+}
+
+func TestHookID(t *testing.T) {
+	hook := sysboxHook("sysbox-test", "echo hi")
+	if id := hookID(hook); id != "sysbox-test" {
+		t.Errorf("hookID: want sysbox-test, got %q", id)
+	}
+
+	for _, h := range []specs.Hook{
+		{Path: "/bin/rm", Args: []string{"rm", "-rf", "/tmp/x\n" + hookIDPrefix + "sysbox-test"}},
+		{Path: "/bin/sh", Args: []string{"sh", "-c", "echo " + hookIDPrefix + "sysbox-test"}},
+		{Path: "/bin/sh", Args: []string{"sh", "-c", "true\n" + hookIDPrefix + "bad id"}},
+	} {
+		if id := hookID(h); id != "" {
+			t.Errorf("hookID: want no ID for %+v, got %q", h, id)
+		}
+	}
+
+	// the ID comment does not alter the hook's command
+	out, err := exec.Command(hook.Path, hook.Args[1:]...).Output()
+	if err != nil || string(out) != "hi\n" {
+		t.Errorf("sysboxHook: want output %q, got %q (%v)", "hi\n", out, err)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	arg := `/var/lib/it's "a" $(dir)`
+	out, err := exec.Command("/bin/sh", "-c", "printf %s "+shellQuote(arg)).Output()
+	if err != nil || string(out) != arg {
+		t.Errorf("shellQuote: want %q, got %q (%v)", arg, out, err)
+	}
+}
@@ -0,0 +1,86 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// Host capabilities required by sysbox-runc to setup sys containers, along
+// with the operations they are needed for.
+var requiredHostCaps = []struct {
+	cap     uintptr
+	name    string
+	purpose string
+}{
+	{unix.CAP_SYS_ADMIN, "CAP_SYS_ADMIN", "mounts and namespace setup"},
+	{unix.CAP_NET_ADMIN, "CAP_NET_ADMIN", "network namespace setup"},
+	{unix.CAP_MKNOD, "CAP_MKNOD", "device node creation"},
+	{unix.CAP_SETUID, "CAP_SETUID", "user-ID mappings"},
+	{unix.CAP_SETGID, "CAP_SETGID", "group-ID mappings"},
+}
+
+// capget returns the effective capability set of the current process
+// (replaceable for testing).
+var capget = func() (uint64, error) {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return 0, err
+	}
+
+	return uint64(data[0].Effective) | uint64(data[1].Effective)<<32, nil
+}
+
+// checkHostCapabilities returns the capabilities required by sysbox-runc that
+// are missing from its effective capability set, each followed by the
+// operations that require it.
+func checkHostCapabilities() []string {
+	effective, err := capget()
+	if err != nil {
+		logrus.Warnf("failed to get sysbox-runc's capabilities; skipping capability check: %v", err)
+		return nil
+	}
+
+	missing := []string{}
+	for _, c := range requiredHostCaps {
+		if effective&(1<<c.cap) == 0 {
+			missing = append(missing, fmt.Sprintf("%s (needed for %s)", c.name, c.purpose))
+		}
+	}
+
+	return missing
+}
+
+// checkHostCaps returns an error if sysbox-runc lacks any of the capabilities
+// it requires.
+func checkHostCaps() error {
+	missing := checkHostCapabilities()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("sysbox-runc lacks required capabilities: %s; "+
+		"use --skip-capability-check if this is a false negative", strings.Join(missing, ", "))
+}
@@ -0,0 +1,75 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCheckHostCapabilities(t *testing.T) {
+	origCapget := capget
+	defer func() { capget = origCapget }()
+
+	all := uint64(0)
+	for _, c := range requiredHostCaps {
+		all |= 1 << c.cap
+	}
+
+	// all required caps present
+	capget = func() (uint64, error) { return all, nil }
+	if missing := checkHostCapabilities(); len(missing) != 0 {
+		t.Errorf("checkHostCapabilities: want no missing caps; got %v", missing)
+	}
+	if err := checkHostCaps(); err != nil {
+		t.Errorf("checkHostCaps: unexpected error: %v", err)
+	}
+
+	// some caps missing
+	capget = func() (uint64, error) {
+		return all &^ (1<<unix.CAP_SYS_ADMIN | 1<<unix.CAP_MKNOD), nil
+	}
+
+	missing := checkHostCapabilities()
+	if len(missing) != 2 ||
+		!strings.HasPrefix(missing[0], "CAP_SYS_ADMIN (") ||
+		!strings.HasPrefix(missing[1], "CAP_MKNOD (") {
+		t.Errorf("checkHostCapabilities: want CAP_SYS_ADMIN and CAP_MKNOD missing; got %v", missing)
+	}
+
+	err := checkHostCaps()
+	if err == nil || !strings.Contains(err.Error(), "CAP_SYS_ADMIN") || !strings.Contains(err.Error(), "CAP_MKNOD") {
+		t.Errorf("checkHostCaps: want error listing missing caps; got %v", err)
+	}
+
+	// capget failure skips the check
+	capget = func() (uint64, error) { return 0, errors.New("capget failed") }
+	if missing := checkHostCapabilities(); len(missing) != 0 {
+		t.Errorf("checkHostCapabilities: want no missing caps on capget failure; got %v", missing)
+	}
+
+	// the real capget works
+	capget = origCapget
+	if _, err := capget(); err != nil {
+		t.Errorf("capget: unexpected error: %v", err)
+	}
+}
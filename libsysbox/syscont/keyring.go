@@ -0,0 +1,38 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// keyringIsolation is set per the sysbox-runc config file (see Config)
+var keyringIsolation = true
+
+// KeyringIsolation returns true if each sys container must get its own
+// anonymous session keyring (see configs.Config.AnonymousKeyring), so that
+// keys can't leak between containers on the same host: unlike the session
+// keyring named after the container, an anonymous keyring can't be joined by
+// name from other processes.
+func KeyringIsolation() bool {
+	if !keyringIsolation {
+		logrus.Warnf("keyring isolation is disabled (see the sysbox-runc config file); containers may share keyrings")
+	}
+	return keyringIsolation
+}
@@ -0,0 +1,124 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Max length of an iptables LOG prefix (excluding the terminating null)
+const iptablesLogPrefixMaxLen = 29
+
+// netAccountingLogLimit is the rate at which the container's outgoing packets
+// are logged, so that a busy container can't flood the kernel log.
+const netAccountingLogLimit = "--limit 10/min --limit-burst 5"
+
+// netAccountingRules returns the iptables rules (in "<chain> <rule-spec>"
+// form) that account for the traffic of the cgroup with the given net_cls
+// classid: a rule without a target, whose counters account for all of the
+// cgroup's outgoing traffic, and a rate-limited LOG rule.
+func netAccountingRules(containerID string, classid uint32) []string {
+	prefix := fmt.Sprintf("sysbox-%s:", containerID)
+	if len(prefix) > iptablesLogPrefixMaxLen {
+		prefix = prefix[:iptablesLogPrefixMaxLen-1] + ":"
+	}
+
+	return []string{
+		fmt.Sprintf("OUTPUT -m cgroup --cgroup %d", classid),
+		fmt.Sprintf("OUTPUT -m cgroup --cgroup %d -m limit %s -j LOG --log-prefix %s", classid, netAccountingLogLimit, prefix),
+	}
+}
+
+// netAccountingCmd returns the shell command that runs "iptables <op> <rule>"
+// for each of the given rules in the network namespace at netnsPath; it fails
+// as soon as one of them fails.
+func netAccountingCmd(op, netnsPath string, rules []string) string {
+	cmds := []string{"set -e"}
+	if netnsPath == "" {
+		// prestart hooks receive the container's state (including the
+		// container's init pid) on stdin
+		cmds = append(cmds, `pid=$(sed -n 's/.*"pid":\([0-9]*\).*/\1/p')`)
+		netnsPath = "/proc/$pid/ns/net"
+	} else {
+		netnsPath = shellQuote(netnsPath)
+	}
+	for _, r := range rules {
+		cmds = append(cmds, fmt.Sprintf("nsenter --net=%s iptables %s %s", netnsPath, op, r))
+	}
+	return strings.Join(cmds, "\n")
+}
+
+// cfgNetworkAccounting sets up a hook that adds iptables rules accounting for
+// the sys container's outgoing traffic via its net_cls classid, when enabled
+// via the "sysbox.io/network-accounting" annotation. The container must have a
+// non-zero net_cls classid (cgroup v1 only).
+//
+// The rules go in the container's network namespace (not the host's), so
+// they don't alter the host's firewall and go away with the namespace. Only
+// when the container joins an existing network namespace is a hook needed to
+// remove them. Note that the kernel only logs packets from non-initial network
+// namespaces if net.netfilter.nf_log_all_netns is set.
+func cfgNetworkAccounting(spec *specs.Spec, containerID string) error {
+	val, ok := spec.Annotations[netAccountingAnnot]
+	if !ok {
+		return nil
+	}
+
+	switch val {
+	case "true":
+	case "false":
+		return nil
+	default:
+		return fmt.Errorf("invalid value for annotation %s: %s (must be \"true\" or \"false\")", netAccountingAnnot, val)
+	}
+
+	var classid uint32
+	if r := spec.Linux.Resources; r != nil && r.Network != nil && r.Network.ClassID != nil {
+		classid = *r.Network.ClassID
+	}
+	if classid == 0 {
+		logrus.Warnf("ignoring annotation %s: container has no net_cls classid", netAccountingAnnot)
+		return nil
+	}
+
+	var netnsPath string
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Type == specs.NetworkNamespace {
+			netnsPath = ns.Path
+		}
+	}
+
+	rules := netAccountingRules(containerID, classid)
+
+	hm := NewHookManager(spec)
+
+	if err := hm.AppendHook(HookPrestart, netAccountingSetupHookID, netAccountingCmd("-A", netnsPath, rules)); err != nil {
+		return err
+	}
+
+	if netnsPath == "" {
+		return nil
+	}
+
+	return hm.AppendHook(HookPoststop, netAccountingCleanupHookID, netAccountingCmd("-D", netnsPath, rules))
+}
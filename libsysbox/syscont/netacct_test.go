@@ -0,0 +1,137 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestNetAccountingRules(t *testing.T) {
+	rules := netAccountingRules("cid", 0x100001)
+	want := []string{
+		"OUTPUT -m cgroup --cgroup 1048577",
+		"OUTPUT -m cgroup --cgroup 1048577 -m limit --limit 10/min --limit-burst 5 -j LOG --log-prefix sysbox-cid:",
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("netAccountingRules: want %v; got %v", want, rules)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("netAccountingRules: want %q; got %q", want[i], rules[i])
+		}
+	}
+
+	// long container ids are truncated to fit the LOG prefix
+	rules = netAccountingRules("0123456789abcdef0123456789abcdef", 1)
+	if !strings.HasSuffix(rules[1], "--log-prefix sysbox-0123456789abcdef01234:") {
+		t.Errorf("netAccountingRules: unexpected LOG rule for long id: %q", rules[1])
+	}
+
+	want = []string{
+		"set -e",
+		`pid=$(sed -n 's/.*"pid":\([0-9]*\).*/\1/p')`,
+		"nsenter --net=/proc/$pid/ns/net iptables -A " + rules[0],
+	}
+	if got := netAccountingCmd("-A", "", rules[:1]); got != strings.Join(want, "\n") {
+		t.Errorf("netAccountingCmd: unexpected command %q", got)
+	}
+
+	want = []string{
+		"set -e",
+		"nsenter --net='/var/run/netns/pod' iptables -D " + rules[0],
+	}
+	if got := netAccountingCmd("-D", "/var/run/netns/pod", rules[:1]); got != strings.Join(want, "\n") {
+		t.Errorf("netAccountingCmd: unexpected command %q", got)
+	}
+}
+
+func TestCfgNetworkAccounting(t *testing.T) {
+	classid := uint32(0x100001)
+
+	newSpec := func(annot string, classid *uint32) *specs.Spec {
+		spec := new(specs.Spec)
+		spec.Linux = &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{{Type: specs.NetworkNamespace}},
+		}
+		if classid != nil {
+			spec.Linux.Resources = &specs.LinuxResources{
+				Network: &specs.LinuxNetwork{ClassID: classid},
+			}
+		}
+		if annot != "" {
+			spec.Annotations = map[string]string{netAccountingAnnot: annot}
+		}
+		return spec
+	}
+
+	// no annotation, disabled, or no classid -> no hooks
+	zero := uint32(0)
+	for _, spec := range []*specs.Spec{
+		newSpec("", &classid),
+		newSpec("false", &classid),
+		newSpec("true", nil),
+		newSpec("true", &zero),
+	} {
+		if err := cfgNetworkAccounting(spec, "cid"); err != nil {
+			t.Errorf("cfgNetworkAccounting: unexpected error: %v", err)
+		}
+		if spec.Hooks != nil {
+			t.Errorf("cfgNetworkAccounting: unexpected hooks: %+v", spec.Hooks)
+		}
+	}
+
+	if err := cfgNetworkAccounting(newSpec("yes", &classid), "cid"); err == nil {
+		t.Errorf("cfgNetworkAccounting: expected error for invalid annotation value")
+	}
+
+	// the rules go away with the container's network namespace
+	spec := newSpec("true", &classid)
+	if err := cfgNetworkAccounting(spec, "cid"); err != nil {
+		t.Fatalf("cfgNetworkAccounting: unexpected error: %v", err)
+	}
+	if spec.Hooks == nil || len(spec.Hooks.Prestart) != 1 || len(spec.Hooks.Poststop) != 0 {
+		t.Fatalf("cfgNetworkAccounting: want 1 prestart and no poststop hook; got %+v", spec.Hooks)
+	}
+	for _, rule := range netAccountingRules("cid", classid) {
+		if !strings.Contains(spec.Hooks.Prestart[0].Args[2], "nsenter --net=/proc/$pid/ns/net iptables -A "+rule) {
+			t.Errorf("cfgNetworkAccounting: prestart hook missing rule %q: %s", rule, spec.Hooks.Prestart[0].Args[2])
+		}
+	}
+
+	// the container joins an existing network namespace
+	spec = newSpec("true", &classid)
+	spec.Linux.Namespaces[0].Path = "/var/run/netns/pod"
+	if err := cfgNetworkAccounting(spec, "cid"); err != nil {
+		t.Fatalf("cfgNetworkAccounting: unexpected error: %v", err)
+	}
+	if spec.Hooks == nil || len(spec.Hooks.Prestart) != 1 || len(spec.Hooks.Poststop) != 1 {
+		t.Fatalf("cfgNetworkAccounting: want 1 prestart and 1 poststop hook; got %+v", spec.Hooks)
+	}
+	for _, rule := range netAccountingRules("cid", classid) {
+		if !strings.Contains(spec.Hooks.Prestart[0].Args[2], "nsenter --net='/var/run/netns/pod' iptables -A "+rule) {
+			t.Errorf("cfgNetworkAccounting: prestart hook missing rule %q: %s", rule, spec.Hooks.Prestart[0].Args[2])
+		}
+		if !strings.Contains(spec.Hooks.Poststop[0].Args[2], "nsenter --net='/var/run/netns/pod' iptables -D "+rule) {
+			t.Errorf("cfgNetworkAccounting: poststop hook missing rule %q: %s", rule, spec.Hooks.Poststop[0].Args[2])
+		}
+	}
+}
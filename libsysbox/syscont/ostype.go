@@ -0,0 +1,159 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// OSType is the type of OS (distro) in a container's image, as relevant to
+// the container's config (e.g., its libc).
+type OSType int
+
+const (
+	OSTypeUnknown OSType = iota
+	OSTypeDebian
+	OSTypeAlpine
+	OSTypeDistroless
+)
+
+func (t OSType) String() string {
+	switch t {
+	case OSTypeDebian:
+		return "debian"
+	case OSTypeAlpine:
+		return "alpine"
+	case OSTypeDistroless:
+		return "distroless"
+	default:
+		return "unknown"
+	}
+}
+
+// isMusl returns true if the OS type uses the musl libc (rather than glibc).
+func (t OSType) isMusl() bool {
+	return t == OSTypeAlpine
+}
+
+// detectContainerOSType returns the OS type of the container rootfs at the
+// given path, per its /etc/alpine-release or /etc/os-release files.
+func detectContainerOSType(rootfsPath string) OSType {
+	if rootfsPath == "" {
+		return OSTypeUnknown
+	}
+
+	path, err := securejoin.SecureJoin(rootfsPath, "/etc/alpine-release")
+	if err == nil {
+		if _, err := os.Stat(path); err == nil {
+			return OSTypeAlpine
+		}
+	}
+
+	// os-release is often a symlink to /usr/lib/os-release
+	path, err = securejoin.SecureJoin(rootfsPath, "/etc/os-release")
+	if err != nil {
+		return OSTypeUnknown
+	}
+
+	osRelease, err := parseOSRelease(path)
+	if err != nil {
+		return OSTypeUnknown
+	}
+
+	// distroless images are Debian-based, but are identified as distroless
+	// in PRETTY_NAME
+	if strings.Contains(osRelease["PRETTY_NAME"], "Distroless") {
+		return OSTypeDistroless
+	}
+
+	ids := append([]string{osRelease["ID"]}, strings.Fields(osRelease["ID_LIKE"])...)
+	for _, id := range ids {
+		switch id {
+		case "alpine":
+			return OSTypeAlpine
+		case "debian", "ubuntu":
+			return OSTypeDebian
+		}
+	}
+
+	return OSTypeUnknown
+}
+
+// parseOSRelease returns the key/value pairs in the os-release file at the
+// given path; values are unquoted.
+func parseOSRelease(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vals := make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		vals[kv[0]] = strings.Trim(kv[1], `"'`)
+	}
+
+	return vals, scanner.Err()
+}
+
+// Sysbox-fs mounts not needed in containers with the musl libc (e.g.,
+// Alpine): glibc's sysconf(_SC_NGROUPS_MAX) reads ngroups_max, while musl
+// returns a compile-time constant.
+var sysboxFsMuslSkip = []string{
+	"/proc/sys/kernel/ngroups_max",
+}
+
+// sysboxFsMountsFor returns the variant of the given sysbox-fs mount list for
+// containers of the given OS type.
+func sysboxFsMountsFor(mounts []specs.Mount, osType OSType) []specs.Mount {
+	if !osType.isMusl() {
+		return mounts
+	}
+
+	musl := []specs.Mount{}
+	for _, m := range mounts {
+		skip := false
+		for _, dest := range sysboxFsMuslSkip {
+			if m.Destination == dest {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			musl = append(musl, m)
+		}
+	}
+
+	return musl
+}
@@ -0,0 +1,188 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runc/libsysbox/sysbox"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// mkTestRootfs creates a rootfs with the given files (path -> content) under
+// the given dir; content starting with "->" creates a symlink instead.
+func mkTestRootfs(t *testing.T, dir string, files map[string]string) string {
+	rootfs, err := ioutil.TempDir(dir, "rootfs")
+	if err != nil {
+		t.Fatalf("failed to create rootfs: %v", err)
+	}
+
+	for path, content := range files {
+		path = filepath.Join(rootfs, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if len(content) > 2 && content[:2] == "->" {
+			if err := os.Symlink(content[2:], path); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return rootfs
+}
+
+func TestDetectContainerOSType(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sysbox-ostype-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  OSType
+	}{
+		{
+			"ubuntu",
+			map[string]string{
+				"/etc/os-release":     "->../usr/lib/os-release",
+				"/usr/lib/os-release": "NAME=\"Ubuntu\"\nID=ubuntu\nID_LIKE=debian\nPRETTY_NAME=\"Ubuntu 22.04.3 LTS\"\n",
+			},
+			OSTypeDebian,
+		},
+		{
+			"debian",
+			map[string]string{"/etc/os-release": "PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nID=debian\n"},
+			OSTypeDebian,
+		},
+		{
+			"alpine-release",
+			map[string]string{"/etc/alpine-release": "3.18.4\n"},
+			OSTypeAlpine,
+		},
+		{
+			"alpine-os-release",
+			map[string]string{"/etc/os-release": "NAME=\"Alpine Linux\"\nID=alpine\nVERSION_ID=3.18.4\n"},
+			OSTypeAlpine,
+		},
+		{
+			"distroless",
+			map[string]string{"/etc/os-release": "PRETTY_NAME=\"Distroless\"\nNAME=\"Debian GNU/Linux\"\nID=\"debian\"\n"},
+			OSTypeDistroless,
+		},
+		{
+			"fedora",
+			map[string]string{"/etc/os-release": "NAME=\"Fedora Linux\"\nID=fedora\n"},
+			OSTypeUnknown,
+		},
+		{
+			"empty",
+			map[string]string{},
+			OSTypeUnknown,
+		},
+		{
+			// symlinks can't escape the rootfs
+			"escape",
+			map[string]string{"/etc/os-release": "->/../../../../etc/os-release"},
+			OSTypeUnknown,
+		},
+	}
+
+	for _, test := range tests {
+		rootfs := mkTestRootfs(t, tmpDir, test.files)
+		if got := detectContainerOSType(rootfs); got != test.want {
+			t.Errorf("detectContainerOSType(%s): want %s, got %s", test.name, test.want, got)
+		}
+	}
+
+	if got := detectContainerOSType(""); got != OSTypeUnknown {
+		t.Errorf("detectContainerOSType: want unknown for empty path, got %s", got)
+	}
+}
+
+func TestSysboxFsMountsFor(t *testing.T) {
+	for _, osType := range []OSType{OSTypeUnknown, OSTypeDebian, OSTypeDistroless} {
+		if got := sysboxFsMountsFor(sysboxFsMounts, osType); len(got) != len(sysboxFsMounts) {
+			t.Errorf("sysboxFsMountsFor(%s): want %d mounts, got %d", osType, len(sysboxFsMounts), len(got))
+		}
+	}
+
+	musl := sysboxFsMountsFor(sysboxFsMounts, OSTypeAlpine)
+	if len(musl) != len(sysboxFsMounts)-len(sysboxFsMuslSkip) {
+		t.Errorf("sysboxFsMountsFor(alpine): want %d mounts, got %d", len(sysboxFsMounts)-len(sysboxFsMuslSkip), len(musl))
+	}
+	for _, m := range musl {
+		for _, dest := range sysboxFsMuslSkip {
+			if m.Destination == dest {
+				t.Errorf("sysboxFsMountsFor(alpine): unexpected mount at %s", dest)
+			}
+		}
+	}
+}
+
+func TestCfgSysboxFsMountsOSType(t *testing.T) {
+	origMounts := sysboxFsMounts
+	sysboxFsMounts = append([]specs.Mount{}, sysboxFsMounts...)
+	defer func() { sysboxFsMounts = origMounts }()
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-ostype-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	hasMount := func(spec *specs.Spec, dest string) bool {
+		for _, m := range spec.Mounts {
+			if m.Destination == dest {
+				return true
+			}
+		}
+		return false
+	}
+
+	rootfs := mkTestRootfs(t, tmpDir, map[string]string{"/etc/alpine-release": "3.18.4\n"})
+	spec := &specs.Spec{Root: &specs.Root{Path: rootfs}}
+	if err := cfgSysboxFsMounts(spec, sysbox.NewFs("cid", true)); err != nil {
+		t.Fatalf("cfgSysboxFsMounts: unexpected error: %v", err)
+	}
+	if hasMount(spec, "/proc/sys/kernel/ngroups_max") {
+		t.Errorf("cfgSysboxFsMounts: unexpected ngroups_max mount for alpine rootfs")
+	}
+	if !hasMount(spec, "/proc/sys") {
+		t.Errorf("cfgSysboxFsMounts: missing /proc/sys mount for alpine rootfs")
+	}
+
+	rootfs = mkTestRootfs(t, tmpDir, map[string]string{"/etc/os-release": "ID=debian\n"})
+	spec = &specs.Spec{Root: &specs.Root{Path: rootfs}}
+	if err := cfgSysboxFsMounts(spec, sysbox.NewFs("cid", true)); err != nil {
+		t.Fatalf("cfgSysboxFsMounts: unexpected error: %v", err)
+	}
+	if !hasMount(spec, "/proc/sys/kernel/ngroups_max") {
+		t.Errorf("cfgSysboxFsMounts: missing ngroups_max mount for debian rootfs")
+	}
+}
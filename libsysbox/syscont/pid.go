@@ -0,0 +1,115 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ResolveContainerPID returns the host PID of the process with the given PID in
+// the sys container's PID namespace; the container is identified by the host
+// PID of its init process. Only processes in the container's PID namespace
+// itself (not in namespaces nested within it) are considered.
+func ResolveContainerPID(containerPID int, containerInitHostPID int) (int, error) {
+
+	if containerPID <= 0 {
+		return 0, fmt.Errorf("invalid container pid %d", containerPID)
+	}
+
+	initNs, err := os.Readlink(filepath.Join(procRoot, strconv.Itoa(containerInitHostPID), "ns", "pid"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pid namespace of container init process: %v", err)
+	}
+
+	if containerPID == 1 {
+		return containerInitHostPID, nil
+	}
+
+	initNSpid, err := readNSpid(containerInitHostPID)
+	if err != nil {
+		return 0, err
+	}
+	level := len(initNSpid)
+
+	dirs, err := filepath.Glob(filepath.Join(procRoot, "[0-9]*"))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, dir := range dirs {
+		hostPID, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil {
+			continue
+		}
+
+		// processes may exit while we scan; ignore them
+		nspid, err := readNSpid(hostPID)
+		if err != nil || len(nspid) != level || nspid[level-1] != containerPID {
+			continue
+		}
+
+		ns, err := os.Readlink(filepath.Join(dir, "ns", "pid"))
+		if err != nil || ns != initNs {
+			continue
+		}
+
+		return hostPID, nil
+	}
+
+	return 0, fmt.Errorf("no process with pid %d in the container's pid namespace", containerPID)
+}
+
+// readNSpid returns the PIDs of the given process in each of the PID
+// namespaces it belongs to (from the "NSpid" field of /proc/<pid>/status).
+func readNSpid(pid int) ([]int, error) {
+	f, err := os.Open(filepath.Join(procRoot, strconv.Itoa(pid), "status"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "NSpid:") {
+			continue
+		}
+
+		var pids []int
+		for _, field := range strings.Fields(strings.TrimPrefix(line, "NSpid:")) {
+			p, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid NSpid field for pid %d: %q", pid, line)
+			}
+			pids = append(pids, p)
+		}
+		return pids, nil
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("no NSpid field for pid %d (kernel too old?)", pid)
+}
@@ -0,0 +1,99 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveContainerPID(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-pid-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origProcRoot := procRoot
+	procRoot = tmpDir
+	defer func() { procRoot = origProcRoot }()
+
+	// synthetic procfs; the container's init is host pid 1000.
+	procs := []struct {
+		pid   string
+		nspid string
+		pidns string
+	}{
+		{"1", "1", "pid:[4026531836]"},              // host init
+		{"1000", "1000\t1", "pid:[4026532100]"},     // container init
+		{"1001", "1001\t25", "pid:[4026532100]"},    // container process
+		{"2000", "2000\t1", "pid:[4026532200]"},     // other container's init
+		{"2001", "2001\t30", "pid:[4026532200]"},    // other container's process
+		{"1002", "1002\t30\t1", "pid:[4026532300]"}, // nested pid ns in container
+		{"1003", "1003\t31\t2", "pid:[4026532300]"}, // nested pid ns in container
+	}
+
+	for _, p := range procs {
+		dir := filepath.Join(tmpDir, p.pid)
+		if err := os.MkdirAll(filepath.Join(dir, "ns"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		status := "Name:\tproc\nPid:\t" + p.pid + "\nNSpid:\t" + p.nspid + "\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, "status"), []byte(status), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(p.pidns, filepath.Join(dir, "ns", "pid")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		containerPID int
+		hostPID      int
+		valid        bool
+	}{
+		{1, 1000, true},
+		{25, 1001, true},
+		{30, 0, false}, // only in the other container and in a nested pid ns
+		{31, 0, false}, // only in a nested pid ns
+		{99, 0, false},
+		{0, 0, false},
+	}
+
+	for _, test := range tests {
+		pid, err := ResolveContainerPID(test.containerPID, 1000)
+		if test.valid {
+			if err != nil {
+				t.Errorf("ResolveContainerPID(%d): unexpected error: %v", test.containerPID, err)
+			} else if pid != test.hostPID {
+				t.Errorf("ResolveContainerPID(%d): want host pid %d; got %d", test.containerPID, test.hostPID, pid)
+			}
+		} else if err == nil {
+			t.Errorf("ResolveContainerPID(%d): expected error; got pid %d", test.containerPID, pid)
+		}
+	}
+
+	// non-existent container init
+	if _, err := ResolveContainerPID(25, 3000); err == nil {
+		t.Errorf("ResolveContainerPID: expected error for non-existent init process")
+	}
+}
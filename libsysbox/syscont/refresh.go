@@ -0,0 +1,168 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unsafe"
+
+	utils "github.com/nestybox/sysbox-libs/utils"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// open_tree(2) and move_mount(2) (kernel 5.2+); not in our version of x/sys.
+// The syscall numbers are the same on all architectures.
+const (
+	sysOpenTree  = 428
+	sysMoveMount = 429
+
+	openTreeClone       = 0x1
+	atRecursive         = 0x8000
+	moveMountFEmptyPath = 0x4
+)
+
+// replaceable in tests
+var injectMount = hostBindMount
+
+// RefreshSysboxFsMounts sets up in the given running container the sysbox-fs
+// mounts it's missing. These are the mounts in this sysbox-runc's sysbox-fs
+// mount list (which may have grown since the container was created) that are
+// not among the container's applied mounts and whose source sysbox-fs
+// currently exposes under the container's sysbox-fs mountpoint (i.e.,
+// SysboxFsDir/<sysFsID>, as set up by cfgSysboxFsMounts()). The ones
+// successfully set up are returned so that the caller can record them in the
+// container's state.
+func RefreshSysboxFsMounts(sysFsID string, pid int, applied []specs.Mount) ([]specs.Mount, error) {
+	added := []specs.Mount{}
+
+	for _, m := range missingSysboxFsMounts(sysFsID, applied) {
+		if err := injectMount(pid, m); err != nil {
+			return added, fmt.Errorf("failed to mount %s in container %s: %v", m.Destination, sysFsID, err)
+		}
+		added = append(added, m)
+	}
+
+	return added, nil
+}
+
+// missingSysboxFsMounts returns the sysbox-fs mounts (with their sources
+// adjusted to the container's sysbox-fs mountpoint) that are not among the
+// given applied mounts and whose source exists.
+func missingSysboxFsMounts(sysFsID string, applied []specs.Mount) []specs.Mount {
+	cntrMountpoint := filepath.Join(SysboxFsDir, sysFsID)
+	missing := []specs.Mount{}
+
+	for _, m := range sysboxFsMounts {
+		dest := filepath.Clean(m.Destination)
+
+		isApplied := false
+		for _, a := range applied {
+			if filepath.Clean(a.Destination) == dest {
+				isApplied = true
+				break
+			}
+		}
+		if isApplied {
+			continue
+		}
+
+		// sysboxFsMounts may already have been adjusted by cfgSysboxFsMounts()
+		rel := strings.TrimPrefix(m.Source, SysboxFsDir+"/")
+		if strings.HasPrefix(rel, sysFsID+"/") {
+			rel = strings.TrimPrefix(rel, sysFsID+"/")
+		}
+
+		m.Source = filepath.Join(cntrMountpoint, rel)
+		if !sysboxFsSourceExists(m.Source) {
+			continue
+		}
+
+		m.Options = append([]string{}, m.Options...)
+		missing = append(missing, m)
+	}
+
+	return missing
+}
+
+// hostBindMount clones the given mount's source in the caller's mount
+// namespace (i.e., the host's) and moves the clone over the mount's
+// destination in the mount namespace of the process with the given pid. This
+// way the source needn't be reachable from within the container, while the
+// destination is resolved within it.
+func hostBindMount(pid int, m specs.Mount) error {
+	flags := openTreeClone | unix.O_CLOEXEC
+	if utils.StringSliceContains(m.Options, "rbind") {
+		flags |= atRecursive
+	}
+
+	src, err := unix.BytePtrFromString(m.Source)
+	if err != nil {
+		return err
+	}
+	cwd := unix.AT_FDCWD
+	treeFd, _, errno := unix.Syscall(sysOpenTree, uintptr(cwd), uintptr(unsafe.Pointer(src)), uintptr(flags))
+	if errno != 0 {
+		return fmt.Errorf("open_tree %s: %v", m.Source, errno)
+	}
+	defer unix.Close(int(treeFd))
+
+	nsFd, err := unix.Open(fmt.Sprintf("/proc/%d/ns/mnt", pid), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(nsFd)
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		// The thread is left in the container's mount namespace, so it's never
+		// unlocked; the Go runtime terminates it when the goroutine returns.
+		runtime.LockOSThread()
+
+		// setns(CLONE_NEWNS) requires that the thread not share its fs info
+		if err := unix.Unshare(unix.CLONE_FS); err != nil {
+			errCh <- fmt.Errorf("unshare fs: %v", err)
+			return
+		}
+		if err := unix.Setns(nsFd, unix.CLONE_NEWNS); err != nil {
+			errCh <- fmt.Errorf("setns to mount ns of pid %d: %v", pid, err)
+			return
+		}
+
+		empty, _ := unix.BytePtrFromString("")
+		dest, err := unix.BytePtrFromString(m.Destination)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		_, _, errno := unix.Syscall6(sysMoveMount, treeFd, uintptr(unsafe.Pointer(empty)),
+			uintptr(cwd), uintptr(unsafe.Pointer(dest)), moveMountFEmptyPath, 0)
+		if errno != 0 {
+			errCh <- fmt.Errorf("move_mount to %s: %v", m.Destination, errno)
+			return
+		}
+		errCh <- nil
+	}()
+
+	return <-errCh
+}
@@ -0,0 +1,127 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestRefreshSysboxFsMounts(t *testing.T) {
+	origInject := injectMount
+	origSourceExists := sysboxFsSourceExists
+	defer func() {
+		injectMount = origInject
+		sysboxFsSourceExists = origSourceExists
+	}()
+
+	injected := map[string]specs.Mount{}
+	injectMount = func(pid int, m specs.Mount) error {
+		if pid != 1234 {
+			return fmt.Errorf("unexpected pid %d", pid)
+		}
+		injected[m.Destination] = m
+		return nil
+	}
+
+	cntrDir := filepath.Join(SysboxFsDir, "cid")
+
+	// sysbox-fs exposes the given files under the container's mountpoint
+	exposed := map[string]bool{}
+	sysboxFsSourceExists = func(path string) bool {
+		return exposed[path]
+	}
+	expose := func(dests ...string) {
+		exposed = map[string]bool{}
+		for _, d := range dests {
+			exposed[filepath.Join(cntrDir, d)] = true
+		}
+	}
+
+	// all but /proc/uptime and /proc/sys/kernel/pid_max applied
+	applied := []specs.Mount{}
+	for _, m := range sysboxFsMounts {
+		if m.Destination != "/proc/uptime" && m.Destination != "/proc/sys/kernel/pid_max" {
+			applied = append(applied, m)
+		}
+	}
+	expose("/proc/uptime", "/proc/sys/kernel/pid_max", "/proc/swaps")
+
+	added, err := RefreshSysboxFsMounts("cid", 1234, applied)
+	if err != nil {
+		t.Fatalf("RefreshSysboxFsMounts: unexpected error: %v", err)
+	}
+
+	if len(added) != 2 || len(injected) != 2 {
+		t.Fatalf("RefreshSysboxFsMounts: want 2 mounts; got %v (injected %v)", added, injected)
+	}
+
+	for _, dest := range []string{"/proc/uptime", "/proc/sys/kernel/pid_max"} {
+		m, ok := injected[dest]
+		if !ok {
+			t.Errorf("RefreshSysboxFsMounts: mount at %s not injected", dest)
+			continue
+		}
+		if want := filepath.Join(cntrDir, dest); m.Source != want {
+			t.Errorf("RefreshSysboxFsMounts: mount at %s: want source %s; got %s", dest, want, m.Source)
+		}
+	}
+
+	// mounts whose source sysbox-fs does not expose are skipped
+	injected = map[string]specs.Mount{}
+	expose("/proc/swaps")
+	added, err = RefreshSysboxFsMounts("cid", 1234, nil)
+	if err != nil || len(added) != 1 || added[0].Destination != "/proc/swaps" {
+		t.Errorf("RefreshSysboxFsMounts: want only /proc/swaps; got %v (%v)", added, err)
+	}
+
+	// nothing to do
+	if added, err := RefreshSysboxFsMounts("cid", 1234, sysboxFsMounts); err != nil || len(added) != 0 {
+		t.Errorf("RefreshSysboxFsMounts: want no mounts; got %v (%v)", added, err)
+	}
+
+	// injection errors are reported, along with the mounts set up until then
+	injectMount = func(pid int, m specs.Mount) error {
+		if m.Destination == "/proc/uptime" {
+			return fmt.Errorf("mount failed")
+		}
+		return nil
+	}
+	expose("/proc/swaps", "/proc/uptime")
+	added, err = RefreshSysboxFsMounts("cid", 1234, nil)
+	if err == nil {
+		t.Errorf("RefreshSysboxFsMounts: expected error")
+	}
+	for _, m := range added {
+		if m.Destination == "/proc/uptime" {
+			t.Errorf("RefreshSysboxFsMounts: failed mount reported as added")
+		}
+	}
+
+	// sysboxFsMounts itself must not be modified
+	for _, m := range sysboxFsMounts {
+		if strings.HasPrefix(m.Source, cntrDir+"/") {
+			t.Errorf("RefreshSysboxFsMounts: sysboxFsMounts modified: %v", m)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// ResourcePolicy holds the host resource thresholds below (or above) which
+// sysbox-runc refuses to create containers. A zero threshold is not checked.
+type ResourcePolicy struct {
+	MinFreeMemoryMB   int
+	MaxCPULoadPercent int
+	MinFreeInodes     int
+
+	// Rootfs is the path whose filesystem is checked for free inodes (the
+	// container's rootfs; the host's root if empty).
+	Rootfs string
+}
+
+// PolicyViolation describes a resource policy threshold breached by the host.
+type PolicyViolation struct {
+	Resource  string
+	Threshold int
+	Actual    int
+}
+
+func (v PolicyViolation) String() string {
+	return fmt.Sprintf("%s is %d (threshold %d)", v.Resource, v.Actual, v.Threshold)
+}
+
+// The resource policy loaded via LoadResourcePolicy (nil if none)
+var resourcePolicy *ResourcePolicy
+
+// replaceable in tests
+var (
+	meminfoPath = "/proc/meminfo"
+	loadavgPath = "/proc/loadavg"
+)
+
+// resourcePolicyFile is the format of the resource policy file.
+type resourcePolicyFile struct {
+	MinFreeMemoryMB   int `toml:"min_free_memory_mb"`
+	MaxCPULoadPercent int `toml:"max_cpu_load_percent"`
+	MinFreeInodes     int `toml:"min_free_inodes"`
+
+	// Not supported: sysbox-mgr can't report the number of active containers
+	// yet, so it's rejected rather than silently ignored.
+	MaxActiveContainers *int `toml:"max_active_containers"`
+}
+
+// LoadResourcePolicy loads the resource policy file at the given path; the
+// policy is checked before creating each container (see ConvertSpec). The
+// file has the (TOML) format:
+//
+//	min_free_memory_mb = 512
+//	max_cpu_load_percent = 95
+//	min_free_inodes = 10000
+func LoadResourcePolicy(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read resource policy file: %v", err)
+	}
+
+	policy, err := parseResourcePolicy(data)
+	if err != nil {
+		return fmt.Errorf("invalid resource policy file %s: %v", path, err)
+	}
+
+	resourcePolicy = policy
+	return nil
+}
+
+func parseResourcePolicy(data []byte) (*ResourcePolicy, error) {
+	var f resourcePolicyFile
+
+	if err := toml.NewDecoder(bytes.NewReader(data)).Strict(true).Decode(&f); err != nil {
+		return nil, err
+	}
+
+	if f.MaxActiveContainers != nil {
+		return nil, fmt.Errorf("max_active_containers is not supported (sysbox-mgr does not report the number of active containers)")
+	}
+
+	for key, val := range map[string]int{
+		"min_free_memory_mb":   f.MinFreeMemoryMB,
+		"max_cpu_load_percent": f.MaxCPULoadPercent,
+		"min_free_inodes":      f.MinFreeInodes,
+	} {
+		if val < 0 {
+			return nil, fmt.Errorf("%s: expected a non-negative integer, got %d", key, val)
+		}
+	}
+	if f.MaxCPULoadPercent > 100 {
+		return nil, fmt.Errorf("max_cpu_load_percent: must be <= 100")
+	}
+
+	return &ResourcePolicy{
+		MinFreeMemoryMB:   f.MinFreeMemoryMB,
+		MaxCPULoadPercent: f.MaxCPULoadPercent,
+		MinFreeInodes:     f.MinFreeInodes,
+	}, nil
+}
+
+// checkResourcePolicy checks the loaded resource policy (if any) against the
+// host's resources, for a container with the given rootfs.
+func checkResourcePolicy(rootfs string) error {
+	if resourcePolicy == nil {
+		return nil
+	}
+
+	policy := *resourcePolicy
+	policy.Rootfs = rootfs
+
+	violations := CheckResourcePolicy(policy)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, len(violations))
+	for i, v := range violations {
+		msgs[i] = v.String()
+	}
+	return fmt.Errorf("host resources are too low to create the container: %s", strings.Join(msgs, "; "))
+}
+
+// CheckResourcePolicy returns the thresholds of the given policy that the
+// host breaches. Resources that can't be read are not checked.
+func CheckResourcePolicy(policy ResourcePolicy) []PolicyViolation {
+	var violations []PolicyViolation
+
+	if policy.MinFreeMemoryMB > 0 {
+		free, err := readFreeMemoryMB(meminfoPath)
+		if err != nil {
+			logrus.Warnf("resource policy: failed to read free memory: %v", err)
+		} else if free < policy.MinFreeMemoryMB {
+			violations = append(violations, PolicyViolation{"free memory (MB)", policy.MinFreeMemoryMB, free})
+		}
+	}
+
+	if policy.MaxCPULoadPercent > 0 {
+		load, err := readCPULoadPercent(loadavgPath, runtime.NumCPU())
+		if err != nil {
+			logrus.Warnf("resource policy: failed to read cpu load: %v", err)
+		} else if load > policy.MaxCPULoadPercent {
+			violations = append(violations, PolicyViolation{"cpu load (%)", policy.MaxCPULoadPercent, load})
+		}
+	}
+
+	if policy.MinFreeInodes > 0 {
+		rootfs := policy.Rootfs
+		if rootfs == "" {
+			rootfs = "/"
+		}
+		var st unix.Statfs_t
+		if err := unix.Statfs(rootfs, &st); err != nil {
+			logrus.Warnf("resource policy: failed to statfs %s: %v", rootfs, err)
+		} else if st.Files > 0 && st.Ffree < uint64(policy.MinFreeInodes) {
+			// filesystems with dynamic inodes (e.g., btrfs) report no inodes
+			violations = append(violations, PolicyViolation{"free inodes", policy.MinFreeInodes, int(st.Ffree)})
+		}
+	}
+
+	return violations
+}
+
+// readFreeMemoryMB returns the available memory (in MB) per the given
+// meminfo file; MemFree is used in kernels without MemAvailable (< 3.14).
+func readFreeMemoryMB(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	free := -1
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		if fields[0] != "MemAvailable:" && fields[0] != "MemFree:" {
+			continue
+		}
+		kb, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s value %q", fields[0], fields[1])
+		}
+		if fields[0] == "MemAvailable:" {
+			return kb / 1024, nil
+		}
+		free = kb / 1024
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	if free < 0 {
+		return 0, fmt.Errorf("no MemAvailable or MemFree in %s", path)
+	}
+	return free, nil
+}
+
+// readCPULoadPercent returns the host's cpu load (in percent of the given
+// number of cpus), per the 1 minute load average in the given loadavg file.
+func readCPULoadPercent(path string, cpus int) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("no load average in %s", path)
+	}
+
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid load average %q", fields[0])
+	}
+
+	if cpus < 1 {
+		cpus = 1
+	}
+	return int(load * 100 / float64(cpus)), nil
+}
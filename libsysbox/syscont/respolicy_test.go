@@ -0,0 +1,210 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMeminfo = `MemTotal:       16314500 kB
+MemFree:          524288 kB
+MemAvailable:    2097152 kB
+Buffers:          204800 kB
+Cached:          1433600 kB
+`
+
+const testLoadavg = "1.50 1.20 0.90 2/345 6789\n"
+
+func writeTestFile(t *testing.T, dir, name, data string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestReadFreeMemoryMB(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sysbox-respolicy-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tests := []struct {
+		name    string
+		meminfo string
+		want    int
+		wantErr bool
+	}{
+		{"available", testMeminfo, 2048, false},
+		{"no-available", "MemTotal: 16314500 kB\nMemFree: 524288 kB\n", 512, false},
+		{"missing", "MemTotal: 16314500 kB\n", 0, true},
+		{"invalid", "MemAvailable: lots kB\n", 0, true},
+	}
+
+	for _, test := range tests {
+		path := writeTestFile(t, tmpDir, test.name, test.meminfo)
+		got, err := readFreeMemoryMB(path)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("readFreeMemoryMB(%s): expected error, got none", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("readFreeMemoryMB(%s): unexpected error: %v", test.name, err)
+		} else if got != test.want {
+			t.Errorf("readFreeMemoryMB(%s): want %d, got %d", test.name, test.want, got)
+		}
+	}
+}
+
+func TestReadCPULoadPercent(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sysbox-respolicy-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := writeTestFile(t, tmpDir, "loadavg", testLoadavg)
+	load, err := readCPULoadPercent(path, 2)
+	if err != nil {
+		t.Fatalf("readCPULoadPercent: unexpected error: %v", err)
+	}
+	if load != 75 {
+		t.Errorf("readCPULoadPercent: want 75, got %d", load)
+	}
+
+	path = writeTestFile(t, tmpDir, "bad", "lots\n")
+	if _, err := readCPULoadPercent(path, 2); err == nil {
+		t.Errorf("readCPULoadPercent: expected error for invalid load average")
+	}
+}
+
+func TestParseResourcePolicy(t *testing.T) {
+	data := `
+# thresholds for sysbox-runc
+min_free_memory_mb = 512
+max_cpu_load_percent = 95   # percent
+min_free_inodes = 10000
+`
+	policy, err := parseResourcePolicy([]byte(data))
+	if err != nil {
+		t.Fatalf("parseResourcePolicy: unexpected error: %v", err)
+	}
+
+	want := ResourcePolicy{
+		MinFreeMemoryMB:   512,
+		MaxCPULoadPercent: 95,
+		MinFreeInodes:     10000,
+	}
+	if *policy != want {
+		t.Errorf("parseResourcePolicy: want %+v, got %+v", want, *policy)
+	}
+
+	bad := []string{
+		"min_free_memory_mb",
+		"min_free_memory_mb = lots",
+		"min_free_inodes = -1",
+		"max_cpu_load_percent = 101",
+		"max_active_containers = 100",
+		"min_free_disk_mb = 100",
+	}
+	for _, data := range bad {
+		if _, err := parseResourcePolicy([]byte(data)); err == nil {
+			t.Errorf("parseResourcePolicy(%q): expected error, got none", data)
+		}
+	}
+}
+
+func TestCheckResourcePolicy(t *testing.T) {
+	origMeminfo := meminfoPath
+	origLoadavg := loadavgPath
+	defer func() {
+		meminfoPath = origMeminfo
+		loadavgPath = origLoadavg
+	}()
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-respolicy-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	meminfoPath = writeTestFile(t, tmpDir, "meminfo", testMeminfo)
+	loadavgPath = writeTestFile(t, tmpDir, "loadavg", "0.00 0.00 0.00 1/100 42\n")
+
+	// within the thresholds
+	policy := ResourcePolicy{
+		MinFreeMemoryMB:   1024,
+		MaxCPULoadPercent: 90,
+		MinFreeInodes:     1,
+		Rootfs:            tmpDir,
+	}
+	if v := CheckResourcePolicy(policy); len(v) != 0 {
+		t.Errorf("CheckResourcePolicy: unexpected violations: %v", v)
+	}
+
+	// free memory breached
+	policy.MinFreeMemoryMB = 4096
+
+	v := CheckResourcePolicy(policy)
+	want := []PolicyViolation{
+		{"free memory (MB)", 4096, 2048},
+	}
+	if fmt.Sprint(v) != fmt.Sprint(want) {
+		t.Errorf("CheckResourcePolicy: want %v, got %v", want, v)
+	}
+
+	// a zero policy checks nothing
+	meminfoPath = filepath.Join(tmpDir, "missing")
+	if v := CheckResourcePolicy(ResourcePolicy{}); len(v) != 0 {
+		t.Errorf("CheckResourcePolicy: unexpected violations for empty policy: %v", v)
+	}
+}
+
+func TestLoadResourcePolicy(t *testing.T) {
+	orig := resourcePolicy
+	defer func() { resourcePolicy = orig }()
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-respolicy-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := LoadResourcePolicy(filepath.Join(tmpDir, "missing.toml")); err == nil {
+		t.Errorf("LoadResourcePolicy: expected error for missing file")
+	}
+
+	path := writeTestFile(t, tmpDir, "policy.toml", "min_free_memory_mb = 1000000000\n")
+	if err := LoadResourcePolicy(path); err != nil {
+		t.Fatalf("LoadResourcePolicy: unexpected error: %v", err)
+	}
+
+	err = checkResourcePolicy(tmpDir)
+	if err == nil || !strings.Contains(err.Error(), "free memory") {
+		t.Errorf("checkResourcePolicy: expected free memory violation, got %v", err)
+	}
+}
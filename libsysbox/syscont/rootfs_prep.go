@@ -0,0 +1,193 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	securejoin "github.com/cyphar/filepath-securejoin"
+)
+
+// RootfsChange describes a change made to a sys container's rootfs by
+// PrepareRootfs.
+type RootfsChange struct {
+	Path   string `json:"path"`
+	Action string `json:"action"` // "mkdir", "chmod" or "create"
+	Mode   string `json:"mode"`
+}
+
+// RootfsManifest lists the changes made (or, in dry-run mode, that would be
+// made) to a sys container's rootfs by PrepareRootfs.
+type RootfsManifest struct {
+	Rootfs  string         `json:"rootfs"`
+	DryRun  bool           `json:"dry_run"`
+	Changes []RootfsChange `json:"changes"`
+}
+
+// directories required in the sys container's rootfs; the permissions of
+// those with fixPerm set are corrected if they exist with other permissions.
+var rootfsDirs = []struct {
+	path    string
+	mode    os.FileMode
+	fixPerm bool
+}{
+	{"/dev", 0755, false},
+	{"/etc", 0755, true},
+	{"/proc", 0555, false},
+	{"/run", 0755, false},
+	{"/run/lock", os.ModeSticky | 0777, true},
+	{"/sys", 0555, false},
+	{"/tmp", os.ModeSticky | 0777, true},
+}
+
+// PrepareRootfs sets up the given sys container rootfs: it creates the
+// directories required by the sys container (e.g., /run, /run/lock, /tmp),
+// corrects their permissions, and creates the stub files over which
+// sysbox-fs files are mounted. Stubs are not needed for sysbox-fs mounts under
+// /proc or /sys, since these are mounted over the container's procfs and
+// sysfs rather than over the rootfs. Created entries are owned by the owner of
+// the rootfs. In dry-run mode the rootfs is not modified.
+func PrepareRootfs(rootfs string, dryRun bool) (*RootfsManifest, error) {
+
+	rootfs, err := filepath.Abs(rootfs)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(rootfs)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("rootfs %s is not a directory", rootfs)
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+
+	manifest := &RootfsManifest{
+		Rootfs:  rootfs,
+		DryRun:  dryRun,
+		Changes: []RootfsChange{},
+	}
+
+	apply := func(c RootfsChange, fn func(path string) error) error {
+		manifest.Changes = append(manifest.Changes, c)
+		if dryRun {
+			return nil
+		}
+		path, err := securejoin.SecureJoin(rootfs, c.Path)
+		if err != nil {
+			return err
+		}
+		if err := fn(path); err != nil {
+			return fmt.Errorf("failed to %s %s: %v", c.Action, c.Path, err)
+		}
+		return nil
+	}
+
+	for _, d := range rootfsDirs {
+		path, err := securejoin.SecureJoin(rootfs, d.path)
+		if err != nil {
+			return nil, err
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		if os.IsNotExist(err) {
+			mode := d.mode
+			err = apply(RootfsChange{Path: d.path, Action: "mkdir", Mode: modeString(mode)}, func(path string) error {
+				if err := os.Mkdir(path, 0700); err != nil {
+					return err
+				}
+				if err := os.Lchown(path, int(st.Uid), int(st.Gid)); err != nil {
+					return err
+				}
+				// chmod explicitly, as mkdir is subject to the umask
+				return os.Chmod(path, mode)
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("%s in rootfs %s is not a directory", d.path, rootfs)
+		}
+
+		if d.fixPerm && fi.Mode()&(os.ModePerm|os.ModeSticky) != d.mode {
+			mode := d.mode
+			err = apply(RootfsChange{Path: d.path, Action: "chmod", Mode: modeString(mode)}, func(path string) error {
+				return os.Chmod(path, mode)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, m := range sysboxFsMounts {
+		dest := filepath.Clean(m.Destination)
+		if strings.HasPrefix(dest, "/proc/") || strings.HasPrefix(dest, "/sys/") {
+			continue
+		}
+
+		path, err := securejoin.SecureJoin(rootfs, dest)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Lstat(path); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		err = apply(RootfsChange{Path: dest, Action: "create", Mode: modeString(0644)}, func(path string) error {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+			if err != nil {
+				return err
+			}
+			f.Close()
+			return os.Lchown(path, int(st.Uid), int(st.Gid))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return manifest, nil
+}
+
+// modeString returns the given file mode in octal (e.g., "1777").
+func modeString(mode os.FileMode) string {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSticky != 0 {
+		m |= syscall.S_ISVTX
+	}
+	return fmt.Sprintf("%04o", m)
+}
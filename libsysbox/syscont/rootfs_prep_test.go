@@ -0,0 +1,136 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestPrepareRootfs(t *testing.T) {
+
+	rootfs, err := ioutil.TempDir("", "sysbox-rootfs-prep-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	origSysboxFsMounts := sysboxFsMounts
+	sysboxFsMounts = append([]specs.Mount{}, sysboxFsMounts...)
+	sysboxFsMounts = append(sysboxFsMounts, specs.Mount{
+		Destination: "/var/lib/sysboxfs-stub",
+		Source:      filepath.Join(SysboxFsDir, "var/lib/sysboxfs-stub"),
+		Type:        "bind",
+	})
+	defer func() { sysboxFsMounts = origSysboxFsMounts }()
+
+	// rootfs with /etc (bad permissions) and /tmp (good permissions)
+	if err := os.Mkdir(filepath.Join(rootfs, "etc"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(rootfs, "etc"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(rootfs, "tmp"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(rootfs, "tmp"), os.ModeSticky|0777); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]RootfsChange{
+		"/dev":                   {Path: "/dev", Action: "mkdir", Mode: "0755"},
+		"/etc":                   {Path: "/etc", Action: "chmod", Mode: "0755"},
+		"/proc":                  {Path: "/proc", Action: "mkdir", Mode: "0555"},
+		"/run":                   {Path: "/run", Action: "mkdir", Mode: "0755"},
+		"/run/lock":              {Path: "/run/lock", Action: "mkdir", Mode: "1777"},
+		"/sys":                   {Path: "/sys", Action: "mkdir", Mode: "0555"},
+		"/var/lib/sysboxfs-stub": {Path: "/var/lib/sysboxfs-stub", Action: "create", Mode: "0644"},
+	}
+
+	checkManifest := func(m *RootfsManifest, dryRun bool) {
+		if m.DryRun != dryRun {
+			t.Errorf("PrepareRootfs: want dry-run %v; got %v", dryRun, m.DryRun)
+		}
+		if len(m.Changes) != len(want) {
+			t.Errorf("PrepareRootfs: want %d changes; got %v", len(want), m.Changes)
+		}
+		for _, c := range m.Changes {
+			if w, ok := want[c.Path]; !ok || w != c {
+				t.Errorf("PrepareRootfs: unexpected change %+v", c)
+			}
+		}
+	}
+
+	// dry-run: the rootfs is not modified
+	m, err := PrepareRootfs(rootfs, true)
+	if err != nil {
+		t.Fatalf("PrepareRootfs: unexpected error: %v", err)
+	}
+	checkManifest(m, true)
+
+	if _, err := os.Stat(filepath.Join(rootfs, "run")); !os.IsNotExist(err) {
+		t.Errorf("PrepareRootfs: dry-run created /run")
+	}
+
+	m, err = PrepareRootfs(rootfs, false)
+	if err != nil {
+		t.Fatalf("PrepareRootfs: unexpected error: %v", err)
+	}
+	checkManifest(m, false)
+
+	for path, c := range want {
+		fi, err := os.Stat(filepath.Join(rootfs, path))
+		if err != nil {
+			t.Errorf("PrepareRootfs: %s: %v", path, err)
+			continue
+		}
+		if got := modeString(fi.Mode()); got != c.Mode {
+			t.Errorf("PrepareRootfs: %s: want mode %s; got %s", path, c.Mode, got)
+		}
+	}
+
+	// a prepared rootfs needs no changes
+	m, err = PrepareRootfs(rootfs, false)
+	if err != nil {
+		t.Fatalf("PrepareRootfs: unexpected error: %v", err)
+	}
+	if len(m.Changes) != 0 {
+		t.Errorf("PrepareRootfs: want no changes; got %v", m.Changes)
+	}
+
+	// rootfs paths that must be dirs
+	if err := os.RemoveAll(filepath.Join(rootfs, "tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "tmp"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PrepareRootfs(rootfs, true); err == nil {
+		t.Errorf("PrepareRootfs: want error for non-dir /tmp")
+	}
+
+	if _, err := PrepareRootfs(filepath.Join(rootfs, "missing"), true); err == nil {
+		t.Errorf("PrepareRootfs: want error for missing rootfs")
+	}
+}
@@ -0,0 +1,219 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+// SeccompProfileDir is the dir holding the seccomp profiles that containers
+// may chain to their own via the "sysbox.io/seccomp-extra-profiles"
+// annotation; the annotation is rejected if it's not set. It's set by the
+// operator only (see the --seccomp-profile-dir flag).
+var SeccompProfileDir string
+
+// cfgSeccompExtraProfiles chains the seccomp profiles listed in the
+// "sysbox.io/seccomp-extra-profiles" annotation (a JSON array of the names of
+// profiles in SeccompProfileDir) to the spec's seccomp profile. In strict
+// seccomp mode, profiles that block syscalls required by sysbox are rejected.
+func cfgSeccompExtraProfiles(spec *specs.Spec, strict bool) error {
+
+	val, ok := spec.Annotations[seccompExtraProfAnnot]
+	if !ok {
+		return nil
+	}
+
+	if SeccompProfileDir == "" {
+		return fmt.Errorf("annotation %s is not allowed (requires the --seccomp-profile-dir flag)", seccompExtraProfAnnot)
+	}
+
+	var names []string
+	if err := json.Unmarshal([]byte(val), &names); err != nil {
+		return fmt.Errorf("invalid value for annotation %s: %v", seccompExtraProfAnnot, err)
+	}
+
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		if name == "" || name == "." || name == ".." || name != filepath.Base(name) {
+			return fmt.Errorf("invalid value for annotation %s: %q is not a profile name", seccompExtraProfAnnot, name)
+		}
+		paths = append(paths, filepath.Join(SeccompProfileDir, name))
+	}
+
+	seccomp, err := loadAndChainSeccompProfiles(spec.Linux.Seccomp, paths, strict)
+	if err != nil {
+		return err
+	}
+
+	spec.Linux.Seccomp = seccomp
+	return nil
+}
+
+// loadAndChainSeccompProfiles loads the seccomp profiles (in OCI spec format)
+// at the given paths and chains them to the base profile. Chaining only ever
+// narrows the base profile: the chained profile allows a syscall only if the
+// base profile and all the extra profiles allow it (i.e., it's the
+// intersection of the profiles' allow sets); its default action is that of the
+// base profile. The extra profiles must be whitelists (i.e., their default
+// action must not be "allow").
+//
+// The syscalls required by sysbox are never blocked by the extra profiles; if
+// strict is set, extra profiles that don't allow them are rejected.
+//
+// The base profile is not modified.
+func loadAndChainSeccompProfiles(base *specs.LinuxSeccomp, extraPaths []string, strict bool) (*specs.LinuxSeccomp, error) {
+
+	var merged *specs.LinuxSeccomp
+	if base != nil {
+		merged = copySeccomp(base)
+	}
+
+	for _, path := range extraPaths {
+		prof, err := loadSeccompProfile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if prof.DefaultAction == specs.ActAllow {
+			return nil, fmt.Errorf("seccomp profile %s: chained profiles can't have default action %s", path, specs.ActAllow)
+		}
+
+		if merged == nil {
+			merged = prof
+			continue
+		}
+
+		if err := narrowSeccompAllowSet(merged, prof, strict); err != nil {
+			return nil, fmt.Errorf("seccomp profile %s: %v", path, err)
+		}
+		logrus.Debugf("chained seccomp profile %s", path)
+	}
+
+	return merged, nil
+}
+
+// loadSeccompProfile reads the seccomp profile at the given path.
+func loadSeccompProfile(path string) (*specs.LinuxSeccomp, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seccomp profile: %v", err)
+	}
+
+	prof := new(specs.LinuxSeccomp)
+	if err := json.Unmarshal(data, prof); err != nil {
+		return nil, fmt.Errorf("failed to parse seccomp profile %s: %v", path, err)
+	}
+
+	return prof, nil
+}
+
+// narrowSeccompAllowSet blocks in the merged profile the syscalls that the given
+// (whitelist) profile does not allow unconditionally, except those required by
+// sysbox.
+func narrowSeccompAllowSet(merged, prof *specs.LinuxSeccomp, strict bool) error {
+
+	allowSet := mapset.NewSet()
+	for _, sc := range prof.Syscalls {
+		if sc.Action == specs.ActAllow && len(sc.Args) == 0 {
+			for _, name := range sc.Names {
+				allowSet.Add(name)
+			}
+		}
+	}
+
+	for _, name := range syscontSyscallWhitelist {
+		if allowSet.Contains(name) {
+			continue
+		}
+		if strict {
+			return fmt.Errorf("syscall %s is required by sysbox but not allowed by the profile", name)
+		}
+		logrus.Warnf("syscall %s is required by sysbox but not allowed by a chained seccomp profile; allowing it", name)
+		allowSet.Add(name)
+	}
+
+	// drop the syscalls the profile doesn't allow from the allow rules
+	var syscalls []specs.LinuxSyscall
+	for _, sc := range merged.Syscalls {
+		if sc.Action == specs.ActAllow {
+			var names []string
+			for _, name := range sc.Names {
+				if allowSet.Contains(name) {
+					names = append(names, name)
+				}
+			}
+			if len(names) == 0 {
+				continue
+			}
+			sc.Names = names
+		}
+		syscalls = append(syscalls, sc)
+	}
+	merged.Syscalls = syscalls
+
+	if merged.DefaultAction != specs.ActAllow {
+		return nil
+	}
+
+	// blacklist: also deny the syscalls the profile doesn't allow
+	if syscallTable == nil {
+		return fmt.Errorf("profiles can't be chained to a profile with default action %s on this architecture", specs.ActAllow)
+	}
+
+	var denied []string
+	for name := range syscallTable {
+		if !allowSet.Contains(name) {
+			denied = append(denied, name)
+		}
+	}
+	if len(denied) > 0 {
+		sort.Strings(denied)
+		merged.Syscalls = append(merged.Syscalls, specs.LinuxSyscall{
+			Names:  denied,
+			Action: specs.ActErrno,
+		})
+	}
+
+	return nil
+}
+
+func copySeccomp(s *specs.LinuxSeccomp) *specs.LinuxSeccomp {
+	c := *s
+
+	c.Architectures = append([]specs.Arch(nil), s.Architectures...)
+	c.Flags = append([]specs.LinuxSeccompFlag(nil), s.Flags...)
+
+	c.Syscalls = make([]specs.LinuxSyscall, len(s.Syscalls))
+	for i, sc := range s.Syscalls {
+		sc.Names = append([]string(nil), sc.Names...)
+		sc.Args = append([]specs.LinuxSeccompArg(nil), sc.Args...)
+		c.Syscalls[i] = sc
+	}
+
+	return &c
+}
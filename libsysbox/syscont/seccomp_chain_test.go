@@ -0,0 +1,280 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func writeSeccompProfile(t *testing.T, path string, prof *specs.LinuxSeccomp) {
+	data, err := json.Marshal(prof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadAndChainSeccompProfiles(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-seccomp-chain-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	base := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: []specs.Arch{specs.ArchX86_64},
+		Syscalls: append(genSeccompWhitelist(syscontSyscallWhitelist),
+			specs.LinuxSyscall{Names: []string{"fake_syscall_a", "fake_syscall_b", "fake_syscall_c"}, Action: specs.ActAllow},
+			specs.LinuxSyscall{Names: []string{"fake_syscall_d"}, Action: specs.ActErrno}),
+	}
+	baseLen := len(base.Syscalls)
+
+	k8sProf := filepath.Join(tmpDir, "k8s.json")
+	writeSeccompProfile(t, k8sProf, &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: []specs.Arch{specs.ArchX86_64, specs.ArchX86},
+		Syscalls: append(genSeccompWhitelist(syscontSyscallWhitelist),
+			specs.LinuxSyscall{Names: []string{"fake_syscall_a", "fake_syscall_b", "fake_syscall_e"}, Action: specs.ActAllow}),
+	})
+
+	dockerProf := filepath.Join(tmpDir, "docker.json")
+	writeSeccompProfile(t, dockerProf, &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: []specs.Arch{specs.ArchX86_64},
+		Syscalls: append(genSeccompWhitelist(syscontSyscallWhitelist),
+			specs.LinuxSyscall{Names: []string{"fake_syscall_b", "fake_syscall_c"}, Action: specs.ActAllow},
+			specs.LinuxSyscall{Names: []string{"fake_syscall_a"}, Action: specs.ActAllow,
+				Args: []specs.LinuxSeccompArg{{Index: 0, Value: 1, Op: specs.OpEqualTo}}}),
+	})
+
+	merged, err := loadAndChainSeccompProfiles(base, []string{k8sProf, dockerProf}, true)
+	if err != nil {
+		t.Fatalf("loadAndChainSeccompProfiles: unexpected error: %v", err)
+	}
+
+	if len(base.Syscalls) != baseLen {
+		t.Errorf("loadAndChainSeccompProfiles: base profile was modified")
+	}
+
+	if merged.DefaultAction != specs.ActErrno {
+		t.Errorf("loadAndChainSeccompProfiles: want default action %s; got %s", specs.ActErrno, merged.DefaultAction)
+	}
+
+	if seccompArchFound(merged.Architectures, specs.ArchX86) {
+		t.Errorf("loadAndChainSeccompProfiles: architectures widened: %v", merged.Architectures)
+	}
+
+	// only the syscalls allowed (unconditionally) by all profiles are allowed
+	allFound, notFound := findSeccompSyscall(merged, append([]string{"fake_syscall_b"}, syscontSyscallWhitelist...))
+	if !allFound {
+		t.Errorf("loadAndChainSeccompProfiles: missing allowed syscalls %v", notFound)
+	}
+
+	for _, sc := range merged.Syscalls {
+		if sc.Action != specs.ActAllow {
+			continue
+		}
+		for _, name := range sc.Names {
+			switch name {
+			case "fake_syscall_a", "fake_syscall_c", "fake_syscall_e":
+				t.Errorf("loadAndChainSeccompProfiles: syscall %s should not be allowed", name)
+			}
+		}
+	}
+
+	// the base's deny rules are kept
+	if found, _ := findSeccompSyscall(merged, []string{"fake_syscall_d"}); !found {
+		t.Errorf("loadAndChainSeccompProfiles: deny rule for fake_syscall_d dropped")
+	}
+
+	// blacklist base: syscalls not allowed by the extra profile are denied
+	blBase := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActAllow,
+		Architectures: []specs.Arch{specs.ArchX86_64},
+		Syscalls: []specs.LinuxSyscall{
+			{Names: []string{"kexec_load"}, Action: specs.ActErrno},
+		},
+	}
+
+	if syscallTable != nil {
+		merged, err = loadAndChainSeccompProfiles(blBase, []string{dockerProf}, false)
+		if err != nil {
+			t.Fatalf("loadAndChainSeccompProfiles: unexpected error: %v", err)
+		}
+		if merged.DefaultAction != specs.ActAllow {
+			t.Errorf("loadAndChainSeccompProfiles: want default action %s; got %s", specs.ActAllow, merged.DefaultAction)
+		}
+		denied := deniedSyscalls(merged)
+		for _, name := range []string{"kexec_load", "init_module"} {
+			if !denied[name] {
+				t.Errorf("loadAndChainSeccompProfiles: want %s denied", name)
+			}
+		}
+		for _, name := range syscontSyscallWhitelist {
+			if denied[name] {
+				t.Errorf("loadAndChainSeccompProfiles: syscall %s required by sysbox was denied", name)
+			}
+		}
+	}
+
+	// no base profile: the first extra profile is the base
+	merged, err = loadAndChainSeccompProfiles(nil, []string{dockerProf}, false)
+	if err != nil {
+		t.Fatalf("loadAndChainSeccompProfiles: unexpected error: %v", err)
+	}
+	if merged == nil || merged.DefaultAction != specs.ActErrno {
+		t.Errorf("loadAndChainSeccompProfiles: want docker profile as base; got %v", merged)
+	}
+
+	// extra profiles must be whitelists
+	allowProf := filepath.Join(tmpDir, "allow.json")
+	writeSeccompProfile(t, allowProf, &specs.LinuxSeccomp{
+		DefaultAction: specs.ActAllow,
+		Architectures: []specs.Arch{specs.ArchX86_64},
+	})
+	if _, err := loadAndChainSeccompProfiles(base, []string{allowProf}, false); err == nil {
+		t.Errorf("loadAndChainSeccompProfiles: expected error for profile with default allow action")
+	}
+
+	// extra profiles that block syscalls required by sysbox are rejected in
+	// strict mode, and otherwise don't block them
+	narrowProf := filepath.Join(tmpDir, "narrow.json")
+	writeSeccompProfile(t, narrowProf, &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: []specs.Arch{specs.ArchX86_64},
+		Syscalls:      genSeccompWhitelist([]string{"fake_syscall_b"}),
+	})
+	if _, err := loadAndChainSeccompProfiles(base, []string{narrowProf}, true); err == nil {
+		t.Errorf("loadAndChainSeccompProfiles: expected error in strict mode for profile blocking sysbox syscalls")
+	}
+	merged, err = loadAndChainSeccompProfiles(base, []string{narrowProf}, false)
+	if err != nil {
+		t.Fatalf("loadAndChainSeccompProfiles: unexpected error: %v", err)
+	}
+	if allFound, notFound := findSeccompSyscall(merged, syscontSyscallWhitelist); !allFound {
+		t.Errorf("loadAndChainSeccompProfiles: syscalls required by sysbox blocked: %v", notFound)
+	}
+
+	// non-existent and invalid profiles
+	if _, err := loadAndChainSeccompProfiles(base, []string{filepath.Join(tmpDir, "missing.json")}, false); err == nil {
+		t.Errorf("loadAndChainSeccompProfiles: expected error for non-existent profile")
+	}
+
+	badProf := filepath.Join(tmpDir, "bad.json")
+	if err := ioutil.WriteFile(badProf, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadAndChainSeccompProfiles(base, []string{badProf}, false); err == nil {
+		t.Errorf("loadAndChainSeccompProfiles: expected error for invalid profile")
+	}
+}
+
+// deniedSyscalls returns the syscalls with a non-allow rule in the given
+// profile.
+func deniedSyscalls(seccomp *specs.LinuxSeccomp) map[string]bool {
+	denied := make(map[string]bool)
+	for _, sc := range seccomp.Syscalls {
+		if sc.Action == specs.ActAllow {
+			continue
+		}
+		for _, name := range sc.Names {
+			denied[name] = true
+		}
+	}
+	return denied
+}
+
+func seccompArchFound(archs []specs.Arch, arch specs.Arch) bool {
+	for _, a := range archs {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCfgSeccompExtraProfiles(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-seccomp-chain-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origDir := SeccompProfileDir
+	defer func() { SeccompProfileDir = origDir }()
+
+	spec := new(specs.Spec)
+	spec.Linux = &specs.Linux{}
+
+	// no annotation
+	if err := cfgSeccompExtraProfiles(spec, false); err != nil {
+		t.Errorf("cfgSeccompExtraProfiles: unexpected error: %v", err)
+	}
+	if spec.Linux.Seccomp != nil {
+		t.Errorf("cfgSeccompExtraProfiles: seccomp profile unexpectedly set")
+	}
+
+	writeSeccompProfile(t, filepath.Join(tmpDir, "k8s.json"), &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: []specs.Arch{specs.ArchX86_64},
+		Syscalls:      genSeccompWhitelist(syscontSyscallWhitelist),
+	})
+
+	// the annotation is rejected unless the operator sets the profile dir
+	SeccompProfileDir = ""
+	spec.Annotations = map[string]string{seccompExtraProfAnnot: `["k8s.json"]`}
+	if err := cfgSeccompExtraProfiles(spec, false); err == nil {
+		t.Errorf("cfgSeccompExtraProfiles: expected error without a profile dir")
+	}
+
+	SeccompProfileDir = tmpDir
+	if err := cfgSeccompExtraProfiles(spec, false); err != nil {
+		t.Errorf("cfgSeccompExtraProfiles: unexpected error: %v", err)
+	}
+	if spec.Linux.Seccomp == nil || spec.Linux.Seccomp.DefaultAction != specs.ActErrno {
+		t.Errorf("cfgSeccompExtraProfiles: want k8s profile; got %v", spec.Linux.Seccomp)
+	}
+
+	// profiles outside the profile dir are rejected
+	invalid := []string{
+		"/etc/sysbox/profiles/k8s.json",
+		`["/etc/sysbox/profiles/k8s.json"]`,
+		`["../k8s.json"]`,
+		`["sub/k8s.json"]`,
+		`[".."]`,
+		`[""]`,
+	}
+	for _, val := range invalid {
+		spec.Annotations = map[string]string{seccompExtraProfAnnot: val}
+		if err := cfgSeccompExtraProfiles(spec, false); err == nil {
+			t.Errorf("cfgSeccompExtraProfiles: expected error for annotation value %s", val)
+		}
+	}
+}
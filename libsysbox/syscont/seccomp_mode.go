@@ -0,0 +1,122 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Seccomp modes (set via the "sysbox.io/seccomp-mode" annotation)
+const (
+	// The profile's actions are applied as-is (the default)
+	seccompModeEnforce = ""
+	// Syscalls the profile blocks are logged rather than blocked
+	seccompModeLogOnly = "log-only"
+	// The profile's actions are applied, and syscalls sysbox allows that the
+	// profile doesn't mention are logged
+	seccompModeAudit = "audit"
+)
+
+// AllowSeccompLogMode allows system containers to relax their seccomp profile
+// via the "sysbox.io/seccomp-mode" annotation; the annotation is rejected
+// otherwise. Since the log-only mode disables seccomp enforcement for the
+// container, it's set by the operator only (see the --allow-seccomp-log-mode
+// flag).
+var AllowSeccompLogMode bool
+
+// Lists the seccomp actions supported by the kernel (since kernel 4.14, which
+// is also the first to support the log action)
+const seccompActionsAvailPath = "/proc/sys/kernel/seccomp/actions_avail"
+
+// replaceable in tests
+var seccompActLogSupported = func() bool {
+	data, err := ioutil.ReadFile(seccompActionsAvailPath)
+	if err != nil {
+		return false
+	}
+	for _, action := range strings.Fields(string(data)) {
+		if action == "log" {
+			return true
+		}
+	}
+	return false
+}
+
+// getSeccompMode returns the seccomp mode in the "sysbox.io/seccomp-mode"
+// annotation. The annotation is only honored if AllowSeccompLogMode is set, and
+// never in strict seccomp mode (i.e., --strict-seccomp).
+func getSeccompMode(annotations map[string]string, strict bool) (string, error) {
+	mode, ok := annotations[seccompModeAnnot]
+	if !ok {
+		return seccompModeEnforce, nil
+	}
+
+	if !AllowSeccompLogMode {
+		return "", fmt.Errorf("annotation %s is not allowed (requires the --allow-seccomp-log-mode flag)",
+			seccompModeAnnot)
+	}
+
+	if strict {
+		return "", fmt.Errorf("annotation %s is not allowed with strict seccomp (--strict-seccomp)",
+			seccompModeAnnot)
+	}
+
+	if mode != seccompModeLogOnly && mode != seccompModeAudit {
+		return "", fmt.Errorf("invalid value for annotation %s: %s (must be %q or %q)",
+			seccompModeAnnot, mode, seccompModeLogOnly, seccompModeAudit)
+	}
+
+	if !seccompActLogSupported() {
+		return "", fmt.Errorf("annotation %s requires the seccomp log action, which the kernel does not support (kernel 4.14+ required)",
+			seccompModeAnnot)
+	}
+
+	logrus.Warnf("seccomp mode is %s; syscalls will be logged to the kernel's audit log", mode)
+
+	return mode, nil
+}
+
+// isSeccompBlockAction returns true if the given seccomp action prevents the
+// syscall from executing.
+func isSeccompBlockAction(action specs.LinuxSeccompAction) bool {
+	return action == specs.ActErrno ||
+		action == specs.ActKill ||
+		action == specs.ActKillProcess
+}
+
+// seccompLogOnly replaces the blocking actions in the given seccomp profile
+// (including the default action) with the log action, such that the profile
+// blocks nothing.
+func seccompLogOnly(seccomp *specs.LinuxSeccomp) {
+	if isSeccompBlockAction(seccomp.DefaultAction) {
+		seccomp.DefaultAction = specs.ActLog
+	}
+
+	for i, sc := range seccomp.Syscalls {
+		if isSeccompBlockAction(sc.Action) {
+			seccomp.Syscalls[i].Action = specs.ActLog
+			seccomp.Syscalls[i].ErrnoRet = nil
+		}
+	}
+}
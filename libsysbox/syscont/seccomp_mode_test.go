@@ -0,0 +1,203 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestGetSeccompMode(t *testing.T) {
+	orig, origAllow := seccompActLogSupported, AllowSeccompLogMode
+	defer func() {
+		seccompActLogSupported = orig
+		AllowSeccompLogMode = origAllow
+	}()
+
+	seccompActLogSupported = func() bool { return true }
+	AllowSeccompLogMode = true
+
+	tests := []struct {
+		annot   map[string]string
+		want    string
+		wantErr bool
+	}{
+		{nil, seccompModeEnforce, false},
+		{map[string]string{seccompModeAnnot: "log-only"}, seccompModeLogOnly, false},
+		{map[string]string{seccompModeAnnot: "audit"}, seccompModeAudit, false},
+		{map[string]string{seccompModeAnnot: "enforce"}, "", true},
+		{map[string]string{seccompModeAnnot: ""}, "", true},
+	}
+
+	for _, test := range tests {
+		got, err := getSeccompMode(test.annot, false)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("getSeccompMode(%v): expected error, got none", test.annot)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("getSeccompMode(%v): unexpected error: %v", test.annot, err)
+		} else if got != test.want {
+			t.Errorf("getSeccompMode(%v): want %q, got %q", test.annot, test.want, got)
+		}
+	}
+
+	// the annotation is rejected in strict seccomp mode
+	if _, err := getSeccompMode(map[string]string{seccompModeAnnot: "log-only"}, true); err == nil {
+		t.Errorf("getSeccompMode: expected error in strict seccomp mode")
+	}
+
+	// the annotation is rejected unless the operator allows it
+	AllowSeccompLogMode = false
+
+	if _, err := getSeccompMode(map[string]string{seccompModeAnnot: "audit"}, false); err == nil {
+		t.Errorf("getSeccompMode: expected error when the seccomp log mode is not allowed")
+	}
+
+	// the log action is required
+	AllowSeccompLogMode = true
+	seccompActLogSupported = func() bool { return false }
+
+	if _, err := getSeccompMode(map[string]string{seccompModeAnnot: "log-only"}, false); err == nil {
+		t.Errorf("getSeccompMode: expected error when the log action is not supported")
+	}
+	if mode, err := getSeccompMode(nil, false); err != nil || mode != seccompModeEnforce {
+		t.Errorf("getSeccompMode: want enforce mode without annotation, got %q (%v)", mode, err)
+	}
+}
+
+func TestCfgSeccompLogOnly(t *testing.T) {
+	errnoRet := uint(1)
+
+	seccomp := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: []specs.Arch{specs.ArchX86_64},
+		Syscalls: append(genSeccompWhitelist([]string{"accept", "access"}),
+			specs.LinuxSyscall{Names: []string{"kexec_load"}, Action: specs.ActErrno, ErrnoRet: &errnoRet},
+			specs.LinuxSyscall{Names: []string{"reboot"}, Action: specs.ActKill},
+			specs.LinuxSyscall{Names: []string{"init_module"}, Action: specs.ActKillProcess},
+		),
+	}
+
+	if err := cfgSeccomp(seccomp, false, nil, seccompModeLogOnly); err != nil {
+		t.Fatalf("cfgSeccomp: returned error: %v", err)
+	}
+
+	if seccomp.DefaultAction != specs.ActLog {
+		t.Errorf("cfgSeccomp: log-only default action: want %v, got %v", specs.ActLog, seccomp.DefaultAction)
+	}
+
+	for _, sc := range seccomp.Syscalls {
+		if isSeccompBlockAction(sc.Action) {
+			t.Errorf("cfgSeccomp: log-only profile blocks syscalls %v with action %v", sc.Names, sc.Action)
+		}
+		if sc.ErrnoRet != nil {
+			t.Errorf("cfgSeccomp: log-only profile has errno return for syscalls %v", sc.Names)
+		}
+	}
+
+	if ok, notFound := findSeccompSyscall(seccomp, syscontSyscallWhitelist); !ok {
+		t.Errorf("cfgSeccomp: log-only whitelist test failed: missing syscalls: %s", notFound)
+	}
+
+	// allow-by-default profiles keep their default action
+	seccomp = &specs.LinuxSeccomp{
+		DefaultAction: specs.ActAllow,
+		Architectures: []specs.Arch{specs.ArchX86_64},
+		Syscalls: []specs.LinuxSyscall{
+			{Names: []string{"kexec_load"}, Action: specs.ActErrno},
+		},
+	}
+
+	if err := cfgSeccomp(seccomp, false, nil, seccompModeLogOnly); err != nil {
+		t.Fatalf("cfgSeccomp: returned error: %v", err)
+	}
+	if seccomp.DefaultAction != specs.ActAllow {
+		t.Errorf("cfgSeccomp: log-only blacklist default action: want %v, got %v", specs.ActAllow, seccomp.DefaultAction)
+	}
+	if len(seccomp.Syscalls) != 1 || seccomp.Syscalls[0].Action != specs.ActLog {
+		t.Errorf("cfgSeccomp: log-only blacklist: want kexec_load logged, got %v", seccomp.Syscalls)
+	}
+}
+
+func TestCfgSeccompAudit(t *testing.T) {
+	partialList := []string{"accept", "accept4", "access", "adjtimex"}
+
+	// whitelist: the profile's rules are kept, the syscalls sysbox adds are logged
+	seccomp := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: []specs.Arch{specs.ArchX86_64},
+		Syscalls:      genSeccompWhitelist(partialList),
+	}
+
+	if err := cfgSeccomp(seccomp, false, nil, seccompModeAudit); err != nil {
+		t.Fatalf("cfgSeccomp: returned error: %v", err)
+	}
+
+	if seccomp.DefaultAction != specs.ActErrno {
+		t.Errorf("cfgSeccomp: audit default action: want %v, got %v", specs.ActErrno, seccomp.DefaultAction)
+	}
+
+	if ok, notFound := findSeccompSyscall(seccomp, syscontSyscallWhitelist); !ok {
+		t.Errorf("cfgSeccomp: audit whitelist test failed: missing syscalls: %s", notFound)
+	}
+
+	for i, sc := range seccomp.Syscalls {
+		want := specs.ActLog
+		if i < len(partialList) {
+			want = specs.ActAllow
+		}
+		if sc.Action != want {
+			t.Errorf("cfgSeccomp: audit whitelist: syscalls %v: want action %v, got %v", sc.Names, want, sc.Action)
+		}
+	}
+
+	// blacklist: the profile's rules are kept, the syscalls sysbox allows that
+	// the profile doesn't list are logged
+	seccomp = &specs.LinuxSeccomp{
+		DefaultAction: specs.ActAllow,
+		Architectures: []specs.Arch{specs.ArchX86_64},
+		Syscalls: []specs.LinuxSyscall{
+			{Names: []string{"mount"}, Action: specs.ActErrno},
+		},
+	}
+
+	if err := cfgSeccomp(seccomp, false, nil, seccompModeAudit); err != nil {
+		t.Fatalf("cfgSeccomp: returned error: %v", err)
+	}
+
+	if seccomp.DefaultAction != specs.ActAllow {
+		t.Errorf("cfgSeccomp: audit blacklist default action: want %v, got %v", specs.ActAllow, seccomp.DefaultAction)
+	}
+	if ok, notFound := findSeccompSyscall(seccomp, syscontSyscallWhitelist); !ok {
+		t.Errorf("cfgSeccomp: audit blacklist test failed: missing syscalls: %s", notFound)
+	}
+	for _, sc := range seccomp.Syscalls {
+		want := specs.ActLog
+		if len(sc.Names) == 1 && sc.Names[0] == "mount" {
+			want = specs.ActErrno
+		}
+		if sc.Action != want {
+			t.Errorf("cfgSeccomp: audit blacklist: syscalls %v: want action %v, got %v", sc.Names, want, sc.Action)
+		}
+	}
+}
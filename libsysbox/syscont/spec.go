@@ -19,24 +19,49 @@
 package syscont
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	securejoin "github.com/cyphar/filepath-securejoin"
 	mapset "github.com/deckarep/golang-set"
+	units "github.com/docker/go-units"
 	ipcLib "github.com/nestybox/sysbox-ipc/sysboxMgrLib"
 	utils "github.com/nestybox/sysbox-libs/utils"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libcontainer/specconv"
+	"github.com/opencontainers/runc/libcontainer/system"
+	"github.com/opencontainers/runc/libcontainer/user"
 	"github.com/opencontainers/runc/libsysbox/sysbox"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 )
 
 // Exported
 const (
-	SysboxFsDir string = "/var/lib/sysboxfs"
-	IdRangeMin  uint32 = 65536
+	SysboxFsDir  string = sysbox.FsMountDir
+	SysboxRunDir string = "/run/sysbox"
+	IdRangeMin   uint32 = 65536
 )
 
 // Internal
@@ -45,6 +70,45 @@ const (
 	defaultGid uint32 = 231072
 )
 
+// Sysbox-specific spec annotations
+const (
+	allowKvmAnnot          = "sysbox.io/allow-kvm"
+	denyCapsAnnot          = "sysbox.io/deny-caps"
+	extraCapsAnnotPrefix   = "sysbox.io/extra-caps/"
+	netIsolationAnnot      = "sysbox.io/network-isolation"
+	innerDockerBridgeAnnot = "sysbox.io/inner-docker-bridge-subnet"
+	dockerAddrPoolsAnnot   = "sysbox.io/docker-address-pools"
+	numaAffinityAnnot      = "sysbox.io/numa-affinity"
+	seccompExtraProfAnnot  = "sysbox.io/seccomp-extra-profiles"
+	devShmSizeAnnot        = "sysbox.io/dev-shm-size"
+	supMountOverridePrefix = "sysbox.io/sup-mount-override/"
+	resourceModeAnnot      = "sysbox.io/resource-mode"
+	mountPropagationAnnot  = "sysbox.io/mount-propagation"
+	seccompGroupsAnnot     = "sysbox.io/seccomp-groups"
+	netIfaceNameAnnot      = "sysbox.io/net-iface-name"
+	innerKubePodCIDRAnnot  = "sysbox.io/inner-kube-pod-cidr"
+	innerKubeSvcCIDRAnnot  = "sysbox.io/inner-kube-svc-cidr"
+	allowDebugfsAnnot      = "sysbox.io/allow-debugfs"
+	netSysctlsAnnot        = "sysbox.io/net-sysctls"
+	allowVmSysctlsAnnot    = "sysbox.io/allow-vm-sysctl-override"
+	reclaimMemOnStartAnnot = "sysbox.io/reclaim-memory-on-start"
+	netAccountingAnnot     = "sysbox.io/network-accounting"
+	parentDeathSigAnnot    = "sysbox.io/parent-death-signal"
+	seccompModeAnnot       = "sysbox.io/seccomp-mode"
+	netPolicyIngressAnnot  = "sysbox.io/network-policy-prog-ingress"
+	netPolicyEgressAnnot   = "sysbox.io/network-policy-prog-egress"
+	corePatternAnnot       = "sysbox.io/core-pattern"
+	readonlyNetSysfsAnnot  = "sysbox.io/readonly-net-sysfs"
+)
+
+// sysboxAnnotPrefix is the prefix of all sysbox-specific annotations.
+const sysboxAnnotPrefix = "sysbox.io/"
+
+// imageConfigFile is the (optional) file in the container's bundle that holds
+// the config of the container's image (in OCI image config format), as
+// written by the container manager.
+const imageConfigFile = "image-config.json"
+
 // System container "must-have" mounts
 var sysboxMounts = []specs.Mount{
 	specs.Mount{
@@ -124,6 +188,81 @@ var sysboxFsMounts = []specs.Mount{
 		Type:        "bind",
 		Options:     []string{"rbind", "rprivate"},
 	},
+	// the following are container-scoped (e.g., pid_max must not exceed the
+	// host's value, but defaults to the container's pid namespace limit)
+	specs.Mount{
+		Destination: "/proc/sys/kernel/ngroups_max",
+		Source:      filepath.Join(SysboxFsDir, "proc/sys/kernel/ngroups_max"),
+		Type:        "bind",
+		Options:     []string{"rbind", "rprivate"},
+	},
+	specs.Mount{
+		Destination: "/proc/sys/kernel/pid_max",
+		Source:      filepath.Join(SysboxFsDir, "proc/sys/kernel/pid_max"),
+		Type:        "bind",
+		Options:     []string{"rbind", "rprivate"},
+	},
+	specs.Mount{
+		Destination: "/proc/sys/kernel/threads-max",
+		Source:      filepath.Join(SysboxFsDir, "proc/sys/kernel/threads-max"),
+		Type:        "bind",
+		Options:     []string{"rbind", "rprivate"},
+	},
+	// vm sysctls are virtualized per-container (e.g., for databases that tune
+	// swappiness or overcommit without affecting the host)
+	specs.Mount{
+		Destination: "/proc/sys/vm/swappiness",
+		Source:      filepath.Join(SysboxFsDir, "proc/sys/vm/swappiness"),
+		Type:        "bind",
+		Options:     []string{"rbind", "rprivate"},
+	},
+	specs.Mount{
+		Destination: "/proc/sys/vm/dirty_ratio",
+		Source:      filepath.Join(SysboxFsDir, "proc/sys/vm/dirty_ratio"),
+		Type:        "bind",
+		Options:     []string{"rbind", "rprivate"},
+	},
+	specs.Mount{
+		Destination: "/proc/sys/vm/dirty_background_ratio",
+		Source:      filepath.Join(SysboxFsDir, "proc/sys/vm/dirty_background_ratio"),
+		Type:        "bind",
+		Options:     []string{"rbind", "rprivate"},
+	},
+	specs.Mount{
+		Destination: "/proc/sys/vm/overcommit_memory",
+		Source:      filepath.Join(SysboxFsDir, "proc/sys/vm/overcommit_memory"),
+		Type:        "bind",
+		Options:     []string{"rbind", "rprivate"},
+	},
+	// timer and interrupt info; sysbox-fs filters /proc/interrupts and
+	// /proc/timer_list down to the CPUs in the container's cpuset, while
+	// /proc/timer_stats and /proc/irq/ still show (read-only) host-wide data.
+	// The latter are only mounted if sysbox-fs exposes them (e.g.,
+	// timer_stats was removed in kernel 4.11); see sysboxFsOptionalMounts.
+	specs.Mount{
+		Destination: "/proc/interrupts",
+		Source:      filepath.Join(SysboxFsDir, "proc/interrupts"),
+		Type:        "bind",
+		Options:     []string{"rbind", "rprivate"},
+	},
+	specs.Mount{
+		Destination: "/proc/irq",
+		Source:      filepath.Join(SysboxFsDir, "proc/irq"),
+		Type:        "bind",
+		Options:     []string{"rbind", "rprivate"},
+	},
+	specs.Mount{
+		Destination: "/proc/timer_list",
+		Source:      filepath.Join(SysboxFsDir, "proc/timer_list"),
+		Type:        "bind",
+		Options:     []string{"rbind", "rprivate"},
+	},
+	specs.Mount{
+		Destination: "/proc/timer_stats",
+		Source:      filepath.Join(SysboxFsDir, "proc/timer_stats"),
+		Type:        "bind",
+		Options:     []string{"rbind", "rprivate"},
+	},
 
 	// XXX: In the future sysbox-fs will also virtualize the following
 
@@ -310,6 +449,86 @@ var linuxCaps = []string{
 	"CAP_AUDIT_READ",
 }
 
+// innerContainerCaps is the list of capabilities that may be given to a system
+// container when sysbox-runc itself runs inside another system container;
+// capabilities that act on the host kernel or hardware (e.g., CAP_SYS_MODULE,
+// CAP_SYS_RAWIO) are excluded as they would not be honored there anyway.
+var innerContainerCaps = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FSETID",
+	"CAP_FOWNER",
+	"CAP_MKNOD",
+	"CAP_NET_RAW",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETFCAP",
+	"CAP_SETPCAP",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_SYS_CHROOT",
+	"CAP_KILL",
+	"CAP_AUDIT_WRITE",
+	"CAP_DAC_READ_SEARCH",
+	"CAP_LINUX_IMMUTABLE",
+	"CAP_NET_BROADCAST",
+	"CAP_NET_ADMIN",
+	"CAP_IPC_LOCK",
+	"CAP_IPC_OWNER",
+	"CAP_SYS_PTRACE",
+	"CAP_SYS_PACCT",
+	"CAP_SYS_ADMIN",
+	"CAP_SYS_BOOT",
+	"CAP_SYS_NICE",
+	"CAP_SYS_RESOURCE",
+	"CAP_SYS_TTY_CONFIG",
+	"CAP_LEASE",
+	"CAP_AUDIT_CONTROL",
+	"CAP_MAC_OVERRIDE",
+	"CAP_MAC_ADMIN",
+	"CAP_SYSLOG",
+	"CAP_AUDIT_READ",
+}
+
+// ForceFullCaps gives system containers the full set of capabilities even when
+// sysbox-runc runs inside another system container (see innerContainerCaps).
+var ForceFullCaps bool
+
+// innerContainerMarker, when present, indicates that sysbox-runc is running
+// inside a system container.
+var innerContainerMarker = "/run/sysbox-runc/inner-container"
+
+// replaceable in tests
+var (
+	runningInUserNS     = system.RunningInUserNS
+	innerContainerCheck = isInsideSysboxContainer
+)
+
+// isInsideSysboxContainer returns true if sysbox-runc is running inside
+// another system container. This is the case when the inner container marker
+// is present or when we are not in the initial user namespace (system
+// containers always use the user namespace).
+func isInsideSysboxContainer() bool {
+	if _, err := os.Stat(innerContainerMarker); err == nil {
+		return true
+	}
+	return runningInUserNS()
+}
+
+// containerCaps returns the full set of capabilities for the system container.
+func containerCaps() []string {
+	if ForceFullCaps || !innerContainerCheck() {
+		return linuxCaps
+	}
+
+	caps := []string{}
+	for _, c := range linuxCaps {
+		if utils.StringSliceContains(innerContainerCaps, c) {
+			caps = append(caps, c)
+		}
+	}
+	return caps
+}
+
 // cfgNamespaces checks that the namespace config has the minimum set
 // of namespaces required and adds any missing namespaces to it
 func cfgNamespaces(sysMgr *sysbox.Mgr, spec *specs.Spec) error {
@@ -368,6 +587,108 @@ func cfgNamespaces(sysMgr *sysbox.Mgr, spec *specs.Spec) error {
 	return nil
 }
 
+// ReclaimMemoryOnStart returns the amount of memory (in bytes) to reclaim from
+// the container's cgroup once it's created, per the given container
+// annotations (0 if none).
+func ReclaimMemoryOnStart(annotations map[string]string) (uint64, error) {
+	val, ok := annotations[reclaimMemOnStartAnnot]
+	if !ok {
+		return 0, nil
+	}
+	size, err := units.RAMInBytes(val)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid value for annotation %s: %s", reclaimMemOnStartAnnot, val)
+	}
+	return uint64(size), nil
+}
+
+// ParentDeathSignal returns the signal sent to the container's init process
+// when its parent (sysbox-runc) dies, per the given container annotations (0
+// if none). The signal may be given by name (e.g., "SIGKILL" or "KILL") or
+// number.
+func ParentDeathSignal(annotations map[string]string) (int, error) {
+	val, ok := annotations[parentDeathSigAnnot]
+	if !ok {
+		return 0, nil
+	}
+
+	if num, err := strconv.Atoi(val); err == nil {
+		// 64 is SIGRTMAX on Linux
+		if num <= 0 || num > 64 {
+			return 0, fmt.Errorf("invalid value for annotation %s: %s", parentDeathSigAnnot, val)
+		}
+		return num, nil
+	}
+
+	name := strings.ToUpper(val)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig := unix.SignalNum(name)
+	if sig == 0 {
+		return 0, fmt.Errorf("invalid value for annotation %s: %s", parentDeathSigAnnot, val)
+	}
+	return int(sig), nil
+}
+
+// SetParentDeathSignal sets the parent death signal of the container with the
+// given spec (see ParentDeathSignal).
+func SetParentDeathSignal(spec *specs.Spec, sig string) error {
+	annotations := map[string]string{parentDeathSigAnnot: sig}
+	if _, err := ParentDeathSignal(annotations); err != nil {
+		return err
+	}
+	if spec.Annotations == nil {
+		spec.Annotations = make(map[string]string)
+	}
+	spec.Annotations[parentDeathSigAnnot] = sig
+	return nil
+}
+
+// AllowNetworkPolicyProgs allows system containers to have eBPF programs
+// loaded (by sysbox-runc, as root on the host) via the
+// "sysbox.io/network-policy-prog-*" annotations; the annotations are rejected
+// otherwise. It's set by the operator only (see the
+// --allow-network-policy-progs flag).
+var AllowNetworkPolicyProgs bool
+
+// NetworkPolicyPrograms returns the eBPF (cgroup_skb) programs that filter the
+// container's ingress and egress traffic, per the given container annotations
+// (nil if none). The programs are given as base64-encoded ELF objects.
+func NetworkPolicyPrograms(annotations map[string]string) (ingress, egress []byte, err error) {
+	if !AllowNetworkPolicyProgs {
+		for _, annot := range []string{netPolicyIngressAnnot, netPolicyEgressAnnot} {
+			if _, ok := annotations[annot]; ok {
+				return nil, nil, fmt.Errorf("annotation %s is not allowed (requires the --allow-network-policy-progs flag)", annot)
+			}
+		}
+	}
+
+	if ingress, err = decodeNetPolicyProg(annotations, netPolicyIngressAnnot); err != nil {
+		return nil, nil, err
+	}
+	if egress, err = decodeNetPolicyProg(annotations, netPolicyEgressAnnot); err != nil {
+		return nil, nil, err
+	}
+	return ingress, egress, nil
+}
+
+func decodeNetPolicyProg(annotations map[string]string, annot string) ([]byte, error) {
+	val, ok := annotations[annot]
+	if !ok {
+		return nil, nil
+	}
+
+	prog, err := base64.StdEncoding.DecodeString(strings.TrimSpace(val))
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for annotation %s: %s", annot, err)
+	}
+	if !bytes.HasPrefix(prog, []byte(elf.ELFMAG)) {
+		return nil, fmt.Errorf("invalid value for annotation %s: not an ELF object", annot)
+	}
+	return prog, nil
+}
+
 // allocIDMappings performs uid and gid allocation for the system container
 func allocIDMappings(sysMgr *sysbox.Mgr, spec *specs.Spec) error {
 	var uid, gid uint32
@@ -381,6 +702,12 @@ func allocIDMappings(sysMgr *sysbox.Mgr, spec *specs.Spec) error {
 	} else {
 		uid = defaultUid
 		gid = defaultGid
+
+		// Without sysbox-mgr there is no subid allocator, so make sure the
+		// range is not already in use by another container.
+		if err := checkUidRangeAvailability(uid, IdRangeMin); err != nil {
+			return err
+		}
 	}
 
 	uidMap := specs.LinuxIDMapping{
@@ -401,6 +728,99 @@ func allocIDMappings(sysMgr *sysbox.Mgr, spec *specs.Spec) error {
 	return nil
 }
 
+// procRoot is the path to the host's procfs (replaceable for testing)
+var procRoot = "/proc"
+
+// sysNodeRoot is the path to the host's sysfs NUMA topology (replaceable for testing)
+var sysNodeRoot = "/sys/devices/system/node"
+
+// uidMapCacheTTL is how long the results of the host's uid_map scan are reused
+const uidMapCacheTTL = time.Second
+
+var uidMapCache struct {
+	sync.Mutex
+	mappings []specs.LinuxIDMapping
+	expiry   time.Time
+}
+
+// checkUidRangeAvailability returns an error if the given host uid range
+// [uid, uid+size) overlaps with the user-ns uid mappings of any process on the
+// host.
+func checkUidRangeAvailability(uid, size uint32) error {
+
+	mappings, err := hostUidMappings()
+	if err != nil {
+		return fmt.Errorf("failed to get host uid mappings: %v", err)
+	}
+
+	start := uint64(uid)
+	end := start + uint64(size)
+
+	for _, m := range mappings {
+		mStart := uint64(m.HostID)
+		mEnd := mStart + uint64(m.Size)
+
+		if start < mEnd && mStart < end {
+			return fmt.Errorf("uid range [%d, %d) overlaps with existing user-ns mapping %v; "+
+				"enable sysbox-mgr or configure explicit uid mappings", start, end, m)
+		}
+	}
+
+	return nil
+}
+
+// hostUidMappings returns the uid mappings of all user namespaces (other than
+// the initial one) in use by processes on the host. Results are cached for
+// uidMapCacheTTL.
+func hostUidMappings() ([]specs.LinuxIDMapping, error) {
+	uidMapCache.Lock()
+	defer uidMapCache.Unlock()
+
+	if time.Now().Before(uidMapCache.expiry) {
+		return uidMapCache.mappings, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(procRoot, "[0-9]*", "uid_map"))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[specs.LinuxIDMapping]bool)
+	mappings := []specs.LinuxIDMapping{}
+
+	for _, path := range paths {
+
+		// processes may exit while we scan; ignore them
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			var m specs.LinuxIDMapping
+
+			if _, err := fmt.Sscanf(line, "%d %d %d", &m.ContainerID, &m.HostID, &m.Size); err != nil {
+				continue
+			}
+
+			// skip the initial user-ns identity mapping
+			if m.ContainerID == 0 && m.HostID == 0 && m.Size == 4294967295 {
+				continue
+			}
+
+			if !seen[m] {
+				seen[m] = true
+				mappings = append(mappings, m)
+			}
+		}
+	}
+
+	uidMapCache.mappings = mappings
+	uidMapCache.expiry = time.Now().Add(uidMapCacheTTL)
+
+	return mappings, nil
+}
+
 // validateIDMappings checks if the spec's user namespace uid and gid mappings meet
 // sysbox-runc requirements.
 func validateIDMappings(spec *specs.Spec) error {
@@ -483,28 +903,97 @@ func cfgIDMappings(sysMgr *sysbox.Mgr, spec *specs.Spec) error {
 }
 
 // cfgCapabilities sets the capabilities for the process in the system container
-func cfgCapabilities(p *specs.Process) {
+func cfgCapabilities(p *specs.Process, annotations map[string]string) error {
 	caps := p.Capabilities
 	uid := p.User.UID
 
 	noCaps := []string{}
+	allCaps := containerCaps()
+
+	denyCaps, err := parseCapsAnnot(annotations, denyCapsAnnot)
+	if err != nil {
+		return err
+	}
+
+	extraCapsAnnot := extraCapsAnnotPrefix + strconv.FormatUint(uint64(uid), 10)
+	extraCaps, err := parseCapsAnnot(annotations, extraCapsAnnot)
+	if err != nil {
+		return err
+	}
+
+	// A cap can't be both denied and explicitly granted to the same user
+	for _, c := range extraCaps {
+		if utils.StringSliceContains(denyCaps, c) {
+			return fmt.Errorf("capability %s is in both annotations %s and %s", c, denyCapsAnnot, extraCapsAnnot)
+		}
+	}
 
 	if uid == 0 {
 		// init processes owned by root have all capabilities
-		caps.Bounding = linuxCaps
-		caps.Effective = linuxCaps
-		caps.Inheritable = linuxCaps
-		caps.Permitted = linuxCaps
-		caps.Ambient = linuxCaps
+		caps.Bounding = allCaps
+		caps.Effective = allCaps
+		caps.Inheritable = allCaps
+		caps.Permitted = allCaps
+		caps.Ambient = allCaps
 	} else {
 		// init processes owned by others have all caps disabled and the bounding caps all
 		// set (just as in a regular host)
-		caps.Bounding = linuxCaps
+		caps.Bounding = allCaps
 		caps.Effective = noCaps
 		caps.Inheritable = noCaps
 		caps.Permitted = noCaps
 		caps.Ambient = noCaps
+
+		// extra caps granted to the user via annotation; they're also made
+		// ambient so that they are kept across execve()
+		for _, c := range extraCaps {
+			if !utils.StringSliceContains(allCaps, c) {
+				logrus.Warnf("annotation %s: capability %s is not available in the container; ignoring it", extraCapsAnnot, c)
+				continue
+			}
+			caps.Effective = append(caps.Effective, c)
+			caps.Inheritable = append(caps.Inheritable, c)
+			caps.Permitted = append(caps.Permitted, c)
+			caps.Ambient = append(caps.Ambient, c)
+		}
+	}
+
+	// denied caps are removed even for root
+	if len(denyCaps) > 0 {
+		caps.Bounding = utils.StringSliceRemove(caps.Bounding, denyCaps)
+		caps.Effective = utils.StringSliceRemove(caps.Effective, denyCaps)
+		caps.Inheritable = utils.StringSliceRemove(caps.Inheritable, denyCaps)
+		caps.Permitted = utils.StringSliceRemove(caps.Permitted, denyCaps)
+		caps.Ambient = utils.StringSliceRemove(caps.Ambient, denyCaps)
+	}
+
+	return nil
+}
+
+// parseCapsAnnot returns the list of capabilities in the given annotation (a
+// comma-separated list of capability names).
+func parseCapsAnnot(annotations map[string]string, annot string) ([]string, error) {
+	val, ok := annotations[annot]
+	if !ok {
+		return nil, nil
+	}
+
+	caps := []string{}
+	for _, c := range strings.Split(val, ",") {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if !utils.StringSliceContains(linuxCaps, c) {
+			return nil, fmt.Errorf("invalid capability %q in annotation %s", c, annot)
+		}
+		if annot == denyCapsAnnot && c == "CAP_SYS_ADMIN" {
+			logrus.Warnf("annotation %s denies CAP_SYS_ADMIN; processes in the container will likely malfunction", denyCapsAnnot)
+		}
+		caps = append(caps, c)
 	}
+
+	return caps, nil
 }
 
 // cfgMaskedPaths removes from the container's config any masked paths for which
@@ -525,17 +1014,38 @@ func cfgReadonlyPaths(spec *specs.Spec) {
 	spec.Linux.ReadonlyPaths = utils.StringSliceRemove(spec.Linux.ReadonlyPaths, sysboxRwPaths)
 }
 
+// supMountsOpts are the options for the supplementary mounts that sysbox-mgr
+// sets up for the sys container.
+type supMountsOpts struct {
+	partialOk bool // use the mounts setup before a sysbox-mgr failure
+	remap     bool // remap the ownership of the mounts to the container's root
+}
+
 // cfgMounts configures the system container mounts
-func cfgMounts(spec *specs.Spec, sysMgr *sysbox.Mgr, sysFs *sysbox.Fs, uidShiftRootfs bool) error {
+func cfgMounts(spec *specs.Spec, sysMgr *sysbox.Mgr, sysFs *sysbox.Fs, uidShiftRootfs bool, supOpts supMountsOpts) error {
+
+	if err := validateMountLabel(spec.Linux.MountLabel); err != nil {
+		return err
+	}
 
 	cfgSysboxMounts(spec)
 
+	if err := cfgDebugfs(spec); err != nil {
+		return err
+	}
+
+	if err := cfgDevMount(spec); err != nil {
+		return err
+	}
+
 	if sysFs.Enabled() {
-		cfgSysboxFsMounts(spec, sysFs)
+		if err := cfgSysboxFsMounts(spec, sysFs); err != nil {
+			return err
+		}
 	}
 
 	if sysMgr.Enabled() {
-		if err := sysMgrSetupMounts(sysMgr, spec, uidShiftRootfs); err != nil {
+		if err := sysMgrSetupMounts(sysMgr, spec, uidShiftRootfs, supOpts); err != nil {
 			return err
 		}
 	}
@@ -544,6 +1054,18 @@ func cfgMounts(spec *specs.Spec, sysMgr *sysbox.Mgr, sysFs *sysbox.Fs, uidShiftR
 		cfgSystemdMounts(spec)
 	}
 
+	if err := cfgHostsAndResolvConf(spec, sysMgr.Id); err != nil {
+		return err
+	}
+
+	if err := cfgInnerNetworkIsolation(spec, sysMgr.Id); err != nil {
+		return err
+	}
+
+	if err := cfgNetSysfs(spec); err != nil {
+		return err
+	}
+
 	sortMounts(spec)
 
 	return nil
@@ -573,166 +1095,1857 @@ func cfgSysboxMounts(spec *specs.Spec) {
 	spec.Mounts = append(spec.Mounts, sysboxMounts...)
 }
 
-// cfgSysboxFsMounts adds the sysbox-fs mounts to the containers config.
-func cfgSysboxFsMounts(spec *specs.Spec, sysFs *sysbox.Fs) {
-	spec.Mounts = utils.MountSliceRemove(spec.Mounts, sysboxFsMounts, func(m1, m2 specs.Mount) bool {
-		return m1.Destination == m2.Destination
-	})
+// cfgDebugfs replaces the sys container's dummy /sys/kernel/debug with a
+// read-only bind-mount of the host's debugfs when the "sysbox.io/allow-debugfs"
+// annotation is "true". Note that this exposes host kernel info to the
+// container.
+func cfgDebugfs(spec *specs.Spec) error {
+	val, ok := spec.Annotations[allowDebugfsAnnot]
+	if !ok {
+		return nil
+	}
 
-	// Adjust sysboxFsMounts path attending to container-id value.
-	cntrMountpoint := filepath.Join(SysboxFsDir, sysFs.Id)
+	switch val {
+	case "false":
+		return nil
+	case "true":
+	default:
+		return fmt.Errorf("invalid value for annotation %s: %s (must be \"true\" or \"false\")", allowDebugfsAnnot, val)
+	}
 
-	for i := range sysboxFsMounts {
-		sysboxFsMounts[i].Source =
-			strings.Replace(
-				sysboxFsMounts[i].Source,
-				SysboxFsDir,
-				cntrMountpoint,
-				1,
-			)
+	logrus.Warnf("annotation %s is set; the host's debugfs is exposed (read-only) to the container", allowDebugfsAnnot)
+
+	for i, m := range spec.Mounts {
+		if m.Destination == "/sys/kernel/debug" {
+			spec.Mounts[i] = specs.Mount{
+				Destination: "/sys/kernel/debug",
+				Source:      "/sys/kernel/debug",
+				Type:        "bind",
+				Options:     []string{"rbind", "rprivate", "ro", "nosuid", "noexec", "nodev"},
+			}
+		}
 	}
 
-	spec.Mounts = append(spec.Mounts, sysboxFsMounts...)
+	return nil
 }
 
-// cfgSystemdMounts adds systemd related mounts to the spec
-func cfgSystemdMounts(spec *specs.Spec) {
+// Default size of the sys container's /dev/shm (same as Docker's)
+const defaultDevShmSize = "65536k"
+
+// Device nodes that must exist in the sys container's /dev. These are always
+// created by libcontainer (see specconv.AllowedDevices), along with /dev/full
+// and /dev/tty; they are only added to the spec as a safeguard. All other
+// device nodes come from the spec (spec.Linux.Devices).
+var sysboxDevices = []specs.LinuxDevice{
+	{Path: "/dev/null", Type: "c", Major: 1, Minor: 3},
+	{Path: "/dev/zero", Type: "c", Major: 1, Minor: 5},
+	{Path: "/dev/random", Type: "c", Major: 1, Minor: 8},
+	{Path: "/dev/urandom", Type: "c", Major: 1, Minor: 9},
+}
 
-	// For sys containers with systemd inside, sysbox mounts tmpfs over certain directories
-	// of the container (this is a systemd requirement). However, if the container spec
-	// already has tmpfs mounts over any of these directories, we honor the spec mounts
-	// (i.e., these override the sysbox mount).
+// defaultTtyGid is the gid of the "tty" group in most distros
+const defaultTtyGid = 5
 
-	spec.Mounts = utils.MountSliceRemove(spec.Mounts, sysboxSystemdMounts, func(m1, m2 specs.Mount) bool {
-		return m1.Destination == m2.Destination && m1.Type != "tmpfs"
-	})
+// cfgDevptsMount ensures the sys container has a devpts mount at /dev/pts, as
+// needed for pseudo-terminal allocation (e.g., by sshd or the init system).
+// The mount is owned by the "tty" group of the container's rootfs. Mounts over
+// /dev/ptmx are removed, since /dev/ptmx must be a symlink to /dev/pts/ptmx
+// (libcontainer creates this symlink when it sets up /dev).
+func cfgDevptsMount(spec *specs.Spec) {
 
-	sysboxSystemdMounts = utils.MountSliceRemove(sysboxSystemdMounts, spec.Mounts, func(m1, m2 specs.Mount) bool {
-		return m1.Destination == m2.Destination && m2.Type == "tmpfs"
-	})
+	for _, m := range spec.Mounts {
+		if filepath.Clean(m.Destination) == "/dev/pts" {
+			return
+		}
+	}
+
+	var mounts []specs.Mount
+	for _, m := range spec.Mounts {
+		if filepath.Clean(m.Destination) == "/dev/ptmx" {
+			logrus.Warnf("ignoring mount over /dev/ptmx (source %s); it's a symlink to /dev/pts/ptmx", m.Source)
+			continue
+		}
+		mounts = append(mounts, m)
+	}
+	spec.Mounts = mounts
+
+	gid := defaultTtyGid
+	if spec.Root != nil {
+		gid = ttyGid(spec.Root.Path)
+	}
+
+	spec.Mounts = append(spec.Mounts, specs.Mount{
+		Destination: "/dev/pts",
+		Source:      "devpts",
+		Type:        "devpts",
+		Options:     []string{"nosuid", "noexec", "newinstance", "ptmxmode=0666", "mode=0620", fmt.Sprintf("gid=%d", gid)},
+	})
+}
+
+// ttyGid returns the gid of the "tty" group in the given rootfs's /etc/group
+// file, or the default tty gid if it can't be found.
+func ttyGid(rootfs string) int {
+	groupFile, err := securejoin.SecureJoin(rootfs, "/etc/group")
+	if err != nil {
+		return defaultTtyGid
+	}
+
+	groups, err := user.ParseGroupFileFilter(groupFile, func(g user.Group) bool {
+		return g.Name == "tty"
+	})
+	if err != nil || len(groups) == 0 {
+		return defaultTtyGid
+	}
+
+	return groups[0].Gid
+}
+
+// cfgDevMount ensures the sys container has a /dev tmpfs mount, a devpts mount
+// at /dev/pts (see cfgDevptsMount), a tmpfs mount at /dev/shm, and the basic device nodes. The size
+// of /dev/shm can be set via the "sysbox.io/dev-shm-size" annotation (e.g.,
+// "128m"); it defaults to 64MB for /dev/shm mounts added by Sysbox.
+func cfgDevMount(spec *specs.Spec) error {
+
+	shmSize := ""
+	if val, ok := spec.Annotations[devShmSizeAnnot]; ok {
+		size, err := units.RAMInBytes(val)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("invalid value for annotation %s: %s", devShmSizeAnnot, val)
+		}
+		shmSize = fmt.Sprintf("size=%d", size)
+	}
+
+	found := make(map[string]int)
+	for i, m := range spec.Mounts {
+		found[m.Destination] = i
+	}
+
+	if _, ok := found["/dev"]; !ok {
+		spec.Mounts = append(spec.Mounts, specs.Mount{
+			Destination: "/dev",
+			Source:      "tmpfs",
+			Type:        "tmpfs",
+			Options:     []string{"nosuid", "mode=0755"},
+		})
+	}
+
+	cfgDevptsMount(spec)
+
+	if i, ok := found["/dev/shm"]; ok {
+		if shmSize != "" {
+			m := &spec.Mounts[i]
+			if m.Type != "tmpfs" {
+				logrus.Warnf("ignoring annotation %s: /dev/shm is a %s mount", devShmSizeAnnot, m.Type)
+			} else {
+				opts := []string{}
+				for _, opt := range m.Options {
+					if !strings.HasPrefix(opt, "size=") {
+						opts = append(opts, opt)
+					}
+				}
+				m.Options = append(opts, shmSize)
+			}
+		}
+	} else {
+		if shmSize == "" {
+			shmSize = "size=" + defaultDevShmSize
+		}
+		spec.Mounts = append(spec.Mounts, specs.Mount{
+			Destination: "/dev/shm",
+			Source:      "shm",
+			Type:        "tmpfs",
+			Options:     []string{"nosuid", "noexec", "nodev", "mode=1777", shmSize},
+		})
+	}
+
+	for _, dev := range sysboxDevices {
+		devFound := false
+		for _, d := range spec.Linux.Devices {
+			if d.Path == dev.Path {
+				devFound = true
+				break
+			}
+		}
+		if devFound {
+			continue
+		}
+		for _, d := range specconv.AllowedDevices {
+			if d.Path == dev.Path {
+				devFound = true
+				break
+			}
+		}
+		if !devFound {
+			mode := os.FileMode(0666)
+			dev.FileMode = &mode
+			spec.Linux.Devices = append(spec.Linux.Devices, dev)
+		}
+	}
+
+	return nil
+}
+
+// cfgSysboxFsMounts adds the sysbox-fs mounts to the containers config. The
+// mounts have "rprivate" propagation, unless overridden via the
+// "sysbox.io/mount-propagation" annotation (e.g., "rslave" allows mount events
+// on them to propagate to mount namespaces created inside the container).
+// User mounts over vm sysctls (/proc/sys/vm/*) are ignored, unless allowed via
+// the "sysbox.io/allow-vm-sysctl-override" annotation. User mounts under the
+// sysboxFsBlockedPrefixes are always ignored. Optional sysbox-fs mounts whose
+// source does not exist (see sysboxFsOptionalMounts), and those the
+// container's OS doesn't need (see sysboxFsMountsFor), are skipped.
+func cfgSysboxFsMounts(spec *specs.Spec, sysFs *sysbox.Fs) error {
+
+	propagation, ok := spec.Annotations[mountPropagationAnnot]
+	if ok && !utils.StringSliceContains(sysboxFsPropagationModes, propagation) {
+		return fmt.Errorf("invalid value for annotation %s: %s (expected one of %v)",
+			mountPropagationAnnot, propagation, sysboxFsPropagationModes)
+	}
+
+	allowVmOverride := false
+	if val, ok := spec.Annotations[allowVmSysctlsAnnot]; ok {
+		switch val {
+		case "true":
+			allowVmOverride = true
+		case "false":
+		default:
+			return fmt.Errorf("invalid value for annotation %s: %s (must be \"true\" or \"false\")", allowVmSysctlsAnnot, val)
+		}
+	}
+
+	// User mounts over vm sysctls are only allowed via the annotation, in which
+	// case they replace the corresponding sysbox-fs mounts; other user mounts
+	// that conflict with sysbox-fs mounts are removed.
+	userVmMounts := make(map[string]bool)
+	mounts := []specs.Mount{}
+
+	for _, m := range spec.Mounts {
+		dest := filepath.Clean(m.Destination)
+		if isVmSysctlPath(dest) {
+			if allowVmOverride {
+				userVmMounts[dest] = true
+				mounts = append(mounts, m)
+			} else {
+				logrus.Warnf("ignoring mount at %s: vm sysctls are virtualized by sysbox-fs (see annotation %s)",
+					dest, allowVmSysctlsAnnot)
+			}
+			continue
+		}
+		if isSysboxFsBlockedPath(dest) {
+			logrus.Warnf("ignoring mount at %s: path is virtualized by sysbox-fs", dest)
+			continue
+		}
+		mounts = append(mounts, m)
+	}
+
+	spec.Mounts = utils.MountSliceRemove(mounts, sysboxFsMounts, func(m1, m2 specs.Mount) bool {
+		dest := filepath.Clean(m1.Destination)
+		return !userVmMounts[dest] && dest == filepath.Clean(m2.Destination)
+	})
+
+	// Adjust sysboxFsMounts path attending to container-id value.
+	cntrMountpoint := filepath.Join(SysboxFsDir, sysFs.Id)
+
+	if err := sysboxFsHealthCheck(cntrMountpoint); err != nil {
+		logrus.Warnf("%v", err)
+	}
+
+	for i := range sysboxFsMounts {
+		sysboxFsMounts[i].Source =
+			strings.Replace(
+				sysboxFsMounts[i].Source,
+				SysboxFsDir,
+				cntrMountpoint,
+				1,
+			)
+	}
+
+	// the mount list varies with the container's libc
+	osType := OSTypeUnknown
+	if spec.Root != nil {
+		osType = detectContainerOSType(spec.Root.Path)
+	}
+	logrus.Debugf("container os type: %s", osType)
+
+	start := len(spec.Mounts)
+	for _, m := range sysboxFsMountsFor(sysboxFsMounts, osType) {
+		if userVmMounts[filepath.Clean(m.Destination)] {
+			continue
+		}
+		if sysboxFsOptionalMounts[m.Destination] && !sysboxFsSourceExists(m.Source) {
+			logrus.Warnf("skipping sysbox-fs mount at %s: source %s not found", m.Destination, m.Source)
+			continue
+		}
+		spec.Mounts = append(spec.Mounts, m)
+	}
+
+	for i := start; i < len(spec.Mounts); i++ {
+		if propagation != "" {
+			setMountPropagation(&spec.Mounts[i], propagation)
+		}
+		if spec.Linux != nil {
+			applyMountLabel(&spec.Mounts[i], spec.Linux.MountLabel)
+		}
+	}
+
+	return nil
+}
+
+// isVmSysctlPath returns true if the given (clean) path is that of a vm sysctl
+// (i.e., under /proc/sys/vm/).
+func isVmSysctlPath(path string) bool {
+	return strings.HasPrefix(path, "/proc/sys/vm/")
+}
+
+// Sysbox-fs mounts that are skipped if sysbox-fs does not expose their source;
+// all others are required (i.e., their absence fails the container's
+// creation), as otherwise the container would see the host's procfs data.
+var sysboxFsOptionalMounts = map[string]bool{
+	"/proc/irq":         true,
+	"/proc/timer_stats": true,
+}
+
+// User mounts under these paths are not allowed, since they are backed by
+// sysbox-fs mounts (e.g., the /proc/irq dir).
+var sysboxFsBlockedPrefixes = []string{
+	"/proc/irq/",
+}
+
+// isSysboxFsBlockedPath returns true if the given (clean) path is under one of
+// the sysboxFsBlockedPrefixes.
+func isSysboxFsBlockedPath(path string) bool {
+	for _, prefix := range sysboxFsBlockedPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceable in tests
+var sysboxFsSourceExists = func(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Files read by the sysbox-fs health check, along with a sanity check of their
+// contents; these are among the files that back the container's sysbox-fs
+// mounts (see sysboxFsMounts).
+var sysboxFsHealthFiles = []struct {
+	path  string
+	check func(data string) error
+}{
+	{"proc/uptime", func(data string) error {
+		fields := strings.Fields(data)
+		if len(fields) != 2 {
+			return fmt.Errorf("want 2 fields, got %d", len(fields))
+		}
+		for _, f := range fields {
+			if _, err := strconv.ParseFloat(f, 64); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"proc/swaps", func(data string) error {
+		if !strings.HasPrefix(data, "Filename") {
+			return fmt.Errorf("no swaps header found")
+		}
+		return nil
+	}},
+	{"proc/sys/kernel/pid_max", func(data string) error {
+		_, err := strconv.Atoi(strings.TrimSpace(data))
+		return err
+	}},
+}
+
+const (
+	sysboxFsHealthReadSize = 256
+	sysboxFsHealthTimeout  = 500 * time.Millisecond
+)
+
+// replaceable in tests
+var sysboxFsHealthCheck = checkSysboxFsHealth
+
+// checkSysboxFsHealth checks that the files under the given sysbox-fs dir can
+// be read (within a timeout) and have sane contents; this way we detect an
+// unhealthy sysbox-fs before the container's mounts are backed by it. Note
+// that the files are read from sysbox-runc's (i.e., the host's) pid namespace
+// rather than the container's, so the check is advisory only.
+func checkSysboxFsHealth(sysboxFsDir string) error {
+	for _, hf := range sysboxFsHealthFiles {
+		path := filepath.Join(sysboxFsDir, hf.path)
+
+		data, err := readFileWithTimeout(path, sysboxFsHealthReadSize, sysboxFsHealthTimeout)
+		if err != nil {
+			return fmt.Errorf("sysbox-fs health check failed: %s: %v", path, err)
+		}
+
+		if err := hf.check(string(data)); err != nil {
+			return fmt.Errorf("sysbox-fs health check failed: %s: unexpected contents: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// readFileWithTimeout reads up to size bytes from the given file; it fails if
+// this can't be done within the given timeout.
+func readFileWithTimeout(path string, size int, timeout time.Duration) ([]byte, error) {
+
+	type result struct {
+		data []byte
+		err  error
+	}
+
+	// buffered so the reader does not leak if we time out
+	done := make(chan result, 1)
+
+	go func() {
+		f, err := os.Open(path)
+		if err != nil {
+			done <- result{nil, err}
+			return
+		}
+		defer f.Close()
+
+		buf := make([]byte, size)
+		n, err := f.Read(buf)
+		if err != nil && err != io.EOF {
+			done <- result{nil, err}
+			return
+		}
+		done <- result{buf[:n], nil}
+	}()
+
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("timed out reading file")
+	}
+}
+
+// Propagation modes allowed for the sysbox-fs mounts
+var sysboxFsPropagationModes = []string{"rprivate", "rslave", "rshared"}
+
+// Mount options that set the mount propagation
+var propagationOpts = []string{
+	"private", "rprivate", "slave", "rslave", "shared", "rshared", "unbindable", "runbindable",
+}
+
+// setMountPropagation replaces the propagation option of the given mount (the
+// mount's options slice is copied as it may be shared).
+func setMountPropagation(mount *specs.Mount, propagation string) {
+	opts := make([]string, 0, len(mount.Options)+1)
+	for _, opt := range mount.Options {
+		if !utils.StringSliceContains(propagationOpts, opt) {
+			opts = append(opts, opt)
+		}
+	}
+	mount.Options = append(opts, propagation)
+}
+
+// cfgNetSysctls adds to the spec the network sysctls in the
+// "sysbox.io/net-sysctls" annotation (a comma-separated list of "key=value"
+// pairs, e.g., "net.ipv4.ip_forward=1"). Sysctls already in the spec take
+// priority. Only "net." sysctls are allowed, as these are scoped by the
+// container's network namespace.
+func cfgNetSysctls(spec *specs.Spec) error {
+	val, ok := spec.Annotations[netSysctlsAnnot]
+	if !ok {
+		return nil
+	}
+
+	sysctls := make(map[string]string)
+	for _, kv := range strings.Split(val, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		fields := strings.SplitN(kv, "=", 2)
+		if len(fields) != 2 || fields[1] == "" {
+			return fmt.Errorf("invalid sysctl %q in annotation %s (expected key=value)", kv, netSysctlsAnnot)
+		}
+		key := strings.TrimSpace(fields[0])
+		if !strings.HasPrefix(key, "net.") {
+			return fmt.Errorf("sysctl %s in annotation %s is not a network sysctl", key, netSysctlsAnnot)
+		}
+		sysctls[key] = strings.TrimSpace(fields[1])
+	}
+
+	if spec.Linux.Sysctl == nil {
+		spec.Linux.Sysctl = make(map[string]string)
+	}
+
+	for key, v := range sysctls {
+		if _, ok := spec.Linux.Sysctl[key]; ok {
+			continue
+		}
+		spec.Linux.Sysctl[key] = v
+	}
+
+	return nil
+}
+
+// applyMountLabel adds the SELinux context mount option for the given label to
+// the given mount (if it's a bind mount), so that the kernel labels the mounted
+// files accordingly. No-op if the label is empty (i.e., SELinux not in use).
+func applyMountLabel(mount *specs.Mount, label string) {
+	if label == "" {
+		return
+	}
+
+	isBind := mount.Type == "bind"
+	for _, opt := range mount.Options {
+		if opt == "bind" || opt == "rbind" {
+			isBind = true
+		}
+		if strings.HasPrefix(opt, "context=") {
+			return
+		}
+	}
+
+	if !isBind {
+		return
+	}
+
+	// copy the options, as they may be shared with other mounts
+	opts := make([]string, len(mount.Options), len(mount.Options)+1)
+	copy(opts, mount.Options)
+	mount.Options = append(opts, fmt.Sprintf("context=%q", label))
+}
+
+// validateMountLabel checks that the given SELinux mount label has the
+// "user:role:type:level" format.
+func validateMountLabel(label string) error {
+	if label == "" {
+		return nil
+	}
+
+	// the level may itself contain ":" (e.g., "s0:c1,c2")
+	fields := strings.SplitN(label, ":", 4)
+	if len(fields) != 4 {
+		return fmt.Errorf("invalid mount label %q: must have the format user:role:type:level", label)
+	}
+
+	for _, f := range fields {
+		if f == "" {
+			return fmt.Errorf("invalid mount label %q: must have the format user:role:type:level", label)
+		}
+	}
+
+	return nil
+}
+
+// cfgSystemdMounts adds systemd related mounts to the spec
+func cfgSystemdMounts(spec *specs.Spec) {
+
+	// For sys containers with systemd inside, sysbox mounts tmpfs over certain directories
+	// of the container (this is a systemd requirement). However, if the container spec
+	// already has tmpfs mounts over any of these directories, we honor the spec mounts
+	// (i.e., these override the sysbox mount).
+
+	spec.Mounts = utils.MountSliceRemove(spec.Mounts, sysboxSystemdMounts, func(m1, m2 specs.Mount) bool {
+		return m1.Destination == m2.Destination && m1.Type != "tmpfs"
+	})
+
+	sysboxSystemdMounts = utils.MountSliceRemove(sysboxSystemdMounts, spec.Mounts, func(m1, m2 specs.Mount) bool {
+		return m1.Destination == m2.Destination && m2.Type == "tmpfs"
+	})
+
+	spec.Mounts = append(spec.Mounts, sysboxSystemdMounts...)
+}
+
+// sysMgrSetupMounts requests the sysbox-mgr to setup special sys container mounts.
+func sysMgrSetupMounts(mgr *sysbox.Mgr, spec *specs.Spec, uidShiftRootfs bool, supOpts supMountsOpts) error {
+
+	// These directories in the sys container are bind-mounted from host dirs managed by sysbox-mgr
+	specialDir := map[string]ipcLib.MntKind{
+		"/var/lib/docker":      ipcLib.MntVarLibDocker,
+		"/var/lib/kubelet":     ipcLib.MntVarLibKubelet,
+		"/var/lib/rancher/k3s": ipcLib.MntVarLibK3s,
+		"/var/lib/containerd/io.containerd.snapshotter.v1.overlayfs": ipcLib.MntVarLibContainerdOvfs,
+	}
+
+	uid := spec.Linux.UIDMappings[0].HostID
+	gid := spec.Linux.GIDMappings[0].HostID
+
+	// If the spec has a bind-mount over one of the special dirs, ask the
+	// sysbox-mgr to prepare the mount source (e.g., chown files to match the
+	// container host uid & gid).
+	prepList := []ipcLib.MountPrepInfo{}
+
+	for i := len(spec.Mounts) - 1; i >= 0; i-- {
+
+		m := spec.Mounts[i]
+		_, isSpecialDir := specialDir[m.Destination]
+
+		if m.Type == "bind" && isSpecialDir {
+			info := ipcLib.MountPrepInfo{
+				Source:    m.Source,
+				Exclusive: true,
+			}
+
+			prepList = append(prepList, info)
+			delete(specialDir, m.Destination)
+		}
+	}
+
+	if len(prepList) > 0 {
+		if err := mgr.PrepMounts(uid, gid, prepList); err != nil {
+			return err
+		}
+	}
+
+	// Otherwise, add the special dir to the list of mounts that we will request
+	// sysbox-mgr to setup
+	reqList := []ipcLib.MountReqInfo{}
+	for dest, kind := range specialDir {
+		info := ipcLib.MountReqInfo{
+			Kind: kind,
+			Dest: dest,
+		}
+		reqList = append(reqList, info)
+	}
+
+	// sysbox-mgr will setup host dirs to back the mounts in the
+	// request list; it will also send us any other mounts it needs.
+	rootPath, err := filepath.Abs(spec.Root.Path)
+	if err != nil {
+		return err
+	}
+
+	expected := []string{}
+	for _, info := range reqList {
+		expected = append(expected, info.Dest)
+	}
+	sort.Strings(expected)
+
+	logrus.Debugf("requesting mounts from sysbox-mgr: %v", expected)
+
+	m, err := mgr.ReqMounts(rootPath, uid, gid, uidShiftRootfs, reqList)
+	m, err = supMountsResult(m, err, supOpts.partialOk)
+	if err != nil {
+		return fmt.Errorf("%v (expected mounts: %v)", err, expected)
+	}
+
+	m, err = applySupMountOverrides(spec, m)
+	if err != nil {
+		return err
+	}
+
+	// If any sysbox-mgr mounts conflict with any in the spec (i.e.,
+	// same dest), prioritize the spec ones
+	mounts := utils.MountSliceRemove(m, spec.Mounts, func(m1, m2 specs.Mount) bool {
+		return m1.Destination == m2.Destination
+	})
+
+	for i := range mounts {
+		applyMountLabel(&mounts[i], spec.Linux.MountLabel)
+	}
+
+	if supOpts.remap {
+		mounts, err = cfgRemapSupMounts(spec, uid, gid, mounts)
+		if err != nil {
+			return err
+		}
+	}
+
+	spec.Mounts = append(spec.Mounts, mounts...)
+
+	return nil
+}
+
+// cfgRemapSupMounts remaps the ownership of the given sysbox-mgr supplementary
+// mounts to the container's root user (uid & gid), such that their files don't
+// show up as owned by nobody:nogroup inside the container. This is done by
+// chowning the mount sources via a prestart hook; ID-mapped mounts would avoid
+// changing the sources, but libcontainer does not support them yet.
+func cfgRemapSupMounts(spec *specs.Spec, uid, gid uint32, mounts []specs.Mount) ([]specs.Mount, error) {
+
+	srcs := []string{}
+	for _, m := range mounts {
+		if m.Type != "bind" {
+			continue
+		}
+		if !filepath.IsAbs(m.Source) {
+			return nil, fmt.Errorf("supplementary mount at %s has a non-absolute source %s", m.Destination, m.Source)
+		}
+		srcs = append(srcs, m.Source)
+	}
+
+	if len(srcs) == 0 {
+		return mounts, nil
+	}
+
+	cmd := fmt.Sprintf("chown -R %d:%d --", uid, gid)
+	for _, src := range srcs {
+		cmd += " " + shellQuote(src)
+	}
+
+	if err := NewHookManager(spec).AppendHook(HookPrestart, supMountChownHookID, cmd); err != nil {
+		return nil, err
+	}
+
+	return mounts, nil
+}
+
+// applySupMountOverrides replaces the source and options of the given
+// sysbox-mgr supplementary mounts per the "sysbox.io/sup-mount-override/<dest>"
+// annotations, whose value is a JSON-encoded mount (e.g.,
+// {"source": "/data/docker", "options": ["rbind", "rprivate"]}). Overrides are
+// only allowed for destinations setup by sysbox-mgr.
+func applySupMountOverrides(spec *specs.Spec, mounts []specs.Mount) ([]specs.Mount, error) {
+
+	for key, val := range spec.Annotations {
+		if !strings.HasPrefix(key, supMountOverridePrefix) {
+			continue
+		}
+
+		dest := filepath.Clean("/" + strings.TrimPrefix(key, supMountOverridePrefix))
+
+		var override specs.Mount
+		if err := json.Unmarshal([]byte(val), &override); err != nil {
+			return nil, fmt.Errorf("invalid value for annotation %s: %v", key, err)
+		}
+
+		if override.Destination != "" && filepath.Clean(override.Destination) != dest {
+			return nil, fmt.Errorf("invalid value for annotation %s: destination %s does not match %s",
+				key, override.Destination, dest)
+		}
+
+		if !filepath.IsAbs(override.Source) {
+			return nil, fmt.Errorf("invalid value for annotation %s: source must be an absolute path", key)
+		}
+
+		found := false
+		for i := range mounts {
+			if filepath.Clean(mounts[i].Destination) != dest {
+				continue
+			}
+
+			logrus.Warnf("overriding supplementary mount at %s: source %s -> %s",
+				dest, mounts[i].Source, override.Source)
+
+			mounts[i].Source = override.Source
+			if override.Options != nil {
+				mounts[i].Options = override.Options
+			}
+			found = true
+		}
+
+		if !found {
+			return nil, fmt.Errorf("invalid annotation %s: %s is not a supplementary mount setup by sysbox-mgr", key, dest)
+		}
+	}
+
+	return mounts, nil
+}
+
+// supMountsResult handles the result of a mount request to sysbox-mgr. If the
+// request failed after sysbox-mgr setup some of the mounts, and partialOk is
+// set, the failure is logged and the partial mounts are returned.
+func supMountsResult(mounts []specs.Mount, err error, partialOk bool) ([]specs.Mount, error) {
+	if err == nil {
+		return mounts, nil
+	}
+
+	var smErr *sysbox.SupMountsError
+	if !partialOk || !errors.As(err, &smErr) || len(smErr.Mounts) == 0 {
+		return nil, err
+	}
+
+	logrus.Warnf("%v; continuing with the partial mounts", err)
+
+	return smErr.Mounts, nil
+}
+
+// Host files from which the sys container's /etc/hosts and /etc/resolv.conf are
+// generated, and the dir where the generated files are placed (replaceable in tests).
+var (
+	hostEtcHosts      = "/etc/hosts"
+	hostEtcResolvConf = "/etc/resolv.conf"
+	sysboxRunDir      = SysboxRunDir
+)
+
+// Nameserver added to the sys container's resolv.conf, for use by inner DNS
+// resolvers (e.g., systemd-resolved).
+const innerNameserver = "127.0.0.53"
+
+// Max length of a hostname (HOST_NAME_MAX)
+const hostNameMax = 64
+
+// cfgHostsAndResolvConf bind-mounts container specific copies of the host's
+// /etc/hosts and /etc/resolv.conf into the sys container, such that the
+// container does not see the host's hostname or DNS config. The copies are
+// generated by genHostsAndResolvConf() once the spec conversion succeeds, and
+// removed along with the container's run dir (see RemoveRunDir()). Paths for
+// which the spec already has a mount are left untouched. The container's
+// hostname defaults to its ID, rather than the host's hostname.
+func cfgHostsAndResolvConf(spec *specs.Spec, containerID string) error {
+	var hostsMount, resolvMount bool = true, true
+
+	if spec.Hostname == "" {
+		spec.Hostname = containerID
+		if len(spec.Hostname) > hostNameMax {
+			spec.Hostname = spec.Hostname[:hostNameMax]
+		}
+	}
+
+	for _, m := range spec.Mounts {
+		switch filepath.Clean(m.Destination) {
+		case "/etc/hosts":
+			hostsMount = false
+		case "/etc/resolv.conf":
+			resolvMount = false
+		}
+	}
+
+	etcDir := filepath.Join(sysboxRunDir, containerID, "etc")
+
+	if hostsMount {
+		spec.Mounts = append(spec.Mounts, specs.Mount{
+			Destination: "/etc/hosts",
+			Source:      filepath.Join(etcDir, "hosts"),
+			Type:        "bind",
+			Options:     []string{"rbind", "rprivate"},
+		})
+	}
+
+	if resolvMount {
+		spec.Mounts = append(spec.Mounts, specs.Mount{
+			Destination: "/etc/resolv.conf",
+			Source:      filepath.Join(etcDir, "resolv.conf"),
+			Type:        "bind",
+			Options:     []string{"rbind", "rprivate"},
+		})
+	}
+
+	return nil
+}
+
+// genHostsAndResolvConf generates the container specific /etc/hosts and
+// /etc/resolv.conf files bind-mounted into the sys container by
+// cfgHostsAndResolvConf().
+func genHostsAndResolvConf(spec *specs.Spec, containerID string) error {
+	etcDir := filepath.Join(sysboxRunDir, containerID, "etc")
+	hosts := filepath.Join(etcDir, "hosts")
+	resolv := filepath.Join(etcDir, "resolv.conf")
+
+	for _, m := range spec.Mounts {
+		if m.Source != hosts && m.Source != resolv {
+			continue
+		}
+
+		if err := os.MkdirAll(etcDir, 0755); err != nil {
+			return fmt.Errorf("failed to create dir %s: %v", etcDir, err)
+		}
+
+		if m.Source == hosts {
+			if err := genEtcHosts(hostEtcHosts, hosts, spec.Hostname); err != nil {
+				return err
+			}
+		} else {
+			if err := genResolvConf(hostEtcResolvConf, resolv); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// RemoveRunDir removes the given container's sysbox run dir, where the files
+// generated for the container (e.g., its /etc/hosts) are placed.
+func RemoveRunDir(containerID string) error {
+	return os.RemoveAll(filepath.Join(sysboxRunDir, containerID))
+}
+
+// genEtcHosts copies the given hosts file to dst, replacing the host's
+// hostname with the container's hostname.
+func genEtcHosts(src, dst, hostname string) error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", src, err)
+	}
+
+	hostHostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get hostname: %v", err)
+	}
+
+	lines := strings.Split(string(data), "\n")
+
+	if hostname != "" && hostHostname != "" {
+		for i, line := range lines {
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+			fields := strings.Fields(line)
+			for j := 1; j < len(fields); j++ {
+				if fields[j] == hostHostname {
+					fields[j] = hostname
+					lines[i] = strings.Join(fields, "\t")
+				}
+			}
+		}
+	}
+
+	if err := ioutil.WriteFile(dst, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", dst, err)
+	}
+
+	return nil
+}
+
+// genResolvConf copies the given resolv.conf file to dst, adding the inner
+// nameserver as the first nameserver.
+func genResolvConf(src, dst string) error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %v", src, err)
+	}
+
+	nsLine := "nameserver " + innerNameserver
+	out := []string{nsLine}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == nsLine {
+			continue
+		}
+		out = append(out, line)
+	}
+
+	if err := ioutil.WriteFile(dst, []byte(strings.Join(out, "\n")), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", dst, err)
+	}
+
+	return nil
+}
+
+// netIsolationChain returns the name of the iptables chain dedicated to the
+// given container. It's derived from a hash of the container ID, since chain
+// names are limited to 28 chars (XT_EXTENSION_MAXNAMELEN - 1) and truncated
+// IDs may collide.
+func netIsolationChain(containerID string) string {
+	sum := sha256.Sum256([]byte(containerID))
+	return "SYSBOX-" + hex.EncodeToString(sum[:])[:16]
+}
+
+// netIsolationSetupCmd returns the shell command that creates the container's
+// iptables chains and jumps to them from the FORWARD chain for traffic coming
+// from the container's veth interface. It's meant to run as a prestart hook,
+// which receives the container's state (including the container's init pid)
+// on stdin; the host-side veth is the peer of the container's eth0. The hook
+// fails if any step fails (or the veth is not found).
+func netIsolationSetupCmd(chain string) string {
+	return strings.Join([]string{
+		"set -e",
+		`pid=$(sed -n 's/.*"pid":\([0-9]*\).*/\1/p')`,
+		`[ -n "$pid" ] || { echo "container pid not found in state" >&2; exit 1; }`,
+		`iflink=$(nsenter --net=/proc/$pid/ns/net ip -o link show eth0 | sed -n 's/.*@if\([0-9]*\).*/\1/p')`,
+		`veth=$(ip -o link | sed -n "s/^$iflink: \([^:@]*\).*/\1/p")`,
+		`[ -n "$iflink" ] && [ -n "$veth" ] || { echo "container veth not found" >&2; exit 1; }`,
+		fmt.Sprintf("iptables -N %s", chain),
+		fmt.Sprintf("ip6tables -N %s", chain),
+		fmt.Sprintf("iptables -I FORWARD -i $veth -j %s", chain),
+		fmt.Sprintf("ip6tables -I FORWARD -i $veth -j %s", chain),
+	}, "\n")
+}
+
+// netIsolationCleanupCmd returns the shell command that removes the
+// container's iptables chains (and the FORWARD rules that jump to them). The
+// hook fails if any step fails; chains that don't exist (e.g., because the
+// setup hook failed) are skipped.
+func netIsolationCleanupCmd(chain string) string {
+	cmds := []string{"set -e"}
+
+	for _, ipt := range []string{"iptables", "ip6tables"} {
+		cmds = append(cmds,
+			fmt.Sprintf(`if %s -n -L %s >/dev/null 2>&1; then`, ipt, chain),
+			fmt.Sprintf(`%s -S FORWARD | grep -- "-j %s$" | sed 's/^-A/-D/' | while read -r rule; do %s $rule; done`, ipt, chain, ipt),
+			fmt.Sprintf("%s -F %s", ipt, chain),
+			fmt.Sprintf("%s -X %s", ipt, chain),
+			"fi")
+	}
+
+	return strings.Join(cmds, "\n")
+}
+
+// cfgNetworkIsolation sets up hooks that create (and later remove) dedicated
+// iptables chains for the sys container on the host, such that the host's
+// iptables rules don't interfere with the NAT rules of inner containers (e.g.,
+// an inner Kubernetes cluster). Only done when the network isolation
+// annotation is set to "strict".
+func cfgNetworkIsolation(spec *specs.Spec, containerID string) error {
+	val, ok := spec.Annotations[netIsolationAnnot]
+	if !ok {
+		return nil
+	}
+
+	if val != "strict" {
+		return fmt.Errorf("invalid value for annotation %s: %s (expected \"strict\")", netIsolationAnnot, val)
+	}
+
+	chain := netIsolationChain(containerID)
+
+	hm := NewHookManager(spec)
+
+	if err := hm.AppendHook(HookPrestart, netIsolationSetupHookID, netIsolationSetupCmd(chain)); err != nil {
+		return err
+	}
+
+	return hm.AppendHook(HookPoststop, netIsolationCleanupHookID, netIsolationCleanupCmd(chain))
+}
+
+// cfgNetSysfs makes the sys container's /sys/class/net read-only when the
+// "sysbox.io/readonly-net-sysfs" annotation is "true".
+//
+// Since the container's sysfs is mounted from within the container's network
+// namespace, its /sys/class/net already shows the container's interfaces; spec
+// mounts over it (which would expose the host's view) are thus dropped. The
+// dir is made read-only via the spec's readonly paths, which are remounted
+// read-only in the container's mount namespace.
+func cfgNetSysfs(spec *specs.Spec) error {
+	val, ok := spec.Annotations[readonlyNetSysfsAnnot]
+	if !ok {
+		return nil
+	}
+
+	switch val {
+	case "false":
+		return nil
+	case "true":
+	default:
+		return fmt.Errorf("invalid value for annotation %s: %s (must be \"true\" or \"false\")", readonlyNetSysfsAnnot, val)
+	}
+
+	var netSysfsMount = []specs.Mount{
+		specs.Mount{
+			Destination: netSysfsPath,
+		},
+	}
+
+	spec.Mounts = utils.MountSliceRemove(spec.Mounts, netSysfsMount, func(m1, m2 specs.Mount) bool {
+		dest := filepath.Clean(m1.Destination)
+		if dest == m2.Destination || strings.HasPrefix(dest, m2.Destination+"/") {
+			logrus.Debugf("ignoring spec mount over %s (sysbox sets up %s)", m1.Destination, m2.Destination)
+			return true
+		}
+		return false
+	})
+
+	if !utils.StringSliceContains(spec.Linux.ReadonlyPaths, netSysfsPath) {
+		spec.Linux.ReadonlyPaths = append(spec.Linux.ReadonlyPaths, netSysfsPath)
+	}
+
+	return nil
+}
+
+// The container's network interfaces dir in sysfs
+const netSysfsPath = "/sys/class/net"
+
+// Name of the container's network interface, as set up by the container manager
+const defaultNetIface = "eth0"
+
+// Chars allowed in network interface names; the kernel allows more (anything
+// but '/', ':' and whitespace), but we restrict them as the name is passed to
+// a shell hook.
+var netIfaceNameRe = regexp.MustCompile(`^[a-zA-Z0-9_.@-]+$`)
+
+// validateNetIfaceName checks that the given name is a valid Linux network
+// interface name.
+func validateNetIfaceName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("invalid interface name %q", name)
+	}
+	if len(name) >= unix.IFNAMSIZ {
+		return fmt.Errorf("interface name %q is too long (max %d chars)", name, unix.IFNAMSIZ-1)
+	}
+	if !netIfaceNameRe.MatchString(name) {
+		return fmt.Errorf("interface name %q contains invalid chars", name)
+	}
+	return nil
+}
+
+// cfgNetworkIfaceRename renames the sys container's network interface per the
+// net-iface-name annotation (e.g., so that it matches the CNI config of an
+// inner Kubernetes cluster). This is done via a createRuntime hook, as the
+// interface is only placed in the container's network namespace by then.
+func cfgNetworkIfaceRename(spec *specs.Spec) error {
+	name, ok := spec.Annotations[netIfaceNameAnnot]
+	if !ok {
+		return nil
+	}
+
+	if err := validateNetIfaceName(name); err != nil {
+		return fmt.Errorf("invalid value for annotation %s: %v", netIfaceNameAnnot, err)
+	}
+
+	// never rename the host's interfaces
+	ownNetns := false
+	if spec.Linux != nil {
+		for _, ns := range spec.Linux.Namespaces {
+			if ns.Type == specs.NetworkNamespace {
+				ownNetns = true
+				break
+			}
+		}
+	}
+	if !ownNetns {
+		return fmt.Errorf("annotation %s requires the container to have a network namespace", netIfaceNameAnnot)
+	}
+
+	if name == defaultNetIface {
+		return nil
+	}
+
+	return NewHookManager(spec).AppendHook(HookCreateRuntime, netIfaceRenameHookID, netIfaceRenameCmd(defaultNetIface, name))
+}
+
+// netIfaceRenameCmd returns the shell command that renames the given network
+// interface in the container's network namespace (the interface must be down
+// to be renamed, so it's brought back up afterwards). It's meant to run as a
+// createRuntime hook, which receives the container's state (including the
+// container's init pid) on stdin.
+func netIfaceRenameCmd(from, to string) string {
+	return strings.Join([]string{
+		`pid=$(sed -n 's/.*"pid":\([0-9]*\).*/\1/p')`,
+		fmt.Sprintf(`nsenter --target $pid --net sh -c 'ip link set "%s" down && ip link set "%s" name "%s" && ip link set "%s" up'`, from, from, to, to),
+	}, "\n")
+}
+
+// RFC1918 private IPv4 networks
+var privateNets = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}
+
+// hostBridgeNets returns the IPv4 networks of the host's bridge interfaces
+// (replaceable in tests).
+var hostBridgeNets = func() ([]*net.IPNet, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, err
+	}
+
+	nets := []*net.IPNet{}
+	for _, link := range links {
+		if link.Type() != "bridge" {
+			continue
+		}
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			nets = append(nets, &net.IPNet{IP: addr.IP.Mask(addr.Mask), Mask: addr.Mask})
+		}
+	}
+
+	return nets, nil
+}
+
+// cfgInnerNetworkIsolation configures the networks of the Docker daemon inside
+// the sys container: the subnet of its bridge, per the
+// "sysbox.io/inner-docker-bridge-subnet" annotation, and its default address
+// pools, per the "sysbox.io/docker-address-pools" annotation. This avoids
+// conflicts between the inner Docker networks and the host's bridges (or those
+// of other sys containers). The container's /etc/docker/daemon.json is
+// generated (preserving any existing settings in the container image) and
+// bind-mounted into the container.
+func cfgInnerNetworkIsolation(spec *specs.Spec, containerID string) error {
+	settings := make(map[string]interface{})
+
+	if val, ok := spec.Annotations[innerDockerBridgeAnnot]; ok {
+		bip, err := validateInnerBridgeSubnet(val)
+		if err != nil {
+			return fmt.Errorf("invalid value for annotation %s: %v", innerDockerBridgeAnnot, err)
+		}
+		settings["bip"] = bip
+	}
+
+	if err := cfgInnerDockerAddressPools(spec, settings); err != nil {
+		return err
+	}
+
+	if len(settings) == 0 {
+		return nil
+	}
+
+	// honor user mounts over the docker config
+	for _, m := range spec.Mounts {
+		dest := filepath.Clean(m.Destination)
+		if dest == "/etc/docker" || dest == "/etc/docker/daemon.json" {
+			logrus.Warnf("ignoring annotations %s and %s: spec has a mount over %s",
+				innerDockerBridgeAnnot, dockerAddrPoolsAnnot, dest)
+			return nil
+		}
+	}
+
+	rootfsCfg, err := securejoin.SecureJoin(spec.Root.Path, "/etc/docker/daemon.json")
+	if err != nil {
+		return err
+	}
+
+	cur, err := ioutil.ReadFile(rootfsCfg)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %v", rootfsCfg, err)
+	}
+
+	data, err := genDockerDaemonCfg(cur, settings)
+	if err != nil {
+		return err
+	}
+
+	dockerDir := filepath.Join(sysboxRunDir, containerID, "etc", "docker")
+	if err := os.MkdirAll(dockerDir, 0755); err != nil {
+		return fmt.Errorf("failed to create dir %s: %v", dockerDir, err)
+	}
+
+	dst := filepath.Join(dockerDir, "daemon.json")
+	if err := ioutil.WriteFile(dst, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", dst, err)
+	}
+
+	spec.Mounts = append(spec.Mounts, specs.Mount{
+		Destination: "/etc/docker/daemon.json",
+		Source:      dst,
+		Type:        "bind",
+		Options:     []string{"rbind", "rprivate"},
+	})
+
+	return nil
+}
+
+// validateInnerBridgeSubnet checks that the given subnet (in CIDR notation) is
+// an RFC1918 private network that does not overlap with the host's bridges.
+// It returns the corresponding Docker bridge IP (i.e., the subnet's first host
+// address, in CIDR notation).
+func validateInnerBridgeSubnet(cidr string) (string, error) {
+	ip, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+
+	if ip.To4() == nil {
+		return "", fmt.Errorf("%s is not an IPv4 subnet", cidr)
+	}
+
+	ones, bits := subnet.Mask.Size()
+	if bits-ones < 2 {
+		return "", fmt.Errorf("subnet %s is too small", cidr)
+	}
+
+	if !isPrivateSubnet(subnet) {
+		return "", fmt.Errorf("subnet %s is not a private (RFC1918) network", cidr)
+	}
+
+	if err := checkHostBridgeOverlap(subnet); err != nil {
+		return "", err
+	}
+
+	gw := make(net.IP, len(subnet.IP.To4()))
+	copy(gw, subnet.IP.To4())
+	gw[3]++
+
+	return fmt.Sprintf("%s/%d", gw, ones), nil
+}
+
+// isPrivateSubnet returns true if the given subnet is within an RFC1918
+// private network.
+func isPrivateSubnet(subnet *net.IPNet) bool {
+	ones, _ := subnet.Mask.Size()
+	for _, p := range privateNets {
+		_, pnet, _ := net.ParseCIDR(p)
+		pones, _ := pnet.Mask.Size()
+		if pnet.Contains(subnet.IP) && ones >= pones {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHostBridgeOverlap returns an error if the given subnet overlaps with
+// the network of any of the host's bridges.
+func checkHostBridgeOverlap(subnet *net.IPNet) error {
+	bridgeNets, err := hostBridgeNets()
+	if err != nil {
+		return fmt.Errorf("failed to get host bridge networks: %v", err)
+	}
+
+	for _, bnet := range bridgeNets {
+		if IPRangeOverlap(bnet, subnet) {
+			return fmt.Errorf("subnet %s overlaps with host bridge network %s", subnet, bnet)
+		}
+	}
+
+	return nil
+}
+
+// IPRangeOverlap returns true if the given networks have addresses in common.
+func IPRangeOverlap(a, b *net.IPNet) bool {
+	aNet := &net.IPNet{IP: a.IP.Mask(a.Mask), Mask: a.Mask}
+	bNet := &net.IPNet{IP: b.IP.Mask(b.Mask), Mask: b.Mask}
+	return aNet.Contains(bNet.IP) || bNet.Contains(aNet.IP)
+}
+
+// hostRoutes returns the destination networks of the host's routes, excluding
+// default routes (replaceable in tests).
+var hostRoutes = func() ([]*net.IPNet, error) {
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+
+	nets := []*net.IPNet{}
+	for _, r := range routes {
+		if r.Dst == nil {
+			continue
+		}
+		if ones, _ := r.Dst.Mask.Size(); ones == 0 {
+			continue
+		}
+		nets = append(nets, r.Dst)
+	}
+
+	return nets, nil
+}
+
+// CIDRConflictError is returned when a network configured for the sys
+// container conflicts with the host's networks.
+type CIDRConflictError struct {
+	Annotation string       // annotation that configures the network
+	CIDR       *net.IPNet   // the network
+	Conflicts  []*net.IPNet // the host networks it overlaps with
+}
+
+func (e *CIDRConflictError) Error() string {
+	conflicts := make([]string, 0, len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		conflicts = append(conflicts, c.String())
+	}
+	return fmt.Sprintf("%s %s overlaps with host network(s) %s", e.Annotation, e.CIDR, strings.Join(conflicts, ", "))
+}
+
+// cfgInnerKubeCIDRConflict checks that the pod and service networks of the
+// Kubernetes cluster inside the sys container (per the
+// "sysbox.io/inner-kube-pod-cidr" and "sysbox.io/inner-kube-svc-cidr"
+// annotations) don't overlap each other or the networks the host has routes
+// to; otherwise inner pods would not be able to reach those networks.
+func cfgInnerKubeCIDRConflict(spec *specs.Spec) error {
+	cidrs := make(map[string]*net.IPNet)
+
+	for _, annot := range []string{innerKubePodCIDRAnnot, innerKubeSvcCIDRAnnot} {
+		val, ok := spec.Annotations[annot]
+		if !ok {
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(val)
+		if err != nil {
+			return fmt.Errorf("invalid value for annotation %s: %v", annot, err)
+		}
+		cidrs[annot] = cidr
+	}
+
+	if len(cidrs) == 0 {
+		return nil
+	}
+
+	podCIDR, svcCIDR := cidrs[innerKubePodCIDRAnnot], cidrs[innerKubeSvcCIDRAnnot]
+	if podCIDR != nil && svcCIDR != nil && IPRangeOverlap(podCIDR, svcCIDR) {
+		return fmt.Errorf("inner kubernetes pod network %s overlaps with service network %s", podCIDR, svcCIDR)
+	}
+
+	routes, err := hostRoutes()
+	if err != nil {
+		return fmt.Errorf("failed to get host routes: %v", err)
+	}
+
+	for _, annot := range []string{innerKubePodCIDRAnnot, innerKubeSvcCIDRAnnot} {
+		cidr, ok := cidrs[annot]
+		if !ok {
+			continue
+		}
+
+		var conflicts []*net.IPNet
+		for _, r := range routes {
+			if IPRangeOverlap(cidr, r) {
+				conflicts = append(conflicts, r)
+			}
+		}
+
+		if len(conflicts) > 0 {
+			return &CIDRConflictError{Annotation: annot, CIDR: cidr, Conflicts: conflicts}
+		}
+	}
+
+	return nil
+}
+
+// Size of the networks that the inner Docker allocates from its default
+// address pools (unless the pool itself is smaller).
+const innerDockerPoolNetSize = 24
+
+// cfgInnerDockerAddressPools sets the "default-address-pools" of the inner
+// Docker daemon config (in the given settings) per the
+// "sysbox.io/docker-address-pools" annotation, a JSON array of private subnets
+// in CIDR notation (e.g., ["10.10.0.0/16", "10.20.0.0/16"]).
+func cfgInnerDockerAddressPools(spec *specs.Spec, settings map[string]interface{}) error {
+	val, ok := spec.Annotations[dockerAddrPoolsAnnot]
+	if !ok {
+		return nil
+	}
+
+	var cidrs []string
+	if err := json.Unmarshal([]byte(val), &cidrs); err != nil {
+		return fmt.Errorf("invalid value for annotation %s: %v", dockerAddrPoolsAnnot, err)
+	}
+
+	if len(cidrs) == 0 {
+		return fmt.Errorf("invalid value for annotation %s: no address pools", dockerAddrPoolsAnnot)
+	}
+
+	pools := []map[string]interface{}{}
+	subnets := []*net.IPNet{}
+
+	for _, cidr := range cidrs {
+		ip, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid value for annotation %s: %v", dockerAddrPoolsAnnot, err)
+		}
+		if ip.To4() == nil || !isPrivateSubnet(subnet) {
+			return fmt.Errorf("invalid value for annotation %s: %s is not a private (RFC1918) IPv4 network",
+				dockerAddrPoolsAnnot, cidr)
+		}
+		for _, s := range subnets {
+			if s.Contains(subnet.IP) || subnet.Contains(s.IP) {
+				return fmt.Errorf("invalid value for annotation %s: address pools %s and %s overlap",
+					dockerAddrPoolsAnnot, s, subnet)
+			}
+		}
+		if err := checkHostBridgeOverlap(subnet); err != nil {
+			return fmt.Errorf("invalid value for annotation %s: %v", dockerAddrPoolsAnnot, err)
+		}
+		subnets = append(subnets, subnet)
+
+		size, _ := subnet.Mask.Size()
+		if size < innerDockerPoolNetSize {
+			size = innerDockerPoolNetSize
+		}
+
+		pools = append(pools, map[string]interface{}{
+			"base": subnet.String(),
+			"size": size,
+		})
+	}
+
+	settings["default-address-pools"] = pools
+
+	return nil
+}
+
+// genDockerDaemonCfg returns the given Docker daemon config (daemon.json) with
+// the given settings added (replacing existing ones).
+func genDockerDaemonCfg(cur []byte, settings map[string]interface{}) ([]byte, error) {
+	cfg := make(map[string]interface{})
+
+	if len(strings.TrimSpace(string(cur))) > 0 {
+		if err := json.Unmarshal(cur, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse docker daemon config: %v", err)
+		}
+	}
+
+	for k, v := range settings {
+		cfg[k] = v
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+// checkSpec performs some basic checks on the system container's spec
+func checkSpec(spec *specs.Spec, requireSeccomp bool) error {
+
+	if spec.Root == nil || spec.Linux == nil {
+		return fmt.Errorf("not a linux container spec")
+	}
+
+	if err := checkSeccompNotNil(spec, requireSeccomp); err != nil {
+		return err
+	}
+
+	if _, err := ReclaimMemoryOnStart(spec.Annotations); err != nil {
+		return err
+	}
+
+	if _, err := ParentDeathSignal(spec.Annotations); err != nil {
+		return err
+	}
+
+	if _, _, err := NetworkPolicyPrograms(spec.Annotations); err != nil {
+		return err
+	}
+
+	// Ensure the container's network ns is not shared with the host
+	for _, ns := range spec.Linux.Namespaces {
+		if ns.Type == specs.NetworkNamespace && ns.Path != "" {
+			var st1, st2 unix.Stat_t
+
+			if err := unix.Stat("/proc/self/ns/net", &st1); err != nil {
+				return fmt.Errorf("unable to stat sysbox's network namespace: %s", err)
+			}
+			if err := unix.Stat(ns.Path, &st2); err != nil {
+				return fmt.Errorf("unable to stat %q: %s", ns.Path, err)
+			}
+
+			if (st1.Dev == st2.Dev) && (st1.Ino == st2.Ino) {
+				return fmt.Errorf("sysbox containers can't share a network namespace with the host (because they use the linux user-namespace for isolation)")
+			}
+
+			break
+		}
+	}
+
+	return nil
+}
+
+// checkSeccompNotNil checks if the spec has a seccomp config; if not, the
+// container has no syscall filtering, which is an error when seccomp is
+// required.
+func checkSeccompNotNil(spec *specs.Spec, required bool) error {
+	if spec.Linux.Seccomp != nil {
+		return nil
+	}
+
+	if required {
+		return fmt.Errorf("spec has no seccomp config, but seccomp is required")
+	}
+
+	logrus.Infof("spec has no seccomp config; container will have no syscall filtering")
+
+	return nil
+}
+
+func cfgOomScoreAdj(spec *specs.Spec) {
+
+	// For sys containers we don't allow -1000 for the OOM score value, as this
+	// is not supported from within a user-ns.
+
+	if spec.Process.OOMScoreAdj != nil {
+		if *spec.Process.OOMScoreAdj < -999 {
+			*spec.Process.OOMScoreAdj = -999
+		}
+	}
+}
+
+// cfgResourceMode adjusts the sys container's resource limits per the
+// "sysbox.io/resource-mode" annotation:
+//
+// "strict": the limits in the spec are enforced as is (the default).
+//
+// "elastic": the memory limit becomes a soft limit (i.e., the memory
+// reservation, which maps to memory.soft_limit_in_bytes on cgroup v1 and
+// memory.low on cgroup v2), so the container can use more memory when the
+// host has it available.
+//
+// "none": no resource limits are set. The device access rules are kept as
+// they are required for the container's isolation.
+func cfgResourceMode(spec *specs.Spec) error {
+	mode, ok := spec.Annotations[resourceModeAnnot]
+	if !ok {
+		return nil
+	}
+
+	r := spec.Linux.Resources
+
+	switch mode {
+	case "strict":
+		return nil
+
+	case "elastic":
+		if r == nil || r.Memory == nil || r.Memory.Limit == nil || *r.Memory.Limit <= 0 {
+			return nil
+		}
+		limit := *r.Memory.Limit
+		logrus.Debugf("resource mode %s: memory limit %d set as memory reservation", mode, limit)
+		r.Memory.Reservation = &limit
+		r.Memory.Limit = nil
+		// the swap limit is the memory+swap limit, so it goes too
+		r.Memory.Swap = nil
+
+	case "none":
+		if r == nil {
+			return nil
+		}
+		logrus.Debugf("resource mode %s: removing the container's resource limits", mode)
+		spec.Linux.Resources = &specs.LinuxResources{
+			Devices: r.Devices,
+		}
+
+	default:
+		return fmt.Errorf("invalid value for annotation %s: %s (expected \"strict\", \"elastic\" or \"none\")",
+			resourceModeAnnot, mode)
+	}
+
+	return nil
+}
+
+// cfgCpusetNuma checks whether the cpus assigned to the sys container span
+// multiple NUMA nodes. By default this only results in a warning; with the
+// "sysbox.io/numa-affinity=strict" annotation it's an error.
+func cfgCpusetNuma(spec *specs.Spec) error {
+
+	strict := false
+	if val, ok := spec.Annotations[numaAffinityAnnot]; ok {
+		if val != "strict" {
+			return fmt.Errorf("invalid value for annotation %s: %s (expected \"strict\")", numaAffinityAnnot, val)
+		}
+		strict = true
+	}
+
+	if spec.Linux.Resources == nil || spec.Linux.Resources.CPU == nil || spec.Linux.Resources.CPU.Cpus == "" {
+		return nil
+	}
+
+	nodes, err := validateCpusetNuma(spec.Linux.Resources.CPU.Cpus)
+	if err != nil {
+		return err
+	}
 
-	spec.Mounts = append(spec.Mounts, sysboxSystemdMounts...)
+	if len(nodes) > 1 && strict {
+		return fmt.Errorf("cpus %s span NUMA nodes %v; not allowed by annotation %s=strict",
+			spec.Linux.Resources.CPU.Cpus, nodes, numaAffinityAnnot)
+	}
+
+	return nil
 }
 
-// sysMgrSetupMounts requests the sysbox-mgr to setup special sys container mounts.
-func sysMgrSetupMounts(mgr *sysbox.Mgr, spec *specs.Spec, uidShiftRootfs bool) error {
+// validateCpusetNuma returns the (sorted) NUMA nodes spanned by the given cpu
+// list (e.g., "0-3,8"). The node of each cpu is obtained from the cpulist of
+// the NUMA nodes in sysfs; if these can't be read, the check is skipped with a
+// warning. Logs a warning if more than one node is spanned.
+func validateCpusetNuma(cpuList string) ([]int, error) {
 
-	// These directories in the sys container are bind-mounted from host dirs managed by sysbox-mgr
-	specialDir := map[string]ipcLib.MntKind{
-		"/var/lib/docker":      ipcLib.MntVarLibDocker,
-		"/var/lib/kubelet":     ipcLib.MntVarLibKubelet,
-		"/var/lib/rancher/k3s": ipcLib.MntVarLibK3s,
-		"/var/lib/containerd/io.containerd.snapshotter.v1.overlayfs": ipcLib.MntVarLibContainerdOvfs,
+	cpus, err := fscommon.ParseCpusetList(cpuList)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cpu list %q: %v", cpuList, err)
 	}
 
-	uid := spec.Linux.UIDMappings[0].HostID
-	gid := spec.Linux.GIDMappings[0].HostID
+	cpuNode, err := readCpuNodes()
+	if err != nil {
+		logrus.Warnf("skipping NUMA check of cpus %s: %v", cpuList, err)
+		return nil, nil
+	}
 
-	// If the spec has a bind-mount over one of the special dirs, ask the
-	// sysbox-mgr to prepare the mount source (e.g., chown files to match the
-	// container host uid & gid).
-	prepList := []ipcLib.MountPrepInfo{}
+	found := make(map[int]bool)
+	nodes := []int{}
 
-	for i := len(spec.Mounts) - 1; i >= 0; i-- {
+	for _, cpu := range cpus {
+		node, ok := cpuNode[cpu]
+		if !ok {
+			return nil, fmt.Errorf("cpu %d is not in any NUMA node", cpu)
+		}
 
-		m := spec.Mounts[i]
-		_, isSpecialDir := specialDir[m.Destination]
+		if !found[node] {
+			found[node] = true
+			nodes = append(nodes, node)
+		}
+	}
 
-		if m.Type == "bind" && isSpecialDir {
-			info := ipcLib.MountPrepInfo{
-				Source:    m.Source,
-				Exclusive: true,
-			}
+	sort.Ints(nodes)
 
-			prepList = append(prepList, info)
-			delete(specialDir, m.Destination)
-		}
+	if len(nodes) > 1 {
+		logrus.Warnf("cpus %s span multiple NUMA nodes (%v); processes in the container may see non-uniform memory latency", cpuList, nodes)
 	}
 
-	if len(prepList) > 0 {
-		if err := mgr.PrepMounts(uid, gid, prepList); err != nil {
-			return err
-		}
+	return nodes, nil
+}
+
+// readCpuNodes returns the NUMA node of each of the host's cpus, per the
+// cpulist of each node in sysfs.
+func readCpuNodes() (map[uint16]int, error) {
+
+	dirs, err := filepath.Glob(filepath.Join(sysNodeRoot, "node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no NUMA nodes found in %s", sysNodeRoot)
 	}
 
-	// Otherwise, add the special dir to the list of mounts that we will request
-	// sysbox-mgr to setup
-	reqList := []ipcLib.MountReqInfo{}
-	for dest, kind := range specialDir {
-		info := ipcLib.MountReqInfo{
-			Kind: kind,
-			Dest: dest,
+	cpuNode := make(map[uint16]int)
+
+	for _, dir := range dirs {
+		node, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(dir, "cpulist")
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+
+		// memory-only nodes have an empty cpulist
+		list := strings.TrimSpace(string(data))
+		if list == "" {
+			continue
+		}
+
+		cpus, err := fscommon.ParseCpusetList(list)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		for _, cpu := range cpus {
+			cpuNode[cpu] = node
 		}
-		reqList = append(reqList, info)
 	}
 
-	// sysbox-mgr will setup host dirs to back the mounts in the
-	// request list; it will also send us any other mounts it needs.
-	rootPath, err := filepath.Abs(spec.Root.Path)
-	if err != nil {
-		return err
+	return cpuNode, nil
+}
+
+// CfgOOMGroup configures the sys container's cgroup such that, on OOM, all
+// processes in the container are killed together rather than individually. This
+// is only done for OOM-protected containers (i.e., negative OOM score adj),
+// where a partial kill of the container's processes is most undesirable. Only
+// supported on cgroup v2 (via memory.oom.group); no-op on cgroup v1.
+func CfgOOMGroup(oomScoreAdj *int, manager cgroups.Manager) error {
+
+	if oomScoreAdj == nil || *oomScoreAdj >= 0 {
+		return nil
 	}
 
-	m, err := mgr.ReqMounts(rootPath, uid, gid, uidShiftRootfs, reqList)
-	if err != nil {
-		return err
+	cgType := manager.GetType()
+	if cgType != cgroups.Cgroup_v2_fs && cgType != cgroups.Cgroup_v2_systemd {
+		return nil
 	}
 
-	// If any sysbox-mgr mounts conflict with any in the spec (i.e.,
-	// same dest), prioritize the spec ones
-	mounts := utils.MountSliceRemove(m, spec.Mounts, func(m1, m2 specs.Mount) bool {
-		return m1.Destination == m2.Destination
-	})
+	path := manager.Path("")
+	if path == "" {
+		return fmt.Errorf("failed to get container's cgroup path")
+	}
 
-	spec.Mounts = append(spec.Mounts, mounts...)
+	if err := fscommon.WriteFile(path, "memory.oom.group", "1"); err != nil {
+		return fmt.Errorf("failed to set memory.oom.group: %v", err)
+	}
 
 	return nil
 }
 
-// checkSpec performs some basic checks on the system container's spec
-func checkSpec(spec *specs.Spec) error {
+// hostDevice describes a host device that may be exposed inside the sys container
+type hostDevice struct {
+	path  string
+	major int64
+	minor int64
+}
 
-	if spec.Root == nil || spec.Linux == nil {
-		return fmt.Errorf("not a linux container spec")
-	}
+// kvmDevices lists the devices exposed to sys containers that host KVM virtual
+// machines (i.e., when the "sysbox.io/allow-kvm" annotation is "true").
+var kvmDevices = []hostDevice{
+	{"/dev/kvm", 10, 232},
+}
 
-	// Ensure the container's network ns is not shared with the host
-	for _, ns := range spec.Linux.Namespaces {
-		if ns.Type == specs.NetworkNamespace && ns.Path != "" {
-			var st1, st2 unix.Stat_t
+// kvmFullDevices lists the additional devices exposed to sys containers when
+// the "sysbox.io/allow-kvm" annotation is "full" (i.e., vhost acceleration for
+// VM networking and host<->VM sockets).
+var kvmFullDevices = []hostDevice{
+	{"/dev/vhost-net", 10, 238},
+	{"/dev/vhost-vsock", 10, 241},
+}
 
-			if err := unix.Stat("/proc/self/ns/net", &st1); err != nil {
-				return fmt.Errorf("unable to stat sysbox's network namespace: %s", err)
-			}
-			if err := unix.Stat(ns.Path, &st2); err != nil {
-				return fmt.Errorf("unable to stat %q: %s", ns.Path, err)
-			}
+// hostDevExists returns true if the given device exists on the host (a var
+// so that it can be replaced in unit tests).
+var hostDevExists = func(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
 
-			if (st1.Dev == st2.Dev) && (st1.Ino == st2.Ino) {
-				return fmt.Errorf("sysbox containers can't share a network namespace with the host (because they use the linux user-namespace for isolation)")
-			}
+// cfgKvmDevice exposes /dev/kvm (and optionally the vhost devices) inside the
+// sys container, so that it can run QEMU/KVM virtual machines. This only occurs
+// when the container's spec carries the "sysbox.io/allow-kvm" annotation and
+// the devices are present on the host.
+func cfgKvmDevice(spec *specs.Spec) error {
 
-			break
-		}
+	val, ok := spec.Annotations[allowKvmAnnot]
+	if !ok {
+		return nil
 	}
 
-	return nil
-}
+	var devList []hostDevice
 
-func cfgOomScoreAdj(spec *specs.Spec) {
+	switch val {
+	case "false":
+		return nil
+	case "true":
+		devList = kvmDevices
+	case "full":
+		devList = append(append(devList, kvmDevices...), kvmFullDevices...)
+	default:
+		return fmt.Errorf("invalid value for annotation %s: %s (must be \"true\", \"full\", or \"false\")",
+			allowKvmAnnot, val)
+	}
 
-	// For sys containers we don't allow -1000 for the OOM score value, as this
-	// is not supported from within a user-ns.
+	if spec.Linux.Resources == nil {
+		spec.Linux.Resources = &specs.LinuxResources{}
+	}
 
-	if spec.Process.OOMScoreAdj != nil {
-		if *spec.Process.OOMScoreAdj < -999 {
-			*spec.Process.OOMScoreAdj = -999
+	for _, dev := range devList {
+
+		if !hostDevExists(dev.path) {
+			logrus.Warnf("annotation %s is set but device %s is not present on the host; skipping it",
+				allowKvmAnnot, dev.path)
+			continue
+		}
+
+		present := false
+		for _, d := range spec.Linux.Devices {
+			if d.Path == dev.path {
+				present = true
+				break
+			}
+		}
+
+		if !present {
+			fileMode := os.FileMode(0666)
+			rootId := uint32(0)
+
+			spec.Linux.Devices = append(spec.Linux.Devices, specs.LinuxDevice{
+				Path:     dev.path,
+				Type:     "c",
+				Major:    dev.major,
+				Minor:    dev.minor,
+				FileMode: &fileMode,
+				UID:      &rootId,
+				GID:      &rootId,
+			})
 		}
+
+		major := dev.major
+		minor := dev.minor
+
+		spec.Linux.Resources.Devices = append(spec.Linux.Resources.Devices, specs.LinuxDeviceCgroup{
+			Allow:  true,
+			Type:   "c",
+			Major:  &major,
+			Minor:  &minor,
+			Access: "rwm",
+		})
+
+		logrus.Debugf("added device %s to spec", dev.path)
 	}
+
+	return nil
 }
 
-// cfgSeccomp configures the system container's seccomp settings.
-func cfgSeccomp(seccomp *specs.LinuxSeccomp) error {
+// cfgSeccomp configures the system container's seccomp settings; the given
+// extra syscalls are allowed in addition to the sys container syscall
+// whitelist. The given seccomp mode (see getSeccompMode) determines whether
+// the profile's blocking actions are enforced or just logged.
+func cfgSeccomp(seccomp *specs.LinuxSeccomp, strict bool, extra []string, mode string) error {
 
 	if seccomp == nil {
 		return nil
@@ -751,7 +2964,8 @@ func cfgSeccomp(seccomp *specs.LinuxSeccomp) error {
 	// we don't yet support specs with default trap, trace, or log actions
 	if seccomp.DefaultAction != specs.ActAllow &&
 		seccomp.DefaultAction != specs.ActErrno &&
-		seccomp.DefaultAction != specs.ActKill {
+		seccomp.DefaultAction != specs.ActKill &&
+		seccomp.DefaultAction != specs.ActKillProcess {
 		return fmt.Errorf("spec seccomp default actions other than allow, errno, and kill are not supported")
 	}
 
@@ -759,6 +2973,7 @@ func cfgSeccomp(seccomp *specs.LinuxSeccomp) error {
 	allowSet := mapset.NewSet()
 	errnoSet := mapset.NewSet()
 	killSet := mapset.NewSet()
+	killProcSet := mapset.NewSet()
 
 	for _, syscall := range seccomp.Syscalls {
 		for _, name := range syscall.Names {
@@ -769,6 +2984,9 @@ func cfgSeccomp(seccomp *specs.LinuxSeccomp) error {
 				errnoSet.Add(name)
 			case specs.ActKill:
 				killSet.Add(name)
+			case specs.ActKillProcess:
+				killSet.Add(name)
+				killProcSet.Add(name)
 			}
 		}
 	}
@@ -778,10 +2996,16 @@ func cfgSeccomp(seccomp *specs.LinuxSeccomp) error {
 	for _, sc := range syscontSyscallWhitelist {
 		syscontAllowSet.Add(sc)
 	}
+	for _, sc := range extra {
+		syscontAllowSet.Add(sc)
+	}
 
-	// seccomp syscall list may be a whitelist or blacklist
+	// seccomp syscall list may be a whitelist or blacklist; note that
+	// SCMP_ACT_KILL_PROCESS (kills the whole process) is treated like
+	// SCMP_ACT_KILL (kills the offending thread only) here.
 	whitelist := (seccomp.DefaultAction == specs.ActErrno ||
-		seccomp.DefaultAction == specs.ActKill)
+		seccomp.DefaultAction == specs.ActKill ||
+		seccomp.DefaultAction == specs.ActKillProcess)
 
 	// diffset is the set of syscalls that needs adding (for whitelist) or removing (for blacklist)
 	diffSet := mapset.NewSet()
@@ -792,19 +3016,42 @@ func cfgSeccomp(seccomp *specs.LinuxSeccomp) error {
 		diffSet = disallowSet.Difference(syscontAllowSet)
 	}
 
+	// in audit mode, the syscalls sysbox allows but the profile doesn't are
+	// logged
+	addAction := specs.ActAllow
+	if mode == seccompModeAudit {
+		addAction = specs.ActLog
+	}
+
 	if whitelist {
 		// add the diffset to the whitelist
 		for syscallName := range diffSet.Iter() {
 			str := fmt.Sprintf("%v", syscallName)
+
+			// The spec may have rules for the syscall with another action; the
+			// outcome then depends on rule ordering.
+			for _, rule := range findConflictingRules(seccomp.Syscalls, str) {
+				if strict {
+					return fmt.Errorf("seccomp rule for syscall %s with action %s conflicts with sysbox required action %s",
+						str, rule.Action, specs.ActAllow)
+				}
+				logrus.Warnf("seccomp rule for syscall %s with action %s conflicts with sysbox required action %s",
+					str, rule.Action, specs.ActAllow)
+			}
+
 			sc := specs.LinuxSyscall{
 				Names:  []string{str},
-				Action: specs.ActAllow,
+				Action: addAction,
 			}
 			seccomp.Syscalls = append(seccomp.Syscalls, sc)
 		}
 
 		logrus.Debugf("added syscalls to seccomp profile: %v", diffSet)
 
+		if seccomp.DefaultAction == specs.ActKillProcess {
+			logrus.Debugf("added syscalls were blocked by default with kill-process semantics")
+		}
+
 	} else {
 		// remove the diffset from the blacklist
 		var newSyscalls []specs.LinuxSyscall
@@ -822,6 +3069,25 @@ func cfgSeccomp(seccomp *specs.LinuxSeccomp) error {
 		seccomp.Syscalls = newSyscalls
 
 		logrus.Debugf("removed syscalls from seccomp profile: %v", diffSet)
+
+		if killProcDiff := diffSet.Intersect(killProcSet); killProcDiff.Cardinality() > 0 {
+			logrus.Debugf("removed syscalls were blocked with kill-process semantics: %v", killProcDiff)
+		}
+
+		if mode == seccompModeAudit {
+			listed := mapset.NewSet()
+			for _, sc := range seccomp.Syscalls {
+				for _, name := range sc.Names {
+					listed.Add(name)
+				}
+			}
+			for syscallName := range syscontAllowSet.Difference(listed).Iter() {
+				seccomp.Syscalls = append(seccomp.Syscalls, specs.LinuxSyscall{
+					Names:  []string{fmt.Sprintf("%v", syscallName)},
+					Action: specs.ActLog,
+				})
+			}
+		}
 	}
 
 	if whitelist {
@@ -836,9 +3102,30 @@ func cfgSeccomp(seccomp *specs.LinuxSeccomp) error {
 		}
 	}
 
+	if mode == seccompModeLogOnly {
+		seccompLogOnly(seccomp)
+	}
+
 	return nil
 }
 
+// findConflictingRules returns the seccomp rules for the given syscall whose
+// action is not "allow".
+func findConflictingRules(syscalls []specs.LinuxSyscall, name string) []specs.LinuxSyscall {
+	var conflicts []specs.LinuxSyscall
+
+	for _, sc := range syscalls {
+		if sc.Action == specs.ActAllow {
+			continue
+		}
+		if utils.StringSliceContains(sc.Names, name) {
+			conflicts = append(conflicts, sc)
+		}
+	}
+
+	return conflicts
+}
+
 // cfgAppArmor sets up the apparmor config for sys containers
 func cfgAppArmor(p *specs.Process) error {
 
@@ -879,10 +3166,124 @@ func systemdInit(p *specs.Process) bool {
 	return p.Args[0] == "/sbin/init"
 }
 
+// ImageConfig holds the execution parameters of a container image (i.e., the
+// "config" section of an OCI image config) that are relevant to sysbox.
+type ImageConfig struct {
+	Labels map[string]string `json:"Labels"`
+}
+
+// LoadImageConfig returns the image config in the given OCI image config file.
+func LoadImageConfig(path string) (ImageConfig, error) {
+	var imgConfig struct {
+		Config ImageConfig `json:"config"`
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return imgConfig.Config, err
+	}
+
+	if err := json.Unmarshal(data, &imgConfig); err != nil {
+		return imgConfig.Config, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	return imgConfig.Config, nil
+}
+
+// ExtractSysboxLabels returns the sysbox labels ("sysbox.io/*") in the given
+// image config that images are allowed to set (see imageLabelAnnots); other
+// sysbox labels are ignored.
+func ExtractSysboxLabels(imageConfig ImageConfig) map[string]string {
+	labels := make(map[string]string)
+	for key, val := range imageConfig.Labels {
+		if !strings.HasPrefix(key, sysboxAnnotPrefix) {
+			continue
+		}
+		if !imageLabelAnnots[key] {
+			logrus.Warnf("ignoring image label %s (not allowed as an image label)", key)
+			continue
+		}
+		labels[key] = val
+	}
+	return labels
+}
+
+// InjectLabelsAsAnnotations merges the given labels into the spec's
+// annotations; annotations already in the spec take priority.
+func InjectLabelsAsAnnotations(spec *specs.Spec, labels map[string]string) {
+	for key, val := range labels {
+		if _, ok := spec.Annotations[key]; ok {
+			logrus.Debugf("image label %s overridden by spec annotation", key)
+			continue
+		}
+		if spec.Annotations == nil {
+			spec.Annotations = make(map[string]string)
+		}
+		spec.Annotations[key] = val
+	}
+}
+
+// imageLabelAnnots are the sysbox annotations that an image may set via its
+// labels (see InjectImageAnnotations). The image's author is not trusted, so
+// annotations that relax the container's isolation (e.g., allow-debugfs,
+// seccomp-mode) are not among them; those must be set by whoever creates the
+// container.
+var imageLabelAnnots = map[string]bool{
+	denyCapsAnnot:          true,
+	netIsolationAnnot:      true,
+	innerDockerBridgeAnnot: true,
+	dockerAddrPoolsAnnot:   true,
+	numaAffinityAnnot:      true,
+	devShmSizeAnnot:        true,
+	netIfaceNameAnnot:      true,
+	innerKubePodCIDRAnnot:  true,
+	innerKubeSvcCIDRAnnot:  true,
+	netSysctlsAnnot:        true,
+	reclaimMemOnStartAnnot: true,
+	netAccountingAnnot:     true,
+	parentDeathSigAnnot:    true,
+	corePatternAnnot:       true,
+	readonlyNetSysfsAnnot:  true,
+}
+
+// InjectImageAnnotations merges the sysbox annotations ("sysbox.io/*") among
+// the given image config labels into the spec's annotations, such that images
+// can carry their own sysbox config (e.g., LABEL sysbox.io/dev-shm-size=1G).
+// Annotations already in the spec take priority over image labels. Only the
+// annotations in imageLabelAnnots are taken from the labels (see
+// ExtractSysboxLabels).
+func InjectImageAnnotations(spec *specs.Spec, imageConfigLabels map[string]string) error {
+	labels := ExtractSysboxLabels(ImageConfig{Labels: imageConfigLabels})
+
+	for key, val := range labels {
+		if strings.TrimSpace(val) == "" {
+			return fmt.Errorf("image label %s has an empty value", key)
+		}
+	}
+
+	InjectLabelsAsAnnotations(spec, labels)
+	return nil
+}
+
+// loadImageLabels returns the labels in the given image config file; it
+// returns no labels if the file does not exist.
+func loadImageLabels(path string) (map[string]string, error) {
+	imgConfig, err := LoadImageConfig(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return imgConfig.Labels, nil
+}
+
 // Configure the container's process spec for system containers
-func ConvertProcessSpec(p *specs.Process) error {
+func ConvertProcessSpec(p *specs.Process, annotations map[string]string) error {
 
-	cfgCapabilities(p)
+	if err := cfgCapabilities(p, annotations); err != nil {
+		return fmt.Errorf("failed to configure capabilities: %v", err)
+	}
 
 	if err := cfgAppArmor(p); err != nil {
 		return fmt.Errorf("failed to configure AppArmor profile: %v", err)
@@ -898,7 +3299,37 @@ func ConvertProcessSpec(p *specs.Process) error {
 // ConvertSpec converts the given container spec to a system container spec.
 func ConvertSpec(context *cli.Context, sysMgr *sysbox.Mgr, sysFs *sysbox.Fs, spec *specs.Spec) (bool, bool, error) {
 
-	if err := checkSpec(spec); err != nil {
+	// the caller's annotations (see preserveAnnotations())
+	original := &specs.Spec{Annotations: make(map[string]string, len(spec.Annotations))}
+	for k, v := range spec.Annotations {
+		original.Annotations[k] = v
+	}
+
+	rootfs := ""
+	if spec.Root != nil {
+		rootfs = spec.Root.Path
+	}
+	if err := checkResourcePolicy(rootfs); err != nil {
+		return false, false, err
+	}
+
+	if !context.GlobalBool("skip-capability-check") {
+		if err := checkHostCaps(); err != nil {
+			return false, false, err
+		}
+	}
+
+	// the spec was loaded from the bundle dir, which is the current dir
+	imageLabels, err := loadImageLabels(imageConfigFile)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to load image config: %v", err)
+	}
+
+	if err := InjectImageAnnotations(spec, imageLabels); err != nil {
+		return false, false, fmt.Errorf("invalid image config: %v", err)
+	}
+
+	if err := checkSpec(spec, context.GlobalBool("require-seccomp")); err != nil {
 		return false, false, fmt.Errorf("invalid or unsupported container spec: %v", err)
 	}
 
@@ -916,7 +3347,12 @@ func ConvertSpec(context *cli.Context, sysMgr *sysbox.Mgr, sysFs *sysbox.Fs, spe
 		return false, false, err
 	}
 
-	if err := cfgMounts(spec, sysMgr, sysFs, uidShiftRootfs); err != nil {
+	supOpts := supMountsOpts{
+		partialOk: context.GlobalBool("partial-supmounts-ok"),
+		remap:     context.GlobalBool("remap-sup-mounts"),
+	}
+
+	if err := cfgMounts(spec, sysMgr, sysFs, uidShiftRootfs, supOpts); err != nil {
 		return false, false, fmt.Errorf("invalid mount config: %v", err)
 	}
 
@@ -924,13 +3360,100 @@ func ConvertSpec(context *cli.Context, sysMgr *sysbox.Mgr, sysFs *sysbox.Fs, spe
 	cfgReadonlyPaths(spec)
 	cfgOomScoreAdj(spec)
 
-	if err := cfgSeccomp(spec.Linux.Seccomp); err != nil {
+	if err := cfgResourceMode(spec); err != nil {
+		return false, false, fmt.Errorf("invalid resource config: %v", err)
+	}
+
+	if err := cfgCpusetNuma(spec); err != nil {
+		return false, false, fmt.Errorf("invalid cpuset config: %v", err)
+	}
+
+	if err := cfgKvmDevice(spec); err != nil {
+		return false, false, fmt.Errorf("failed to configure kvm devices: %v", err)
+	}
+
+	if err := cfgNetSysctls(spec); err != nil {
+		return false, false, fmt.Errorf("failed to configure sysctls: %v", err)
+	}
+
+	if sysFs.Enabled() {
+		if err := cfgCoreDumpPattern(spec); err != nil {
+			return false, false, fmt.Errorf("failed to configure core dump pattern: %v", err)
+		}
+	}
+
+	if err := cfgNetworkIsolation(spec, sysMgr.Id); err != nil {
+		return false, false, fmt.Errorf("failed to configure network isolation: %v", err)
+	}
+
+	if err := cfgNetworkAccounting(spec, sysMgr.Id); err != nil {
+		return false, false, fmt.Errorf("failed to configure network accounting: %v", err)
+	}
+
+	if err := cfgNetworkIfaceRename(spec); err != nil {
+		return false, false, fmt.Errorf("failed to configure network interface: %v", err)
+	}
+
+	if err := cfgInnerKubeCIDRConflict(spec); err != nil {
+		return false, false, fmt.Errorf("failed to configure inner kubernetes networks: %v", err)
+	}
+
+	strictSeccomp := context.GlobalBool("strict-seccomp")
+
+	if err := cfgSeccompExtraProfiles(spec, strictSeccomp); err != nil {
+		return false, false, fmt.Errorf("failed to configure seccomp: %v", err)
+	}
+
+	extraSyscalls, err := cfgSeccompGroups(spec.Annotations)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to configure seccomp: %v", err)
+	}
+
+	seccompMode, err := getSeccompMode(spec.Annotations, strictSeccomp)
+	if err != nil {
+		return false, false, err
+	}
+
+	if err := cfgSeccomp(spec.Linux.Seccomp, strictSeccomp, extraSyscalls, seccompMode); err != nil {
 		return false, false, fmt.Errorf("failed to configure seccomp: %v", err)
 	}
 
-	if err := ConvertProcessSpec(spec.Process); err != nil {
+	if err := ConvertProcessSpec(spec.Process, spec.Annotations); err != nil {
 		return false, false, fmt.Errorf("failed to configure process spec: %v", err)
 	}
 
+	if auditDir := context.GlobalString("capability-audit-log-dir"); auditDir != "" {
+		if err := cfgCapabilityAuditLog(spec.Process, sysMgr.Id, auditDir); err != nil {
+			return false, false, fmt.Errorf("failed to write capability audit log: %v", err)
+		}
+	}
+
+	// Done last, so that no files are generated for specs that fail conversion
+	if err := genHostsAndResolvConf(spec, sysMgr.Id); err != nil {
+		return false, false, fmt.Errorf("failed to generate /etc/hosts and /etc/resolv.conf: %v", err)
+	}
+
+	preserveAnnotations(original, spec)
+
 	return uidShiftSupported, uidShiftRootfs, nil
 }
+
+// preserveAnnotations copies to the converted spec the annotations of the
+// original one that are missing or were blanked in it, so that annotations
+// sysbox doesn't know about (e.g., "com.example.app/version") survive the
+// conversion unchanged. Annotations given a (non-empty) new value are kept.
+func preserveAnnotations(original, converted *specs.Spec) {
+	if len(original.Annotations) == 0 {
+		return
+	}
+
+	if converted.Annotations == nil {
+		converted.Annotations = make(map[string]string, len(original.Annotations))
+	}
+
+	for k, v := range original.Annotations {
+		if cur, ok := converted.Annotations[k]; !ok || (cur == "" && v != "") {
+			converted.Annotations[k] = v
+		}
+	}
+}
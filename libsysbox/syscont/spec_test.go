@@ -17,12 +17,38 @@
 package syscont
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	utils "github.com/nestybox/sysbox-libs/utils"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/opencontainers/runc/libsysbox/sysbox"
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
 )
 
+func TestMain(m *testing.M) {
+	// sysbox-fs is not present in the test environment
+	sysboxFsHealthCheck = func(string) error { return nil }
+	sysboxFsSourceExists = func(string) bool { return true }
+	// tests may themselves run inside a container
+	innerContainerCheck = func() bool { return false }
+	os.Exit(m.Run())
+}
+
 func findSeccompSyscall(seccomp *specs.LinuxSeccomp, targetSyscalls []string) (allFound bool, notFound []string) {
 	if seccomp == nil {
 		return false, notFound
@@ -63,7 +89,7 @@ func TestCfgSeccomp(t *testing.T) {
 	var seccomp *specs.LinuxSeccomp
 
 	// Test handling of nil seccomp
-	if err := cfgSeccomp(nil); err != nil {
+	if err := cfgSeccomp(nil, false, nil, seccompModeEnforce); err != nil {
 		t.Errorf("cfgSeccomp: returned error: %v", err)
 	}
 
@@ -73,7 +99,7 @@ func TestCfgSeccomp(t *testing.T) {
 		Architectures: []specs.Arch{specs.ArchARM},
 		Syscalls:      []specs.LinuxSyscall{},
 	}
-	if err := cfgSeccomp(seccomp); err != nil {
+	if err := cfgSeccomp(seccomp, false, nil, seccompModeEnforce); err != nil {
 		t.Errorf("cfgSeccomp: failed to handle unsupported arch: %v", err)
 	}
 
@@ -83,7 +109,7 @@ func TestCfgSeccomp(t *testing.T) {
 		Architectures: []specs.Arch{specs.ArchX86_64},
 		Syscalls:      []specs.LinuxSyscall{},
 	}
-	if err := cfgSeccomp(seccomp); err != nil {
+	if err := cfgSeccomp(seccomp, false, nil, seccompModeEnforce); err != nil {
 		t.Errorf("cfgSeccomp: returned error: %v", err)
 	}
 	if ok, notFound := findSeccompSyscall(seccomp, syscontSyscallWhitelist); !ok {
@@ -96,7 +122,7 @@ func TestCfgSeccomp(t *testing.T) {
 		Architectures: []specs.Arch{specs.ArchX86_64},
 		Syscalls:      genSeccompWhitelist(syscontSyscallWhitelist),
 	}
-	if err := cfgSeccomp(seccomp); err != nil {
+	if err := cfgSeccomp(seccomp, false, nil, seccompModeEnforce); err != nil {
 		t.Errorf("cfgSeccomp: returned error: %v", err)
 	}
 	if ok, notFound := findSeccompSyscall(seccomp, syscontSyscallWhitelist); !ok {
@@ -110,7 +136,7 @@ func TestCfgSeccomp(t *testing.T) {
 		Architectures: []specs.Arch{specs.ArchX86_64},
 		Syscalls:      genSeccompWhitelist(partialList),
 	}
-	if err := cfgSeccomp(seccomp); err != nil {
+	if err := cfgSeccomp(seccomp, false, nil, seccompModeEnforce); err != nil {
 		t.Errorf("cfgSeccomp: returned error: %v", err)
 	}
 	if ok, notFound := findSeccompSyscall(seccomp, syscontSyscallWhitelist); !ok {
@@ -127,7 +153,7 @@ func TestCfgSeccomp(t *testing.T) {
 		Architectures: []specs.Arch{specs.ArchX86_64},
 		Syscalls:      []specs.LinuxSyscall{linuxSyscall},
 	}
-	if err := cfgSeccomp(seccomp); err != nil {
+	if err := cfgSeccomp(seccomp, false, nil, seccompModeEnforce); err != nil {
 		t.Errorf("cfgSeccomp: returned error: %v", err)
 	}
 	if ok, notFound := findSeccompSyscall(seccomp, syscontSyscallWhitelist); !ok {
@@ -140,6 +166,55 @@ func TestCfgSeccomp(t *testing.T) {
 	// TODO: Test handling of non-conflicting blacklist
 }
 
+// Test handling of SCMP_ACT_KILL_PROCESS vs SCMP_ACT_KILL actions
+func TestCfgSeccompKillProcess(t *testing.T) {
+
+	// Whitelist with kill-process default action
+	for _, action := range []specs.LinuxSeccompAction{specs.ActKill, specs.ActKillProcess} {
+		seccomp := &specs.LinuxSeccomp{
+			DefaultAction: action,
+			Architectures: []specs.Arch{specs.ArchX86_64},
+			Syscalls:      genSeccompWhitelist([]string{"accept", "access"}),
+		}
+		if err := cfgSeccomp(seccomp, false, nil, seccompModeEnforce); err != nil {
+			t.Errorf("cfgSeccomp: returned error for default action %v: %v", action, err)
+		}
+		if ok, notFound := findSeccompSyscall(seccomp, syscontSyscallWhitelist); !ok {
+			t.Errorf("cfgSeccomp: %v whitelist test failed: missing syscalls: %s", action, notFound)
+		}
+	}
+
+	// Blacklists with kill and kill-process actions must be processed identically
+	var blocked [2][]string
+
+	for i, action := range []specs.LinuxSeccompAction{specs.ActKill, specs.ActKillProcess} {
+		seccomp := &specs.LinuxSeccomp{
+			DefaultAction: specs.ActAllow,
+			Architectures: []specs.Arch{specs.ArchX86_64},
+			Syscalls: []specs.LinuxSyscall{
+				{
+					Names:  []string{"mount"},
+					Action: action,
+				},
+				{
+					Names:  []string{"kexec_load"},
+					Action: action,
+				},
+			},
+		}
+		if err := cfgSeccomp(seccomp, false, nil, seccompModeEnforce); err != nil {
+			t.Errorf("cfgSeccomp: returned error for action %v: %v", action, err)
+		}
+		for _, sc := range seccomp.Syscalls {
+			blocked[i] = append(blocked[i], sc.Names...)
+		}
+	}
+
+	if !utils.StringSliceEqual(blocked[0], blocked[1]) {
+		t.Errorf("cfgSeccomp: kill vs kill-process blacklist mismatch: %v, %v", blocked[0], blocked[1])
+	}
+}
+
 // Test removal of seccomp syscall arg restrictions
 func TestCfgSeccompArgRemoval(t *testing.T) {
 
@@ -175,7 +250,7 @@ func TestCfgSeccompArgRemoval(t *testing.T) {
 		},
 	}
 
-	if err := cfgSeccomp(seccomp); err != nil {
+	if err := cfgSeccomp(seccomp, false, nil, seccompModeEnforce); err != nil {
 		t.Errorf("cfgSeccomp: returned error: %v", err)
 	}
 
@@ -191,6 +266,60 @@ func TestCfgSeccompArgRemoval(t *testing.T) {
 	}
 }
 
+func TestFindConflictingRules(t *testing.T) {
+	syscalls := []specs.LinuxSyscall{
+		{Names: []string{"mount", "umount2"}, Action: specs.ActErrno},
+		{Names: []string{"mount"}, Action: specs.ActAllow},
+		{Names: []string{"reboot"}, Action: specs.ActKill},
+	}
+
+	conflicts := findConflictingRules(syscalls, "mount")
+	if len(conflicts) != 1 || conflicts[0].Action != specs.ActErrno {
+		t.Errorf("findConflictingRules: want errno rule for mount; got %v", conflicts)
+	}
+
+	conflicts = findConflictingRules(syscalls, "reboot")
+	if len(conflicts) != 1 || conflicts[0].Action != specs.ActKill {
+		t.Errorf("findConflictingRules: want kill rule for reboot; got %v", conflicts)
+	}
+
+	if conflicts := findConflictingRules(syscalls, "open"); len(conflicts) != 0 {
+		t.Errorf("findConflictingRules: want no conflicts for open; got %v", conflicts)
+	}
+}
+
+func TestCfgSeccompConflicts(t *testing.T) {
+
+	// whitelist that denies a syscall sysbox requires
+	newSeccomp := func() *specs.LinuxSeccomp {
+		return &specs.LinuxSeccomp{
+			DefaultAction: specs.ActErrno,
+			Architectures: []specs.Arch{specs.ArchX86_64},
+			Syscalls: []specs.LinuxSyscall{
+				{Names: []string{"mount"}, Action: specs.ActErrno},
+			},
+		}
+	}
+
+	if err := cfgSeccomp(newSeccomp(), false, nil, seccompModeEnforce); err != nil {
+		t.Errorf("cfgSeccomp: unexpected error for conflict in non-strict mode: %v", err)
+	}
+
+	if err := cfgSeccomp(newSeccomp(), true, nil, seccompModeEnforce); err == nil {
+		t.Errorf("cfgSeccomp: expected error for conflict in strict mode")
+	}
+
+	// no conflicts
+	seccomp := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: []specs.Arch{specs.ArchX86_64},
+		Syscalls:      genSeccompWhitelist(syscontSyscallWhitelist),
+	}
+	if err := cfgSeccomp(seccomp, true, nil, seccompModeEnforce); err != nil {
+		t.Errorf("cfgSeccomp: unexpected error in strict mode: %v", err)
+	}
+}
+
 func TestCfgMaskedPaths(t *testing.T) {
 	spec := new(specs.Spec)
 	spec.Linux = new(specs.Linux)
@@ -520,3 +649,2492 @@ func TestValidateIDMappings(t *testing.T) {
 			want, spec.Linux.GIDMappings)
 	}
 }
+
+func TestCfgKvmDevice(t *testing.T) {
+
+	origHostDevExists := hostDevExists
+	defer func() { hostDevExists = origHostDevExists }()
+
+	hostDevExists = func(path string) bool { return true }
+
+	// No annotation -> no devices added
+	spec := new(specs.Spec)
+	spec.Linux = new(specs.Linux)
+
+	if err := cfgKvmDevice(spec); err != nil {
+		t.Errorf("cfgKvmDevice: returned error: %v", err)
+	}
+	if len(spec.Linux.Devices) != 0 || spec.Linux.Resources != nil {
+		t.Errorf("cfgKvmDevice: unexpected devices added without annotation: %v", spec.Linux.Devices)
+	}
+
+	// "true" -> /dev/kvm only
+	spec = new(specs.Spec)
+	spec.Linux = new(specs.Linux)
+	spec.Annotations = map[string]string{allowKvmAnnot: "true"}
+
+	if err := cfgKvmDevice(spec); err != nil {
+		t.Errorf("cfgKvmDevice: returned error: %v", err)
+	}
+	if len(spec.Linux.Devices) != 1 || spec.Linux.Devices[0].Path != "/dev/kvm" {
+		t.Fatalf("cfgKvmDevice: want /dev/kvm in devices; got %v", spec.Linux.Devices)
+	}
+
+	dev := spec.Linux.Devices[0]
+	if dev.Type != "c" || dev.Major != 10 || dev.Minor != 232 {
+		t.Errorf("cfgKvmDevice: invalid /dev/kvm device: %+v", dev)
+	}
+
+	if len(spec.Linux.Resources.Devices) != 1 {
+		t.Fatalf("cfgKvmDevice: want 1 device cgroup rule; got %v", spec.Linux.Resources.Devices)
+	}
+
+	rule := spec.Linux.Resources.Devices[0]
+	if !rule.Allow || rule.Type != "c" || *rule.Major != 10 || *rule.Minor != 232 || rule.Access != "rwm" {
+		t.Errorf("cfgKvmDevice: invalid /dev/kvm device cgroup rule: %+v", rule)
+	}
+
+	// "full" -> /dev/kvm + vhost devices
+	spec = new(specs.Spec)
+	spec.Linux = new(specs.Linux)
+	spec.Annotations = map[string]string{allowKvmAnnot: "full"}
+
+	if err := cfgKvmDevice(spec); err != nil {
+		t.Errorf("cfgKvmDevice: returned error: %v", err)
+	}
+
+	want := []string{"/dev/kvm", "/dev/vhost-net", "/dev/vhost-vsock"}
+	got := []string{}
+	for _, d := range spec.Linux.Devices {
+		got = append(got, d.Path)
+	}
+	if !utils.StringSliceEqual(got, want) {
+		t.Errorf("cfgKvmDevice: want devices %v; got %v", want, got)
+	}
+	if len(spec.Linux.Resources.Devices) != len(want) {
+		t.Errorf("cfgKvmDevice: want %d device cgroup rules; got %v", len(want), spec.Linux.Resources.Devices)
+	}
+
+	// Device not present on host -> skipped
+	hostDevExists = func(path string) bool { return false }
+
+	spec = new(specs.Spec)
+	spec.Linux = new(specs.Linux)
+	spec.Annotations = map[string]string{allowKvmAnnot: "true"}
+
+	if err := cfgKvmDevice(spec); err != nil {
+		t.Errorf("cfgKvmDevice: returned error: %v", err)
+	}
+	if len(spec.Linux.Devices) != 0 || len(spec.Linux.Resources.Devices) != 0 {
+		t.Errorf("cfgKvmDevice: unexpected devices added when not present on host: %v", spec.Linux.Devices)
+	}
+
+	// Invalid annotation value
+	spec.Annotations = map[string]string{allowKvmAnnot: "bad"}
+
+	if err := cfgKvmDevice(spec); err == nil {
+		t.Errorf("cfgKvmDevice: expected failure due to invalid annotation value, but it passed")
+	}
+}
+
+func TestCfgHostsAndResolvConf(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-etc-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origHosts, origResolv, origRunDir := hostEtcHosts, hostEtcResolvConf, sysboxRunDir
+	defer func() {
+		hostEtcHosts, hostEtcResolvConf, sysboxRunDir = origHosts, origResolv, origRunDir
+	}()
+
+	hostHostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("failed to get hostname: %v", err)
+	}
+
+	hostEtcHosts = filepath.Join(tmpDir, "hosts")
+	hostEtcResolvConf = filepath.Join(tmpDir, "resolv.conf")
+	sysboxRunDir = filepath.Join(tmpDir, "run")
+
+	hosts := "127.0.0.1\tlocalhost\n127.0.1.1\t" + hostHostname + "\n"
+	resolv := "search example.com\nnameserver 10.0.0.1\n"
+
+	if err := ioutil.WriteFile(hostEtcHosts, []byte(hosts), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(hostEtcResolvConf, []byte(resolv), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := new(specs.Spec)
+	spec.Hostname = "syscont"
+
+	if err := cfgHostsAndResolvConf(spec, "cid"); err != nil {
+		t.Fatalf("cfgHostsAndResolvConf: returned error: %v", err)
+	}
+
+	// the files are only generated after the spec conversion
+	if _, err := os.Stat(filepath.Join(sysboxRunDir, "cid")); !os.IsNotExist(err) {
+		t.Errorf("cfgHostsAndResolvConf: files generated before the spec conversion completed")
+	}
+	if err := genHostsAndResolvConf(spec, "cid"); err != nil {
+		t.Fatalf("genHostsAndResolvConf: returned error: %v", err)
+	}
+
+	genHosts := filepath.Join(sysboxRunDir, "cid", "etc", "hosts")
+	genResolv := filepath.Join(sysboxRunDir, "cid", "etc", "resolv.conf")
+
+	wantMounts := []specs.Mount{
+		{
+			Destination: "/etc/hosts",
+			Source:      genHosts,
+			Type:        "bind",
+			Options:     []string{"rbind", "rprivate"},
+		},
+		{
+			Destination: "/etc/resolv.conf",
+			Source:      genResolv,
+			Type:        "bind",
+			Options:     []string{"rbind", "rprivate"},
+		},
+	}
+
+	if !utils.MountSliceEqual(spec.Mounts, wantMounts) {
+		t.Errorf("cfgHostsAndResolvConf: mounts mismatch: want %v, got %v", wantMounts, spec.Mounts)
+	}
+
+	data, err := ioutil.ReadFile(genHosts)
+	if err != nil {
+		t.Fatalf("cfgHostsAndResolvConf: failed to read %s: %v", genHosts, err)
+	}
+	want := "127.0.0.1\tlocalhost\n127.0.1.1\tsyscont\n"
+	if string(data) != want {
+		t.Errorf("cfgHostsAndResolvConf: hosts mismatch: want %q, got %q", want, string(data))
+	}
+
+	data, err = ioutil.ReadFile(genResolv)
+	if err != nil {
+		t.Fatalf("cfgHostsAndResolvConf: failed to read %s: %v", genResolv, err)
+	}
+	want = "nameserver 127.0.0.53\nsearch example.com\nnameserver 10.0.0.1\n"
+	if string(data) != want {
+		t.Errorf("cfgHostsAndResolvConf: resolv.conf mismatch: want %q, got %q", want, string(data))
+	}
+
+	// The files are removed along with the container's run dir
+	if err := RemoveRunDir("cid"); err != nil {
+		t.Fatalf("RemoveRunDir: returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(sysboxRunDir, "cid")); !os.IsNotExist(err) {
+		t.Errorf("RemoveRunDir: %s not removed", filepath.Join(sysboxRunDir, "cid"))
+	}
+
+	// An empty hostname defaults to the container ID
+	spec = new(specs.Spec)
+	if err := cfgHostsAndResolvConf(spec, "cid"); err != nil {
+		t.Fatalf("cfgHostsAndResolvConf: returned error: %v", err)
+	}
+	if spec.Hostname != "cid" {
+		t.Errorf("cfgHostsAndResolvConf: want hostname cid, got %q", spec.Hostname)
+	}
+
+	// Spec with existing mounts at both paths -> left untouched
+	spec = new(specs.Spec)
+	spec.Mounts = []specs.Mount{
+		{Destination: "/etc/hosts", Source: "/some/hosts", Type: "bind"},
+		{Destination: "/etc/resolv.conf", Source: "/some/resolv.conf", Type: "bind"},
+	}
+	origMounts := append([]specs.Mount{}, spec.Mounts...)
+
+	if err := cfgHostsAndResolvConf(spec, "cid2"); err != nil {
+		t.Fatalf("cfgHostsAndResolvConf: returned error: %v", err)
+	}
+	if !utils.MountSliceEqual(spec.Mounts, origMounts) {
+		t.Errorf("cfgHostsAndResolvConf: existing mounts modified: want %v, got %v", origMounts, spec.Mounts)
+	}
+	if err := genHostsAndResolvConf(spec, "cid2"); err != nil {
+		t.Fatalf("genHostsAndResolvConf: returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(sysboxRunDir, "cid2")); !os.IsNotExist(err) {
+		t.Errorf("genHostsAndResolvConf: unexpected files generated")
+	}
+}
+
+func TestCfgCapabilitiesDenyCaps(t *testing.T) {
+
+	// No annotation: root gets all caps
+	p := &specs.Process{
+		User:         specs.User{UID: 0},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	if err := cfgCapabilities(p, nil); err != nil {
+		t.Fatalf("cfgCapabilities: returned error: %v", err)
+	}
+	if !utils.StringSliceEqual(p.Capabilities.Effective, linuxCaps) {
+		t.Errorf("cfgCapabilities: root caps mismatch: want %v, got %v", linuxCaps, p.Capabilities.Effective)
+	}
+
+	// Denied caps are removed from all sets, even for root
+	annotations := map[string]string{denyCapsAnnot: "CAP_SYS_MODULE, cap_sys_rawio"}
+	p = &specs.Process{
+		User:         specs.User{UID: 0},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	if err := cfgCapabilities(p, annotations); err != nil {
+		t.Fatalf("cfgCapabilities: returned error: %v", err)
+	}
+
+	want := utils.StringSliceRemove(linuxCaps, []string{"CAP_SYS_MODULE", "CAP_SYS_RAWIO"})
+	caps := p.Capabilities
+	for _, set := range [][]string{caps.Bounding, caps.Effective, caps.Inheritable, caps.Permitted, caps.Ambient} {
+		if !utils.StringSliceEqual(set, want) {
+			t.Errorf("cfgCapabilities: deny-caps mismatch: want %v, got %v", want, set)
+		}
+	}
+
+	// linuxCaps itself must not be modified
+	if !utils.StringSliceContains(linuxCaps, "CAP_SYS_MODULE") {
+		t.Errorf("cfgCapabilities: linuxCaps was modified")
+	}
+
+	// Denied caps are removed from the bounding set of non-root processes
+	p = &specs.Process{
+		User:         specs.User{UID: 1000},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	if err := cfgCapabilities(p, annotations); err != nil {
+		t.Fatalf("cfgCapabilities: returned error: %v", err)
+	}
+	if !utils.StringSliceEqual(p.Capabilities.Bounding, want) {
+		t.Errorf("cfgCapabilities: non-root bounding caps mismatch: want %v, got %v", want, p.Capabilities.Bounding)
+	}
+	if len(p.Capabilities.Effective) != 0 {
+		t.Errorf("cfgCapabilities: non-root effective caps not empty: %v", p.Capabilities.Effective)
+	}
+
+	// Invalid cap name
+	annotations = map[string]string{denyCapsAnnot: "CAP_SYS_MODULE,CAP_BOGUS"}
+	p = &specs.Process{
+		User:         specs.User{UID: 0},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	if err := cfgCapabilities(p, annotations); err == nil {
+		t.Errorf("cfgCapabilities: expected error for invalid cap name")
+	}
+
+	// Cap both denied and granted to the same uid
+	annotations = map[string]string{
+		denyCapsAnnot:                 "CAP_SYS_MODULE",
+		extraCapsAnnotPrefix + "1000": "CAP_NET_ADMIN,CAP_SYS_MODULE",
+	}
+	p = &specs.Process{
+		User:         specs.User{UID: 1000},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	if err := cfgCapabilities(p, annotations); err == nil {
+		t.Errorf("cfgCapabilities: expected error for contradictory deny-caps and extra-caps")
+	}
+
+	// ... but not if granted to a different uid
+	p = &specs.Process{
+		User:         specs.User{UID: 0},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	if err := cfgCapabilities(p, annotations); err != nil {
+		t.Errorf("cfgCapabilities: returned error: %v", err)
+	}
+
+	// Extra caps are granted to processes of the given uid only
+	annotations = map[string]string{
+		extraCapsAnnotPrefix + "1000": "cap_net_admin, CAP_NET_RAW",
+	}
+	want = []string{"CAP_NET_ADMIN", "CAP_NET_RAW"}
+	p = &specs.Process{
+		User:         specs.User{UID: 1000},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	if err := cfgCapabilities(p, annotations); err != nil {
+		t.Fatalf("cfgCapabilities: returned error: %v", err)
+	}
+	for _, set := range [][]string{p.Capabilities.Effective, p.Capabilities.Inheritable,
+		p.Capabilities.Permitted, p.Capabilities.Ambient} {
+		if !utils.StringSliceEqual(set, want) {
+			t.Errorf("cfgCapabilities: extra-caps mismatch: want %v, got %v", want, set)
+		}
+	}
+	if !utils.StringSliceEqual(p.Capabilities.Bounding, linuxCaps) {
+		t.Errorf("cfgCapabilities: extra-caps bounding caps mismatch: want %v, got %v", linuxCaps, p.Capabilities.Bounding)
+	}
+
+	p = &specs.Process{
+		User:         specs.User{UID: 1001},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	if err := cfgCapabilities(p, annotations); err != nil {
+		t.Fatalf("cfgCapabilities: returned error: %v", err)
+	}
+	if len(p.Capabilities.Effective) != 0 {
+		t.Errorf("cfgCapabilities: extra-caps granted to the wrong uid: %v", p.Capabilities.Effective)
+	}
+
+	// Invalid extra cap name
+	annotations = map[string]string{extraCapsAnnotPrefix + "1000": "CAP_BOGUS"}
+	p = &specs.Process{
+		User:         specs.User{UID: 1000},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	if err := cfgCapabilities(p, annotations); err == nil {
+		t.Errorf("cfgCapabilities: expected error for invalid extra cap name")
+	}
+}
+
+func TestIsInsideSysboxContainer(t *testing.T) {
+	origMarker := innerContainerMarker
+	origUserNS := runningInUserNS
+	defer func() {
+		innerContainerMarker = origMarker
+		runningInUserNS = origUserNS
+	}()
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-inner-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	innerContainerMarker = filepath.Join(tmpDir, "inner-container")
+	runningInUserNS = func() bool { return false }
+
+	if isInsideSysboxContainer() {
+		t.Errorf("isInsideSysboxContainer: want false without marker and user-ns")
+	}
+
+	runningInUserNS = func() bool { return true }
+	if !isInsideSysboxContainer() {
+		t.Errorf("isInsideSysboxContainer: want true when in a user-ns")
+	}
+
+	runningInUserNS = func() bool { return false }
+	if err := ioutil.WriteFile(innerContainerMarker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !isInsideSysboxContainer() {
+		t.Errorf("isInsideSysboxContainer: want true when marker is present")
+	}
+}
+
+func TestCfgCapabilitiesInnerContainer(t *testing.T) {
+	origCheck := innerContainerCheck
+	origForce := ForceFullCaps
+	defer func() {
+		innerContainerCheck = origCheck
+		ForceFullCaps = origForce
+	}()
+
+	innerContainerCheck = func() bool { return true }
+
+	p := &specs.Process{
+		User:         specs.User{UID: 0},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	if err := cfgCapabilities(p, nil); err != nil {
+		t.Fatalf("cfgCapabilities: returned error: %v", err)
+	}
+
+	caps := p.Capabilities
+	for _, set := range [][]string{caps.Bounding, caps.Effective, caps.Inheritable, caps.Permitted, caps.Ambient} {
+		if utils.StringSliceContains(set, "CAP_SYS_MODULE") || utils.StringSliceContains(set, "CAP_SYS_RAWIO") {
+			t.Errorf("cfgCapabilities: inner container has host-only caps: %v", set)
+		}
+		if !utils.StringSliceContains(set, "CAP_SYS_ADMIN") {
+			t.Errorf("cfgCapabilities: inner container lacks CAP_SYS_ADMIN: %v", set)
+		}
+		for _, c := range set {
+			if !utils.StringSliceContains(innerContainerCaps, c) {
+				t.Errorf("cfgCapabilities: inner container cap %s not in innerContainerCaps", c)
+			}
+		}
+	}
+
+	// non-root processes get the reduced bounding set
+	p = &specs.Process{
+		User:         specs.User{UID: 1000},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	if err := cfgCapabilities(p, nil); err != nil {
+		t.Fatalf("cfgCapabilities: returned error: %v", err)
+	}
+	if utils.StringSliceContains(p.Capabilities.Bounding, "CAP_SYS_MODULE") {
+		t.Errorf("cfgCapabilities: inner container non-root bounding set has CAP_SYS_MODULE")
+	}
+
+	// the reduction can be overridden
+	ForceFullCaps = true
+	p = &specs.Process{
+		User:         specs.User{UID: 0},
+		Capabilities: &specs.LinuxCapabilities{},
+	}
+	if err := cfgCapabilities(p, nil); err != nil {
+		t.Fatalf("cfgCapabilities: returned error: %v", err)
+	}
+	if !utils.StringSliceEqual(p.Capabilities.Effective, linuxCaps) {
+		t.Errorf("cfgCapabilities: force-full-caps mismatch: want %v, got %v", linuxCaps, p.Capabilities.Effective)
+	}
+}
+
+func TestCfgSysboxFsMounts(t *testing.T) {
+
+	origMounts := make([]specs.Mount, len(sysboxFsMounts))
+	copy(origMounts, sysboxFsMounts)
+	defer func() { sysboxFsMounts = origMounts }()
+
+	sysFs := sysbox.NewFs("cid", true)
+
+	spec := new(specs.Spec)
+	spec.Mounts = []specs.Mount{
+		{Destination: "/proc/sys/kernel/pid_max/", Source: "/some/pid_max", Type: "bind"},
+		{Destination: "/proc/sys/kernel/threads-max", Source: "/some/threads-max", Type: "bind"},
+		{Destination: "/data", Source: "/some/data", Type: "bind"},
+	}
+
+	cfgSysboxFsMounts(spec, sysFs)
+
+	cntrMountpoint := filepath.Join(SysboxFsDir, "cid")
+
+	for _, dest := range []string{"/proc/sys/kernel/ngroups_max", "/proc/sys/kernel/pid_max", "/proc/sys/kernel/threads-max"} {
+		found := 0
+		for _, m := range spec.Mounts {
+			if filepath.Clean(m.Destination) != dest {
+				continue
+			}
+			found++
+			if m.Source != filepath.Join(cntrMountpoint, dest) {
+				t.Errorf("cfgSysboxFsMounts: invalid source for %s: %s", dest, m.Source)
+			}
+		}
+		if found != 1 {
+			t.Errorf("cfgSysboxFsMounts: want 1 mount at %s, got %d", dest, found)
+		}
+	}
+
+	found := false
+	for _, m := range spec.Mounts {
+		if m.Destination == "/data" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("cfgSysboxFsMounts: non-conflicting user mount was removed")
+	}
+}
+
+func TestCfgSysboxFsMountsVmSysctls(t *testing.T) {
+
+	origMounts := make([]specs.Mount, len(sysboxFsMounts))
+	copy(origMounts, sysboxFsMounts)
+	defer func() { sysboxFsMounts = origMounts }()
+
+	cntrMountpoint := filepath.Join(SysboxFsDir, "cid")
+
+	userMounts := func() []specs.Mount {
+		return []specs.Mount{
+			{Destination: "/proc/sys/vm/swappiness", Source: "/some/swappiness", Type: "bind"},
+			{Destination: "/proc/sys/vm/min_free_kbytes", Source: "/some/min_free_kbytes", Type: "bind"},
+		}
+	}
+
+	mountsAt := func(spec *specs.Spec, dest string) []specs.Mount {
+		var mounts []specs.Mount
+		for _, m := range spec.Mounts {
+			if filepath.Clean(m.Destination) == dest {
+				mounts = append(mounts, m)
+			}
+		}
+		return mounts
+	}
+
+	// user mounts over vm sysctls are ignored by default
+	copy(sysboxFsMounts, origMounts)
+	spec := new(specs.Spec)
+	spec.Mounts = userMounts()
+
+	if err := cfgSysboxFsMounts(spec, sysbox.NewFs("cid", true)); err != nil {
+		t.Fatalf("cfgSysboxFsMounts: unexpected error: %v", err)
+	}
+
+	for _, dest := range []string{"/proc/sys/vm/swappiness", "/proc/sys/vm/dirty_ratio",
+		"/proc/sys/vm/dirty_background_ratio", "/proc/sys/vm/overcommit_memory"} {
+		m := mountsAt(spec, dest)
+		if len(m) != 1 || m[0].Source != filepath.Join(cntrMountpoint, dest) {
+			t.Errorf("cfgSysboxFsMounts: want sysbox-fs mount at %s; got %v", dest, m)
+		}
+	}
+	if m := mountsAt(spec, "/proc/sys/vm/min_free_kbytes"); len(m) != 0 {
+		t.Errorf("cfgSysboxFsMounts: user vm sysctl mount not removed: %v", m)
+	}
+
+	// the annotation allows them (and they replace the sysbox-fs mounts)
+	copy(sysboxFsMounts, origMounts)
+	spec = new(specs.Spec)
+	spec.Annotations = map[string]string{allowVmSysctlsAnnot: "true"}
+	spec.Mounts = userMounts()
+
+	if err := cfgSysboxFsMounts(spec, sysbox.NewFs("cid", true)); err != nil {
+		t.Fatalf("cfgSysboxFsMounts: unexpected error: %v", err)
+	}
+
+	if m := mountsAt(spec, "/proc/sys/vm/swappiness"); len(m) != 1 || m[0].Source != "/some/swappiness" {
+		t.Errorf("cfgSysboxFsMounts: want user mount at /proc/sys/vm/swappiness; got %v", m)
+	}
+	if m := mountsAt(spec, "/proc/sys/vm/min_free_kbytes"); len(m) != 1 {
+		t.Errorf("cfgSysboxFsMounts: want user mount at /proc/sys/vm/min_free_kbytes; got %v", m)
+	}
+	if m := mountsAt(spec, "/proc/sys/vm/overcommit_memory"); len(m) != 1 || m[0].Source != filepath.Join(cntrMountpoint, "/proc/sys/vm/overcommit_memory") {
+		t.Errorf("cfgSysboxFsMounts: want sysbox-fs mount at /proc/sys/vm/overcommit_memory; got %v", m)
+	}
+
+	// invalid annotation
+	copy(sysboxFsMounts, origMounts)
+	spec = new(specs.Spec)
+	spec.Annotations = map[string]string{allowVmSysctlsAnnot: "yes"}
+
+	if err := cfgSysboxFsMounts(spec, sysbox.NewFs("cid", true)); err == nil {
+		t.Errorf("cfgSysboxFsMounts: want error for invalid annotation %s", allowVmSysctlsAnnot)
+	}
+}
+
+func TestCfgSysboxFsMountsPropagation(t *testing.T) {
+
+	origMounts := make([]specs.Mount, len(sysboxFsMounts))
+	copy(origMounts, sysboxFsMounts)
+	defer func() { sysboxFsMounts = origMounts }()
+
+	for _, mode := range []string{"", "rprivate", "rslave", "rshared"} {
+		spec := new(specs.Spec)
+		if mode != "" {
+			spec.Annotations = map[string]string{mountPropagationAnnot: mode}
+		}
+
+		if err := cfgSysboxFsMounts(spec, sysbox.NewFs("cid", true)); err != nil {
+			t.Fatalf("cfgSysboxFsMounts(%q): unexpected error: %v", mode, err)
+		}
+
+		want := mode
+		if want == "" {
+			want = "rprivate"
+		}
+
+		if len(spec.Mounts) != len(sysboxFsMounts) {
+			t.Fatalf("cfgSysboxFsMounts(%q): want %d mounts; got %d", mode, len(sysboxFsMounts), len(spec.Mounts))
+		}
+
+		for _, m := range spec.Mounts {
+			propagation := []string{}
+			for _, opt := range m.Options {
+				if utils.StringSliceContains(propagationOpts, opt) {
+					propagation = append(propagation, opt)
+				}
+			}
+			if len(propagation) != 1 || propagation[0] != want {
+				t.Errorf("cfgSysboxFsMounts(%q): mount at %s has propagation %v", mode, m.Destination, propagation)
+			}
+			if !utils.StringSliceContains(m.Options, "rbind") {
+				t.Errorf("cfgSysboxFsMounts(%q): mount at %s lost its rbind option: %v", mode, m.Destination, m.Options)
+			}
+		}
+	}
+
+	// the default mounts are not modified
+	for _, m := range sysboxFsMounts {
+		if !utils.StringSliceContains(m.Options, "rprivate") {
+			t.Errorf("cfgSysboxFsMounts: sysboxFsMounts entry %s was modified: %v", m.Destination, m.Options)
+		}
+	}
+
+	spec := new(specs.Spec)
+	spec.Annotations = map[string]string{mountPropagationAnnot: "slave"}
+	if err := cfgSysboxFsMounts(spec, sysbox.NewFs("cid", true)); err == nil {
+		t.Errorf("cfgSysboxFsMounts: expected error for invalid propagation mode")
+	}
+}
+
+func TestCfgSysboxFsMountsTimersIrqs(t *testing.T) {
+
+	origMounts := make([]specs.Mount, len(sysboxFsMounts))
+	copy(origMounts, sysboxFsMounts)
+	origSourceExists := sysboxFsSourceExists
+	defer func() {
+		sysboxFsMounts = origMounts
+		sysboxFsSourceExists = origSourceExists
+	}()
+
+	cntrMountpoint := filepath.Join(SysboxFsDir, "cid")
+
+	// sysbox-fs does not expose timer_stats (e.g., kernel >= 4.11); missing
+	// sources of required mounts (e.g., /proc/uptime) are not skipped though
+	sysboxFsSourceExists = func(path string) bool {
+		return path != filepath.Join(cntrMountpoint, "proc/timer_stats") &&
+			path != filepath.Join(cntrMountpoint, "proc/uptime")
+	}
+
+	spec := new(specs.Spec)
+	spec.Mounts = []specs.Mount{
+		{Destination: "/proc/irq/0/smp_affinity", Source: "/some/smp_affinity", Type: "bind"},
+		{Destination: "/proc/irq/", Source: "/some/irq", Type: "bind"},
+		{Destination: "/proc/interrupts", Source: "/some/interrupts", Type: "bind"},
+		{Destination: "/proc/irqfoo", Source: "/some/irqfoo", Type: "bind"},
+	}
+
+	if err := cfgSysboxFsMounts(spec, sysbox.NewFs("cid", true)); err != nil {
+		t.Fatalf("cfgSysboxFsMounts: unexpected error: %v", err)
+	}
+
+	found := make(map[string][]string)
+	for _, m := range spec.Mounts {
+		dest := filepath.Clean(m.Destination)
+		found[dest] = append(found[dest], m.Source)
+	}
+
+	for _, dest := range []string{"/proc/interrupts", "/proc/irq", "/proc/timer_list", "/proc/uptime"} {
+		want := []string{filepath.Join(cntrMountpoint, dest)}
+		if !reflect.DeepEqual(found[dest], want) {
+			t.Errorf("cfgSysboxFsMounts: want mounts %v at %s; got %v", want, dest, found[dest])
+		}
+	}
+
+	if srcs, ok := found["/proc/timer_stats"]; ok {
+		t.Errorf("cfgSysboxFsMounts: mount with missing source not skipped: %v", srcs)
+	}
+	if srcs, ok := found["/proc/irq/0/smp_affinity"]; ok {
+		t.Errorf("cfgSysboxFsMounts: user mount under /proc/irq/ not removed: %v", srcs)
+	}
+	if !reflect.DeepEqual(found["/proc/irqfoo"], []string{"/some/irqfoo"}) {
+		t.Errorf("cfgSysboxFsMounts: non-conflicting user mount was removed: %v", found["/proc/irqfoo"])
+	}
+}
+
+func TestCheckSysboxFsHealth(t *testing.T) {
+
+	healthy := map[string]string{
+		"proc/uptime":             "35245.67 138271.43\n",
+		"proc/swaps":              "Filename\t\t\t\tType\t\tSize\t\tUsed\t\tPriority\n",
+		"proc/sys/kernel/pid_max": "4194304\n",
+	}
+
+	unhealthy := map[string]string{
+		"proc/uptime":             "35245.67 abc\n",
+		"proc/swaps":              "garbage",
+		"proc/sys/kernel/pid_max": "",
+	}
+
+	setup := func(files map[string]string) string {
+		dir, err := ioutil.TempDir("", "sysbox-fs-health-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for path, data := range files {
+			path = filepath.Join(dir, path)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return dir
+	}
+
+	dir := setup(healthy)
+	defer os.RemoveAll(dir)
+
+	if err := checkSysboxFsHealth(dir); err != nil {
+		t.Errorf("checkSysboxFsHealth: unexpected error on healthy dir: %v", err)
+	}
+
+	// each unhealthy file must be detected and reported
+	for path, data := range unhealthy {
+		files := make(map[string]string)
+		for k, v := range healthy {
+			files[k] = v
+		}
+		files[path] = data
+
+		dir := setup(files)
+		defer os.RemoveAll(dir)
+
+		err := checkSysboxFsHealth(dir)
+		if err == nil || !strings.Contains(err.Error(), path) {
+			t.Errorf("checkSysboxFsHealth: want error for %s; got %v", path, err)
+		}
+	}
+
+	// missing file
+	dir = setup(map[string]string{"proc/uptime": healthy["proc/uptime"]})
+	defer os.RemoveAll(dir)
+
+	if err := checkSysboxFsHealth(dir); err == nil {
+		t.Errorf("checkSysboxFsHealth: expected error on missing files")
+	}
+
+	// unresponsive file: opening a fifo with no writer blocks
+	dir = setup(healthy)
+	defer os.RemoveAll(dir)
+
+	fifo := filepath.Join(dir, "proc/swaps")
+	os.Remove(fifo)
+	if err := unix.Mkfifo(fifo, 0644); err != nil {
+		t.Fatalf("failed to create fifo: %v", err)
+	}
+
+	err := checkSysboxFsHealth(dir)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("checkSysboxFsHealth: want timeout error on unresponsive file; got %v", err)
+	}
+
+}
+
+// mockCgroupManager implements the cgroup manager methods used by CfgOOMGroup
+type mockCgroupManager struct {
+	cgroups.Manager
+	cgType cgroups.CgroupType
+	path   string
+}
+
+func (m *mockCgroupManager) GetType() cgroups.CgroupType {
+	return m.cgType
+}
+
+func (m *mockCgroupManager) Path(string) string {
+	return m.path
+}
+
+func TestCfgOOMGroup(t *testing.T) {
+
+	fscommon.TestMode = true
+	defer func() { fscommon.TestMode = false }()
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-oomgroup-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oomGroupFile := filepath.Join(tmpDir, "memory.oom.group")
+
+	readOomGroup := func() string {
+		data, err := ioutil.ReadFile(oomGroupFile)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", oomGroupFile, err)
+		}
+		return string(data)
+	}
+
+	mgr := &mockCgroupManager{cgType: cgroups.Cgroup_v2_fs, path: tmpDir}
+	negScore := -500
+	posScore := 500
+
+	// no oom score adj / non-negative score -> untouched
+	for _, score := range []*int{nil, &posScore} {
+		if err := ioutil.WriteFile(oomGroupFile, []byte("0"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := CfgOOMGroup(score, mgr); err != nil {
+			t.Errorf("CfgOOMGroup: returned error: %v", err)
+		}
+		if got := readOomGroup(); got != "0" {
+			t.Errorf("CfgOOMGroup: memory.oom.group modified for score %v: %s", score, got)
+		}
+	}
+
+	// negative score on cgroup v1 -> untouched
+	mgr.cgType = cgroups.Cgroup_v1_fs
+	if err := CfgOOMGroup(&negScore, mgr); err != nil {
+		t.Errorf("CfgOOMGroup: returned error: %v", err)
+	}
+	if got := readOomGroup(); got != "0" {
+		t.Errorf("CfgOOMGroup: memory.oom.group modified on cgroup v1: %s", got)
+	}
+
+	// negative score on cgroup v2 -> oom group set
+	for _, cgType := range []cgroups.CgroupType{cgroups.Cgroup_v2_fs, cgroups.Cgroup_v2_systemd} {
+		if err := ioutil.WriteFile(oomGroupFile, []byte("0"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mgr.cgType = cgType
+		if err := CfgOOMGroup(&negScore, mgr); err != nil {
+			t.Errorf("CfgOOMGroup: returned error: %v", err)
+		}
+		if got := readOomGroup(); got != "1" {
+			t.Errorf("CfgOOMGroup: memory.oom.group not set: want 1, got %s", got)
+		}
+	}
+}
+
+func TestCfgNetworkIsolation(t *testing.T) {
+
+	// No annotation -> no hooks
+	spec := new(specs.Spec)
+	if err := cfgNetworkIsolation(spec, "cid"); err != nil {
+		t.Errorf("cfgNetworkIsolation: returned error: %v", err)
+	}
+	if spec.Hooks != nil {
+		t.Errorf("cfgNetworkIsolation: unexpected hooks without annotation: %+v", spec.Hooks)
+	}
+
+	// Invalid annotation value
+	spec = new(specs.Spec)
+	spec.Annotations = map[string]string{netIsolationAnnot: "loose"}
+	if err := cfgNetworkIsolation(spec, "cid"); err == nil {
+		t.Errorf("cfgNetworkIsolation: expected error for invalid annotation value")
+	}
+
+	// Strict isolation -> prestart and poststop hooks
+	id := "0123456789abcdef0123456789abcdef"
+	chain := netIsolationChain(id)
+
+	if !strings.HasPrefix(chain, "SYSBOX-") || len(chain) > 28 {
+		t.Fatalf("netIsolationChain: invalid chain name %s", chain)
+	}
+	if chain != netIsolationChain(id) {
+		t.Fatalf("netIsolationChain: chain name is not deterministic")
+	}
+	// IDs sharing a long prefix must not map to the same chain
+	if other := netIsolationChain(id + "0"); other == chain {
+		t.Fatalf("netIsolationChain: IDs %s and %s0 map to the same chain %s", id, id, chain)
+	}
+
+	spec = new(specs.Spec)
+	spec.Annotations = map[string]string{netIsolationAnnot: "strict"}
+	if err := cfgNetworkIsolation(spec, id); err != nil {
+		t.Fatalf("cfgNetworkIsolation: returned error: %v", err)
+	}
+
+	if spec.Hooks == nil || len(spec.Hooks.Prestart) != 1 || len(spec.Hooks.Poststop) != 1 {
+		t.Fatalf("cfgNetworkIsolation: want 1 prestart and 1 poststop hook; got %+v", spec.Hooks)
+	}
+
+	prestart := spec.Hooks.Prestart[0]
+	if prestart.Path != "/bin/sh" || len(prestart.Args) != 3 || prestart.Args[1] != "-c" {
+		t.Fatalf("cfgNetworkIsolation: invalid prestart hook: %+v", prestart)
+	}
+
+	for _, cmd := range []string{
+		"set -e",
+		"iptables -N " + chain,
+		"ip6tables -N " + chain,
+		"iptables -I FORWARD -i $veth -j " + chain,
+		"ip6tables -I FORWARD -i $veth -j " + chain,
+	} {
+		if !strings.Contains(prestart.Args[2], cmd) {
+			t.Errorf("cfgNetworkIsolation: prestart hook missing %q: %s", cmd, prestart.Args[2])
+		}
+	}
+
+	poststop := spec.Hooks.Poststop[0]
+	if poststop.Path != "/bin/sh" || len(poststop.Args) != 3 || poststop.Args[1] != "-c" {
+		t.Fatalf("cfgNetworkIsolation: invalid poststop hook: %+v", poststop)
+	}
+
+	for _, cmd := range []string{
+		"set -e",
+		"iptables -F " + chain,
+		"iptables -X " + chain,
+		"ip6tables -F " + chain,
+		"ip6tables -X " + chain,
+	} {
+		if !strings.Contains(poststop.Args[2], cmd) {
+			t.Errorf("cfgNetworkIsolation: poststop hook missing %q: %s", cmd, poststop.Args[2])
+		}
+	}
+}
+
+func TestCheckSeccompNotNil(t *testing.T) {
+	spec := new(specs.Spec)
+	spec.Linux = new(specs.Linux)
+
+	// nil seccomp
+	if err := checkSeccompNotNil(spec, false); err != nil {
+		t.Errorf("checkSeccompNotNil: returned error when seccomp not required: %v", err)
+	}
+	if err := checkSeccompNotNil(spec, true); err == nil {
+		t.Errorf("checkSeccompNotNil: expected error when seccomp required")
+	}
+
+	// non-nil seccomp
+	spec.Linux.Seccomp = &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+	}
+	for _, required := range []bool{false, true} {
+		if err := checkSeccompNotNil(spec, required); err != nil {
+			t.Errorf("checkSeccompNotNil: returned error (required = %v): %v", required, err)
+		}
+	}
+}
+
+func TestCheckUidRangeAvailability(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-proc-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origProcRoot := procRoot
+	procRoot = tmpDir
+	defer func() {
+		procRoot = origProcRoot
+		uidMapCache.expiry = time.Time{}
+	}()
+
+	// synthetic procfs: a host process (identity mapping), a container
+	// process, and a non-pid entry that must be ignored.
+	uidMaps := map[string]string{
+		"1":    "         0          0 4294967295\n",
+		"1234": "         0     296608      65536\n",
+		"self": "         0     231072      65536\n",
+	}
+
+	for dir, uidMap := range uidMaps {
+		if err := os.Mkdir(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, dir, "uid_map"), []byte(uidMap), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	uidMapCache.expiry = time.Time{}
+
+	tests := []struct {
+		uid   uint32
+		size  uint32
+		avail bool
+	}{
+		{231072, 65536, true},
+		{296608, 65536, false},
+		{231073, 65536, false},
+		{362144, 65536, true},
+		{100000, 1, true},
+	}
+
+	for _, test := range tests {
+		err := checkUidRangeAvailability(test.uid, test.size)
+		if test.avail && err != nil {
+			t.Errorf("checkUidRangeAvailability(%d, %d): unexpected error: %v", test.uid, test.size, err)
+		}
+		if !test.avail && err == nil {
+			t.Errorf("checkUidRangeAvailability(%d, %d): expected error, got none", test.uid, test.size)
+		}
+	}
+
+	// results are cached: a new container process is not seen until the
+	// cache expires
+	if err := os.Mkdir(filepath.Join(tmpDir, "5678"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "5678", "uid_map"), []byte("0 231072 65536\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkUidRangeAvailability(231072, 65536); err != nil {
+		t.Errorf("checkUidRangeAvailability: expected cached result; got error: %v", err)
+	}
+
+	uidMapCache.expiry = time.Time{}
+
+	if err := checkUidRangeAvailability(231072, 65536); err == nil {
+		t.Errorf("checkUidRangeAvailability: expected error after cache expiry, got none")
+	}
+}
+
+func TestApplyMountLabel(t *testing.T) {
+	label := "system_u:object_r:container_file_t:s0:c1,c2"
+
+	// bind mounts get the context option
+	m := specs.Mount{Destination: "/proc/sys", Source: "/some/sys", Type: "bind", Options: []string{"rbind", "rprivate"}}
+	applyMountLabel(&m, label)
+	want := []string{"rbind", "rprivate", `context="system_u:object_r:container_file_t:s0:c1,c2"`}
+	if !utils.StringSliceEqual(m.Options, want) {
+		t.Errorf("applyMountLabel: want options %v; got %v", want, m.Options)
+	}
+
+	// the context option is not added twice
+	applyMountLabel(&m, label)
+	if !utils.StringSliceEqual(m.Options, want) {
+		t.Errorf("applyMountLabel: want options %v; got %v", want, m.Options)
+	}
+
+	// non-bind mounts are left untouched
+	m = specs.Mount{Destination: "/dev/mqueue", Source: "mqueue", Type: "mqueue", Options: []string{"nosuid"}}
+	applyMountLabel(&m, label)
+	if !utils.StringSliceEqual(m.Options, []string{"nosuid"}) {
+		t.Errorf("applyMountLabel: non-bind mount options modified: %v", m.Options)
+	}
+
+	// no label (i.e., no SELinux)
+	m = specs.Mount{Destination: "/proc/sys", Source: "/some/sys", Type: "bind", Options: []string{"rbind"}}
+	applyMountLabel(&m, "")
+	if !utils.StringSliceEqual(m.Options, []string{"rbind"}) {
+		t.Errorf("applyMountLabel: options modified with empty label: %v", m.Options)
+	}
+}
+
+func TestValidateMountLabel(t *testing.T) {
+	valid := []string{
+		"",
+		"system_u:object_r:container_file_t:s0",
+		"system_u:object_r:container_file_t:s0:c1,c2",
+	}
+	invalid := []string{
+		"container_file_t",
+		"system_u:object_r:container_file_t",
+		"system_u::container_file_t:s0",
+	}
+
+	for _, l := range valid {
+		if err := validateMountLabel(l); err != nil {
+			t.Errorf("validateMountLabel(%q): unexpected error: %v", l, err)
+		}
+	}
+	for _, l := range invalid {
+		if err := validateMountLabel(l); err == nil {
+			t.Errorf("validateMountLabel(%q): expected error, got none", l)
+		}
+	}
+}
+
+func TestCfgSysboxFsMountsLabel(t *testing.T) {
+
+	origMounts := make([]specs.Mount, len(sysboxFsMounts))
+	copy(origMounts, sysboxFsMounts)
+	defer func() { sysboxFsMounts = origMounts }()
+
+	spec := new(specs.Spec)
+	spec.Linux = &specs.Linux{MountLabel: "system_u:object_r:container_file_t:s0"}
+
+	cfgSysboxFsMounts(spec, sysbox.NewFs("cid", true))
+
+	for _, m := range spec.Mounts {
+		if !utils.StringSliceContains(m.Options, `context="system_u:object_r:container_file_t:s0"`) {
+			t.Errorf("cfgSysboxFsMounts: mount at %s has no context option: %v", m.Destination, m.Options)
+		}
+	}
+
+	// the sysbox-fs mount list itself must not be modified
+	for _, m := range sysboxFsMounts {
+		for _, opt := range m.Options {
+			if strings.HasPrefix(opt, "context=") {
+				t.Errorf("cfgSysboxFsMounts: sysboxFsMounts entry %s was modified: %v", m.Destination, m.Options)
+			}
+		}
+	}
+}
+
+func TestValidateInnerBridgeSubnet(t *testing.T) {
+
+	origHostBridgeNets := hostBridgeNets
+	defer func() { hostBridgeNets = origHostBridgeNets }()
+
+	hostBridgeNets = func() ([]*net.IPNet, error) {
+		_, docker0, _ := net.ParseCIDR("172.17.0.0/16")
+		return []*net.IPNet{docker0}, nil
+	}
+
+	tests := []struct {
+		cidr  string
+		bip   string
+		valid bool
+	}{
+		{"172.20.0.0/16", "172.20.0.1/16", true},
+		{"10.10.0.0/24", "10.10.0.1/24", true},
+		{"192.168.100.0/24", "192.168.100.1/24", true},
+		{"172.17.5.0/24", "", false}, // overlaps docker0
+		{"172.16.0.0/12", "", false}, // contains docker0
+		{"8.8.8.0/24", "", false},    // not private
+		{"172.32.0.0/16", "", false}, // not private
+		{"10.0.0.0/7", "", false},    // larger than the private network
+		{"10.0.0.0/31", "", false},   // too small
+		{"fd00::/64", "", false},     // not IPv4
+		{"not-a-subnet", "", false},
+	}
+
+	for _, test := range tests {
+		bip, err := validateInnerBridgeSubnet(test.cidr)
+		if test.valid {
+			if err != nil {
+				t.Errorf("validateInnerBridgeSubnet(%s): unexpected error: %v", test.cidr, err)
+			} else if bip != test.bip {
+				t.Errorf("validateInnerBridgeSubnet(%s): want bip %s; got %s", test.cidr, test.bip, bip)
+			}
+		} else if err == nil {
+			t.Errorf("validateInnerBridgeSubnet(%s): expected error, got none", test.cidr)
+		}
+	}
+}
+
+func TestGenDockerDaemonCfg(t *testing.T) {
+
+	data, err := genDockerDaemonCfg(nil, map[string]interface{}{"bip": "172.20.0.1/16"})
+	if err != nil {
+		t.Fatalf("genDockerDaemonCfg: unexpected error: %v", err)
+	}
+	if string(data) != "{\n  \"bip\": \"172.20.0.1/16\"\n}\n" {
+		t.Errorf("genDockerDaemonCfg: unexpected config: %s", data)
+	}
+
+	// existing settings are preserved; an existing bip is replaced
+	cur := []byte(`{"debug": true, "bip": "10.0.0.1/24", "storage-driver": "overlay2"}`)
+	data, err = genDockerDaemonCfg(cur, map[string]interface{}{"bip": "172.20.0.1/16"})
+	if err != nil {
+		t.Fatalf("genDockerDaemonCfg: unexpected error: %v", err)
+	}
+
+	cfg := make(map[string]interface{})
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("genDockerDaemonCfg: invalid json: %v", err)
+	}
+	want := map[string]interface{}{"debug": true, "bip": "172.20.0.1/16", "storage-driver": "overlay2"}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("genDockerDaemonCfg: want %v; got %v", want, cfg)
+	}
+
+	if _, err := genDockerDaemonCfg([]byte("{bad json"), map[string]interface{}{"bip": "172.20.0.1/16"}); err == nil {
+		t.Errorf("genDockerDaemonCfg: expected error for invalid config")
+	}
+}
+
+func TestCfgInnerNetworkIsolation(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-inner-net-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origRunDir := sysboxRunDir
+	origHostBridgeNets := hostBridgeNets
+	defer func() {
+		sysboxRunDir = origRunDir
+		hostBridgeNets = origHostBridgeNets
+	}()
+
+	sysboxRunDir = filepath.Join(tmpDir, "run")
+	hostBridgeNets = func() ([]*net.IPNet, error) { return nil, nil }
+
+	rootfs := filepath.Join(tmpDir, "rootfs")
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc", "docker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "etc", "docker", "daemon.json"), []byte(`{"debug": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := new(specs.Spec)
+	spec.Root = &specs.Root{Path: rootfs}
+
+	// no annotation
+	if err := cfgInnerNetworkIsolation(spec, "cid"); err != nil || len(spec.Mounts) != 0 {
+		t.Errorf("cfgInnerNetworkIsolation: unexpected config without annotation (err = %v, mounts = %v)", err, spec.Mounts)
+	}
+
+	spec.Annotations = map[string]string{innerDockerBridgeAnnot: "8.8.8.0/24"}
+	if err := cfgInnerNetworkIsolation(spec, "cid"); err == nil {
+		t.Errorf("cfgInnerNetworkIsolation: expected error for invalid subnet")
+	}
+
+	spec.Annotations[innerDockerBridgeAnnot] = "172.20.0.0/16"
+	if err := cfgInnerNetworkIsolation(spec, "cid"); err != nil {
+		t.Fatalf("cfgInnerNetworkIsolation: unexpected error: %v", err)
+	}
+
+	if len(spec.Mounts) != 1 || spec.Mounts[0].Destination != "/etc/docker/daemon.json" {
+		t.Fatalf("cfgInnerNetworkIsolation: want daemon.json mount; got %v", spec.Mounts)
+	}
+
+	data, err := ioutil.ReadFile(spec.Mounts[0].Source)
+	if err != nil {
+		t.Fatalf("cfgInnerNetworkIsolation: failed to read generated config: %v", err)
+	}
+
+	cfg := make(map[string]interface{})
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("cfgInnerNetworkIsolation: invalid json: %v", err)
+	}
+	if cfg["bip"] != "172.20.0.1/16" || cfg["debug"] != true {
+		t.Errorf("cfgInnerNetworkIsolation: unexpected config %v", cfg)
+	}
+
+	// the generated config is removed along with the container's run dir
+	if err := RemoveRunDir("cid"); err != nil {
+		t.Fatalf("RemoveRunDir: returned error: %v", err)
+	}
+	if _, err := os.Stat(spec.Mounts[0].Source); !os.IsNotExist(err) {
+		t.Errorf("RemoveRunDir: %s not removed", spec.Mounts[0].Source)
+	}
+}
+
+func TestCfgInnerDockerAddressPools(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-addr-pools-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origRunDir := sysboxRunDir
+	origHostBridgeNets := hostBridgeNets
+	defer func() {
+		sysboxRunDir = origRunDir
+		hostBridgeNets = origHostBridgeNets
+	}()
+
+	sysboxRunDir = filepath.Join(tmpDir, "run")
+	hostBridgeNets = func() ([]*net.IPNet, error) {
+		_, docker0, _ := net.ParseCIDR("172.17.0.0/16")
+		return []*net.IPNet{docker0}, nil
+	}
+
+	invalid := []string{
+		`not json`,
+		`[]`,
+		`["10.10.0.0"]`,
+		`["8.8.0.0/16"]`,
+		`["fd00::/64"]`,
+		`["172.16.0.0/12"]`,
+		`["10.10.0.0/16", "10.10.128.0/20"]`,
+	}
+
+	for _, val := range invalid {
+		spec := new(specs.Spec)
+		spec.Annotations = map[string]string{dockerAddrPoolsAnnot: val}
+		if err := cfgInnerDockerAddressPools(spec, make(map[string]interface{})); err == nil {
+			t.Errorf("cfgInnerDockerAddressPools: expected error for %s", val)
+		}
+	}
+
+	rootfs := filepath.Join(tmpDir, "rootfs")
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc", "docker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "etc", "docker", "daemon.json"),
+		[]byte(`{"debug": true, "log-driver": "json-file"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := new(specs.Spec)
+	spec.Root = &specs.Root{Path: rootfs}
+	spec.Annotations = map[string]string{
+		dockerAddrPoolsAnnot: `["10.10.0.0/16", "192.168.100.0/26"]`,
+	}
+
+	if err := cfgInnerNetworkIsolation(spec, "cid"); err != nil {
+		t.Fatalf("cfgInnerNetworkIsolation: unexpected error: %v", err)
+	}
+
+	if len(spec.Mounts) != 1 || spec.Mounts[0].Destination != "/etc/docker/daemon.json" {
+		t.Fatalf("cfgInnerNetworkIsolation: want daemon.json mount; got %v", spec.Mounts)
+	}
+
+	data, err := ioutil.ReadFile(spec.Mounts[0].Source)
+	if err != nil {
+		t.Fatalf("cfgInnerNetworkIsolation: failed to read generated config: %v", err)
+	}
+
+	cfg := struct {
+		Debug     bool   `json:"debug"`
+		LogDriver string `json:"log-driver"`
+		Bip       string `json:"bip"`
+		Pools     []struct {
+			Base string `json:"base"`
+			Size int    `json:"size"`
+		} `json:"default-address-pools"`
+	}{}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("cfgInnerNetworkIsolation: invalid json: %v", err)
+	}
+
+	if !cfg.Debug || cfg.LogDriver != "json-file" || cfg.Bip != "" {
+		t.Errorf("cfgInnerNetworkIsolation: existing config not preserved: %s", data)
+	}
+
+	if len(cfg.Pools) != 2 ||
+		cfg.Pools[0].Base != "10.10.0.0/16" || cfg.Pools[0].Size != 24 ||
+		cfg.Pools[1].Base != "192.168.100.0/26" || cfg.Pools[1].Size != 26 {
+		t.Errorf("cfgInnerNetworkIsolation: unexpected address pools: %s", data)
+	}
+}
+
+func TestIPRangeOverlap(t *testing.T) {
+	test := []struct {
+		a, b    string
+		overlap bool
+	}{
+		{"10.0.0.0/8", "10.1.0.0/16", true},
+		{"10.1.0.0/16", "10.0.0.0/8", true},
+		{"10.1.0.0/16", "10.1.0.0/16", true},
+		{"10.1.2.3/16", "10.1.200.0/24", true},
+		{"10.1.0.0/16", "10.2.0.0/16", false},
+		{"192.168.0.0/24", "192.168.1.0/24", false},
+		{"172.16.0.0/12", "172.31.255.0/24", true},
+		{"172.16.0.0/12", "172.32.0.0/16", false},
+		{"fd00::/64", "fd00::/48", true},
+		{"fd00::/64", "fd01::/64", false},
+		{"10.0.0.0/8", "fd00::/8", false},
+	}
+
+	for _, tt := range test {
+		_, a, _ := net.ParseCIDR(tt.a)
+		_, b, _ := net.ParseCIDR(tt.b)
+		if got := IPRangeOverlap(a, b); got != tt.overlap {
+			t.Errorf("IPRangeOverlap(%s, %s): want %v; got %v", tt.a, tt.b, tt.overlap, got)
+		}
+	}
+}
+
+func TestCfgInnerKubeCIDRConflict(t *testing.T) {
+	origHostRoutes := hostRoutes
+	defer func() { hostRoutes = origHostRoutes }()
+
+	hostRoutes = func() ([]*net.IPNet, error) {
+		nets := []*net.IPNet{}
+		for _, r := range []string{"172.17.0.0/16", "192.168.1.0/24", "10.96.0.0/12"} {
+			_, n, _ := net.ParseCIDR(r)
+			nets = append(nets, n)
+		}
+		return nets, nil
+	}
+
+	newSpec := func(pod, svc string) *specs.Spec {
+		spec := new(specs.Spec)
+		spec.Annotations = map[string]string{}
+		if pod != "" {
+			spec.Annotations[innerKubePodCIDRAnnot] = pod
+		}
+		if svc != "" {
+			spec.Annotations[innerKubeSvcCIDRAnnot] = svc
+		}
+		return spec
+	}
+
+	test := []struct {
+		pod, svc string
+		err      bool
+		conflict string // conflicting host route, if any
+	}{
+		{"", "", false, ""},
+		{"10.244.0.0/16", "", false, ""},
+		{"10.244.0.0/16", "10.200.0.0/16", false, ""},
+		{"172.17.5.0/24", "", true, "172.17.0.0/16"},
+		{"192.168.0.0/16", "", true, "192.168.1.0/24"},
+		{"10.244.0.0/16", "10.96.0.0/16", true, "10.96.0.0/12"},
+		{"10.244.0.0/16", "10.244.128.0/20", true, ""}, // pod & svc overlap
+		{"10.244.0.0", "", true, ""},
+		{"", "bad", true, ""},
+	}
+
+	for _, tt := range test {
+		err := cfgInnerKubeCIDRConflict(newSpec(tt.pod, tt.svc))
+		if !tt.err {
+			if err != nil {
+				t.Errorf("cfgInnerKubeCIDRConflict(%q, %q): unexpected error: %v", tt.pod, tt.svc, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("cfgInnerKubeCIDRConflict(%q, %q): expected error", tt.pod, tt.svc)
+			continue
+		}
+		if tt.conflict == "" {
+			continue
+		}
+		cerr, ok := err.(*CIDRConflictError)
+		if !ok {
+			t.Errorf("cfgInnerKubeCIDRConflict(%q, %q): want CIDRConflictError; got %v", tt.pod, tt.svc, err)
+			continue
+		}
+		if len(cerr.Conflicts) != 1 || cerr.Conflicts[0].String() != tt.conflict {
+			t.Errorf("cfgInnerKubeCIDRConflict(%q, %q): want conflict with %s; got %v", tt.pod, tt.svc, tt.conflict, cerr.Conflicts)
+		}
+	}
+}
+
+func TestCfgNetSysfs(t *testing.T) {
+	mounts := []specs.Mount{
+		{Destination: "/sys/class/net/", Source: "/sys/class/net", Type: "bind"},
+		{Destination: "/sys/class/net/eth0", Source: "/sys/class/net/eth0", Type: "bind"},
+		{Destination: "/sys/class/network", Source: "/some/dir", Type: "bind"},
+		{Destination: "/data", Source: "/some/data", Type: "bind"},
+	}
+
+	// no-op without the annotation
+	spec := new(specs.Spec)
+	spec.Linux = &specs.Linux{}
+	spec.Mounts = append([]specs.Mount(nil), mounts...)
+
+	if err := cfgNetSysfs(spec); err != nil {
+		t.Fatalf("cfgNetSysfs: unexpected error: %v", err)
+	}
+	if len(spec.Mounts) != len(mounts) || len(spec.Linux.ReadonlyPaths) != 0 {
+		t.Errorf("cfgNetSysfs: unexpected changes without annotation: %v, %v", spec.Mounts, spec.Linux.ReadonlyPaths)
+	}
+
+	spec.Annotations = map[string]string{readonlyNetSysfsAnnot: "true"}
+	spec.Linux.ReadonlyPaths = []string{"/proc/bus"}
+
+	if err := cfgNetSysfs(spec); err != nil {
+		t.Fatalf("cfgNetSysfs: unexpected error: %v", err)
+	}
+
+	if len(spec.Mounts) != 2 || spec.Mounts[0].Destination != "/sys/class/network" || spec.Mounts[1].Destination != "/data" {
+		t.Errorf("cfgNetSysfs: unexpected mounts: %v", spec.Mounts)
+	}
+
+	want := []string{"/proc/bus", "/sys/class/net"}
+	if !reflect.DeepEqual(spec.Linux.ReadonlyPaths, want) {
+		t.Errorf("cfgNetSysfs: want readonly paths %v; got %v", want, spec.Linux.ReadonlyPaths)
+	}
+
+	if spec.Hooks != nil {
+		t.Errorf("cfgNetSysfs: unexpected hooks: %v", spec.Hooks)
+	}
+
+	// idempotent
+	if err := cfgNetSysfs(spec); err != nil {
+		t.Fatalf("cfgNetSysfs: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(spec.Linux.ReadonlyPaths, want) {
+		t.Errorf("cfgNetSysfs: want readonly paths %v; got %v", want, spec.Linux.ReadonlyPaths)
+	}
+
+	spec.Annotations[readonlyNetSysfsAnnot] = "yes"
+	if err := cfgNetSysfs(spec); err == nil {
+		t.Errorf("cfgNetSysfs: expected error for invalid annotation value")
+	}
+}
+
+func TestValidateNetIfaceName(t *testing.T) {
+	valid := []string{"eth0", "ens3", "enp3s0", "net1.100", "br-int", "veth_a@b", "abcdefghijklmno"}
+	invalid := []string{"", ".", "..", "abcdefghijklmnop", "eth/0", "eth:0", "eth 0", "eth0'", "$(reboot)"}
+
+	for _, name := range valid {
+		if err := validateNetIfaceName(name); err != nil {
+			t.Errorf("validateNetIfaceName(%q): unexpected error: %v", name, err)
+		}
+	}
+	for _, name := range invalid {
+		if err := validateNetIfaceName(name); err == nil {
+			t.Errorf("validateNetIfaceName(%q): expected error", name)
+		}
+	}
+}
+
+func TestCfgNetworkIfaceRename(t *testing.T) {
+	newSpec := func(name string) *specs.Spec {
+		spec := new(specs.Spec)
+		spec.Linux = &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{{Type: specs.NetworkNamespace}},
+		}
+		spec.Annotations = map[string]string{netIfaceNameAnnot: name}
+		return spec
+	}
+
+	// no annotation -> no hooks
+	spec := new(specs.Spec)
+	if err := cfgNetworkIfaceRename(spec); err != nil || spec.Hooks != nil {
+		t.Errorf("cfgNetworkIfaceRename: unexpected result without annotation: %v, %+v", err, spec.Hooks)
+	}
+
+	// default name -> no hooks
+	spec = newSpec("eth0")
+	if err := cfgNetworkIfaceRename(spec); err != nil || spec.Hooks != nil {
+		t.Errorf("cfgNetworkIfaceRename: unexpected result for default name: %v, %+v", err, spec.Hooks)
+	}
+
+	// invalid name
+	if err := cfgNetworkIfaceRename(newSpec("eth/0")); err == nil {
+		t.Errorf("cfgNetworkIfaceRename: expected error for invalid name")
+	}
+
+	// no network namespace (the host's interfaces must not be renamed)
+	spec = newSpec("ens3")
+	spec.Linux.Namespaces = nil
+	if err := cfgNetworkIfaceRename(spec); err == nil {
+		t.Errorf("cfgNetworkIfaceRename: expected error for container without network namespace")
+	}
+
+	spec = newSpec("ens3")
+	if err := cfgNetworkIfaceRename(spec); err != nil {
+		t.Fatalf("cfgNetworkIfaceRename: unexpected error: %v", err)
+	}
+	if spec.Hooks == nil || len(spec.Hooks.CreateRuntime) != 1 || len(spec.Hooks.Prestart) != 0 {
+		t.Fatalf("cfgNetworkIfaceRename: want 1 createRuntime hook; got %+v", spec.Hooks)
+	}
+
+	hook := spec.Hooks.CreateRuntime[0]
+	if !reflect.DeepEqual(hook, sysboxHook(netIfaceRenameHookID, netIfaceRenameCmd("eth0", "ens3"))) {
+		t.Errorf("cfgNetworkIfaceRename: unexpected hook: %v", hook)
+	}
+
+	cmd := netIfaceRenameCmd("eth0", "ens3")
+	for _, want := range []string{
+		"nsenter --target $pid --net",
+		`ip link set "eth0" down`,
+		`ip link set "eth0" name "ens3"`,
+		`ip link set "ens3" up`,
+	} {
+		if !strings.Contains(cmd, want) {
+			t.Errorf("netIfaceRenameCmd: command does not contain %q:\n%s", want, cmd)
+		}
+	}
+}
+
+func TestCfgResourceMode(t *testing.T) {
+
+	newSpec := func(mode string) *specs.Spec {
+		limit := int64(1 << 30)
+		swap := int64(2 << 30)
+		pids := int64(100)
+		shares := uint64(512)
+
+		spec := new(specs.Spec)
+		spec.Linux = &specs.Linux{
+			Resources: &specs.LinuxResources{
+				Devices: []specs.LinuxDeviceCgroup{{Allow: false, Access: "rwm"}},
+				Memory:  &specs.LinuxMemory{Limit: &limit, Swap: &swap},
+				CPU:     &specs.LinuxCPU{Shares: &shares, Cpus: "0-1"},
+				Pids:    &specs.LinuxPids{Limit: pids},
+			},
+		}
+		if mode != "" {
+			spec.Annotations = map[string]string{resourceModeAnnot: mode}
+		}
+		return spec
+	}
+
+	// no annotation and strict mode leave the limits as is
+	for _, mode := range []string{"", "strict"} {
+		spec := newSpec(mode)
+		if err := cfgResourceMode(spec); err != nil {
+			t.Errorf("cfgResourceMode(%q): unexpected error: %v", mode, err)
+		}
+		if !reflect.DeepEqual(spec.Linux.Resources, newSpec(mode).Linux.Resources) {
+			t.Errorf("cfgResourceMode(%q): resources unexpectedly changed: %+v", mode, spec.Linux.Resources)
+		}
+	}
+
+	// elastic mode
+	spec := newSpec("elastic")
+	if err := cfgResourceMode(spec); err != nil {
+		t.Fatalf("cfgResourceMode(elastic): unexpected error: %v", err)
+	}
+	mem := spec.Linux.Resources.Memory
+	if mem.Limit != nil || mem.Swap != nil || mem.Reservation == nil || *mem.Reservation != 1<<30 {
+		t.Errorf("cfgResourceMode(elastic): unexpected memory config: %+v", mem)
+	}
+	if spec.Linux.Resources.Pids.Limit != 100 || *spec.Linux.Resources.CPU.Shares != 512 {
+		t.Errorf("cfgResourceMode(elastic): non-memory resources unexpectedly changed: %+v", spec.Linux.Resources)
+	}
+
+	// elastic mode without a memory limit
+	spec = newSpec("elastic")
+	spec.Linux.Resources.Memory = nil
+	if err := cfgResourceMode(spec); err != nil || spec.Linux.Resources.Memory != nil {
+		t.Errorf("cfgResourceMode(elastic): unexpected result without memory limit: %v, %+v", err, spec.Linux.Resources)
+	}
+
+	// none mode keeps the device rules only
+	spec = newSpec("none")
+	if err := cfgResourceMode(spec); err != nil {
+		t.Fatalf("cfgResourceMode(none): unexpected error: %v", err)
+	}
+	want := &specs.LinuxResources{
+		Devices: []specs.LinuxDeviceCgroup{{Allow: false, Access: "rwm"}},
+	}
+	if !reflect.DeepEqual(spec.Linux.Resources, want) {
+		t.Errorf("cfgResourceMode(none): want %+v; got %+v", want, spec.Linux.Resources)
+	}
+
+	// unrecognized mode
+	if err := cfgResourceMode(newSpec("best-effort")); err == nil {
+		t.Errorf("cfgResourceMode: expected error for invalid mode")
+	}
+}
+
+func TestValidateCpusetNuma(t *testing.T) {
+
+	tmpDir, err := ioutil.TempDir("", "sysbox-numa-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	origSysNodeRoot := sysNodeRoot
+	sysNodeRoot = tmpDir
+	defer func() { sysNodeRoot = origSysNodeRoot }()
+
+	// no NUMA topology in sysfs -> check skipped
+	if nodes, err := validateCpusetNuma("0-3"); err != nil || nodes != nil {
+		t.Errorf("validateCpusetNuma: want check skipped without sysfs topology; got %v, %v", nodes, err)
+	}
+
+	// mock topology: cpus 0-3 on node 0, cpus 4-7 on node 1, node 2 has
+	// memory only
+	for node, cpulist := range []string{"0-3\n", "4-7\n", "\n"} {
+		dir := filepath.Join(tmpDir, "node"+strconv.Itoa(node))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "cpulist"), []byte(cpulist), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		cpus  string
+		nodes []int
+		valid bool
+	}{
+		{"0-3", []int{0}, true},
+		{"5,7", []int{1}, true},
+		{"2-5", []int{0, 1}, true},
+		{"7,0", []int{0, 1}, true},
+		{"8", nil, false},
+		{"3-1", nil, false},
+		{"abc", nil, false},
+	}
+
+	for _, test := range tests {
+		nodes, err := validateCpusetNuma(test.cpus)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("validateCpusetNuma(%q): expected error; got nodes %v", test.cpus, nodes)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("validateCpusetNuma(%q): unexpected error: %v", test.cpus, err)
+			continue
+		}
+		if !reflect.DeepEqual(nodes, test.nodes) {
+			t.Errorf("validateCpusetNuma(%q): want nodes %v; got %v", test.cpus, test.nodes, nodes)
+		}
+	}
+
+	// strict numa affinity rejects cross-node cpusets
+	spec := new(specs.Spec)
+	spec.Linux = &specs.Linux{
+		Resources: &specs.LinuxResources{
+			CPU: &specs.LinuxCPU{Cpus: "2-5"},
+		},
+	}
+
+	if err := cfgCpusetNuma(spec); err != nil {
+		t.Errorf("cfgCpusetNuma: unexpected error: %v", err)
+	}
+
+	spec.Annotations = map[string]string{numaAffinityAnnot: "strict"}
+	if err := cfgCpusetNuma(spec); err == nil {
+		t.Errorf("cfgCpusetNuma: expected error for cross-node cpuset with strict affinity")
+	}
+
+	spec.Linux.Resources.CPU.Cpus = "4-7"
+	if err := cfgCpusetNuma(spec); err != nil {
+		t.Errorf("cfgCpusetNuma: unexpected error: %v", err)
+	}
+
+	spec.Annotations[numaAffinityAnnot] = "loose"
+	if err := cfgCpusetNuma(spec); err == nil {
+		t.Errorf("cfgCpusetNuma: expected error for invalid annotation value")
+	}
+}
+
+func TestSupMountsResult(t *testing.T) {
+
+	partial := []specs.Mount{
+		{Destination: "/var/lib/docker", Source: "/var/lib/sysbox/docker/ctr", Type: "bind"},
+	}
+
+	// success
+	m, err := supMountsResult(partial, nil, false)
+	if err != nil || len(m) != 1 {
+		t.Errorf("supMountsResult: want 1 mount and no error; got %v, %v", m, err)
+	}
+
+	smErr := &sysbox.SupMountsError{Err: fmt.Errorf("connection refused"), Mounts: partial}
+
+	// partial mounts not allowed
+	if _, err := supMountsResult(nil, smErr, false); err == nil {
+		t.Errorf("supMountsResult: expected error when partial mounts are not allowed")
+	}
+
+	// partial mounts allowed
+	m, err = supMountsResult(nil, smErr, true)
+	if err != nil {
+		t.Errorf("supMountsResult: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(m, partial) {
+		t.Errorf("supMountsResult: want partial mounts %v; got %v", partial, m)
+	}
+
+	// failure with no partial mounts
+	smErr = &sysbox.SupMountsError{Err: fmt.Errorf("connection refused")}
+	if _, err := supMountsResult(nil, smErr, true); err == nil {
+		t.Errorf("supMountsResult: expected error when there are no partial mounts")
+	}
+
+	// other errors
+	if _, err := supMountsResult(nil, fmt.Errorf("some error"), true); err == nil {
+		t.Errorf("supMountsResult: expected error for non SupMountsError failure")
+	}
+}
+
+func TestApplySupMountOverrides(t *testing.T) {
+
+	supMounts := func() []specs.Mount {
+		return []specs.Mount{
+			{Destination: "/var/lib/docker", Source: "/var/lib/sysbox/docker/cid", Type: "bind", Options: []string{"rbind", "rprivate"}},
+			{Destination: "/var/lib/kubelet", Source: "/var/lib/sysbox/kubelet/cid", Type: "bind", Options: []string{"rbind", "rprivate"}},
+		}
+	}
+
+	// no overrides
+	spec := new(specs.Spec)
+	mounts, err := applySupMountOverrides(spec, supMounts())
+	if err != nil || !reflect.DeepEqual(mounts, supMounts()) {
+		t.Errorf("applySupMountOverrides: unexpected result without overrides: %v, %v", mounts, err)
+	}
+
+	// matching override
+	spec.Annotations = map[string]string{
+		supMountOverridePrefix + "var/lib/docker": `{"source": "/data/docker", "options": ["rbind", "rprivate", "nosuid"]}`,
+		"sysbox.io/other":                         "value",
+	}
+
+	mounts, err = applySupMountOverrides(spec, supMounts())
+	if err != nil {
+		t.Fatalf("applySupMountOverrides: unexpected error: %v", err)
+	}
+
+	want := supMounts()
+	want[0].Source = "/data/docker"
+	want[0].Options = []string{"rbind", "rprivate", "nosuid"}
+
+	if !reflect.DeepEqual(mounts, want) {
+		t.Errorf("applySupMountOverrides: want %v; got %v", want, mounts)
+	}
+
+	// invalid overrides
+	invalid := map[string]string{
+		supMountOverridePrefix + "var/lib/containerd": `{"source": "/data/containerd"}`,
+		supMountOverridePrefix + "var/lib/kubelet":    `{"source": "data/kubelet"}`,
+		supMountOverridePrefix + "var/lib/docker":     `{"destination": "/var/lib/other", "source": "/data/docker"}`,
+		supMountOverridePrefix + "var/lib/docker/":    `not json`,
+	}
+
+	for key, val := range invalid {
+		spec.Annotations = map[string]string{key: val}
+		if _, err := applySupMountOverrides(spec, supMounts()); err == nil {
+			t.Errorf("applySupMountOverrides: expected error for %s: %s", key, val)
+		}
+	}
+}
+
+func TestCfgRemapSupMounts(t *testing.T) {
+
+	spec := new(specs.Spec)
+
+	mounts := []specs.Mount{
+		{Destination: "/var/lib/docker", Source: "/var/lib/sysbox/docker/ctr", Type: "bind"},
+		{Destination: "/var/lib/kubelet", Source: "/var/lib/sysbox/kubelet/ctr", Type: "bind"},
+		{Destination: "/run", Source: "tmpfs", Type: "tmpfs"},
+	}
+
+	got, err := cfgRemapSupMounts(spec, 231072, 231073, mounts)
+	if err != nil {
+		t.Fatalf("cfgRemapSupMounts: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, mounts) {
+		t.Errorf("cfgRemapSupMounts: mounts changed: want %v; got %v", mounts, got)
+	}
+
+	if spec.Hooks == nil || len(spec.Hooks.Prestart) != 1 {
+		t.Fatalf("cfgRemapSupMounts: want 1 prestart hook; got %v", spec.Hooks)
+	}
+
+	hook := spec.Hooks.Prestart[0]
+	wantHook := sysboxHook(supMountChownHookID, "chown -R 231072:231073 -- '/var/lib/sysbox/docker/ctr' '/var/lib/sysbox/kubelet/ctr'")
+	if !reflect.DeepEqual(hook, wantHook) {
+		t.Errorf("cfgRemapSupMounts: want hook %v; got %v", wantHook, hook)
+	}
+
+	// no bind mounts, no hook
+	spec = new(specs.Spec)
+	if _, err := cfgRemapSupMounts(spec, 231072, 231072, mounts[2:]); err != nil {
+		t.Errorf("cfgRemapSupMounts: unexpected error: %v", err)
+	}
+	if spec.Hooks != nil {
+		t.Errorf("cfgRemapSupMounts: unexpected hooks %v", spec.Hooks)
+	}
+
+	// relative bind sources are rejected
+	badMounts := []specs.Mount{{Destination: "/var/lib/docker", Source: "docker", Type: "bind"}}
+	if _, err := cfgRemapSupMounts(new(specs.Spec), 231072, 231072, badMounts); err == nil {
+		t.Errorf("cfgRemapSupMounts: expected error for relative mount source")
+	}
+}
+
+func TestCfgSysboxMounts(t *testing.T) {
+
+	findMount := func(spec *specs.Spec, dest string) []specs.Mount {
+		found := []specs.Mount{}
+		for _, m := range spec.Mounts {
+			if m.Destination == dest {
+				found = append(found, m)
+			}
+		}
+		return found
+	}
+
+	wantProc := specs.Mount{Destination: "/proc", Source: "proc", Type: "proc", Options: []string{"noexec", "nosuid", "nodev"}}
+	wantSys := specs.Mount{Destination: "/sys", Source: "sysfs", Type: "sysfs", Options: []string{"noexec", "nosuid", "nodev"}}
+
+	tests := []struct {
+		name   string
+		mounts []specs.Mount
+	}{
+		{"absent", []specs.Mount{
+			{Destination: "/data", Source: "/some/data", Type: "bind"},
+		}},
+		{"present", []specs.Mount{
+			wantProc,
+			wantSys,
+		}},
+		{"conflicting", []specs.Mount{
+			{Destination: "/proc", Source: "/host/proc", Type: "bind", Options: []string{"rbind"}},
+			{Destination: "/sys", Source: "sysfs", Type: "sysfs", Options: []string{"ro", "nosuid"}},
+			{Destination: "/sys/fs/cgroup/memory", Source: "/host/memory", Type: "bind"},
+		}},
+	}
+
+	for _, test := range tests {
+		spec := new(specs.Spec)
+		spec.Mounts = test.mounts
+
+		cfgSysboxMounts(spec)
+
+		for _, want := range []specs.Mount{wantProc, wantSys} {
+			got := findMount(spec, want.Destination)
+			if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+				t.Errorf("cfgSysboxMounts (%s): want single mount %v; got %v", test.name, want, got)
+			}
+		}
+
+		for _, m := range spec.Mounts {
+			if strings.HasPrefix(m.Destination, "/sys/fs/cgroup/") {
+				t.Errorf("cfgSysboxMounts (%s): unexpected mount under /sys/fs/cgroup: %v", test.name, m)
+			}
+		}
+
+		if test.name == "absent" && len(findMount(spec, "/data")) != 1 {
+			t.Errorf("cfgSysboxMounts (%s): non-conflicting mount removed", test.name)
+		}
+	}
+}
+
+func TestCfgDevptsMount(t *testing.T) {
+
+	rootfs, err := ioutil.TempDir("", "sysbox-devpts-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	groupFile := filepath.Join(rootfs, "etc", "group")
+
+	tests := []struct {
+		group string
+		want  string
+	}{
+		{"root:x:0:\ntty:x:5:\nusers:x:100:\n", "gid=5"},
+		{"root:x:0:\ntty:x:4:syslog\n", "gid=4"},
+		{"root:x:0:\nusers:x:100:\n", "gid=5"}, // no tty group
+		{"", "gid=5"},                          // no /etc/group
+	}
+
+	for _, test := range tests {
+		os.Remove(groupFile)
+		if test.group != "" {
+			if err := ioutil.WriteFile(groupFile, []byte(test.group), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		spec := new(specs.Spec)
+		spec.Root = &specs.Root{Path: rootfs}
+		spec.Mounts = []specs.Mount{
+			{Destination: "/dev/ptmx", Source: "/dev/ptmx", Type: "bind", Options: []string{"bind"}},
+		}
+
+		cfgDevptsMount(spec)
+
+		if len(spec.Mounts) != 1 {
+			t.Errorf("cfgDevptsMount: want /dev/pts mount only; got %v", spec.Mounts)
+			continue
+		}
+		m := spec.Mounts[0]
+		if m.Destination != "/dev/pts" || m.Type != "devpts" || !utils.StringSliceContains(m.Options, "newinstance") {
+			t.Errorf("cfgDevptsMount: bad /dev/pts mount: %v", m)
+		}
+		if !utils.StringSliceContains(m.Options, test.want) {
+			t.Errorf("cfgDevptsMount(%q): want option %s; got %v", test.group, test.want, m.Options)
+		}
+	}
+
+	// existing /dev/pts mounts are left alone
+	spec := new(specs.Spec)
+	spec.Root = &specs.Root{Path: rootfs}
+	spec.Mounts = []specs.Mount{
+		{Destination: "/dev/pts/", Source: "devpts", Type: "devpts", Options: []string{"nosuid"}},
+	}
+	cfgDevptsMount(spec)
+	if len(spec.Mounts) != 1 || !reflect.DeepEqual(spec.Mounts[0].Options, []string{"nosuid"}) {
+		t.Errorf("cfgDevptsMount: existing /dev/pts mount changed: %v", spec.Mounts)
+	}
+}
+
+func TestCfgDevMount(t *testing.T) {
+
+	findMount := func(spec *specs.Spec, dest string) *specs.Mount {
+		for i, m := range spec.Mounts {
+			if m.Destination == dest {
+				return &spec.Mounts[i]
+			}
+		}
+		return nil
+	}
+
+	// spec with no /dev mounts
+	spec := new(specs.Spec)
+	spec.Linux = &specs.Linux{}
+
+	if err := cfgDevMount(spec); err != nil {
+		t.Fatalf("cfgDevMount: unexpected error: %v", err)
+	}
+
+	dev := findMount(spec, "/dev")
+	if dev == nil || dev.Type != "tmpfs" || !utils.StringSliceContains(dev.Options, "mode=0755") {
+		t.Errorf("cfgDevMount: bad /dev mount: %v", dev)
+	}
+	pts := findMount(spec, "/dev/pts")
+	if pts == nil || pts.Type != "devpts" || !utils.StringSliceContains(pts.Options, "newinstance") {
+		t.Errorf("cfgDevMount: bad /dev/pts mount: %v", pts)
+	}
+	shm := findMount(spec, "/dev/shm")
+	if shm == nil || shm.Type != "tmpfs" || !utils.StringSliceContains(shm.Options, "size="+defaultDevShmSize) {
+		t.Errorf("cfgDevMount: bad /dev/shm mount: %v", shm)
+	}
+
+	// basic devices are created by libcontainer, so they are not added to the spec
+	if len(spec.Linux.Devices) != 0 {
+		t.Errorf("cfgDevMount: unexpected spec devices: %v", spec.Linux.Devices)
+	}
+
+	// existing mounts are kept; the annotation sets the /dev/shm size
+	spec = new(specs.Spec)
+	spec.Linux = &specs.Linux{}
+	spec.Annotations = map[string]string{devShmSizeAnnot: "128m"}
+	spec.Mounts = []specs.Mount{
+		{Destination: "/dev", Source: "tmpfs", Type: "tmpfs", Options: []string{"nosuid", "strictatime", "mode=755", "size=65536k"}},
+		{Destination: "/dev/pts", Source: "devpts", Type: "devpts", Options: []string{"nosuid", "noexec"}},
+		{Destination: "/dev/shm", Source: "shm", Type: "tmpfs", Options: []string{"nosuid", "size=65536k"}},
+	}
+
+	if err := cfgDevMount(spec); err != nil {
+		t.Fatalf("cfgDevMount: unexpected error: %v", err)
+	}
+	if len(spec.Mounts) != 3 {
+		t.Errorf("cfgDevMount: want 3 mounts; got %v", spec.Mounts)
+	}
+	shm = findMount(spec, "/dev/shm")
+	if shm == nil || !reflect.DeepEqual(shm.Options, []string{"nosuid", "size=134217728"}) {
+		t.Errorf("cfgDevMount: bad /dev/shm mount: %v", shm)
+	}
+
+	// invalid shm size
+	spec = new(specs.Spec)
+	spec.Linux = &specs.Linux{}
+	spec.Annotations = map[string]string{devShmSizeAnnot: "lots"}
+	if err := cfgDevMount(spec); err == nil {
+		t.Errorf("cfgDevMount: expected error for invalid %s annotation", devShmSizeAnnot)
+	}
+}
+
+func TestInjectImageAnnotations(t *testing.T) {
+	spec := new(specs.Spec)
+	spec.Annotations = map[string]string{
+		devShmSizeAnnot: "64M",
+	}
+
+	labels := map[string]string{
+		devShmSizeAnnot:          "1G",
+		parentDeathSigAnnot:      "SIGKILL",
+		allowDebugfsAnnot:        "true",
+		seccompModeAnnot:         "log-only",
+		"sysbox.io/future-label": "x",
+		"maintainer":             "someone",
+	}
+
+	if err := InjectImageAnnotations(spec, labels); err != nil {
+		t.Fatalf("InjectImageAnnotations: unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		devShmSizeAnnot:     "64M",
+		parentDeathSigAnnot: "SIGKILL",
+	}
+	if !reflect.DeepEqual(spec.Annotations, want) {
+		t.Errorf("InjectImageAnnotations: want %v; got %v", want, spec.Annotations)
+	}
+
+	// spec without annotations
+	spec = new(specs.Spec)
+	if err := InjectImageAnnotations(spec, labels); err != nil {
+		t.Fatalf("InjectImageAnnotations: unexpected error: %v", err)
+	}
+	if spec.Annotations[devShmSizeAnnot] != "1G" || len(spec.Annotations) != 2 {
+		t.Errorf("InjectImageAnnotations: unexpected annotations %v", spec.Annotations)
+	}
+
+	// labels that relax the container's isolation are never taken
+	for _, annot := range []string{allowKvmAnnot, allowDebugfsAnnot, extraCapsAnnotPrefix + "1000",
+		seccompExtraProfAnnot, seccompGroupsAnnot, seccompModeAnnot,
+		supMountOverridePrefix + "/var/lib/docker", resourceModeAnnot, netPolicyIngressAnnot,
+		netPolicyEgressAnnot} {
+
+		spec = new(specs.Spec)
+		if err := InjectImageAnnotations(spec, map[string]string{annot: "x"}); err != nil {
+			t.Errorf("InjectImageAnnotations: unexpected error for label %s: %v", annot, err)
+		}
+		if spec.Annotations != nil {
+			t.Errorf("InjectImageAnnotations: label %s should be ignored; got %v", annot, spec.Annotations)
+		}
+	}
+
+	// empty sysbox labels are rejected; other empty labels are ignored
+	spec = new(specs.Spec)
+	if err := InjectImageAnnotations(spec, map[string]string{netSysctlsAnnot: " "}); err == nil {
+		t.Errorf("InjectImageAnnotations: expected error for empty label")
+	}
+	if err := InjectImageAnnotations(spec, map[string]string{"version": ""}); err != nil || spec.Annotations != nil {
+		t.Errorf("InjectImageAnnotations: unexpected result for non-sysbox label: %v, %v", err, spec.Annotations)
+	}
+}
+
+func TestExtractSysboxLabels(t *testing.T) {
+	imgConfig := ImageConfig{
+		Labels: map[string]string{
+			devShmSizeAnnot:       "1G",
+			netSysctlsAnnot:       "",
+			allowKvmAnnot:         "true",
+			"sysbox.io/x":         "",
+			"maintainer":          "someone",
+			"io.sysbox/allow-kvm": "true",
+		},
+	}
+
+	want := map[string]string{
+		devShmSizeAnnot: "1G",
+		netSysctlsAnnot: "",
+	}
+	if got := ExtractSysboxLabels(imgConfig); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractSysboxLabels: want %v; got %v", want, got)
+	}
+
+	// image without labels
+	if got := ExtractSysboxLabels(ImageConfig{}); len(got) != 0 {
+		t.Errorf("ExtractSysboxLabels: want no labels; got %v", got)
+	}
+}
+
+func TestInjectLabelsAsAnnotations(t *testing.T) {
+	spec := new(specs.Spec)
+	spec.Annotations = map[string]string{
+		allowKvmAnnot: "false",
+		"other":       "x",
+	}
+
+	InjectLabelsAsAnnotations(spec, map[string]string{
+		allowKvmAnnot:     "true",
+		allowDebugfsAnnot: "true",
+	})
+
+	want := map[string]string{
+		allowKvmAnnot:     "false",
+		allowDebugfsAnnot: "true",
+		"other":           "x",
+	}
+	if !reflect.DeepEqual(spec.Annotations, want) {
+		t.Errorf("InjectLabelsAsAnnotations: want %v; got %v", want, spec.Annotations)
+	}
+
+	// no labels: the spec is left as is
+	spec = new(specs.Spec)
+	InjectLabelsAsAnnotations(spec, nil)
+	InjectLabelsAsAnnotations(spec, map[string]string{})
+	if spec.Annotations != nil {
+		t.Errorf("InjectLabelsAsAnnotations: want nil annotations; got %v", spec.Annotations)
+	}
+}
+
+func TestLoadImageLabels(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sysbox-image-config-test")
+	if err != nil {
+		t.Fatalf("failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, imageConfigFile)
+
+	labels, err := loadImageLabels(path)
+	if err != nil || labels != nil {
+		t.Errorf("loadImageLabels: want no labels for missing file; got %v, %v", labels, err)
+	}
+
+	data := `{"architecture": "amd64", "config": {"Labels": {"sysbox.io/allow-kvm": "true"}}}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	labels, err = loadImageLabels(path)
+	if err != nil || labels[allowKvmAnnot] != "true" {
+		t.Errorf("loadImageLabels: unexpected result: %v, %v", labels, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("{bad"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadImageLabels(path); err == nil {
+		t.Errorf("loadImageLabels: expected error for invalid config")
+	}
+}
+
+func TestCfgDebugfs(t *testing.T) {
+	spec := new(specs.Spec)
+	spec.Annotations = map[string]string{allowDebugfsAnnot: "true"}
+	cfgSysboxMounts(spec)
+
+	if err := cfgDebugfs(spec); err != nil {
+		t.Fatalf("cfgDebugfs: unexpected error: %v", err)
+	}
+
+	found := false
+	for _, m := range spec.Mounts {
+		if m.Destination == "/sys/kernel/debug" {
+			found = true
+			if m.Type != "bind" || m.Source != "/sys/kernel/debug" || !utils.StringSliceContains(m.Options, "ro") {
+				t.Errorf("cfgDebugfs: unexpected debugfs mount: %+v", m)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("cfgDebugfs: debugfs mount missing")
+	}
+
+	spec.Annotations[allowDebugfsAnnot] = "yes"
+	if err := cfgDebugfs(spec); err == nil {
+		t.Errorf("cfgDebugfs: expected error for invalid annotation value")
+	}
+}
+
+func TestCfgNetSysctls(t *testing.T) {
+	spec := new(specs.Spec)
+	spec.Linux = &specs.Linux{
+		Sysctl: map[string]string{"net.ipv4.ip_forward": "0"},
+	}
+	spec.Annotations = map[string]string{
+		netSysctlsAnnot: "net.ipv4.ip_forward=1, net.core.somaxconn=1024",
+	}
+
+	if err := cfgNetSysctls(spec); err != nil {
+		t.Fatalf("cfgNetSysctls: unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"net.ipv4.ip_forward": "0",
+		"net.core.somaxconn":  "1024",
+	}
+	if !reflect.DeepEqual(spec.Linux.Sysctl, want) {
+		t.Errorf("cfgNetSysctls: want %v; got %v", want, spec.Linux.Sysctl)
+	}
+
+	for _, val := range []string{"kernel.pid_max=100", "net.ipv4.ip_forward", "net.ipv4.ip_forward="} {
+		spec.Annotations[netSysctlsAnnot] = val
+		if err := cfgNetSysctls(spec); err == nil {
+			t.Errorf("cfgNetSysctls: expected error for %q", val)
+		}
+	}
+}
+
+func TestReclaimMemoryOnStart(t *testing.T) {
+	tests := []struct {
+		val     string
+		want    uint64
+		wantErr bool
+	}{
+		{"104857600", 104857600, false},
+		{"100M", 100 << 20, false},
+		{"1g", 1 << 30, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"lots", 0, true},
+	}
+
+	if got, err := ReclaimMemoryOnStart(map[string]string{}); err != nil || got != 0 {
+		t.Errorf("ReclaimMemoryOnStart: want 0 without annotation; got %d (err %v)", got, err)
+	}
+
+	for _, test := range tests {
+		got, err := ReclaimMemoryOnStart(map[string]string{reclaimMemOnStartAnnot: test.val})
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ReclaimMemoryOnStart(%q): want error", test.val)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("ReclaimMemoryOnStart(%q): want %d; got %d (err %v)", test.val, test.want, got, err)
+		}
+	}
+}
+
+func TestParentDeathSignal(t *testing.T) {
+	tests := []struct {
+		val     string
+		want    int
+		wantErr bool
+	}{
+		{"9", 9, false},
+		{"SIGKILL", 9, false},
+		{"term", 15, false},
+		{"0", 0, true},
+		{"65", 0, true},
+		{"SIGFOO", 0, true},
+	}
+
+	if got, err := ParentDeathSignal(map[string]string{}); err != nil || got != 0 {
+		t.Errorf("ParentDeathSignal: want 0 without annotation; got %d (err %v)", got, err)
+	}
+
+	for _, test := range tests {
+		got, err := ParentDeathSignal(map[string]string{parentDeathSigAnnot: test.val})
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParentDeathSignal(%q): want error", test.val)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("ParentDeathSignal(%q): want %d; got %d (err %v)", test.val, test.want, got, err)
+		}
+	}
+
+	spec := &specs.Spec{}
+	if err := SetParentDeathSignal(spec, "SIGFOO"); err == nil || spec.Annotations != nil {
+		t.Errorf("SetParentDeathSignal: want error and no annotation for invalid signal")
+	}
+	if err := SetParentDeathSignal(spec, "KILL"); err != nil || spec.Annotations[parentDeathSigAnnot] != "KILL" {
+		t.Errorf("SetParentDeathSignal: want annotation set; got %v (err %v)", spec.Annotations, err)
+	}
+}
+
+func TestNetworkPolicyPrograms(t *testing.T) {
+	origAllow := AllowNetworkPolicyProgs
+	defer func() { AllowNetworkPolicyProgs = origAllow }()
+
+	prog := append([]byte("\x7fELF"), 2, 1, 1)
+	enc := base64.StdEncoding.EncodeToString(prog)
+
+	// the annotations are rejected unless the operator allows them
+	AllowNetworkPolicyProgs = false
+
+	if _, _, err := NetworkPolicyPrograms(map[string]string{netPolicyEgressAnnot: enc}); err == nil {
+		t.Errorf("NetworkPolicyPrograms: want error when network policy programs are not allowed")
+	}
+
+	AllowNetworkPolicyProgs = true
+
+	ingress, egress, err := NetworkPolicyPrograms(map[string]string{})
+	if err != nil || ingress != nil || egress != nil {
+		t.Errorf("NetworkPolicyPrograms: want no programs without annotations; got %v, %v (err %v)", ingress, egress, err)
+	}
+
+	ingress, egress, err = NetworkPolicyPrograms(map[string]string{netPolicyEgressAnnot: enc})
+	if err != nil || ingress != nil || !reflect.DeepEqual(egress, prog) {
+		t.Errorf("NetworkPolicyPrograms: want egress program only; got %v, %v (err %v)", ingress, egress, err)
+	}
+
+	invalid := []string{
+		"not-base64!",
+		base64.StdEncoding.EncodeToString([]byte("not an elf object")),
+	}
+	for _, val := range invalid {
+		if _, _, err := NetworkPolicyPrograms(map[string]string{netPolicyIngressAnnot: val}); err == nil {
+			t.Errorf("NetworkPolicyPrograms(%q): want error", val)
+		}
+	}
+}
+
+// convertTestSpec calls ConvertSpec on a sys container spec with the given
+// annotations, with sysbox-mgr and sysbox-fs disabled; the rootfs is owned by
+// the container's root user, so no uid shifting is needed.
+func convertTestSpec(t *testing.T, annotations map[string]string) *specs.Spec {
+	if os.Geteuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	dir, err := ioutil.TempDir("", "convert-spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// ConvertSpec runs in the bundle dir
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	if err := os.Mkdir("rootfs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown("rootfs", 165536, 165536); err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := Example()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec.Linux.Namespaces = append(spec.Linux.Namespaces, specs.LinuxNamespace{Type: specs.UserNamespace})
+	spec.Linux.UIDMappings = []specs.LinuxIDMapping{{HostID: 165536, ContainerID: 0, Size: 65536}}
+	spec.Linux.GIDMappings = []specs.LinuxIDMapping{{HostID: 165536, ContainerID: 0, Size: 65536}}
+	spec.Annotations = annotations
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.Bool("skip-capability-check", true, "")
+	context := cli.NewContext(nil, nil, cli.NewContext(nil, set, nil))
+
+	sysMgr := sysbox.NewMgr("test", false)
+	sysFs := sysbox.NewFs("test", false)
+
+	if _, _, err := ConvertSpec(context, sysMgr, sysFs, spec); err != nil {
+		t.Fatalf("ConvertSpec: unexpected error: %v", err)
+	}
+	return spec
+}
+
+func TestConvertSpecPreservesAnnotations(t *testing.T) {
+	want := map[string]string{
+		"com.example.app/version":      "1.2",
+		"com.example.app/owner":        "team-a",
+		"io.kubernetes.cri.sandbox-id": "abc123",
+		"org.opencontainers.image.ref": "ubuntu:20.04",
+		"com.example.empty-annotation": "",
+	}
+
+	annotations := make(map[string]string)
+	for k, v := range want {
+		annotations[k] = v
+	}
+
+	spec := convertTestSpec(t, annotations)
+
+	for k, v := range want {
+		if got, ok := spec.Annotations[k]; !ok || got != v {
+			t.Errorf("ConvertSpec: want annotation %s=%q; got %q (present %v)", k, v, got, ok)
+		}
+	}
+}
+
+func TestConvertSpecSysboxAnnotations(t *testing.T) {
+	want := map[string]string{
+		parentDeathSigAnnot:    "SIGKILL",
+		reclaimMemOnStartAnnot: "64M",
+		netSysctlsAnnot:        "net.ipv4.ip_forward=1",
+	}
+
+	annotations := make(map[string]string)
+	for k, v := range want {
+		annotations[k] = v
+	}
+
+	spec := convertTestSpec(t, annotations)
+
+	for k, v := range want {
+		if got := spec.Annotations[k]; got != v {
+			t.Errorf("ConvertSpec: want annotation %s=%q; got %q", k, v, got)
+		}
+	}
+}
+
+func TestPreserveAnnotations(t *testing.T) {
+	original := &specs.Spec{
+		Annotations: map[string]string{
+			"com.example.app/version": "1.2",
+			parentDeathSigAnnot:       "SIGKILL",
+			seccompModeAnnot:          "audit",
+		},
+	}
+	converted := &specs.Spec{
+		Annotations: map[string]string{
+			parentDeathSigAnnot: "",
+			seccompModeAnnot:    "log-only",
+			netAccountingAnnot:  "true",
+		},
+	}
+
+	preserveAnnotations(original, converted)
+
+	want := map[string]string{
+		"com.example.app/version": "1.2",
+		parentDeathSigAnnot:       "SIGKILL",
+		seccompModeAnnot:          "log-only",
+		netAccountingAnnot:        "true",
+	}
+	if !reflect.DeepEqual(converted.Annotations, want) {
+		t.Errorf("preserveAnnotations: want %v; got %v", want, converted.Annotations)
+	}
+
+	// converted spec without annotations
+	converted = &specs.Spec{}
+	preserveAnnotations(original, converted)
+	if !reflect.DeepEqual(converted.Annotations, original.Annotations) {
+		t.Errorf("preserveAnnotations: want %v; got %v", original.Annotations, converted.Annotations)
+	}
+}
+
+func TestSysboxFsMounts(t *testing.T) {
+	spec := new(specs.Spec)
+	spec.Mounts = []specs.Mount{
+		{Destination: "/proc", Source: "proc", Type: "proc"},
+		{Destination: "/proc/sys", Source: filepath.Join(SysboxFsDir, "proc/sys"), Type: "bind"},
+		{Destination: "/data", Source: "/var/lib/sysboxfs-data", Type: "bind"},
+	}
+
+	mounts := SysboxFsMounts(spec)
+	if len(mounts) != 1 || mounts[0].Destination != "/proc/sys" {
+		t.Errorf("SysboxFsMounts: want /proc/sys mount only; got %v", mounts)
+	}
+}
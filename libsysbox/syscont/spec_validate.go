@@ -0,0 +1,265 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+)
+
+// ValidateSpecJSON checks the given OCI spec document (config.json) against the
+// OCI runtime-spec types. Fields of the wrong type are always an error (e.g., a
+// string where an integer is expected). Unknown fields (which the JSON decoder
+// silently ignores) are reported as warnings, or as an error if strict is set.
+func ValidateSpecJSON(data []byte, strict bool) error {
+	unknown, err := checkSpecJSON(data)
+	if err != nil {
+		return fmt.Errorf("invalid spec: %v", err)
+	}
+
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	if strict {
+		return fmt.Errorf("invalid spec: unknown fields %s", strings.Join(unknown, ", "))
+	}
+
+	for _, f := range unknown {
+		logrus.Warnf("spec: ignoring unknown field %s", f)
+	}
+
+	return nil
+}
+
+// checkSpecJSON returns the unknown fields in the given OCI spec document, or an
+// error if the document is not valid JSON or has fields of the wrong type.
+func checkSpecJSON(data []byte) ([]string, error) {
+	var doc interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+
+	unknown := []string{}
+	if err := checkJSONValue("", doc, reflect.TypeOf(specs.Spec{}), &unknown); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+// checkJSONValue checks that the given decoded JSON value can be unmarshaled
+// into a value of the given type; the unknown object fields are appended to
+// unknown.
+func checkJSONValue(path string, val interface{}, t reflect.Type, unknown *[]string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if val == nil {
+		return nil
+	}
+
+	switch t.Kind() {
+
+	case reflect.Interface:
+		return nil
+
+	case reflect.Struct:
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return jsonTypeError(path, "object", val)
+		}
+
+		fields := jsonFields(t)
+		for k, v := range obj {
+			fpath := k
+			if path != "" {
+				fpath = path + "." + k
+			}
+
+			ft, ok := lookupJSONField(fields, k)
+			if !ok {
+				*unknown = append(*unknown, fpath)
+				continue
+			}
+
+			if err := checkJSONValue(fpath, v, ft, unknown); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return jsonTypeError(path, "object", val)
+		}
+
+		for k, v := range obj {
+			if err := checkJSONValue(path+"."+k, v, t.Elem(), unknown); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		arr, ok := val.([]interface{})
+		if !ok {
+			return jsonTypeError(path, "array", val)
+		}
+
+		for i, v := range arr {
+			if err := checkJSONValue(fmt.Sprintf("%s[%d]", path, i), v, t.Elem(), unknown); err != nil {
+				return err
+			}
+		}
+
+	case reflect.String:
+		if _, ok := val.(string); !ok {
+			return jsonTypeError(path, "string", val)
+		}
+
+	case reflect.Bool:
+		if _, ok := val.(bool); !ok {
+			return jsonTypeError(path, "boolean", val)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		num, ok := val.(json.Number)
+		if !ok {
+			return jsonTypeError(path, "integer", val)
+		}
+		if _, err := strconv.ParseInt(num.String(), 10, t.Bits()); err != nil {
+			return fmt.Errorf("field %s: %s is not a valid %d-bit integer", path, num, t.Bits())
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		num, ok := val.(json.Number)
+		if !ok {
+			return jsonTypeError(path, "unsigned integer", val)
+		}
+		if _, err := strconv.ParseUint(num.String(), 10, t.Bits()); err != nil {
+			return fmt.Errorf("field %s: %s is not a valid %d-bit unsigned integer", path, num, t.Bits())
+		}
+
+	case reflect.Float32, reflect.Float64:
+		num, ok := val.(json.Number)
+		if !ok {
+			return jsonTypeError(path, "number", val)
+		}
+		if _, err := strconv.ParseFloat(num.String(), t.Bits()); err != nil {
+			return fmt.Errorf("field %s: %s is not a valid number", path, num)
+		}
+	}
+
+	return nil
+}
+
+// jsonFields returns the JSON field names of the given struct type, along with
+// their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+
+		// embedded structs without a json name have their fields promoted
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range jsonFields(ft) {
+					fields[k] = v
+				}
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+
+	return fields
+}
+
+// lookupJSONField returns the type of the struct field with the given JSON
+// key. Like the JSON decoder, it prefers an exact match but otherwise matches
+// the key case-insensitively.
+func lookupJSONField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return t, true
+	}
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func jsonTypeError(path string, want string, val interface{}) error {
+	var got string
+
+	switch val.(type) {
+	case map[string]interface{}:
+		got = "object"
+	case []interface{}:
+		got = "array"
+	case string:
+		got = "string"
+	case bool:
+		got = "boolean"
+	case json.Number:
+		got = "number"
+	default:
+		got = fmt.Sprintf("%T", val)
+	}
+
+	return fmt.Errorf("field %s: expected %s, got %s", path, want, got)
+}
@@ -0,0 +1,102 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"encoding/json"
+	"testing"
+
+	utils "github.com/nestybox/sysbox-libs/utils"
+)
+
+func TestCheckSpecJSON(t *testing.T) {
+
+	// a valid spec
+	spec, err := Example()
+	if err != nil {
+		t.Fatalf("Example() failed: %v", err)
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown, err := checkSpecJSON(data)
+	if err != nil || len(unknown) != 0 {
+		t.Errorf("checkSpecJSON: valid spec failed: unknown = %v, err = %v", unknown, err)
+	}
+
+	// unknown fields
+	data = []byte(`{
+		"ociVersion": "1.0.2",
+		"hostname": "syscont",
+		"hostnam": "typo",
+		"process": {"cwd": "/", "args": ["sh"], "User": {"UID": 0, "gid": 0, "extra": 1}},
+		"linux": {"resources": {"memory": {"limit": 1024, "limitt": 2048}}},
+		"annotations": {"any.key": "value"}
+	}`)
+
+	unknown, err = checkSpecJSON(data)
+	if err != nil {
+		t.Fatalf("checkSpecJSON: unexpected error: %v", err)
+	}
+
+	want := []string{"hostnam", "linux.resources.memory.limitt", "process.User.extra"}
+	if !utils.StringSliceEqual(unknown, want) {
+		t.Errorf("checkSpecJSON: want unknown fields %v; got %v", want, unknown)
+	}
+
+	if err := ValidateSpecJSON(data, false); err != nil {
+		t.Errorf("ValidateSpecJSON: unexpected error in non-strict mode: %v", err)
+	}
+	if err := ValidateSpecJSON(data, true); err == nil {
+		t.Errorf("ValidateSpecJSON: expected error in strict mode")
+	}
+
+	// wrong types
+	invalid := []string{
+		`not json`,
+		`["ociVersion"]`,
+		`{"ociVersion": 1}`,
+		`{"process": {"terminal": "yes"}}`,
+		`{"Process": {"Terminal": "yes"}}`,
+		`{"process": {"args": "sh"}}`,
+		`{"process": {"user": {"uid": -1}}}`,
+		`{"process": {"user": {"uid": 4294967296}}}`,
+		`{"linux": {"resources": {"memory": {"limit": "1G"}}}}`,
+		`{"linux": {"resources": {"cpu": {"shares": 1.5}}}}`,
+		`{"mounts": [{"destination": "/data", "options": [1]}]}`,
+		`{"annotations": {"key": 1}}`,
+	}
+
+	for _, doc := range invalid {
+		if _, err := checkSpecJSON([]byte(doc)); err == nil {
+			t.Errorf("checkSpecJSON: expected error for %s", doc)
+		}
+		if err := ValidateSpecJSON([]byte(doc), false); err == nil {
+			t.Errorf("ValidateSpecJSON: expected error for %s", doc)
+		}
+	}
+
+	// null values are allowed for optional fields
+	if _, err := checkSpecJSON([]byte(`{"process": null, "linux": {"resources": null}}`)); err != nil {
+		t.Errorf("checkSpecJSON: unexpected error for null fields: %v", err)
+	}
+}
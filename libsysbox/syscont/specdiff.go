@@ -0,0 +1,113 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"path/filepath"
+	"strings"
+
+	utils "github.com/nestybox/sysbox-libs/utils"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// autoAddedAnnotPrefix is the prefix of the annotations that list the parts
+// of a spec that sysbox added to it (see SpecDiff.Annotations()).
+const autoAddedAnnotPrefix = "sysbox.io/auto-added/"
+
+// SpecDiff lists the parts of a container's spec that sysbox added when
+// converting it to a system container spec.
+type SpecDiff struct {
+	Mounts     []string // mount destinations
+	Namespaces []string // namespace types
+	Caps       []string // capabilities in the bounding set
+}
+
+// DiffSpec returns the parts of the given converted (system container) spec
+// that are not in the given original spec.
+func DiffSpec(orig, converted *specs.Spec) SpecDiff {
+	var diff SpecDiff
+
+	origMounts := make(map[string]bool)
+	for _, m := range orig.Mounts {
+		origMounts[filepath.Clean(m.Destination)] = true
+	}
+	for _, m := range converted.Mounts {
+		dest := filepath.Clean(m.Destination)
+		if !origMounts[dest] {
+			diff.Mounts = append(diff.Mounts, dest)
+		}
+	}
+
+	origNs := make(map[specs.LinuxNamespaceType]bool)
+	if orig.Linux != nil {
+		for _, ns := range orig.Linux.Namespaces {
+			origNs[ns.Type] = true
+		}
+	}
+	if converted.Linux != nil {
+		for _, ns := range converted.Linux.Namespaces {
+			if !origNs[ns.Type] {
+				diff.Namespaces = append(diff.Namespaces, string(ns.Type))
+			}
+		}
+	}
+
+	var origCaps []string
+	if orig.Process != nil && orig.Process.Capabilities != nil {
+		origCaps = orig.Process.Capabilities.Bounding
+	}
+	if converted.Process != nil && converted.Process.Capabilities != nil {
+		for _, c := range converted.Process.Capabilities.Bounding {
+			if !utils.StringSliceContains(origCaps, c) {
+				diff.Caps = append(diff.Caps, c)
+			}
+		}
+	}
+
+	return diff
+}
+
+// Annotations returns the diff as spec annotations (e.g.,
+// "sysbox.io/auto-added/mounts": "/proc/sys,/proc/uptime"); parts of the spec
+// without additions have no annotation.
+func (d SpecDiff) Annotations() map[string]string {
+	annotations := make(map[string]string)
+
+	for name, list := range map[string][]string{
+		"mounts":       d.Mounts,
+		"namespaces":   d.Namespaces,
+		"capabilities": d.Caps,
+	} {
+		if len(list) > 0 {
+			annotations[autoAddedAnnotPrefix+name] = strings.Join(list, ",")
+		}
+	}
+
+	return annotations
+}
+
+// StripSysboxAnnotations removes the sysbox annotations ("sysbox.io/*") from
+// the given spec.
+func StripSysboxAnnotations(spec *specs.Spec) {
+	for key := range spec.Annotations {
+		if strings.HasPrefix(key, sysboxAnnotPrefix) {
+			delete(spec.Annotations, key)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestDiffSpec(t *testing.T) {
+	orig := &specs.Spec{
+		Process: &specs.Process{
+			Capabilities: &specs.LinuxCapabilities{
+				Bounding: []string{"CAP_CHOWN", "CAP_KILL"},
+			},
+		},
+		Mounts: []specs.Mount{
+			{Destination: "/proc", Type: "proc"},
+			{Destination: "/data/", Type: "bind"},
+		},
+		Linux: &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{
+				{Type: specs.PIDNamespace},
+				{Type: specs.MountNamespace},
+			},
+		},
+	}
+
+	converted := &specs.Spec{
+		Process: &specs.Process{
+			Capabilities: &specs.LinuxCapabilities{
+				Bounding: []string{"CAP_CHOWN", "CAP_KILL", "CAP_SYS_ADMIN"},
+			},
+		},
+		Mounts: []specs.Mount{
+			{Destination: "/proc", Type: "proc"},
+			{Destination: "/data", Type: "bind"},
+			{Destination: "/proc/sys", Type: "bind"},
+			{Destination: "/var/lib/docker", Type: "bind"},
+		},
+		Linux: &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{
+				{Type: specs.PIDNamespace},
+				{Type: specs.MountNamespace},
+				{Type: specs.UserNamespace},
+				{Type: specs.CgroupNamespace},
+			},
+		},
+	}
+
+	diff := DiffSpec(orig, converted)
+
+	want := SpecDiff{
+		Mounts:     []string{"/proc/sys", "/var/lib/docker"},
+		Namespaces: []string{"user", "cgroup"},
+		Caps:       []string{"CAP_SYS_ADMIN"},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("DiffSpec: want %+v; got %+v", want, diff)
+	}
+
+	wantAnnot := map[string]string{
+		"sysbox.io/auto-added/mounts":       "/proc/sys,/var/lib/docker",
+		"sysbox.io/auto-added/namespaces":   "user,cgroup",
+		"sysbox.io/auto-added/capabilities": "CAP_SYS_ADMIN",
+	}
+	if got := diff.Annotations(); !reflect.DeepEqual(got, wantAnnot) {
+		t.Errorf("SpecDiff.Annotations: want %v; got %v", wantAnnot, got)
+	}
+
+	// no differences
+	diff = DiffSpec(converted, converted)
+	if len(diff.Annotations()) != 0 {
+		t.Errorf("DiffSpec: want no differences; got %+v", diff)
+	}
+}
+
+func TestStripSysboxAnnotations(t *testing.T) {
+	spec := new(specs.Spec)
+	spec.Annotations = map[string]string{
+		allowKvmAnnot:                 "true",
+		autoAddedAnnotPrefix + "caps": "CAP_SYS_ADMIN",
+		"org.example/other":           "x",
+	}
+
+	StripSysboxAnnotations(spec)
+
+	want := map[string]string{"org.example/other": "x"}
+	if !reflect.DeepEqual(spec.Annotations, want) {
+		t.Errorf("StripSysboxAnnotations: want %v; got %v", want, spec.Annotations)
+	}
+}
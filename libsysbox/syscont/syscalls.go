@@ -20,344 +20,498 @@ package syscont
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/sirupsen/logrus"
 )
 
+// Groups of syscalls allowed inside a system container (docker allows most of
+// these by default)
+var syscontSyscallGroups = map[string][]string{
+
+	// file system and file descriptor I/O
+	"file_ops": {
+		"access",
+		"chdir",
+		"chroot",
+		"chmod",
+		"chown",
+		"chown32",
+		"close",
+		"copy_file_range",
+		"creat",
+		"dup",
+		"dup2",
+		"dup3",
+		"epoll_create",
+		"epoll_create1",
+		"epoll_ctl",
+		"epoll_ctl_old",
+		"epoll_pwait",
+		"epoll_wait",
+		"epoll_wait_old",
+		"faccessat",
+		"faccessat2",
+		"fadvise64",
+		"fadvise64_64",
+		"fallocate",
+		"fanotify_mark",
+		"fchdir",
+		"fchmod",
+		"fchmodat",
+		"fchown",
+		"fchown32",
+		"fchownat",
+		"fcntl",
+		"fcntl64",
+		"fdatasync",
+		"fgetxattr",
+		"flistxattr",
+		"flock",
+		"fremovexattr",
+		"fsetxattr",
+		"fstat",
+		"fstat64",
+		"fstatat64",
+		"fstatfs",
+		"fstatfs64",
+		"fsync",
+		"ftruncate",
+		"ftruncate64",
+		"futimesat",
+		"getcwd",
+		"getdents",
+		"getdents64",
+		"getxattr",
+		"inotify_add_watch",
+		"inotify_init",
+		"inotify_init1",
+		"inotify_rm_watch",
+		"io_cancel",
+		"ioctl",
+		"io_destroy",
+		"io_getevents",
+		"io_setup",
+		"io_submit",
+		"lchown",
+		"lchown32",
+		"lgetxattr",
+		"link",
+		"linkat",
+		"listxattr",
+		"llistxattr",
+		"_llseek",
+		"lremovexattr",
+		"lseek",
+		"lsetxattr",
+		"lstat",
+		"lstat64",
+		"mkdir",
+		"mkdirat",
+		"mknod",
+		"mknodat",
+		"newfstatat",
+		"_newselect",
+		"open",
+		"openat",
+		"openat2",
+		"poll",
+		"ppoll",
+		"pread64",
+		"preadv",
+		"preadv2",
+		"pselect6",
+		"pwrite64",
+		"pwritev",
+		"pwritev2",
+		"read",
+		"readahead",
+		"readlink",
+		"readlinkat",
+		"readv",
+		"removexattr",
+		"rename",
+		"renameat",
+		"renameat2",
+		"rmdir",
+		"select",
+		"sendfile",
+		"sendfile64",
+		"setxattr",
+		"splice",
+		"stat",
+		"stat64",
+		"statfs",
+		"statfs64",
+		"statx",
+		"symlink",
+		"symlinkat",
+		"sync",
+		"sync_file_range",
+		"syncfs",
+		"tee",
+		"truncate",
+		"truncate64",
+		"unlink",
+		"unlinkat",
+		"utime",
+		"utimensat",
+		"utimes",
+		"vmsplice",
+		"write",
+		"writev",
+	},
+
+	// processes, threads, signals, scheduling and credentials
+	"process_ops": {
+		"capget",
+		"capset",
+		"execve",
+		"execveat",
+		"exit",
+		"exit_group",
+		"fork",
+		"futex",
+		"getcpu",
+		"getegid",
+		"getegid32",
+		"geteuid",
+		"geteuid32",
+		"getgid",
+		"getgid32",
+		"getgroups",
+		"getgroups32",
+		"getpgid",
+		"getpgrp",
+		"getpid",
+		"getppid",
+		"getpriority",
+		"getrandom",
+		"getresgid",
+		"getresgid32",
+		"getresuid",
+		"getresuid32",
+		"getrlimit",
+		"get_robust_list",
+		"getrusage",
+		"getsid",
+		"get_thread_area",
+		"gettid",
+		"getuid",
+		"getuid32",
+		"ioprio_get",
+		"ioprio_set",
+		"kill",
+		"pause",
+		"prctl",
+		"prlimit64",
+		"restart_syscall",
+		"rt_sigaction",
+		"rt_sigpending",
+		"rt_sigprocmask",
+		"rt_sigqueueinfo",
+		"rt_sigreturn",
+		"rt_sigsuspend",
+		"rt_sigtimedwait",
+		"rt_tgsigqueueinfo",
+		"sched_getaffinity",
+		"sched_getattr",
+		"sched_getparam",
+		"sched_get_priority_max",
+		"sched_get_priority_min",
+		"sched_getscheduler",
+		"sched_rr_get_interval",
+		"sched_setaffinity",
+		"sched_setattr",
+		"sched_setparam",
+		"sched_setscheduler",
+		"sched_yield",
+		"seccomp",
+		"setfsgid",
+		"setfsgid32",
+		"setfsuid",
+		"setfsuid32",
+		"setgid",
+		"setgid32",
+		"setgroups",
+		"setgroups32",
+		"setpgid",
+		"setpriority",
+		"setregid",
+		"setregid32",
+		"setresgid",
+		"setresgid32",
+		"setresuid",
+		"setresuid32",
+		"setreuid",
+		"setreuid32",
+		"setrlimit",
+		"set_robust_list",
+		"setsid",
+		"set_thread_area",
+		"set_tid_address",
+		"setuid",
+		"setuid32",
+		"sigaltstack",
+		"sigreturn",
+		"sysinfo",
+		"tgkill",
+		"tkill",
+		"ugetrlimit",
+		"umask",
+		"uname",
+		"vfork",
+		"wait4",
+		"waitid",
+		"waitpid",
+		"personality",
+		"arch_prctl",
+		"modify_ldt",
+		"clone",
+	},
+
+	// memory management
+	"memory_ops": {
+		"brk",
+		"madvise",
+		"memfd_create",
+		"mincore",
+		"mlock",
+		"mlock2",
+		"mlockall",
+		"mmap",
+		"mmap2",
+		"mprotect",
+		"mremap",
+		"msync",
+		"munlock",
+		"munlockall",
+		"munmap",
+		"remap_file_pages",
+	},
+
+	// inter-process communication
+	"ipc_ops": {
+		"ipc",
+		"msgctl",
+		"msgget",
+		"msgrcv",
+		"msgsnd",
+		"semctl",
+		"semget",
+		"semop",
+		"semtimedop",
+		"shmat",
+		"shmctl",
+		"shmdt",
+		"shmget",
+		"mq_getsetattr",
+		"mq_notify",
+		"mq_open",
+		"mq_timedreceive",
+		"mq_timedsend",
+		"mq_unlink",
+		"pipe",
+		"pipe2",
+		"eventfd",
+		"eventfd2",
+		"signalfd",
+		"signalfd4",
+	},
+
+	// sockets
+	"network_ops": {
+		"accept",
+		"accept4",
+		"bind",
+		"connect",
+		"getpeername",
+		"getsockname",
+		"getsockopt",
+		"listen",
+		"recv",
+		"recvfrom",
+		"recvmmsg",
+		"recvmsg",
+		"send",
+		"sendmmsg",
+		"sendmsg",
+		"sendto",
+		"setsockopt",
+		"shutdown",
+		"socket",
+		"socketcall",
+		"socketpair",
+	},
+
+	// clocks and timers
+	"time_ops": {
+		"adjtimex",
+		"alarm",
+		"clock_getres",
+		"clock_gettime",
+		"clock_nanosleep",
+		"getitimer",
+		"gettimeofday",
+		"nanosleep",
+		"setitimer",
+		"time",
+		"timer_create",
+		"timer_delete",
+		"timer_getoverrun",
+		"timer_gettime",
+		"timer_settime",
+		"timerfd_create",
+		"timerfd_gettime",
+		"timerfd_settime",
+		"times",
+	},
+
+	// docker blocks these by default; sysbox-runc allows them (mounts,
+	// hostname, keyrings, and namespace creation for nested containers)
+	"container_ops": {
+		"mount",
+		"umount",
+		"umount2",
+		"pivot_root",
+		"setns",
+		"unshare",
+		"gethostname",
+		"sethostname",
+		"add_key",
+		"request_key",
+		"keyctl",
+	},
+}
+
 // List of syscalls allowed inside a system container
-var syscontSyscallWhitelist = []string{
-
-	// docker allows these by default
-	"accept",
-	"accept4",
-	"access",
-	"adjtimex",
-	"alarm",
-	"bind",
-	"brk",
-	"capget",
-	"capset",
-	"chdir",
-	"chmod",
-	"chown",
-	"chown32",
-	"clock_getres",
-	"clock_gettime",
-	"clock_nanosleep",
-	"close",
-	"connect",
-	"copy_file_range",
-	"creat",
-	"dup",
-	"dup2",
-	"dup3",
-	"epoll_create",
-	"epoll_create1",
-	"epoll_ctl",
-	"epoll_ctl_old",
-	"epoll_pwait",
-	"epoll_wait",
-	"epoll_wait_old",
-	"eventfd",
-	"eventfd2",
-	"execve",
-	"execveat",
-	"exit",
-	"exit_group",
-	"faccessat",
-	"faccessat2",
-	"fadvise64",
-	"fadvise64_64",
-	"fallocate",
-	"fanotify_mark",
-	"fchdir",
-	"fchmod",
-	"fchmodat",
-	"fchown",
-	"fchown32",
-	"fchownat",
-	"fcntl",
-	"fcntl64",
-	"fdatasync",
-	"fgetxattr",
-	"flistxattr",
-	"flock",
-	"fork",
-	"fremovexattr",
-	"fsetxattr",
-	"fstat",
-	"fstat64",
-	"fstatat64",
-	"fstatfs",
-	"fstatfs64",
-	"fsync",
-	"ftruncate",
-	"ftruncate64",
-	"futex",
-	"futimesat",
-	"getcpu",
-	"getcwd",
-	"getdents",
-	"getdents64",
-	"getegid",
-	"getegid32",
-	"geteuid",
-	"geteuid32",
-	"getgid",
-	"getgid32",
-	"getgroups",
-	"getgroups32",
-	"getitimer",
-	"getpeername",
-	"getpgid",
-	"getpgrp",
-	"getpid",
-	"getppid",
-	"getpriority",
-	"getrandom",
-	"getresgid",
-	"getresgid32",
-	"getresuid",
-	"getresuid32",
-	"getrlimit",
-	"get_robust_list",
-	"getrusage",
-	"getsid",
-	"getsockname",
-	"getsockopt",
-	"get_thread_area",
-	"gettid",
-	"gettimeofday",
-	"getuid",
-	"getuid32",
-	"getxattr",
-	"inotify_add_watch",
-	"inotify_init",
-	"inotify_init1",
-	"inotify_rm_watch",
-	"io_cancel",
-	"ioctl",
-	"io_destroy",
-	"io_getevents",
-	"ioprio_get",
-	"ioprio_set",
-	"io_setup",
-	"io_submit",
-	"ipc",
-	"kill",
-	"lchown",
-	"lchown32",
-	"lgetxattr",
-	"link",
-	"linkat",
-	"listen",
-	"listxattr",
-	"llistxattr",
-	"_llseek",
-	"lremovexattr",
-	"lseek",
-	"lsetxattr",
-	"lstat",
-	"lstat64",
-	"madvise",
-	"memfd_create",
-	"mincore",
-	"mkdir",
-	"mkdirat",
-	"mknod",
-	"mknodat",
-	"mlock",
-	"mlock2",
-	"mlockall",
-	"mmap",
-	"mmap2",
-	"mprotect",
-	"mq_getsetattr",
-	"mq_notify",
-	"mq_open",
-	"mq_timedreceive",
-	"mq_timedsend",
-	"mq_unlink",
-	"mremap",
-	"msgctl",
-	"msgget",
-	"msgrcv",
-	"msgsnd",
-	"msync",
-	"munlock",
-	"munlockall",
-	"munmap",
-	"nanosleep",
-	"newfstatat",
-	"_newselect",
-	"open",
-	"openat",
-	"openat2",
-	"pause",
-	"pipe",
-	"pipe2",
-	"poll",
-	"ppoll",
-	"prctl",
-	"pread64",
-	"preadv",
-	"preadv2",
-	"prlimit64",
-	"pselect6",
-	"pwrite64",
-	"pwritev",
-	"pwritev2",
-	"read",
-	"readahead",
-	"readlink",
-	"readlinkat",
-	"readv",
-	"recv",
-	"recvfrom",
-	"recvmmsg",
-	"recvmsg",
-	"remap_file_pages",
-	"removexattr",
-	"rename",
-	"renameat",
-	"renameat2",
-	"restart_syscall",
-	"rmdir",
-	"rt_sigaction",
-	"rt_sigpending",
-	"rt_sigprocmask",
-	"rt_sigqueueinfo",
-	"rt_sigreturn",
-	"rt_sigsuspend",
-	"rt_sigtimedwait",
-	"rt_tgsigqueueinfo",
-	"sched_getaffinity",
-	"sched_getattr",
-	"sched_getparam",
-	"sched_get_priority_max",
-	"sched_get_priority_min",
-	"sched_getscheduler",
-	"sched_rr_get_interval",
-	"sched_setaffinity",
-	"sched_setattr",
-	"sched_setparam",
-	"sched_setscheduler",
-	"sched_yield",
-	"seccomp",
-	"select",
-	"semctl",
-	"semget",
-	"semop",
-	"semtimedop",
-	"send",
-	"sendfile",
-	"sendfile64",
-	"sendmmsg",
-	"sendmsg",
-	"sendto",
-	"setfsgid",
-	"setfsgid32",
-	"setfsuid",
-	"setfsuid32",
-	"setgid",
-	"setgid32",
-	"setgroups",
-	"setgroups32",
-	"setitimer",
-	"setpgid",
-	"setpriority",
-	"setregid",
-	"setregid32",
-	"setresgid",
-	"setresgid32",
-	"setresuid",
-	"setresuid32",
-	"setreuid",
-	"setreuid32",
-	"setrlimit",
-	"set_robust_list",
-	"setsid",
-	"setsockopt",
-	"set_thread_area",
-	"set_tid_address",
-	"setuid",
-	"setuid32",
-	"setxattr",
-	"shmat",
-	"shmctl",
-	"shmdt",
-	"shmget",
-	"shutdown",
-	"sigaltstack",
-	"signalfd",
-	"signalfd4",
-	"sigreturn",
-	"socket",
-	"socketcall",
-	"socketpair",
-	"splice",
-	"stat",
-	"stat64",
-	"statfs",
-	"statfs64",
-	"statx",
-	"symlink",
-	"symlinkat",
-	"sync",
-	"sync_file_range",
-	"syncfs",
-	"sysinfo",
-	"tee",
-	"tgkill",
-	"time",
-	"timer_create",
-	"timer_delete",
-	"timerfd_create",
-	"timerfd_gettime",
-	"timerfd_settime",
-	"timer_getoverrun",
-	"timer_gettime",
-	"timer_settime",
-	"times",
-	"tkill",
-	"truncate",
-	"truncate64",
-	"ugetrlimit",
-	"umask",
-	"uname",
-	"unlink",
-	"unlinkat",
-	"utime",
-	"utimensat",
-	"utimes",
-	"vfork",
-	"vmsplice",
-	"wait4",
-	"waitid",
-	"waitpid",
-	"write",
-	"writev",
+var syscontSyscallWhitelist = syscallGroupsUnion(syscontSyscallGroups)
 
-	"personality",
-	"arch_prctl",
-	"modify_ldt",
-	"clone",
-	"chroot",
+// Groups of syscalls that are not allowed inside a system container by
+// default, but can be allowed via the "sysbox.io/seccomp-groups" annotation.
+var syscontOptionalSyscallGroups = map[string][]string{
 
-	// docker blocks these by default; sysbox-runc allows them
-	"mount",
-	"umount",
-	"umount2",
-	"add_key",
-	"request_key",
-	"keyctl",
-	"pivot_root",
-	"gethostname",
-	"sethostname",
-
-	// allow namespace creation inside the system container (for nested containers)
-	"setns",
-	"unshare",
+	// process tracing and inspection (e.g., for debuggers)
+	"debug_ops": {
+		"ptrace",
+		"process_vm_readv",
+		"process_vm_writev",
+		"kcmp",
+	},
+
+	// asynchronous I/O via io_uring
+	"io_uring_ops": {
+		"io_uring_setup",
+		"io_uring_enter",
+		"io_uring_register",
+	},
+
+	// process file descriptors
+	"pidfd_ops": {
+		"pidfd_open",
+		"pidfd_send_signal",
+		"pidfd_getfd",
+	},
+}
+
+// syscallGroupsUnion returns the syscalls in the given groups, without
+// duplicates.
+func syscallGroupsUnion(groups map[string][]string) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := make(map[string]bool)
+	syscalls := []string{}
+
+	for _, name := range names {
+		for _, sc := range groups[name] {
+			if !seen[sc] {
+				seen[sc] = true
+				syscalls = append(syscalls, sc)
+			}
+		}
+	}
+
+	return syscalls
+}
+
+// validateSyscallGroup checks that the given syscall group is not empty and
+// that its syscalls exist in the syscall table of the host's architecture.
+func validateSyscallGroup(name string, syscalls []string) error {
+	if name == "" {
+		return fmt.Errorf("syscall group has no name")
+	}
+
+	if len(syscalls) == 0 {
+		return fmt.Errorf("syscall group %s is empty", name)
+	}
+
+	// the syscall table is not available on all architectures
+	if syscallTable == nil {
+		return nil
+	}
+
+	for _, sc := range syscalls {
+		if _, ok := syscallTable[sc]; !ok {
+			return fmt.Errorf("syscall group %s: unknown syscall %q", name, sc)
+		}
+	}
+
+	return nil
+}
+
+// cfgSeccompGroups returns the syscalls in the extra syscall groups allowed via
+// the "sysbox.io/seccomp-groups" annotation. The annotation value is a
+// comma-separated list of predefined groups (see syscontOptionalSyscallGroups),
+// e.g., "debug_ops,pidfd_ops". Custom groups are not supported, as they would
+// let the container's creator allow arbitrary syscalls.
+func cfgSeccompGroups(annotations map[string]string) ([]string, error) {
+	val, ok := annotations[seccompGroupsAnnot]
+	if !ok {
+		return nil, nil
+	}
+
+	groups := make(map[string][]string)
+
+	for _, entry := range strings.Split(val, ",") {
+		name := strings.TrimSpace(entry)
+		if name == "" {
+			continue
+		}
+
+		if strings.Contains(name, "=") {
+			return nil, fmt.Errorf("invalid value for annotation %s: custom syscall groups (%s) are not supported",
+				seccompGroupsAnnot, name)
+		}
+
+		if _, ok := syscontSyscallGroups[name]; ok {
+			// already allowed
+			continue
+		}
+
+		syscalls, ok := syscontOptionalSyscallGroups[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid value for annotation %s: unknown syscall group %s", seccompGroupsAnnot, name)
+		}
+
+		if err := validateSyscallGroup(name, syscalls); err != nil {
+			return nil, fmt.Errorf("invalid value for annotation %s: %v", seccompGroupsAnnot, err)
+		}
+
+		groups[name] = syscalls
+	}
+
+	extra := syscallGroupsUnion(groups)
+	if len(extra) > 0 {
+		logrus.Infof("allowing extra syscalls per annotation %s: %v", seccompGroupsAnnot, extra)
+	}
+
+	return extra, nil
 }
 
 // List of syscalls with allowed argument restrictions (via seccomp)
@@ -0,0 +1,159 @@
+//
+// Copyright 2019-2020 Nestybox, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build linux
+
+package syscont
+
+import (
+	"testing"
+
+	utils "github.com/nestybox/sysbox-libs/utils"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestSyscallGroups(t *testing.T) {
+
+	// the whitelist is the union of the groups; the groups don't overlap
+	seen := make(map[string]string)
+	total := 0
+
+	for name, syscalls := range syscontSyscallGroups {
+		for _, sc := range syscalls {
+			if other, ok := seen[sc]; ok {
+				t.Errorf("syscall %s is in groups %s and %s", sc, other, name)
+			}
+			seen[sc] = name
+			total++
+		}
+	}
+
+	if len(syscontSyscallWhitelist) != total {
+		t.Errorf("syscontSyscallWhitelist: want %d syscalls; got %d", total, len(syscontSyscallWhitelist))
+	}
+	for sc := range seen {
+		if !utils.StringSliceContains(syscontSyscallWhitelist, sc) {
+			t.Errorf("syscontSyscallWhitelist: missing syscall %s", sc)
+		}
+	}
+
+	// the syscalls trapped by sysbox must be allowed
+	for _, sc := range syscontSyscallTrapList {
+		if !utils.StringSliceContains(syscontSyscallWhitelist, sc) {
+			t.Errorf("syscontSyscallWhitelist: missing trapped syscall %s", sc)
+		}
+	}
+
+	// optional groups are valid and not allowed by default
+	for name, syscalls := range syscontOptionalSyscallGroups {
+		if err := validateSyscallGroup(name, syscalls); err != nil {
+			t.Errorf("validateSyscallGroup(%s): unexpected error: %v", name, err)
+		}
+		for _, sc := range syscalls {
+			if utils.StringSliceContains(syscontSyscallWhitelist, sc) {
+				t.Errorf("optional group %s: syscall %s is allowed by default", name, sc)
+			}
+		}
+	}
+
+	union := syscallGroupsUnion(map[string][]string{
+		"a": {"read", "write"},
+		"b": {"write", "close"},
+	})
+	if !utils.StringSliceEqual(union, []string{"read", "write", "close"}) {
+		t.Errorf("syscallGroupsUnion: unexpected result %v", union)
+	}
+}
+
+func TestValidateSyscallGroup(t *testing.T) {
+
+	if err := validateSyscallGroup("", []string{"read"}); err == nil {
+		t.Errorf("validateSyscallGroup: expected error for unnamed group")
+	}
+	if err := validateSyscallGroup("empty", nil); err == nil {
+		t.Errorf("validateSyscallGroup: expected error for empty group")
+	}
+
+	if syscallTable == nil {
+		t.Skip("no syscall table for this architecture")
+	}
+
+	if err := validateSyscallGroup("io", []string{"read", "write", "io_uring_setup"}); err != nil {
+		t.Errorf("validateSyscallGroup: unexpected error: %v", err)
+	}
+	if err := validateSyscallGroup("bad", []string{"read", "no_such_syscall"}); err == nil {
+		t.Errorf("validateSyscallGroup: expected error for unknown syscall")
+	}
+}
+
+func TestCfgSeccompGroups(t *testing.T) {
+
+	// no annotation
+	extra, err := cfgSeccompGroups(nil)
+	if err != nil || len(extra) != 0 {
+		t.Errorf("cfgSeccompGroups: unexpected result without annotation: %v, %v", extra, err)
+	}
+
+	// predefined and default groups
+	annot := map[string]string{
+		seccompGroupsAnnot: "debug_ops, file_ops",
+	}
+
+	extra, err = cfgSeccompGroups(annot)
+	if err != nil {
+		t.Fatalf("cfgSeccompGroups: unexpected error: %v", err)
+	}
+
+	want := []string{"ptrace", "process_vm_readv", "process_vm_writev", "kcmp"}
+	if len(extra) != len(want) {
+		t.Errorf("cfgSeccompGroups: want %v; got %v", want, extra)
+	}
+	for _, sc := range want {
+		if !utils.StringSliceContains(extra, sc) {
+			t.Errorf("cfgSeccompGroups: missing syscall %s in %v", sc, extra)
+		}
+	}
+
+	// custom groups are not supported
+	invalid := []string{
+		"no_such_group",
+		"debug_ops=read",
+		"file_ops=ptrace",
+		"my_ops=tee:kcmp",
+		"debug_ops,my_ops=",
+		"=read",
+	}
+
+	for _, val := range invalid {
+		annot[seccompGroupsAnnot] = val
+		if _, err := cfgSeccompGroups(annot); err == nil {
+			t.Errorf("cfgSeccompGroups: expected error for %q", val)
+		}
+	}
+
+	// extra syscalls are added to whitelist profiles
+	seccomp := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: []specs.Arch{specs.ArchX86_64},
+		Syscalls:      genSeccompWhitelist(syscontSyscallWhitelist),
+	}
+	if err := cfgSeccomp(seccomp, false, []string{"ptrace", "kcmp"}, seccompModeEnforce); err != nil {
+		t.Fatalf("cfgSeccomp: unexpected error: %v", err)
+	}
+	if ok, notFound := findSeccompSyscall(seccomp, []string{"ptrace", "kcmp"}); !ok {
+		t.Errorf("cfgSeccomp: extra syscalls not allowed: %v", notFound)
+	}
+}
@@ -3,11 +3,13 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"text/tabwriter"
 	"time"
@@ -43,6 +45,24 @@ type containerState struct {
 	Annotations map[string]string `json:"annotations,omitempty"`
 	// The owner of the state directory (the owner of the container).
 	Owner string `json:"owner"`
+	// PausedAt is the time at which the container was paused (paused containers only).
+	PausedAt *time.Time `json:"pausedAt,omitempty"`
+	// CgroupTree is the container's cgroup hierarchy (only reported by the state command).
+	CgroupTree map[string]interface{} `json:"cgroup_tree,omitempty"`
+}
+
+// ContainerListEntry is the information reported for each container by the
+// list command.
+type ContainerListEntry struct {
+	containerState
+	// CgroupRoot is the container's cgroup path (devices subsystem)
+	CgroupRoot string `json:"cgroupRoot"`
+	// UidStart is the host uid to which the container's root user is mapped
+	UidStart int `json:"uidStart"`
+	// ShiftUids indicates if the container's rootfs uids are shifted (e.g., via shiftfs)
+	ShiftUids bool `json:"shiftUids"`
+	// ExitCode is the exit code of the container's init process (stopped containers only)
+	ExitCode *int `json:"exitCode,omitempty"`
 }
 
 var listCommand = cli.Command{
@@ -70,6 +90,11 @@ To list containers created using a non-default value for "--root":
 			Name:  "quiet, q",
 			Usage: "display only container IDs",
 		},
+		cli.StringSliceFlag{
+			Name:  "filter",
+			Value: &cli.StringSlice{},
+			Usage: "display only containers matching the given filter (e.g., status=running)",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 0, exactArgs); err != nil {
@@ -79,6 +104,10 @@ To list containers created using a non-default value for "--root":
 		if err != nil {
 			return err
 		}
+		s, err = filterContainerList(s, context.StringSlice("filter"))
+		if err != nil {
+			return err
+		}
 
 		if context.Bool("quiet") {
 			for _, item := range s {
@@ -87,34 +116,99 @@ To list containers created using a non-default value for "--root":
 			return nil
 		}
 
-		switch context.String("format") {
-		case "table":
-			w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-			fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tOWNER\n")
-			for _, item := range s {
-				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n",
-					item.ID,
-					item.InitProcessPid,
-					item.Status,
-					item.Bundle,
-					item.Created.Format(time.RFC3339Nano),
-					item.Owner)
-			}
-			if err := w.Flush(); err != nil {
-				return err
+		out, err := formatContainerList(s, context.String("format"))
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	},
+}
+
+// filterContainerList returns the containers matching the given filters; each
+// filter is of the form "key=value". Filters with different keys must all
+// match, while filters with the same key match if any of them does.
+func filterContainerList(containers []ContainerListEntry, filters []string) ([]ContainerListEntry, error) {
+	if len(filters) == 0 {
+		return containers, nil
+	}
+
+	want := make(map[string][]string)
+	for _, f := range filters {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("invalid filter %q (expected key=value)", f)
+		}
+		switch kv[0] {
+		case "id", "status", "owner", "bundle":
+		default:
+			return nil, fmt.Errorf("invalid filter key %q", kv[0])
+		}
+		want[kv[0]] = append(want[kv[0]], kv[1])
+	}
+
+	var filtered []ContainerListEntry
+	for _, c := range containers {
+		fields := map[string]string{
+			"id":     c.ID,
+			"status": c.Status,
+			"owner":  c.Owner,
+			"bundle": c.Bundle,
+		}
+		match := true
+		for key, vals := range want {
+			found := false
+			for _, v := range vals {
+				if fields[key] == v {
+					found = true
+					break
+				}
 			}
-		case "json":
-			if err := json.NewEncoder(os.Stdout).Encode(s); err != nil {
-				return err
+			if !found {
+				match = false
+				break
 			}
-		default:
-			return errors.New("invalid format option")
 		}
-		return nil
-	},
+		if match {
+			filtered = append(filtered, c)
+		}
+	}
+
+	return filtered, nil
 }
 
-func getContainers(context *cli.Context) ([]containerState, error) {
+// formatContainerList renders the given containers in the given format (table or json).
+func formatContainerList(containers []ContainerListEntry, format string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch format {
+	case "table":
+		w := tabwriter.NewWriter(&buf, 12, 1, 3, ' ', 0)
+		fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tOWNER\n")
+		for _, item := range containers {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n",
+				item.ID,
+				item.InitProcessPid,
+				item.Status,
+				item.Bundle,
+				item.Created.Format(time.RFC3339Nano),
+				item.Owner)
+		}
+		if err := w.Flush(); err != nil {
+			return nil, err
+		}
+	case "json":
+		if err := json.NewEncoder(&buf).Encode(containers); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("invalid format option")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func getContainers(context *cli.Context) ([]ContainerListEntry, error) {
 	factory, err := loadFactory(context, nil, nil)
 	if err != nil {
 		return nil, err
@@ -129,7 +223,7 @@ func getContainers(context *cli.Context) ([]containerState, error) {
 		fatal(err)
 	}
 
-	var s []containerState
+	var s []ContainerListEntry
 	for _, item := range list {
 		if item.IsDir() {
 			// This cast is safe on Linux.
@@ -159,16 +253,37 @@ func getContainers(context *cli.Context) ([]containerState, error) {
 				pid = 0
 			}
 			bundle, annotations := utils.Annotations(state.Config.Labels)
-			s = append(s, containerState{
-				Version:        state.BaseState.Config.Version,
-				ID:             state.BaseState.ID,
-				InitProcessPid: pid,
-				Status:         containerStatus.String(),
-				Bundle:         bundle,
-				Rootfs:         state.BaseState.Config.Rootfs,
-				Created:        state.BaseState.Created,
-				Annotations:    annotations,
-				Owner:          owner.Name,
+			var uidStart int
+			if len(state.Config.UidMappings) > 0 {
+				uidStart = state.Config.UidMappings[0].HostID
+			}
+			var pausedAt *time.Time
+			if containerStatus == libcontainer.Paused {
+				pausedAt = state.PausedAt
+			}
+			var exitCode *int
+			if containerStatus == libcontainer.Stopped {
+				if code, ok := container.ExitCode(); ok {
+					exitCode = &code
+				}
+			}
+			s = append(s, ContainerListEntry{
+				containerState: containerState{
+					Version:        state.BaseState.Config.Version,
+					ID:             state.BaseState.ID,
+					InitProcessPid: pid,
+					Status:         containerStatus.String(),
+					Bundle:         bundle,
+					Rootfs:         state.BaseState.Config.Rootfs,
+					Created:        state.BaseState.Created,
+					Annotations:    annotations,
+					Owner:          owner.Name,
+					PausedAt:       pausedAt,
+				},
+				CgroupRoot: state.CgroupPaths["devices"],
+				UidStart:   uidStart,
+				ShiftUids:  state.Config.UidShiftRootfs,
+				ExitCode:   exitCode,
 			})
 		}
 	}
@@ -0,0 +1,122 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testContainerList() []ContainerListEntry {
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	exitCode := 137
+	return []ContainerListEntry{
+		{
+			containerState: containerState{ID: "c1", InitProcessPid: 100, Status: "running", Bundle: "/b1", Created: created, Owner: "root"},
+			CgroupRoot:     "/sys/fs/cgroup/devices/c1",
+			UidStart:       165536,
+			ShiftUids:      true,
+		},
+		{
+			containerState: containerState{ID: "c2", Status: "stopped", Bundle: "/b2", Created: created, Owner: "root"},
+			CgroupRoot:     "/sys/fs/cgroup/devices/c2",
+			UidStart:       231072,
+			ExitCode:       &exitCode,
+		},
+		{
+			containerState: containerState{ID: "c3", InitProcessPid: 300, Status: "paused", Bundle: "/b3", Created: created, Owner: "user"},
+		},
+	}
+}
+
+func TestFormatContainerListJSON(t *testing.T) {
+	out, err := formatContainerList(testContainerList(), "json")
+	if err != nil {
+		t.Fatalf("formatContainerList: unexpected error: %v", err)
+	}
+
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(out, &entries); err != nil {
+		t.Fatalf("formatContainerList: invalid json output: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("formatContainerList: want 3 entries; got %d", len(entries))
+	}
+
+	for _, field := range []string{"id", "pid", "status", "bundle", "created", "owner", "cgroupRoot", "uidStart", "shiftUids"} {
+		if _, ok := entries[0][field]; !ok {
+			t.Errorf("formatContainerList: field %q missing from json output: %s", field, out)
+		}
+	}
+
+	if entries[0]["cgroupRoot"] != "/sys/fs/cgroup/devices/c1" ||
+		entries[0]["uidStart"] != float64(165536) ||
+		entries[0]["shiftUids"] != true {
+		t.Errorf("formatContainerList: unexpected json output: %v", entries[0])
+	}
+
+	// the exit code is only reported for stopped containers
+	if _, ok := entries[0]["exitCode"]; ok {
+		t.Errorf("formatContainerList: unexpected exitCode for running container: %v", entries[0])
+	}
+	if entries[1]["exitCode"] != float64(137) {
+		t.Errorf("formatContainerList: want exitCode 137 for stopped container; got %v", entries[1]["exitCode"])
+	}
+}
+
+func TestFormatContainerListTable(t *testing.T) {
+	out, err := formatContainerList(testContainerList(), "table")
+	if err != nil {
+		t.Fatalf("formatContainerList: unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("formatContainerList: want 4 table lines; got %d: %s", len(lines), out)
+	}
+	if !strings.HasPrefix(lines[0], "ID") || !strings.HasPrefix(lines[1], "c1") {
+		t.Errorf("formatContainerList: unexpected table output: %s", out)
+	}
+
+	if _, err := formatContainerList(testContainerList(), "yaml"); err == nil {
+		t.Errorf("formatContainerList: expected error for invalid format")
+	}
+}
+
+func TestFilterContainerList(t *testing.T) {
+	test := []struct {
+		filters []string
+		want    []string
+	}{
+		{nil, []string{"c1", "c2", "c3"}},
+		{[]string{"status=running"}, []string{"c1"}},
+		{[]string{"status=running", "status=paused"}, []string{"c1", "c3"}},
+		{[]string{"owner=root"}, []string{"c1", "c2"}},
+		{[]string{"owner=root", "status=paused"}, []string{}},
+		{[]string{"id=c2"}, []string{"c2"}},
+	}
+
+	for _, tt := range test {
+		got, err := filterContainerList(testContainerList(), tt.filters)
+		if err != nil {
+			t.Errorf("filterContainerList(%v): unexpected error: %v", tt.filters, err)
+			continue
+		}
+
+		ids := []string{}
+		for _, c := range got {
+			ids = append(ids, c.ID)
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("filterContainerList(%v): want %v; got %v", tt.filters, tt.want, ids)
+		}
+	}
+
+	for _, f := range []string{"status", "status=", "color=red"} {
+		if _, err := filterContainerList(testContainerList(), []string{f}); err == nil {
+			t.Errorf("filterContainerList: expected error for filter %q", f)
+		}
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/opencontainers/runc/libcontainer/logs"
+	"github.com/opencontainers/runc/libsysbox/syscont"
 	"github.com/opencontainers/runtime-spec/specs-go"
 
 	"github.com/sirupsen/logrus"
@@ -100,6 +102,75 @@ func main() {
 			Usage:  "enable memory-profiling data collectionprofile data is stored in the cwd of the process invoking sysbox-runc.",
 			Hidden: true,
 		},
+		cli.StringFlag{
+			Name:  "config",
+			Value: "",
+			Usage: "path to the sysbox-runc config file (default: /etc/sysbox/sysbox-runc.toml or ~/.config/sysbox/sysbox-runc.toml)",
+		},
+		cli.StringFlag{
+			Name:  "resource-policy-file",
+			Value: "",
+			Usage: "path to a policy file with the host resource thresholds below which containers are not created",
+		},
+		cli.BoolFlag{
+			Name:  "require-seccomp",
+			Usage: "fail to create containers whose spec has no seccomp config",
+		},
+		cli.BoolFlag{
+			Name:  "strict-seccomp",
+			Usage: "fail to create containers whose seccomp config conflicts with the syscalls required by sysbox",
+		},
+		cli.BoolFlag{
+			Name:  "allow-seccomp-log-mode",
+			Usage: "allow containers to log rather than enforce their seccomp profile via the sysbox.io/seccomp-mode annotation (breaks container isolation; meant for debugging)",
+		},
+		cli.BoolFlag{
+			Name:  "allow-network-policy-progs",
+			Usage: "allow containers to have eBPF programs that filter their network traffic loaded via the sysbox.io/network-policy-prog-* annotations",
+		},
+		cli.StringFlag{
+			Name:  "seccomp-profile-dir",
+			Value: "",
+			Usage: "dir with the seccomp profiles that containers may chain to their own via the sysbox.io/seccomp-extra-profiles annotation (disabled by default)",
+		},
+		cli.StringFlag{
+			Name:  "capability-audit-log-dir",
+			Value: "",
+			Usage: "dir where a log of the capabilities granted to each container is kept (disabled by default)",
+		},
+		cli.BoolFlag{
+			Name:  "skip-capability-check",
+			Usage: "skip checking that sysbox-runc has the capabilities required to create containers",
+		},
+		cli.BoolFlag{
+			Name:  "force-full-caps",
+			Usage: "give containers the full set of capabilities even when sysbox-runc runs inside another system container",
+		},
+		cli.BoolFlag{
+			Name:  "strict-spec-validation",
+			Usage: "fail to create containers whose spec has fields unknown to the OCI runtime spec",
+		},
+		cli.BoolFlag{
+			Name:  "partial-supmounts-ok",
+			Usage: "create containers even if sysbox-mgr sets up only some of the supplementary mounts",
+		},
+		cli.BoolFlag{
+			Name:  "remap-sup-mounts",
+			Usage: "chown the sources of the sysbox-mgr supplementary mounts to the container's root user (for hosts without uid shifting)",
+		},
+		cli.DurationFlag{
+			Name:  "cgroup-join-timeout",
+			Value: 5 * time.Second,
+			Usage: "max time allowed for placing the container's init process in each of its cgroups (systemd cgroup driver only; 0 disables the timeout)",
+		},
+		cli.BoolFlag{
+			Name:  "auto-repair-cgroups",
+			Usage: "repair the container's cgroup paths when getting its cgroup stats fails (systemd cgroup driver on cgroup v1 hosts only)",
+		},
+		cli.BoolFlag{
+			Name:  "strict-resource-verify",
+			Usage: "fail cgroup updates whose memory, cpu shares or pids limits are not applied by the kernel, rather than just warn (systemd cgroup driver on cgroup v1 hosts only)",
+		},
 		cli.BoolFlag{
 			Name:  "systemd-cgroup",
 			Usage: "enable systemd cgroup support, expects cgroupsPath to be of form \"slice:prefix:name\" for e.g. \"system.slice:runc:434234\"",
@@ -107,21 +178,34 @@ func main() {
 	}
 
 	app.Commands = []cli.Command{
+		auditCapsCommand,
+		configCommand,
 		createCommand,
+		debugSnapshotCommand,
 		deleteCommand,
 		eventsCommand,
 		execCommand,
+		exportCgroupsCommand,
+		freezerStateCommand,
 		initCommand,
 		killCommand,
 		listCommand,
+		networkInspectCommand,
 		pauseCommand,
 		psCommand,
+		reclaimMemoryCommand,
+		refreshMountsCommand,
+		repairCgroupsCommand,
 		resumeCommand,
+		rootfsPrepareCommand,
 		runCommand,
 		specCommand,
+		specExportCommand,
 		startCommand,
 		stateCommand,
+		topologyCommand,
 		updateCommand,
+		waitCommand,
 	}
 
 	app.Before = func(context *cli.Context) error {
@@ -141,7 +225,19 @@ func main() {
 		if err := reviseRootDir(context); err != nil {
 			return err
 		}
-		return logs.ConfigureLogging(createLogConfig(context))
+		if err := logs.ConfigureLogging(createLogConfig(context)); err != nil {
+			return err
+		}
+		syscont.ForceFullCaps = context.GlobalBool("force-full-caps")
+		syscont.AllowSeccompLogMode = context.GlobalBool("allow-seccomp-log-mode")
+		syscont.AllowNetworkPolicyProgs = context.GlobalBool("allow-network-policy-progs")
+		syscont.SeccompProfileDir = context.GlobalString("seccomp-profile-dir")
+		if configCommands[context.Args().First()] {
+			if err := syscont.LoadConfig(context.GlobalString("config")); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
 	// If the command returns an error, cli takes upon itself to print
@@ -153,6 +249,16 @@ func main() {
 	}
 }
 
+// configCommands are the commands that use the settings in the sysbox-runc
+// config file (i.e., that generate or convert container specs).
+var configCommands = map[string]bool{
+	"config":  true,
+	"create":  true,
+	"restore": true,
+	"run":     true,
+	"spec":    true,
+}
+
 type FatalWriter struct {
 	cliErrWriter io.Writer
 }
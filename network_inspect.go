@@ -0,0 +1,329 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/urfave/cli"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// NetworkInspectVersion is the version of the network-inspect output format.
+const NetworkInspectVersion = 1
+
+// NetworkInspectResult holds the network state of a container's network
+// namespace.
+type NetworkInspectResult struct {
+	Version     int            `json:"version"`
+	ContainerID string         `json:"container_id"`
+	Interfaces  []IfaceInfo    `json:"interfaces"`
+	Routes      []RouteInfo    `json:"routes"`
+	Neighbors   []NeighborInfo `json:"neighbors"`
+	DNSConfig   DNSInfo        `json:"dns_config"`
+}
+
+// IfaceInfo describes a network interface.
+type IfaceInfo struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	MAC   string `json:"mac,omitempty"`
+	MTU   int    `json:"mtu"`
+	Up    bool   `json:"up"`
+	State string `json:"state"`
+	// Addresses in CIDR notation (e.g., "172.17.0.2/16")
+	Addresses []string `json:"addresses"`
+}
+
+// RouteInfo describes a route in the main routing table.
+type RouteInfo struct {
+	// Destination in CIDR notation, or "default"
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway,omitempty"`
+	Interface   string `json:"interface,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Scope       string `json:"scope"`
+	Protocol    int    `json:"protocol"`
+	Metric      int    `json:"metric"`
+}
+
+// NeighborInfo describes an entry in the neighbor (ARP / NDP) table.
+type NeighborInfo struct {
+	IP        string `json:"ip"`
+	MAC       string `json:"mac,omitempty"`
+	Interface string `json:"interface"`
+	State     string `json:"state"`
+}
+
+// DNSInfo holds the container's DNS config (from its /etc/resolv.conf).
+type DNSInfo struct {
+	Nameservers []string `json:"nameservers"`
+	Search      []string `json:"search"`
+	Options     []string `json:"options"`
+}
+
+var networkInspectCommand = cli.Command{
+	Name:  "network-inspect",
+	Usage: "outputs the network state of a container",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The network-inspect command outputs (in JSON format) the network interfaces,
+routes and neighbor table entries in the network namespace of the given
+container, as well as its DNS config (from the container's /etc/resolv.conf).`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "interface",
+			Usage: "only show the given interface (and its routes and neighbors)",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		status, err := container.Status()
+		if err != nil {
+			return err
+		}
+		if status == libcontainer.Stopped {
+			return fmt.Errorf("container %s is not running", container.ID())
+		}
+		state, err := container.State()
+		if err != nil {
+			return err
+		}
+		result, err := inspectNetwork(state.InitProcessPid, context.String("interface"))
+		if err != nil {
+			return fmt.Errorf("failed to inspect the network of container %s: %v", container.ID(), err)
+		}
+		result.ContainerID = container.ID()
+		data, err := json.MarshalIndent(result, "", "\t")
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(data)
+		return nil
+	},
+}
+
+// inspectNetwork returns the network state of the network namespace of the
+// given process (optionally restricted to the given interface).
+func inspectNetwork(pid int, iface string) (*NetworkInspectResult, error) {
+	procDir := filepath.Join("/proc", strconv.Itoa(pid))
+
+	ns, err := netns.GetFromPath(filepath.Join(procDir, "ns/net"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open network namespace: %v", err)
+	}
+	defer ns.Close()
+
+	// the handle's netlink socket is created in the namespace; the calling
+	// thread returns to its own namespace before NewHandleAt returns
+	h, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enter network namespace: %v", err)
+	}
+	defer h.Delete()
+
+	result := &NetworkInspectResult{
+		Version:    NetworkInspectVersion,
+		Interfaces: []IfaceInfo{},
+		Routes:     []RouteInfo{},
+		Neighbors:  []NeighborInfo{},
+	}
+
+	links, err := h.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %v", err)
+	}
+
+	names := make(map[int]string, len(links))
+	for _, link := range links {
+		names[link.Attrs().Index] = link.Attrs().Name
+	}
+
+	found := false
+	for _, link := range links {
+		if iface != "" && link.Attrs().Name != iface {
+			continue
+		}
+		found = true
+		addrs, err := h.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list addresses of %s: %v", link.Attrs().Name, err)
+		}
+		result.Interfaces = append(result.Interfaces, ifaceInfo(link, addrs))
+	}
+	if iface != "" && !found {
+		return nil, fmt.Errorf("no interface %s in the container", iface)
+	}
+
+	routes, err := h.RouteList(nil, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %v", err)
+	}
+	for _, r := range routes {
+		if iface != "" && names[r.LinkIndex] != iface {
+			continue
+		}
+		result.Routes = append(result.Routes, routeInfo(r, names))
+	}
+
+	neighs, err := h.NeighList(0, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list neighbors: %v", err)
+	}
+	for _, n := range neighs {
+		if iface != "" && names[n.LinkIndex] != iface {
+			continue
+		}
+		result.Neighbors = append(result.Neighbors, neighborInfo(n, names))
+	}
+
+	// the container's resolv.conf is read via its root (it may be absent)
+	data, err := ioutil.ReadFile(filepath.Join(procDir, "root/etc/resolv.conf"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read resolv.conf: %v", err)
+	}
+	result.DNSConfig = parseResolvConf(data)
+
+	return result, nil
+}
+
+func ifaceInfo(link netlink.Link, addrs []netlink.Addr) IfaceInfo {
+	attrs := link.Attrs()
+
+	info := IfaceInfo{
+		Index:     attrs.Index,
+		Name:      attrs.Name,
+		Type:      link.Type(),
+		MTU:       attrs.MTU,
+		Up:        attrs.Flags&net.FlagUp != 0,
+		State:     attrs.OperState.String(),
+		Addresses: []string{},
+	}
+	if len(attrs.HardwareAddr) > 0 {
+		info.MAC = attrs.HardwareAddr.String()
+	}
+	for _, addr := range addrs {
+		info.Addresses = append(info.Addresses, addr.IPNet.String())
+	}
+
+	return info
+}
+
+func routeInfo(r netlink.Route, names map[int]string) RouteInfo {
+	info := RouteInfo{
+		Destination: "default",
+		Interface:   names[r.LinkIndex],
+		Scope:       routeScopeName(r.Scope),
+		Protocol:    r.Protocol,
+		Metric:      r.Priority,
+	}
+	if r.Dst != nil {
+		info.Destination = r.Dst.String()
+	}
+	if r.Gw != nil {
+		info.Gateway = r.Gw.String()
+	}
+	if r.Src != nil {
+		info.Source = r.Src.String()
+	}
+	return info
+}
+
+func neighborInfo(n netlink.Neigh, names map[int]string) NeighborInfo {
+	info := NeighborInfo{
+		IP:        n.IP.String(),
+		Interface: names[n.LinkIndex],
+		State:     neighStateName(n.State),
+	}
+	if len(n.HardwareAddr) > 0 {
+		info.MAC = n.HardwareAddr.String()
+	}
+	return info
+}
+
+var routeScopeNames = map[netlink.Scope]string{
+	netlink.SCOPE_UNIVERSE: "global",
+	netlink.SCOPE_SITE:     "site",
+	netlink.SCOPE_LINK:     "link",
+	netlink.SCOPE_HOST:     "host",
+	netlink.SCOPE_NOWHERE:  "nowhere",
+}
+
+func routeScopeName(scope netlink.Scope) string {
+	if name, ok := routeScopeNames[scope]; ok {
+		return name
+	}
+	return strconv.Itoa(int(scope))
+}
+
+// neighbor states, in the order shown by "ip neigh"
+var neighStateNames = []struct {
+	state int
+	name  string
+}{
+	{netlink.NUD_INCOMPLETE, "INCOMPLETE"},
+	{netlink.NUD_REACHABLE, "REACHABLE"},
+	{netlink.NUD_STALE, "STALE"},
+	{netlink.NUD_DELAY, "DELAY"},
+	{netlink.NUD_PROBE, "PROBE"},
+	{netlink.NUD_FAILED, "FAILED"},
+	{netlink.NUD_NOARP, "NOARP"},
+	{netlink.NUD_PERMANENT, "PERMANENT"},
+}
+
+func neighStateName(state int) string {
+	var names []string
+	for _, s := range neighStateNames {
+		if state&s.state != 0 {
+			names = append(names, s.name)
+		}
+	}
+	if len(names) == 0 {
+		return "NONE"
+	}
+	return strings.Join(names, ",")
+}
+
+// parseResolvConf returns the DNS config in the given resolv.conf data.
+func parseResolvConf(data []byte) DNSInfo {
+	info := DNSInfo{
+		Nameservers: []string{},
+		Search:      []string{},
+		Options:     []string{},
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			info.Nameservers = append(info.Nameservers, fields[1])
+		case "search", "domain":
+			// the last search or domain line wins
+			info.Search = fields[1:]
+		case "options":
+			info.Options = append(info.Options, fields[1:]...)
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,171 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+// checkJSON checks that the given value marshals to the given JSON and back.
+func checkJSON(t *testing.T, v interface{}, want string, decoded interface{}) {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal(%T): unexpected error: %v", v, err)
+	}
+	if string(data) != want {
+		t.Errorf("json.Marshal(%T):\nwant %s\ngot  %s", v, want, data)
+	}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("json.Unmarshal(%T): unexpected error: %v", v, err)
+	}
+	if !reflect.DeepEqual(reflect.ValueOf(decoded).Elem().Interface(), v) {
+		t.Errorf("json.Unmarshal(%T): want %+v, got %+v", v, v, decoded)
+	}
+}
+
+func TestIfaceInfoJSON(t *testing.T) {
+	info := IfaceInfo{
+		Index:     2,
+		Name:      "eth0",
+		Type:      "veth",
+		MAC:       "02:42:ac:11:00:02",
+		MTU:       1500,
+		Up:        true,
+		State:     "up",
+		Addresses: []string{"172.17.0.2/16"},
+	}
+	checkJSON(t, info,
+		`{"index":2,"name":"eth0","type":"veth","mac":"02:42:ac:11:00:02","mtu":1500,"up":true,"state":"up","addresses":["172.17.0.2/16"]}`,
+		&IfaceInfo{})
+
+	// the loopback has no MAC
+	info = IfaceInfo{Index: 1, Name: "lo", Type: "device", MTU: 65536, Up: true, State: "unknown", Addresses: []string{}}
+	checkJSON(t, info,
+		`{"index":1,"name":"lo","type":"device","mtu":65536,"up":true,"state":"unknown","addresses":[]}`,
+		&IfaceInfo{})
+}
+
+func TestRouteInfoJSON(t *testing.T) {
+	info := RouteInfo{
+		Destination: "default",
+		Gateway:     "172.17.0.1",
+		Interface:   "eth0",
+		Scope:       "global",
+		Protocol:    3,
+	}
+	checkJSON(t, info,
+		`{"destination":"default","gateway":"172.17.0.1","interface":"eth0","scope":"global","protocol":3,"metric":0}`,
+		&RouteInfo{})
+
+	info = RouteInfo{
+		Destination: "172.17.0.0/16",
+		Interface:   "eth0",
+		Source:      "172.17.0.2",
+		Scope:       "link",
+		Protocol:    2,
+		Metric:      100,
+	}
+	checkJSON(t, info,
+		`{"destination":"172.17.0.0/16","interface":"eth0","source":"172.17.0.2","scope":"link","protocol":2,"metric":100}`,
+		&RouteInfo{})
+}
+
+func TestNeighborInfoJSON(t *testing.T) {
+	info := NeighborInfo{IP: "172.17.0.1", MAC: "02:42:5e:1b:2c:3d", Interface: "eth0", State: "REACHABLE"}
+	checkJSON(t, info,
+		`{"ip":"172.17.0.1","mac":"02:42:5e:1b:2c:3d","interface":"eth0","state":"REACHABLE"}`,
+		&NeighborInfo{})
+
+	info = NeighborInfo{IP: "172.17.0.9", Interface: "eth0", State: "INCOMPLETE"}
+	checkJSON(t, info,
+		`{"ip":"172.17.0.9","interface":"eth0","state":"INCOMPLETE"}`,
+		&NeighborInfo{})
+}
+
+func TestDNSInfoJSON(t *testing.T) {
+	info := DNSInfo{
+		Nameservers: []string{"8.8.8.8"},
+		Search:      []string{"example.com"},
+		Options:     []string{"ndots:0"},
+	}
+	checkJSON(t, info,
+		`{"nameservers":["8.8.8.8"],"search":["example.com"],"options":["ndots:0"]}`,
+		&DNSInfo{})
+}
+
+func TestNetworkInspectResultJSON(t *testing.T) {
+	result := NetworkInspectResult{
+		Version:     NetworkInspectVersion,
+		ContainerID: "c1",
+		Interfaces:  []IfaceInfo{{Index: 1, Name: "lo", Type: "device", MTU: 65536, Up: true, State: "unknown", Addresses: []string{"127.0.0.1/8"}}},
+		Routes:      []RouteInfo{},
+		Neighbors:   []NeighborInfo{},
+		DNSConfig:   DNSInfo{Nameservers: []string{}, Search: []string{}, Options: []string{}},
+	}
+	checkJSON(t, result,
+		`{"version":1,"container_id":"c1","interfaces":[{"index":1,"name":"lo","type":"device","mtu":65536,"up":true,"state":"unknown","addresses":["127.0.0.1/8"]}],"routes":[],"neighbors":[],"dns_config":{"nameservers":[],"search":[],"options":[]}}`,
+		&NetworkInspectResult{})
+}
+
+func TestRouteAndNeighborInfo(t *testing.T) {
+	names := map[int]string{1: "lo", 2: "eth0"}
+
+	_, dst, _ := net.ParseCIDR("10.0.0.0/24")
+	r := routeInfo(netlink.Route{LinkIndex: 2, Dst: dst, Scope: netlink.SCOPE_LINK, Protocol: 2}, names)
+	want := RouteInfo{Destination: "10.0.0.0/24", Interface: "eth0", Scope: "link", Protocol: 2}
+	if r != want {
+		t.Errorf("routeInfo: want %+v, got %+v", want, r)
+	}
+
+	r = routeInfo(netlink.Route{LinkIndex: 2, Gw: net.ParseIP("10.0.0.1")}, names)
+	want = RouteInfo{Destination: "default", Gateway: "10.0.0.1", Interface: "eth0", Scope: "global"}
+	if r != want {
+		t.Errorf("routeInfo: want %+v, got %+v", want, r)
+	}
+
+	mac, _ := net.ParseMAC("02:42:ac:11:00:01")
+	n := neighborInfo(netlink.Neigh{LinkIndex: 2, IP: net.ParseIP("10.0.0.1"), HardwareAddr: mac, State: netlink.NUD_STALE}, names)
+	wantNeigh := NeighborInfo{IP: "10.0.0.1", MAC: "02:42:ac:11:00:01", Interface: "eth0", State: "STALE"}
+	if n != wantNeigh {
+		t.Errorf("neighborInfo: want %+v, got %+v", wantNeigh, n)
+	}
+
+	if s := neighStateName(netlink.NUD_REACHABLE | netlink.NUD_PERMANENT); s != "REACHABLE,PERMANENT" {
+		t.Errorf("neighStateName: want REACHABLE,PERMANENT, got %s", s)
+	}
+	if s := neighStateName(netlink.NUD_NONE); s != "NONE" {
+		t.Errorf("neighStateName: want NONE, got %s", s)
+	}
+}
+
+func TestParseResolvConf(t *testing.T) {
+	data := `# generated by the container manager
+nameserver 8.8.8.8
+nameserver 2001:4860:4860::8888
+domain corp.example.com
+search example.com svc.cluster.local
+; old style comment
+options ndots:5 timeout:2
+options rotate
+`
+	want := DNSInfo{
+		Nameservers: []string{"8.8.8.8", "2001:4860:4860::8888"},
+		Search:      []string{"example.com", "svc.cluster.local"},
+		Options:     []string{"ndots:5", "timeout:2", "rotate"},
+	}
+	if got := parseResolvConf([]byte(data)); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseResolvConf: want %+v, got %+v", want, got)
+	}
+
+	want = DNSInfo{Nameservers: []string{}, Search: []string{}, Options: []string{}}
+	if got := parseResolvConf(nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseResolvConf: want %+v for empty file, got %+v", want, got)
+	}
+}
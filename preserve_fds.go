@@ -0,0 +1,102 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nestybox/sysbox-libs/utils"
+	"golang.org/x/sys/unix"
+)
+
+// fds inherited by sysbox-runc from its parent, as recorded at startup (fd ->
+// link target in /proc/self/fd)
+var inheritedFds = listFds()
+
+// namespace types, as shown in the link targets of namespace fds (e.g.,
+// "net:[4026531992]")
+var nsLinkTypes = []string{
+	"cgroup", "ipc", "mnt", "net", "pid", "pid_for_children",
+	"time", "time_for_children", "user", "uts",
+}
+
+// validatePreserveFds checks that the given fds (to be passed to the
+// container via --preserve-fds) are open and not in the excluded list.
+func validatePreserveFds(fds []int, excludedFds []int) error {
+	excluded := make(map[int]bool, len(excludedFds))
+	for _, fd := range excludedFds {
+		excluded[fd] = true
+	}
+
+	for _, fd := range fds {
+		if _, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0); err != nil {
+			return fmt.Errorf("fd %d is not open: %v", fd, err)
+		}
+		if excluded[fd] {
+			return fmt.Errorf("fd %d is in use by sysbox-runc and can't be passed to the container", fd)
+		}
+	}
+
+	return nil
+}
+
+// internalFds returns the namespace and cgroup fds opened by sysbox-runc
+// itself (i.e., not inherited from its parent).
+func internalFds() []int {
+	var fds []int
+
+	for fd, target := range listFds() {
+		if t, ok := inheritedFds[fd]; ok && t == target {
+			continue
+		}
+		if isNsLink(target) || isCgroupPath(target) {
+			fds = append(fds, fd)
+		}
+	}
+
+	return fds
+}
+
+// listFds returns the open fds of the current process along with their link
+// targets.
+func listFds() map[int]string {
+	fds := make(map[int]string)
+
+	dir := "/proc/self/fd"
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fds
+	}
+
+	for _, e := range entries {
+		fd, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(dir, e.Name()))
+		if err != nil {
+			// e.g., the fd used to read the dir itself
+			continue
+		}
+		fds[fd] = target
+	}
+
+	return fds
+}
+
+func isNsLink(target string) bool {
+	i := strings.Index(target, ":[")
+	if i <= 0 || !strings.HasSuffix(target, "]") {
+		return false
+	}
+	return utils.StringSliceContains(nsLinkTypes, target[:i])
+}
+
+func isCgroupPath(target string) bool {
+	return target == "/sys/fs/cgroup" || strings.HasPrefix(target, "/sys/fs/cgroup/")
+}
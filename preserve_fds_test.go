@@ -0,0 +1,88 @@
+// +build linux
+
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestValidatePreserveFds(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	rfd, wfd := int(r.Fd()), int(w.Fd())
+
+	if err := validatePreserveFds([]int{rfd, wfd}, nil); err != nil {
+		t.Errorf("validatePreserveFds: unexpected error: %v", err)
+	}
+	if err := validatePreserveFds(nil, []int{rfd}); err != nil {
+		t.Errorf("validatePreserveFds: unexpected error for no fds: %v", err)
+	}
+
+	// excluded fd (e.g., a namespace fd)
+	if err := validatePreserveFds([]int{rfd, wfd}, []int{wfd}); err == nil {
+		t.Errorf("validatePreserveFds: want error for excluded fd %d", wfd)
+	}
+
+	// closed fd
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedFd := int(f.Fd())
+	f.Close()
+	if err := validatePreserveFds([]int{rfd, closedFd}, nil); err == nil {
+		t.Errorf("validatePreserveFds: want error for closed fd %d", closedFd)
+	}
+}
+
+func TestInternalFds(t *testing.T) {
+	ns, err := os.Open("/proc/self/ns/net")
+	if err != nil {
+		t.Skipf("failed to open net ns: %v", err)
+	}
+	defer ns.Close()
+
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	found := map[int]bool{}
+	for _, fd := range internalFds() {
+		found[fd] = true
+	}
+
+	if !found[int(ns.Fd())] {
+		t.Errorf("internalFds: want namespace fd %d; got %v", ns.Fd(), found)
+	}
+	if found[int(f.Fd())] {
+		t.Errorf("internalFds: unexpected fd %d (%s)", f.Fd(), os.DevNull)
+	}
+}
+
+func TestIsNsLink(t *testing.T) {
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"net:[4026531992]", true},
+		{"pid_for_children:[4026531836]", true},
+		{"socket:[12345]", false},
+		{"pipe:[12345]", false},
+		{"anon_inode:[eventfd]", false},
+		{"/dev/null", false},
+	}
+
+	for _, test := range tests {
+		if got := isNsLink(test.target); got != test.want {
+			t.Errorf("isNsLink(%q): want %v; got %v", test.target, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/docker/go-units"
+	"github.com/urfave/cli"
+)
+
+var reclaimMemoryCommand = cli.Command{
+	Name:  "reclaim-memory",
+	Usage: "reclaims the given amount of memory from the container's cgroup",
+	ArgsUsage: `<container-id> <bytes>
+
+Where "<container-id>" is your name for the instance of the container and
+"<bytes>" is the amount of memory to reclaim (e.g., 104857600 or 100M).`,
+	Description: `The reclaim-memory command triggers the reclaim of the given amount of memory
+from the container's cgroup via the cgroup v2 memory.reclaim file, without
+invoking the OOM killer (e.g., to reduce memory pressure ahead of a latency
+sensitive operation). Requires the memory controller in the cgroup v2
+hierarchy and kernel 5.19 or later.`,
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 2, exactArgs); err != nil {
+			return err
+		}
+		bytes, err := units.RAMInBytes(context.Args().Get(1))
+		if err != nil || bytes <= 0 {
+			return fmt.Errorf("invalid amount of memory: %s", context.Args().Get(1))
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		if err := container.ReclaimMemory(uint64(bytes)); err != nil {
+			return fmt.Errorf("failed to reclaim memory of container %s: %v", container.ID(), err)
+		}
+		return nil
+	},
+}
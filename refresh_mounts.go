@@ -0,0 +1,87 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libsysbox/syscont"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
+)
+
+var refreshMountsCommand = cli.Command{
+	Name:  "refresh-mounts",
+	Usage: "sets up the sysbox-fs mounts that a running container is missing",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The refresh-mounts command sets up in the running container the sysbox-fs
+mounts that it lacks (e.g., mounts for procfs or sysfs files that sysbox-fs
+started emulating after the container was created), without restarting it.
+The added mounts are recorded in the container's state.`,
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		added, err := refreshSysboxFsMounts(container)
+		for _, m := range added {
+			fmt.Printf("added mount at %s\n", m.Destination)
+		}
+		return err
+	},
+}
+
+// refreshSysboxFsMounts sets up the sysbox-fs mounts that the given container
+// is missing and records them in the container's state.
+func refreshSysboxFsMounts(container libcontainer.Container) ([]specs.Mount, error) {
+	status, err := container.Status()
+	if err != nil {
+		return nil, err
+	}
+	if status != libcontainer.Running {
+		return nil, fmt.Errorf("container %s is not running", container.ID())
+	}
+
+	state, err := container.State()
+	if err != nil {
+		return nil, err
+	}
+
+	// the container's sysbox-fs mountpoint is per the sysbox-fs state recorded
+	// at creation
+	if !state.SysFs.Enabled() {
+		return nil, fmt.Errorf("container %s does not use sysbox-fs", container.ID())
+	}
+
+	applied := []specs.Mount{}
+	for _, m := range state.Config.Mounts {
+		applied = append(applied, specs.Mount{Destination: m.Destination, Source: m.Source})
+	}
+
+	added, refreshErr := syscont.RefreshSysboxFsMounts(state.SysFs.Id, state.InitProcessPid, applied)
+
+	// record the mounts that were set up, even if others failed
+	mounts := []*configs.Mount{}
+	for _, m := range added {
+		mounts = append(mounts, &configs.Mount{
+			Source:           m.Source,
+			Destination:      m.Destination,
+			Device:           "bind",
+			Flags:            unix.MS_BIND | unix.MS_REC,
+			PropagationFlags: []int{unix.MS_PRIVATE | unix.MS_REC},
+		})
+	}
+	if err := container.AddMounts(mounts); err != nil {
+		return added, fmt.Errorf("failed to record mounts of container %s: %v", container.ID(), err)
+	}
+
+	return added, refreshErr
+}
@@ -0,0 +1,35 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+)
+
+var repairCgroupsCommand = cli.Command{
+	Name:  "repair-cgroups",
+	Usage: "re-syncs the container's cgroup paths with those of its systemd unit",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The repair-cgroups command queries systemd for the current control group of
+the container's unit and, if the container's cgroup paths no longer match it
+(e.g., because systemd moved the unit's cgroups across a host suspend/resume
+cycle), updates them and places the container's init process in the new
+cgroups. Only supported with the systemd cgroup driver on cgroup v1 hosts.`,
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		if err := container.RepairCgroups(); err != nil {
+			return fmt.Errorf("failed to repair cgroups of container %s: %v", container.ID(), err)
+		}
+		return nil
+	},
+}
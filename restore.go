@@ -134,6 +134,13 @@ using the sysbox-runc checkpoint command.`,
 			}()
 		}
 
+		// remove the files generated for the container (if any) on failure
+		defer func() {
+			if err != nil {
+				syscont.RemoveRunDir(id)
+			}
+		}()
+
 		uidShiftSupported, uidShiftRootfs, err = syscont.ConvertSpec(context, sysMgr, sysFs, spec)
 		if err != nil {
 			return fmt.Errorf("error in the container spec: %v", err)
@@ -0,0 +1,46 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/opencontainers/runc/libsysbox/syscont"
+	"github.com/urfave/cli"
+)
+
+var rootfsPrepareCommand = cli.Command{
+	Name:  "rootfs-prepare",
+	Usage: "sets up a rootfs for use by a system container",
+	ArgsUsage: `<rootfs-path>
+
+Where "<rootfs-path>" is the path to the system container's root filesystem.`,
+	Description: `The rootfs-prepare command creates the directories required by a system
+container in the given rootfs (e.g., /run, /run/lock, /tmp), corrects their
+permissions, and creates the stub files over which sysbox-fs files are mounted.
+It outputs (in JSON format) a manifest of the changes made to the rootfs.
+
+The same preparation is done by "sysbox-runc create --prepare-rootfs".`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "output the changes without modifying the rootfs",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		manifest, err := syscont.PrepareRootfs(context.Args().First(), context.Bool("dry-run"))
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(data)
+		return nil
+	},
+}
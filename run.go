@@ -62,6 +62,10 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 			Name:  "no-new-keyring",
 			Usage: "do not create a new session keyring for the container.  This will cause the container to inherit the calling processes session key",
 		},
+		cli.StringSliceFlag{
+			Name:  "exclude-cgroup-subsystem",
+			Usage: "do not create a cgroup for the container in the given cgroup v1 subsystem (may be repeated; devices can't be excluded)",
+		},
 		cli.IntFlag{
 			Name:  "preserve-fds",
 			Usage: "Pass N additional file descriptors to the container (stdio + $LISTEN_FDS + N in total)",
@@ -96,6 +100,9 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 		if err = revisePidFile(context); err != nil {
 			return err
 		}
+		if err = loadResourcePolicy(context); err != nil {
+			return err
+		}
 
 		spec, err = setupSpec(context)
 		if err != nil {
@@ -122,6 +129,13 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 			}()
 		}
 
+		// remove the files generated for the container (if any) on failure
+		defer func() {
+			if err != nil {
+				syscont.RemoveRunDir(id)
+			}
+		}()
+
 		uidShiftSupported, uidShiftRootfs, err = syscont.ConvertSpec(context, sysMgr, sysFs, spec)
 		if err != nil {
 			return fmt.Errorf("error in the container spec: %v", err)
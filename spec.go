@@ -150,18 +150,23 @@ func parseIDMap(idMap string, uid, gid, size *uint32) error {
 	return nil
 }
 
-// loadSpec loads the specification from the provided path
-func loadSpec(cPath string) (spec *specs.Spec, err error) {
-	cf, err := os.Open(cPath)
+// loadSpec loads the specification from the provided path; unknown fields in
+// the specification are an error if strictValidation is set.
+func loadSpec(cPath string, strictValidation bool) (spec *specs.Spec, err error) {
+	data, err := ioutil.ReadFile(cPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, fmt.Errorf("JSON specification file %s not found", cPath)
 		}
 		return nil, err
 	}
-	defer cf.Close()
 
-	if err = json.NewDecoder(cf).Decode(&spec); err != nil {
+	// sysbox-runc: catch spec errors that the JSON decoder lets through
+	if err := syscont.ValidateSpecJSON(data, strictValidation); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &spec); err != nil {
 		return nil, err
 	}
 
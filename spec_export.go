@@ -0,0 +1,201 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/utils"
+	"github.com/opencontainers/runc/libsysbox/syscont"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urfave/cli"
+)
+
+var specExportCommand = cli.Command{
+	Name:  "spec-export",
+	Usage: "outputs a spec (config.json) for a new container equivalent to a running one",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The spec-export command outputs the spec (config.json) of the given
+container, updated with the container's current cgroup limits (e.g., as
+changed via "sysbox-runc update"). Creating a new container from it produces
+a setup equivalent to the given container's.
+
+Mounts, namespaces and capabilities that sysbox added to the container are
+not included in the spec (sysbox adds them again when the new container is
+created); they are listed in "sysbox.io/auto-added/*" annotations instead.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "strip-sysbox-annotations",
+			Usage: "remove all sysbox annotations (sysbox.io/*) from the spec",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		status, err := container.Status()
+		if err != nil {
+			return err
+		}
+		if status == libcontainer.Stopped {
+			return fmt.Errorf("container %s is not running", container.ID())
+		}
+		state, err := container.State()
+		if err != nil {
+			return err
+		}
+		bundle := utils.SearchLabels(state.Config.Labels, "bundle")
+		if bundle == "" {
+			return fmt.Errorf("no bundle found for container %s", container.ID())
+		}
+		orig, err := loadSpec(filepath.Join(bundle, specConfig), false)
+		if err != nil {
+			return err
+		}
+		stats, err := container.Stats()
+		if err != nil {
+			return fmt.Errorf("failed to get cgroup stats: %v", err)
+		}
+		spec, err := exportSpec(orig, &state.Config, stats.CgroupStats, context.Bool("strip-sysbox-annotations"))
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(spec, "", "\t")
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(data)
+		return nil
+	},
+}
+
+// cgroup v1 reports this memory limit when there is none (cgroup v2 reports
+// "max", i.e., math.MaxUint64)
+const memoryUnlimited = uint64(math.MaxInt64 &^ 4095)
+
+var configNamespaceTypes = map[configs.NamespaceType]specs.LinuxNamespaceType{
+	configs.NEWPID:    specs.PIDNamespace,
+	configs.NEWNET:    specs.NetworkNamespace,
+	configs.NEWNS:     specs.MountNamespace,
+	configs.NEWUSER:   specs.UserNamespace,
+	configs.NEWIPC:    specs.IPCNamespace,
+	configs.NEWUTS:    specs.UTSNamespace,
+	configs.NEWCGROUP: specs.CgroupNamespace,
+}
+
+// exportSpec returns the given original container spec updated with the
+// container's current cgroup limits (per its config and cgroup stats), and
+// annotated with the parts of the container's config that sysbox added to it
+// (unless strip is set, in which case all sysbox annotations are removed).
+func exportSpec(orig *specs.Spec, config *configs.Config, cgStats *cgroups.Stats, strip bool) (*specs.Spec, error) {
+	spec := new(specs.Spec)
+
+	// deep copy, so that the original spec is left untouched
+	data, err := json.Marshal(orig)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, err
+	}
+
+	if spec.Linux == nil {
+		spec.Linux = &specs.Linux{}
+	}
+	if spec.Linux.Resources == nil {
+		spec.Linux.Resources = &specs.LinuxResources{}
+	}
+	res := spec.Linux.Resources
+
+	if config.Cgroups != nil && config.Cgroups.Resources != nil {
+		r := config.Cgroups.Resources
+		if r.CpuShares != 0 || r.CpuQuota != 0 || r.CpuPeriod != 0 || r.CpusetCpus != "" || r.CpusetMems != "" {
+			if res.CPU == nil {
+				res.CPU = &specs.LinuxCPU{}
+			}
+			if r.CpuShares != 0 {
+				res.CPU.Shares = &r.CpuShares
+			}
+			if r.CpuQuota != 0 {
+				res.CPU.Quota = &r.CpuQuota
+			}
+			if r.CpuPeriod != 0 {
+				res.CPU.Period = &r.CpuPeriod
+			}
+			res.CPU.Cpus = r.CpusetCpus
+			res.CPU.Mems = r.CpusetMems
+		}
+	}
+
+	if cgStats != nil {
+		if limit := cgStats.MemoryStats.Usage.Limit; limit != 0 && limit < memoryUnlimited {
+			if res.Memory == nil {
+				res.Memory = &specs.LinuxMemory{}
+			}
+			l := int64(limit)
+			res.Memory.Limit = &l
+		}
+		if limit := cgStats.PidsStats.Limit; limit != 0 {
+			res.Pids = &specs.LinuxPids{Limit: int64(limit)}
+		}
+	}
+
+	if strip {
+		syscont.StripSysboxAnnotations(spec)
+		return spec, nil
+	}
+
+	diff := syscont.DiffSpec(orig, configSpec(config))
+	for key, val := range diff.Annotations() {
+		if spec.Annotations == nil {
+			spec.Annotations = make(map[string]string)
+		}
+		spec.Annotations[key] = val
+	}
+
+	return spec, nil
+}
+
+// configSpec returns a (partial) spec with the mounts, namespaces and
+// capabilities in the given container config.
+func configSpec(config *configs.Config) *specs.Spec {
+	spec := &specs.Spec{
+		Process: &specs.Process{},
+		Linux:   &specs.Linux{},
+	}
+
+	for _, m := range config.Mounts {
+		spec.Mounts = append(spec.Mounts, specs.Mount{
+			Destination: m.Destination,
+			Source:      m.Source,
+			Type:        m.Device,
+		})
+	}
+
+	for _, ns := range config.Namespaces {
+		if t, ok := configNamespaceTypes[ns.Type]; ok {
+			spec.Linux.Namespaces = append(spec.Linux.Namespaces, specs.LinuxNamespace{Type: t, Path: ns.Path})
+		}
+	}
+
+	if config.Capabilities != nil {
+		spec.Process.Capabilities = &specs.LinuxCapabilities{
+			Bounding: config.Capabilities.Bounding,
+		}
+	}
+
+	return spec
+}
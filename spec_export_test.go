@@ -0,0 +1,133 @@
+// +build linux
+
+package main
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer/cgroups"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func testExportSpecs() (*specs.Spec, *configs.Config) {
+	orig := &specs.Spec{
+		Version: specs.Version,
+		Process: &specs.Process{
+			Args: []string{"/bin/sh"},
+			Capabilities: &specs.LinuxCapabilities{
+				Bounding: []string{"CAP_CHOWN"},
+			},
+		},
+		Root:   &specs.Root{Path: "rootfs"},
+		Mounts: []specs.Mount{{Destination: "/proc", Type: "proc", Source: "proc"}},
+		Linux: &specs.Linux{
+			Namespaces: []specs.LinuxNamespace{{Type: specs.PIDNamespace}},
+		},
+		Annotations: map[string]string{
+			"sysbox.io/allow-kvm": "true",
+			"org.example/label":   "x",
+		},
+	}
+
+	config := &configs.Config{
+		Mounts: []*configs.Mount{
+			{Destination: "/proc", Device: "proc", Source: "proc"},
+			{Destination: "/proc/sys", Device: "bind", Source: "/var/lib/sysboxfs/cid/proc/sys"},
+		},
+		Namespaces: configs.Namespaces{
+			{Type: configs.NEWPID},
+			{Type: configs.NEWUSER},
+		},
+		Capabilities: &configs.Capabilities{
+			Bounding: []string{"CAP_CHOWN", "CAP_SYS_ADMIN"},
+		},
+		Cgroups: &configs.Cgroup{
+			Resources: &configs.Resources{
+				CpuShares:  512,
+				CpusetCpus: "0-1",
+			},
+		},
+	}
+
+	return orig, config
+}
+
+func TestExportSpec(t *testing.T) {
+	orig, config := testExportSpecs()
+
+	cgStats := cgroups.NewStats()
+	cgStats.MemoryStats.Usage.Limit = 1 << 30
+	cgStats.PidsStats.Limit = 1000
+
+	spec, err := exportSpec(orig, config, cgStats, false)
+	if err != nil {
+		t.Fatalf("exportSpec: unexpected error: %v", err)
+	}
+
+	// sysbox additions are not in the spec, but annotated
+	if len(spec.Mounts) != 1 || len(spec.Linux.Namespaces) != 1 || len(spec.Process.Capabilities.Bounding) != 1 {
+		t.Errorf("exportSpec: sysbox additions included in the spec: %+v", spec)
+	}
+
+	for key, want := range map[string]string{
+		"sysbox.io/auto-added/mounts":       "/proc/sys",
+		"sysbox.io/auto-added/namespaces":   "user",
+		"sysbox.io/auto-added/capabilities": "CAP_SYS_ADMIN",
+		"sysbox.io/allow-kvm":               "true",
+		"org.example/label":                 "x",
+	} {
+		if got := spec.Annotations[key]; got != want {
+			t.Errorf("exportSpec: annotation %s: want %q, got %q", key, want, got)
+		}
+	}
+
+	// current cgroup limits
+	res := spec.Linux.Resources
+	if res == nil || res.Memory == nil || *res.Memory.Limit != 1<<30 {
+		t.Errorf("exportSpec: memory limit not exported: %+v", res)
+	}
+	if res.Pids == nil || res.Pids.Limit != 1000 {
+		t.Errorf("exportSpec: pids limit not exported: %+v", res.Pids)
+	}
+	if res.CPU == nil || *res.CPU.Shares != 512 || res.CPU.Cpus != "0-1" {
+		t.Errorf("exportSpec: cpu limits not exported: %+v", res.CPU)
+	}
+
+	// the original spec is left untouched
+	if orig.Linux.Resources != nil || len(orig.Annotations) != 2 {
+		t.Errorf("exportSpec: original spec modified: %+v", orig)
+	}
+}
+
+func TestExportSpecUnlimited(t *testing.T) {
+	orig, config := testExportSpecs()
+	config.Cgroups.Resources = &configs.Resources{}
+
+	for _, limit := range []uint64{0, memoryUnlimited, ^uint64(0)} {
+		cgStats := cgroups.NewStats()
+		cgStats.MemoryStats.Usage.Limit = limit
+
+		spec, err := exportSpec(orig, config, cgStats, false)
+		if err != nil {
+			t.Fatalf("exportSpec: unexpected error: %v", err)
+		}
+		res := spec.Linux.Resources
+		if res.Memory != nil || res.Pids != nil || res.CPU != nil {
+			t.Errorf("exportSpec: unexpected limits for memory limit %d: %+v", limit, res)
+		}
+	}
+}
+
+func TestExportSpecStripAnnotations(t *testing.T) {
+	orig, config := testExportSpecs()
+
+	spec, err := exportSpec(orig, config, nil, true)
+	if err != nil {
+		t.Fatalf("exportSpec: unexpected error: %v", err)
+	}
+
+	if len(spec.Annotations) != 1 || spec.Annotations["org.example/label"] != "x" {
+		t.Errorf("exportSpec: want only non-sysbox annotations; got %v", spec.Annotations)
+	}
+}
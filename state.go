@@ -7,7 +7,9 @@ import (
 	"os"
 
 	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/utils"
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
@@ -18,7 +20,15 @@ var stateCommand = cli.Command{
 
 Where "<container-id>" is your name for the instance of the container.`,
 	Description: `The state command outputs current state information for the
-instance of a container.`,
+instance of a container. With --cgroups, the output also includes the
+container's cgroup tree (i.e., the container's cgroups and their limits, usage,
+stats and processes).`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "cgroups",
+			Usage: "include the container's cgroup tree in the output",
+		},
+	},
 	Action: func(context *cli.Context) error {
 		if err := checkArgs(context, 1, exactArgs); err != nil {
 			return err
@@ -50,6 +60,19 @@ instance of a container.`,
 			Created:        state.BaseState.Created,
 			Annotations:    annotations,
 		}
+		if containerStatus == libcontainer.Paused {
+			cs.PausedAt = state.PausedAt
+		}
+		// the cgroup tree is best effort; failing to get it must not fail the
+		// state command, which higher level runtimes depend on
+		if context.Bool("cgroups") && containerStatus != libcontainer.Stopped {
+			tree, err := cgroups.DumpCgroupTree(state.CgroupPaths)
+			if err != nil {
+				logrus.Warnf("failed to get cgroup tree: %v", err)
+			} else {
+				cs.CgroupTree = tree
+			}
+		}
 		data, err := json.MarshalIndent(cs, "", "  ")
 		if err != nil {
 			return err
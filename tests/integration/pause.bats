@@ -76,3 +76,46 @@ function teardown() {
 	runc state test_busybox
 	[ "$status" -ne 0 ]
 }
+
+@test "runc pause and resume persist the pause state" {
+	if [[ "$ROOTLESS" -ne 0 ]]; then
+		requires rootless_cgroup
+		set_cgroups_path "$BUSYBOX_BUNDLE"
+	fi
+	requires cgroups_freezer
+
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_busybox
+	[ "$status" -eq 0 ]
+
+	runc freezer-state test_busybox
+	[ "$status" -eq 0 ]
+	[[ "$output" == "thawed" ]]
+
+	# not paused -> no pause timestamp
+	[[ $(__runc state test_busybox | jq -r '.pausedAt') == "null" ]]
+
+	for i in 1 2; do
+		runc pause test_busybox
+		[ "$status" -eq 0 ]
+
+		runc freezer-state test_busybox
+		[ "$status" -eq 0 ]
+		[[ "$output" == "frozen" ]]
+
+		# the pause timestamp is persisted across runc invocations
+		paused_at=$(__runc state test_busybox | jq -r '.pausedAt')
+		[[ "$paused_at" != "null" ]]
+		[[ $(__runc state test_busybox | jq -r '.pausedAt') == "$paused_at" ]]
+		testcontainer test_busybox paused
+
+		runc resume test_busybox
+		[ "$status" -eq 0 ]
+
+		runc freezer-state test_busybox
+		[ "$status" -eq 0 ]
+		[[ "$output" == "thawed" ]]
+
+		[[ $(__runc state test_busybox | jq -r '.pausedAt') == "null" ]]
+		testcontainer test_busybox running
+	done
+}
@@ -0,0 +1,41 @@
+#!/usr/bin/env bats
+
+load helpers
+
+function setup() {
+	teardown_busybox
+	setup_busybox
+}
+
+function teardown() {
+	teardown_busybox
+}
+
+@test "wait for container exit code" {
+	update_config '.process.args = ["/bin/sh", "-c", "sleep 1; exit 42"]'
+
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_busybox
+	[ "$status" -eq 0 ]
+
+	runc wait test_busybox
+	[ "$status" -eq 42 ]
+
+	# the exit code of a stopped container is reported immediately
+	runc wait test_busybox
+	[ "$status" -eq 42 ]
+
+	runc delete test_busybox
+	[ "$status" -eq 0 ]
+}
+
+@test "wait timeout" {
+	runc run -d --console-socket "$CONSOLE_SOCKET" test_busybox
+	[ "$status" -eq 0 ]
+
+	testcontainer test_busybox running
+
+	runc wait --timeout 1s test_busybox
+	[ "$status" -eq 125 ]
+
+	testcontainer test_busybox running
+}
@@ -0,0 +1,288 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/cgroups/fscommon"
+	"github.com/urfave/cli"
+)
+
+// sysCPUDir is the path to the host's sysfs cpu topology (replaceable in tests)
+var sysCPUDir = "/sys/devices/system/cpu"
+
+// CPUTopology describes the physical topology of a set of CPUs.
+type CPUTopology struct {
+	CPUs []int `json:"cpus"`
+	// NUMA nodes containing the CPUs (empty if the kernel has no NUMA support)
+	NUMANodes []int `json:"numa_nodes"`
+	// IDs of the L3 caches shared by the CPUs
+	L3CacheIDs []int `json:"l3_cache_ids"`
+	// Physical cores of the CPUs, each identified by its lowest numbered
+	// (hyper)thread
+	PhysicalCores []int `json:"physical_cores"`
+}
+
+// ContainerTopology describes the physical topology of a container's CPUs and
+// memory, and its cgroups.
+type ContainerTopology struct {
+	ContainerID string `json:"container_id"`
+	CPUTopology
+	MemoryNodes []int `json:"memory_nodes"`
+	// Memory limit in bytes (0 if unlimited)
+	MemoryLimit int64             `json:"memory_limit"`
+	CgroupPaths map[string]string `json:"cgroup_paths"`
+}
+
+var topologyCommand = cli.Command{
+	Name:  "topology",
+	Usage: "outputs the CPU, NUMA and cgroup topology of a container",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The topology command outputs (in JSON format) the CPUs the container may run
+on and their NUMA nodes, L3 caches and physical cores, as well as the
+container's memory nodes, memory limit and cgroup paths (e.g., to inform
+the placement of other workloads).`,
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		status, err := container.Status()
+		if err != nil {
+			return err
+		}
+		if status == libcontainer.Stopped {
+			return fmt.Errorf("container %s is not running", container.ID())
+		}
+		state, err := container.State()
+		if err != nil {
+			return err
+		}
+		topo, err := containerTopology(container.ID(), state)
+		if err != nil {
+			return fmt.Errorf("failed to get the topology of container %s: %v", container.ID(), err)
+		}
+		data, err := json.MarshalIndent(topo, "", "\t")
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(data)
+		return nil
+	},
+}
+
+func containerTopology(id string, state *libcontainer.State) (*ContainerTopology, error) {
+	var (
+		cpus, mems  string
+		memoryLimit int64
+	)
+
+	if cg := state.Config.Cgroups; cg != nil && cg.Resources != nil {
+		cpus = cg.Resources.CpusetCpus
+		mems = cg.Resources.CpusetMems
+		memoryLimit = cg.Resources.Memory
+	}
+
+	// the cpuset cgroup has the cpus and mems in effect (e.g., inherited from
+	// the parent cgroup when the container has none)
+	cpusetDir, ok := state.CgroupPaths["cpuset"]
+	if !ok {
+		cpusetDir = state.CgroupPaths[""]
+	}
+	if cpusetDir != "" {
+		if val := readCpusetFile(cpusetDir, "cpus"); val != "" {
+			cpus = val
+		}
+		if val := readCpusetFile(cpusetDir, "mems"); val != "" {
+			mems = val
+		}
+	}
+
+	if cpus == "" {
+		data, err := ioutil.ReadFile(filepath.Join(sysCPUDir, "online"))
+		if err != nil {
+			return nil, err
+		}
+		cpus = strings.TrimSpace(string(data))
+	}
+
+	cpuTopo, err := readCPUTopology(cpus)
+	if err != nil {
+		return nil, err
+	}
+
+	memNodes, err := parseIntList(mems)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memory nodes %q: %v", mems, err)
+	}
+
+	return &ContainerTopology{
+		ContainerID: id,
+		CPUTopology: cpuTopo,
+		MemoryNodes: memNodes,
+		MemoryLimit: memoryLimit,
+		CgroupPaths: state.CgroupPaths,
+	}, nil
+}
+
+// readCpusetFile returns the effective value of the given cpuset setting
+// ("cpus" or "mems") in the given cgroup dir, or "" if not set.
+func readCpusetFile(dir, name string) string {
+	for _, file := range []string{"cpuset." + name + ".effective", "cpuset.effective_" + name, "cpuset." + name} {
+		if val, err := fscommon.GetCgroupParamString(dir, file); err == nil && val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+// readCPUTopology returns the topology of the CPUs in the given list (e.g.,
+// "0-3,8"), per the host's sysfs.
+func readCPUTopology(cpuList string) (CPUTopology, error) {
+	cpus, err := parseIntList(cpuList)
+	if err != nil {
+		return CPUTopology{}, fmt.Errorf("invalid cpu list %q: %v", cpuList, err)
+	}
+
+	nodes := map[int]bool{}
+	caches := map[int]bool{}
+	cores := map[int]bool{}
+
+	for _, cpu := range cpus {
+		cpuDir := filepath.Join(sysCPUDir, fmt.Sprintf("cpu%d", cpu))
+		if _, err := os.Stat(cpuDir); err != nil {
+			return CPUTopology{}, fmt.Errorf("no cpu %d: %v", cpu, err)
+		}
+
+		// the cpu's NUMA node is linked as "node<N>"
+		links, err := filepath.Glob(filepath.Join(cpuDir, "node[0-9]*"))
+		if err != nil {
+			return CPUTopology{}, err
+		}
+		for _, link := range links {
+			if node, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(link), "node")); err == nil {
+				nodes[node] = true
+			}
+		}
+
+		id, err := readL3CacheID(cpuDir)
+		if err != nil {
+			return CPUTopology{}, fmt.Errorf("failed to read caches of cpu %d: %v", cpu, err)
+		}
+		if id >= 0 {
+			caches[id] = true
+		}
+
+		core, err := readPhysicalCore(cpuDir, cpu)
+		if err != nil {
+			return CPUTopology{}, fmt.Errorf("failed to read topology of cpu %d: %v", cpu, err)
+		}
+		cores[core] = true
+	}
+
+	return CPUTopology{
+		CPUs:          cpus,
+		NUMANodes:     sortedKeys(nodes),
+		L3CacheIDs:    sortedKeys(caches),
+		PhysicalCores: sortedKeys(cores),
+	}, nil
+}
+
+// readL3CacheID returns the ID of the L3 cache of the cpu with the given
+// sysfs dir, or -1 if it has none (or the kernel doesn't report cache IDs).
+func readL3CacheID(cpuDir string) (int, error) {
+	indexes, err := filepath.Glob(filepath.Join(cpuDir, "cache", "index[0-9]*"))
+	if err != nil {
+		return -1, err
+	}
+
+	for _, index := range indexes {
+		level, err := readIntFile(filepath.Join(index, "level"))
+		if err != nil || level != 3 {
+			continue
+		}
+		id, err := readIntFile(filepath.Join(index, "id"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return -1, nil
+			}
+			return -1, err
+		}
+		return id, nil
+	}
+
+	return -1, nil
+}
+
+// readPhysicalCore returns the physical core of the given cpu (with the given
+// sysfs dir), identified by the lowest numbered cpu among its hyperthread
+// siblings.
+func readPhysicalCore(cpuDir string, cpu int) (int, error) {
+	// core_cpus_list replaces thread_siblings_list since kernel 5.7
+	for _, file := range []string{"core_cpus_list", "thread_siblings_list"} {
+		data, err := ioutil.ReadFile(filepath.Join(cpuDir, "topology", file))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return 0, err
+		}
+		siblings, err := parseIntList(strings.TrimSpace(string(data)))
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %v", file, err)
+		}
+		if len(siblings) == 0 {
+			break
+		}
+		return siblings[0], nil
+	}
+
+	// no topology info (e.g., offline cpu); the cpu is its own core
+	return cpu, nil
+}
+
+// parseIntList parses a cpu or node list (e.g., "0-3,8") into its sorted
+// numbers.
+func parseIntList(list string) ([]int, error) {
+	vals, err := fscommon.ParseCpusetList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[int]bool, len(vals))
+	for _, v := range vals {
+		set[int(v)] = true
+	}
+	return sortedKeys(set), nil
+}
+
+func readIntFile(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func sortedKeys(set map[int]bool) []int {
+	keys := make([]int, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
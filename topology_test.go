@@ -0,0 +1,241 @@
+// +build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// mkTestCPU creates the sysfs dir of the given cpu under the given root, with
+// the given NUMA node, L3 cache ID (none if negative) and hyperthread siblings.
+func mkTestCPU(t *testing.T, root string, cpu, node, l3 int, siblings string) {
+	cpuDir := filepath.Join(root, "cpu"+strconv.Itoa(cpu))
+
+	files := map[string]string{
+		"topology/thread_siblings_list": siblings + "\n",
+		"cache/index0/level":            "1\n",
+		"cache/index0/id":               strconv.Itoa(cpu) + "\n",
+		"cache/index2/level":            "2\n",
+		"cache/index2/id":               strconv.Itoa(cpu) + "\n",
+	}
+	if l3 >= 0 {
+		files["cache/index3/level"] = "3\n"
+		files["cache/index3/id"] = strconv.Itoa(l3) + "\n"
+	}
+
+	for name, data := range files {
+		path := filepath.Join(cpuDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	nodeDir := filepath.Join(root, "..", "node", "node"+strconv.Itoa(node))
+	if err := os.MkdirAll(nodeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(nodeDir, filepath.Join(cpuDir, "node"+strconv.Itoa(node))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mkTestTopology creates a mock sysfs cpu dir for a host with 2 NUMA nodes,
+// each with an L3 cache and 2 cores of 2 hyperthreads: node 0 has cpus 0,1
+// and their siblings 4,5; node 1 has cpus 2,3 and their siblings 6,7.
+func mkTestTopology(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "sysbox-topology-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(dir, "cpu")
+
+	cpus := []struct {
+		cpu, node, l3 int
+		siblings      string
+	}{
+		{0, 0, 0, "0,4"},
+		{1, 0, 0, "1,5"},
+		{2, 1, 1, "2,6"},
+		{3, 1, 1, "3,7"},
+		{4, 0, 0, "0,4"},
+		{5, 0, 0, "1,5"},
+		{6, 1, 1, "2,6"},
+		{7, 1, 1, "3,7"},
+	}
+	for _, c := range cpus {
+		mkTestCPU(t, root, c.cpu, c.node, c.l3, c.siblings)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "online"), []byte("0-7\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestReadCPUTopology(t *testing.T) {
+	orig := sysCPUDir
+	defer func() { sysCPUDir = orig }()
+
+	dir := mkTestTopology(t)
+	defer os.RemoveAll(dir)
+	sysCPUDir = filepath.Join(dir, "cpu")
+
+	tests := []struct {
+		cpus string
+		want CPUTopology
+	}{
+		{
+			"0-7",
+			CPUTopology{
+				CPUs:          []int{0, 1, 2, 3, 4, 5, 6, 7},
+				NUMANodes:     []int{0, 1},
+				L3CacheIDs:    []int{0, 1},
+				PhysicalCores: []int{0, 1, 2, 3},
+			},
+		},
+		{
+			// hyperthread siblings share a core
+			"0,4",
+			CPUTopology{
+				CPUs:          []int{0, 4},
+				NUMANodes:     []int{0},
+				L3CacheIDs:    []int{0},
+				PhysicalCores: []int{0},
+			},
+		},
+		{
+			"5,2-3",
+			CPUTopology{
+				CPUs:          []int{2, 3, 5},
+				NUMANodes:     []int{0, 1},
+				L3CacheIDs:    []int{0, 1},
+				PhysicalCores: []int{1, 2, 3},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := readCPUTopology(test.cpus)
+		if err != nil {
+			t.Errorf("readCPUTopology(%s): unexpected error: %v", test.cpus, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("readCPUTopology(%s): want %+v, got %+v", test.cpus, test.want, got)
+		}
+	}
+
+	for _, cpus := range []string{"0-15", "3-1", "x"} {
+		if _, err := readCPUTopology(cpus); err == nil {
+			t.Errorf("readCPUTopology(%s): expected error", cpus)
+		}
+	}
+}
+
+func TestReadCPUTopologyNoL3(t *testing.T) {
+	orig := sysCPUDir
+	defer func() { sysCPUDir = orig }()
+
+	dir, err := ioutil.TempDir("", "sysbox-topology-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sysCPUDir = filepath.Join(dir, "cpu")
+
+	// single node, no L3 cache, no hyperthreads
+	mkTestCPU(t, sysCPUDir, 0, 0, -1, "0")
+	mkTestCPU(t, sysCPUDir, 1, 0, -1, "1")
+
+	got, err := readCPUTopology("0-1")
+	if err != nil {
+		t.Fatalf("readCPUTopology: unexpected error: %v", err)
+	}
+	want := CPUTopology{
+		CPUs:          []int{0, 1},
+		NUMANodes:     []int{0},
+		L3CacheIDs:    []int{},
+		PhysicalCores: []int{0, 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readCPUTopology: want %+v, got %+v", want, got)
+	}
+}
+
+func TestContainerTopology(t *testing.T) {
+	orig := sysCPUDir
+	defer func() { sysCPUDir = orig }()
+
+	dir := mkTestTopology(t)
+	defer os.RemoveAll(dir)
+	sysCPUDir = filepath.Join(dir, "cpu")
+
+	cgroupDir := filepath.Join(dir, "cgroup")
+	if err := os.Mkdir(cgroupDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	state := &libcontainer.State{
+		BaseState: libcontainer.BaseState{
+			Config: configs.Config{
+				Cgroups: &configs.Cgroup{
+					Resources: &configs.Resources{
+						CpusetCpus: "0-7",
+						CpusetMems: "0-1",
+						Memory:     1 << 30,
+					},
+				},
+			},
+		},
+		CgroupPaths: map[string]string{"": cgroupDir},
+	}
+
+	// no cpuset files: the config's settings are used
+	topo, err := containerTopology("c1", state)
+	if err != nil {
+		t.Fatalf("containerTopology: unexpected error: %v", err)
+	}
+	if len(topo.CPUs) != 8 || !reflect.DeepEqual(topo.MemoryNodes, []int{0, 1}) || topo.MemoryLimit != 1<<30 {
+		t.Errorf("containerTopology: unexpected topology %+v", topo)
+	}
+
+	// the cgroup's effective cpuset takes precedence
+	for file, val := range map[string]string{"cpuset.cpus.effective": "2-3\n", "cpuset.mems.effective": "1\n"} {
+		if err := ioutil.WriteFile(filepath.Join(cgroupDir, file), []byte(val), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	topo, err = containerTopology("c1", state)
+	if err != nil {
+		t.Fatalf("containerTopology: unexpected error: %v", err)
+	}
+	want := &ContainerTopology{
+		ContainerID: "c1",
+		CPUTopology: CPUTopology{
+			CPUs:          []int{2, 3},
+			NUMANodes:     []int{1},
+			L3CacheIDs:    []int{1},
+			PhysicalCores: []int{2, 3},
+		},
+		MemoryNodes: []int{1},
+		MemoryLimit: 1 << 30,
+		CgroupPaths: map[string]string{"": cgroupDir},
+	}
+	if !reflect.DeepEqual(topo, want) {
+		t.Errorf("containerTopology: want %+v, got %+v", want, topo)
+	}
+}
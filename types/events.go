@@ -16,6 +16,7 @@ type Stats struct {
 	Memory            Memory              `json:"memory"`
 	Pids              Pids                `json:"pids"`
 	Blkio             Blkio               `json:"blkio"`
+	NetPrio           NetPrio             `json:"net_prio"`
 	Hugetlb           map[string]Hugetlb  `json:"hugetlb"`
 	IntelRdt          IntelRdt            `json:"intel_rdt"`
 	NetworkInterfaces []*NetworkInterface `json:"network_interfaces"`
@@ -35,14 +36,16 @@ type BlkioEntry struct {
 }
 
 type Blkio struct {
-	IoServiceBytesRecursive []BlkioEntry `json:"ioServiceBytesRecursive,omitempty"`
-	IoServicedRecursive     []BlkioEntry `json:"ioServicedRecursive,omitempty"`
-	IoQueuedRecursive       []BlkioEntry `json:"ioQueueRecursive,omitempty"`
-	IoServiceTimeRecursive  []BlkioEntry `json:"ioServiceTimeRecursive,omitempty"`
-	IoWaitTimeRecursive     []BlkioEntry `json:"ioWaitTimeRecursive,omitempty"`
-	IoMergedRecursive       []BlkioEntry `json:"ioMergedRecursive,omitempty"`
-	IoTimeRecursive         []BlkioEntry `json:"ioTimeRecursive,omitempty"`
-	SectorsRecursive        []BlkioEntry `json:"sectorsRecursive,omitempty"`
+	IoServiceBytesRecursive   []BlkioEntry `json:"ioServiceBytesRecursive,omitempty"`
+	IoServicedRecursive       []BlkioEntry `json:"ioServicedRecursive,omitempty"`
+	IoQueuedRecursive         []BlkioEntry `json:"ioQueueRecursive,omitempty"`
+	IoServiceTimeRecursive    []BlkioEntry `json:"ioServiceTimeRecursive,omitempty"`
+	IoWaitTimeRecursive       []BlkioEntry `json:"ioWaitTimeRecursive,omitempty"`
+	IoMergedRecursive         []BlkioEntry `json:"ioMergedRecursive,omitempty"`
+	IoTimeRecursive           []BlkioEntry `json:"ioTimeRecursive,omitempty"`
+	SectorsRecursive          []BlkioEntry `json:"sectorsRecursive,omitempty"`
+	IoDiscardedBytesRecursive []BlkioEntry `json:"ioDiscardedBytesRecursive,omitempty"`
+	IoDiscardedOpsRecursive   []BlkioEntry `json:"ioDiscardedOpsRecursive,omitempty"`
 }
 
 type Pids struct {
@@ -50,6 +53,11 @@ type Pids struct {
 	Limit   uint64 `json:"limit,omitempty"`
 }
 
+type NetPrio struct {
+	Prioidx   uint64            `json:"prioidx,omitempty"`
+	Ifpriomap map[string]uint32 `json:"ifpriomap,omitempty"`
+}
+
 type Throttling struct {
 	Periods          uint64 `json:"periods,omitempty"`
 	ThrottledPeriods uint64 `json:"throttledPeriods,omitempty"`
@@ -98,9 +106,29 @@ type Memory struct {
 	Swap      MemoryEntry       `json:"swap,omitempty"`
 	Kernel    MemoryEntry       `json:"kernel,omitempty"`
 	KernelTCP MemoryEntry       `json:"kernelTCP,omitempty"`
+	Events    MemoryEvents      `json:"events,omitempty"`
+	NUMA      map[int]NUMANode  `json:"numa,omitempty"`
 	Raw       map[string]uint64 `json:"raw,omitempty"`
 }
 
+type NUMANode struct {
+	Anon          uint64 `json:"anon,omitempty"`
+	File          uint64 `json:"file,omitempty"`
+	Shmem         uint64 `json:"shmem,omitempty"`
+	FileMapped    uint64 `json:"file_mapped,omitempty"`
+	FileDirty     uint64 `json:"file_dirty,omitempty"`
+	FileWriteback uint64 `json:"file_writeback,omitempty"`
+	ShmemThp      uint64 `json:"shmem_thp,omitempty"`
+}
+
+type MemoryEvents struct {
+	Low     uint64 `json:"low,omitempty"`
+	High    uint64 `json:"high,omitempty"`
+	Max     uint64 `json:"max,omitempty"`
+	Oom     uint64 `json:"oom,omitempty"`
+	OomKill uint64 `json:"oom_kill,omitempty"`
+}
+
 type L3CacheInfo struct {
 	CbmMask    string `json:"cbm_mask,omitempty"`
 	MinCbmBits uint64 `json:"min_cbm_bits,omitempty"`
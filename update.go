@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"runtime"
 	"strconv"
 
 	"github.com/opencontainers/runc/libcontainer/cgroups"
@@ -16,12 +17,41 @@ import (
 	"github.com/opencontainers/runc/libcontainer/intelrdt"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
 )
 
 func i64Ptr(i int64) *int64   { return &i }
 func u64Ptr(i uint64) *uint64 { return &i }
 func u16Ptr(i uint16) *uint16 { return &i }
 
+// sysbox-runc: checkHostLimits verifies that the given resource limits don't
+// exceed the host's hard limits (i.e., host memory and cpus).
+func checkHostLimits(r *configs.Resources) error {
+	var si unix.Sysinfo_t
+
+	if err := unix.Sysinfo(&si); err != nil {
+		return fmt.Errorf("failed to get host info: %v", err)
+	}
+
+	hostMem := int64(uint64(si.Totalram) * uint64(si.Unit))
+
+	if r.Memory > hostMem {
+		return fmt.Errorf("memory limit (%d) exceeds the host's memory (%d)", r.Memory, hostMem)
+	}
+	if r.MemoryReservation > hostMem {
+		return fmt.Errorf("memory reservation (%d) exceeds the host's memory (%d)", r.MemoryReservation, hostMem)
+	}
+
+	if r.CpuQuota > 0 && r.CpuPeriod > 0 {
+		hostCpus := int64(runtime.NumCPU())
+		if r.CpuQuota > int64(r.CpuPeriod)*hostCpus {
+			return fmt.Errorf("cpu quota (%d) exceeds the host's %d cpus for period %d", r.CpuQuota, hostCpus, r.CpuPeriod)
+		}
+	}
+
+	return nil
+}
+
 var updateCommand = cli.Command{
 	Name:      "update",
 	Usage:     "update container resource constraints",
@@ -113,6 +143,10 @@ other options are ignored.
 			Name:  "memory-swap",
 			Usage: "Total memory usage (memory + swap); set '-1' to enable unlimited swap",
 		},
+		cli.StringFlag{
+			Name:  "memory-swap-max",
+			Usage: "Swap limit (in bytes), independent of the memory limit (cgroup v2 only); set '-1' to enable unlimited swap",
+		},
 		cli.IntFlag{
 			Name:  "pids-limit",
 			Usage: "Maximum number of pids allowed in the container",
@@ -161,6 +195,7 @@ other options are ignored.
 		}
 
 		config := container.Config()
+		var swapMax *int64
 
 		if in := context.String("resources"); in != "" {
 			var (
@@ -249,6 +284,17 @@ other options are ignored.
 				}
 			}
 			r.Pids.Limit = int64(context.Int("pids-limit"))
+
+			if val := context.String("memory-swap-max"); val != "" {
+				v := int64(-1)
+				if val != "-1" {
+					v, err = units.RAMInBytes(val)
+					if err != nil {
+						return fmt.Errorf("invalid value for memory-swap-max: %s", err)
+					}
+				}
+				swapMax = &v
+			}
 		}
 
 		// Update the values
@@ -293,6 +339,9 @@ other options are ignored.
 		config.Cgroups.Resources.Memory = *r.Memory.Limit
 		config.Cgroups.Resources.MemoryReservation = *r.Memory.Reservation
 		config.Cgroups.Resources.MemorySwap = *r.Memory.Swap
+		if swapMax != nil {
+			config.Cgroups.Resources.MemorySwapMax = swapMax
+		}
 		config.Cgroups.Resources.PidsLimit = r.Pids.Limit
 		config.Cgroups.Resources.Unified = r.Unified
 
@@ -327,6 +376,10 @@ other options are ignored.
 			config.IntelRdt.MemBwSchema = memBwSchema
 		}
 
+		if err := checkHostLimits(config.Cgroups.Resources); err != nil {
+			return err
+		}
+
 		return container.Set(config)
 	},
 }
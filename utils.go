@@ -70,7 +70,7 @@ func setupSpec(context *cli.Context) (*specs.Spec, error) {
 			return nil, err
 		}
 	}
-	spec, err := loadSpec(specConfig)
+	spec, err := loadSpec(specConfig, context.GlobalBool("strict-spec-validation"))
 	if err != nil {
 		return nil, err
 	}
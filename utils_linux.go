@@ -12,6 +12,7 @@ import (
 
 	"github.com/nestybox/sysbox-libs/dockerUtils"
 	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/cgroups"
 	"github.com/opencontainers/runc/libcontainer/cgroups/systemd"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/specconv"
@@ -53,6 +54,9 @@ func loadFactory(context *cli.Context, sysMgr *sysbox.Mgr, sysFs *sysbox.Fs) (li
 			return nil, errors.New("systemd cgroup flag passed, but systemd support for managing cgroups is not available")
 		}
 		cgroupManager = libcontainer.SystemdCgroups
+		systemd.CgroupJoinTimeout = context.GlobalDuration("cgroup-join-timeout")
+		systemd.AutoRepairCgroupPaths = context.GlobalBool("auto-repair-cgroups")
+		systemd.StrictResourceVerify = context.GlobalBool("strict-resource-verify")
 		if rootlessCg {
 			cgroupManager = libcontainer.RootlessSystemdCgroups
 		}
@@ -94,6 +98,30 @@ func getContainer(context *cli.Context) (libcontainer.Container, error) {
 	return factory.Load(id)
 }
 
+// reclaimMemoryOnStart reclaims memory from the given (just created)
+// container's cgroup, per its "sysbox.io/reclaim-memory-on-start" annotation.
+// Failures are not fatal to the container.
+func reclaimMemoryOnStart(container libcontainer.Container) {
+	_, annotations := utils.Annotations(container.Config().Labels)
+	bytes, err := syscont.ReclaimMemoryOnStart(annotations)
+	if err != nil || bytes == 0 {
+		return
+	}
+	if err := container.ReclaimMemory(bytes); err != nil {
+		logrus.Warnf("failed to reclaim memory of container %s on start: %v", container.ID(), err)
+	}
+}
+
+// loadResourcePolicy loads the resource policy file given via the
+// --resource-policy-file global option (if any).
+func loadResourcePolicy(context *cli.Context) error {
+	path := context.GlobalString("resource-policy-file")
+	if path == "" {
+		return nil
+	}
+	return syscont.LoadResourcePolicy(path)
+}
+
 func getDefaultImagePath(context *cli.Context) string {
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -148,6 +176,10 @@ func destroy(container libcontainer.Container) {
 	if err := container.Destroy(); err != nil {
 		logrus.Error(err)
 	}
+	// sysbox-runc: remove the files generated for the sys container
+	if err := syscont.RemoveRunDir(container.ID()); err != nil {
+		logrus.Error(err)
+	}
 }
 
 // setupIO modifies the given process config according to the options.
@@ -291,6 +323,8 @@ func createContainer(context *cli.Context,
 		UidShiftSupported: uidShiftSupported,
 		UidShiftRootfs:    uidShiftRootfs,
 		SwitchDockerDns:   switchDockerDns,
+
+		ExcludedSubsystems: context.StringSlice("exclude-cgroup-subsystem"),
 	})
 	if err != nil {
 		return nil, err
@@ -304,6 +338,40 @@ func createContainer(context *cli.Context,
 		}
 	}
 
+	// sysbox-runc: the sysctls emulated by sysbox-fs need not be namespaced
+	if sysFs.Enabled() {
+		config.EmulatedSysctls = syscont.EmulatedSysctls()
+	}
+
+	// sysbox-runc: give the container its own anonymous session keyring (see
+	// the keyring isolation setting in the sysbox-runc config file)
+	config.AnonymousKeyring = syscont.KeyringIsolation()
+
+	// sysbox-runc: set the parent death signal of the container's init process
+	// (see the parent death signal annotation)
+	pdeathsig, err := syscont.ParentDeathSignal(spec.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	config.ParentDeathSignal = pdeathsig
+
+	// sysbox-runc: setup the eBPF programs that filter the container's network
+	// traffic (see the network policy annotations)
+	ingress, egress, err := syscont.NetworkPolicyPrograms(spec.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	if ingress != nil || egress != nil {
+		if !cgroups.IsCgroup2UnifiedMode() {
+			return nil, fmt.Errorf("network policy programs require cgroup v2")
+		}
+		if config.Cgroups == nil || config.Cgroups.Resources == nil {
+			return nil, fmt.Errorf("network policy programs require the container's cgroup config")
+		}
+		config.Cgroups.Resources.NetIngressProgram = ingress
+		config.Cgroups.Resources.NetEgressProgram = egress
+	}
+
 	// sysbox-runc: setup sys container syscall trapping
 	if sysFs.Enabled() {
 		if err := syscont.AddSyscallTraps(config); err != nil {
@@ -353,12 +421,17 @@ func (r *runner) run(config *specs.Process) (int, error) {
 		process.ExtraFiles = append(process.ExtraFiles, r.listenFDs...)
 	}
 	baseFd := 3 + len(process.ExtraFiles)
+	preserved := make([]int, 0, r.preserveFDs)
 	for i := baseFd; i < baseFd+r.preserveFDs; i++ {
-		_, err = os.Stat("/proc/self/fd/" + strconv.Itoa(i))
-		if err != nil {
-			return -1, errors.Wrapf(err, "please check that preserved-fd %d (of %d) is present", i-baseFd, r.preserveFDs)
-		}
-		process.ExtraFiles = append(process.ExtraFiles, os.NewFile(uintptr(i), "PreserveFD:"+strconv.Itoa(i)))
+		preserved = append(preserved, i)
+	}
+	// sysbox-runc: the preserved fds must not be the namespace and cgroup fds
+	// used internally
+	if err = validatePreserveFds(preserved, internalFds()); err != nil {
+		return -1, errors.Wrapf(err, "invalid preserved-fds (%d)", r.preserveFDs)
+	}
+	for _, fd := range preserved {
+		process.ExtraFiles = append(process.ExtraFiles, os.NewFile(uintptr(fd), "PreserveFD:"+strconv.Itoa(fd)))
 	}
 	rootuid, err := r.container.Config().HostRootUID()
 	if err != nil {
@@ -402,6 +475,9 @@ func (r *runner) run(config *specs.Process) (int, error) {
 		r.terminate(process)
 		return -1, err
 	}
+	if r.init && r.action != CT_ACT_RESTORE {
+		reclaimMemoryOnStart(r.container)
+	}
 	if r.pidFile != "" {
 		if err = createPidFile(r.pidFile, process); err != nil {
 			r.terminate(process)
@@ -415,6 +491,13 @@ func (r *runner) run(config *specs.Process) (int, error) {
 	if detach {
 		return 0, nil
 	}
+	// sysbox-runc: record the exit code of the container's init process in
+	// the container's state
+	if err == nil && r.init {
+		if rerr := r.container.RecordExitCode(status); rerr != nil {
+			logrus.Warnf("failed to record exit code of container %s: %v", r.container.ID(), rerr)
+		}
+	}
 	if err == nil {
 		r.destroy()
 	}
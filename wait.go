@@ -0,0 +1,152 @@
+// +build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/system"
+	"github.com/opencontainers/runc/libcontainer/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
+)
+
+// Exit code of the wait command when it times out
+const waitTimeoutExitCode = 125
+
+var errWaitTimeout = errors.New("timed out waiting for the container to exit")
+
+// replaceable in tests
+var (
+	waitPollInterval = 100 * time.Millisecond
+	waitProcessExit  = waitExitStatus
+)
+
+var waitCommand = cli.Command{
+	Name:  "wait",
+	Usage: "waits for the container to exit and exits with its exit code",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The wait command blocks until the container's init process exits, and then
+exits with the exit code of that process, which is also recorded in the
+container's state so later invocations (and "runc list") can report it. If the
+container has already stopped, it exits immediately with the recorded exit
+code. If the timeout expires first, it exits with code 125.`,
+	Flags: []cli.Flag{
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "maximum time to wait for the container to exit (0 means no limit)",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		code, err := waitContainer(container, context.Duration("timeout"))
+		if err == errWaitTimeout {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", container.ID(), err)
+			os.Exit(waitTimeoutExitCode)
+		}
+		if err != nil {
+			return err
+		}
+		os.Exit(code)
+		return nil
+	},
+}
+
+// waitContainer waits for the given container's init process to exit and
+// returns its exit code; a zero timeout means no limit. If we are the init
+// process' parent, we reap it and record its exit code in the container's
+// state dir; otherwise its exit code is the one recorded by its parent's exit
+// handler once the container stops.
+func waitContainer(container libcontainer.Container, timeout time.Duration) (int, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	pid := 0
+	if state, err := container.State(); err == nil && initProcessAlive(state) {
+		pid = state.InitProcessPid
+	}
+
+	for {
+		if pid > 0 {
+			code, exited, err := waitProcessExit(pid)
+			if err == unix.ECHILD {
+				// not our child; its parent records the exit code
+				pid = 0
+			} else if err != nil {
+				return -1, fmt.Errorf("failed to wait for process %d: %v", pid, err)
+			} else if exited {
+				if err := container.RecordExitCode(code); err != nil {
+					logrus.Warnf("failed to record exit code of container %s: %v", container.ID(), err)
+				}
+				return code, nil
+			}
+		}
+
+		status, err := container.Status()
+		if err != nil {
+			return -1, err
+		}
+		if status == libcontainer.Stopped {
+			code, ok := container.ExitCode()
+			if !ok {
+				return -1, fmt.Errorf("exit code of container %s is not available", container.ID())
+			}
+			return code, nil
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return -1, errWaitTimeout
+		}
+
+		time.Sleep(waitPollInterval)
+	}
+}
+
+// initProcessAlive returns true if the container's init process is still the
+// one with the pid recorded in the given state (i.e., the pid was not reused).
+func initProcessAlive(state *libcontainer.State) bool {
+	if state.InitProcessPid <= 0 {
+		return false
+	}
+	stat, err := system.Stat(state.InitProcessPid)
+	if err != nil {
+		return false
+	}
+	return stat.StartTime == state.InitProcessStartTime
+}
+
+// waitExitStatus reaps the child process with the given pid if it has exited,
+// without blocking, and returns its exit status. It returns unix.ECHILD if the
+// process is not a child of ours.
+func waitExitStatus(pid int) (int, bool, error) {
+	var ws unix.WaitStatus
+
+	for {
+		wpid, err := unix.Wait4(pid, &ws, unix.WNOHANG, nil)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return -1, false, err
+		}
+		if wpid == pid && (ws.Exited() || ws.Signaled()) {
+			return utils.ExitStatus(ws), true, nil
+		}
+		return -1, false, nil
+	}
+}
@@ -0,0 +1,170 @@
+// +build linux
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/system"
+	"golang.org/x/sys/unix"
+)
+
+// mockContainer is a container whose init process exits with the given code
+// after the given number of status checks.
+type mockContainer struct {
+	libcontainer.Container
+	runningChecks int
+	exitCode      int
+	hasExitCode   bool
+	state         libcontainer.State
+	recorded      []int
+}
+
+func (c *mockContainer) ID() string {
+	return "test"
+}
+
+func (c *mockContainer) State() (*libcontainer.State, error) {
+	return &c.state, nil
+}
+
+func (c *mockContainer) RecordExitCode(code int) error {
+	c.recorded = append(c.recorded, code)
+	return nil
+}
+
+func (c *mockContainer) Status() (libcontainer.Status, error) {
+	if c.runningChecks > 0 {
+		c.runningChecks--
+		return libcontainer.Running, nil
+	}
+	return libcontainer.Stopped, nil
+}
+
+func (c *mockContainer) ExitCode() (int, bool) {
+	return c.exitCode, c.hasExitCode
+}
+
+func TestWaitContainer(t *testing.T) {
+	origInterval := waitPollInterval
+	waitPollInterval = time.Millisecond
+	defer func() { waitPollInterval = origInterval }()
+
+	// container exits while being waited for
+	c := &mockContainer{runningChecks: 5, exitCode: 42, hasExitCode: true}
+	if code, err := waitContainer(c, 0); err != nil || code != 42 {
+		t.Errorf("waitContainer: want exit code 42; got %d (err %v)", code, err)
+	}
+
+	// already stopped container
+	c = &mockContainer{exitCode: 42, hasExitCode: true}
+	if code, err := waitContainer(c, time.Second); err != nil || code != 42 {
+		t.Errorf("waitContainer: want exit code 42; got %d (err %v)", code, err)
+	}
+
+	// no exit code recorded
+	c = &mockContainer{}
+	if _, err := waitContainer(c, 0); err == nil {
+		t.Errorf("waitContainer: want error when the exit code is not available")
+	}
+
+	// timeout
+	c = &mockContainer{runningChecks: 1 << 30}
+	if _, err := waitContainer(c, 20*time.Millisecond); err != errWaitTimeout {
+		t.Errorf("waitContainer: want errWaitTimeout; got %v", err)
+	}
+}
+
+func TestWaitContainerInitAlive(t *testing.T) {
+	origInterval := waitPollInterval
+	waitPollInterval = time.Millisecond
+	defer func() { waitPollInterval = origInterval }()
+
+	stat, err := system.Stat(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origWait := waitProcessExit
+	defer func() { waitProcessExit = origWait }()
+
+	// init is our child and exits while being waited for
+	polls := 5
+	waitProcessExit = func(pid int) (int, bool, error) {
+		if polls > 0 {
+			polls--
+			return -1, false, nil
+		}
+		return 42, true, nil
+	}
+
+	c := &mockContainer{runningChecks: 1 << 30}
+	c.state.InitProcessPid = os.Getpid()
+	c.state.InitProcessStartTime = stat.StartTime
+
+	code, err := waitContainer(c, 0)
+	if err != nil || code != 42 {
+		t.Errorf("waitContainer: want exit code 42; got %d (err %v)", code, err)
+	}
+	if len(c.recorded) != 1 || c.recorded[0] != 42 {
+		t.Errorf("waitContainer: want exit code 42 recorded; got %v", c.recorded)
+	}
+
+	// init is not our child: the exit code recorded by its parent is used
+	waitProcessExit = func(pid int) (int, bool, error) {
+		return -1, false, unix.ECHILD
+	}
+	c = &mockContainer{runningChecks: 5, exitCode: 7, hasExitCode: true}
+	c.state.InitProcessPid = os.Getpid()
+	c.state.InitProcessStartTime = stat.StartTime
+
+	if code, err := waitContainer(c, 0); err != nil || code != 7 {
+		t.Errorf("waitContainer: want exit code 7; got %d (err %v)", code, err)
+	}
+	if len(c.recorded) != 0 {
+		t.Errorf("waitContainer: want no exit code recorded; got %v", c.recorded)
+	}
+
+	// pid reused by another process: the recorded exit code is used
+	waitProcessExit = func(pid int) (int, bool, error) {
+		t.Fatal("waitContainer: unexpected wait on a reused pid")
+		return -1, false, nil
+	}
+	c = &mockContainer{exitCode: 7, hasExitCode: true}
+	c.state.InitProcessPid = os.Getpid()
+	c.state.InitProcessStartTime = stat.StartTime + 1
+
+	if code, err := waitContainer(c, 0); err != nil || code != 7 {
+		t.Errorf("waitContainer: want exit code 7; got %d (err %v)", code, err)
+	}
+}
+
+func TestWaitExitStatus(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "exit 42")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		code, exited, err := waitExitStatus(cmd.Process.Pid)
+		if err != nil {
+			t.Fatalf("waitExitStatus: %v", err)
+		}
+		if exited {
+			if code != 42 {
+				t.Errorf("waitExitStatus: want exit code 42; got %d", code)
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// not a child of ours
+	if _, _, err := waitExitStatus(1); err != unix.ECHILD {
+		t.Errorf("waitExitStatus: want ECHILD for a non-child process; got %v", err)
+	}
+}